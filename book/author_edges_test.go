@@ -0,0 +1,33 @@
+package book_test
+
+import (
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+)
+
+// TestAuthorEdges checks that edges to other books by the same author are not
+// recommendations, so PageRank, ShortestPath and ComputeStats leave them out
+func TestAuthorEdges(t *testing.T) {
+	books := graph("a:b,c", "c:d")
+	for idx := range books["a"].AlsoRead {
+		if books["a"].AlsoRead[idx].To == books["c"] {
+			books["a"].AlsoRead[idx].Source = book.SourceAuthor
+		}
+	}
+	g := book.NewGraph(books["a"])
+
+	if len(g.All) != 4 {
+		t.Errorf("books reached through author edges are still in the graph (%d books)", len(g.All))
+	}
+	ranks := book.PageRankByURL(g)
+	if !(ranks[books["c"].URL] < ranks[books["b"].URL]) {
+		t.Errorf("author edges do not rank books (%v)", ranks)
+	}
+	if path := book.ShortestPath(books["a"], books["d"]); path != nil {
+		t.Errorf("paths do not follow author edges (%d books)", len(path))
+	}
+	if stats := book.ComputeStats(g); !(stats.Edges == 2 && stats.Components == 2) {
+		t.Errorf("stats do not count author edges (%d edges, %d components)", stats.Edges, stats.Components)
+	}
+}
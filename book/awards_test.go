@@ -0,0 +1,149 @@
+package book_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/jsonl"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage/memory"
+)
+
+func awardsRow(title string, item string) string {
+	return fmt.Sprintf(`<div class="clearFloats"><div class="infoBoxRowTitle">%s</div><div class="infoBoxRowItem">%s</div></div>`, title, item)
+}
+
+func awardsExtract(t *testing.T, rows ...string) *book.Book {
+	t.Helper()
+	page := `<html><body><div id="bookDataBox">` + strings.Join(rows, "\n") + `</div></body></html>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := book.New("https://www.goodreads.com/book/show/1")
+	book.Build(b, doc)
+	return b
+}
+
+// TestAwards checks that literary awards are extracted from the book data
+// box, split and cleaned, and that they are persisted by the crawler, survive
+// the storage log and saved graphs and make it to the jsonl output
+func TestAwards(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	cases := []struct {
+		name   string
+		rows   []string
+		awards []string
+	}{
+		{
+			"award links",
+			[]string{awardsRow("ISBN", "0441013597"), awardsRow("Literary Awards", `<a class="award" href="/award/show/9">Hugo Award for Best Novel (1966)</a>, <a class="award" href="/award/show/23">Nebula Award for Best Novel (1965)</a>`)},
+			[]string{"Hugo Award for Best Novel (1966)", "Nebula Award for Best Novel (1965)"},
+		},
+		{
+			"spaced out",
+			[]string{awardsRow("Literary Awards", "\n  Locus Award\n  for Best SF Novel (1975) ,\n\n  Prometheus Hall of Fame Award (1983) \n")},
+			[]string{"Locus Award for Best SF Novel (1975)", "Prometheus Hall of Fame Award (1983)"},
+		},
+		{
+			"truncated list",
+			[]string{awardsRow("Literary Awards", `<a class="award">Hugo Award (1966)</a>, <a class="award">Nebula Award (1965)</a><span style="display:none">, <a class="award">Hugo Award (1966)</a>, <a class="award">Seiun Award (1987)</a></span><a class="actionLinkLite" href="#">...more</a>`)},
+			[]string{"Hugo Award (1966)", "Nebula Award (1965)", "Seiun Award (1987)"},
+		},
+		{"no awards row", []string{awardsRow("ISBN", "0441013597")}, []string{}},
+	}
+	for _, c := range cases {
+		b := awardsExtract(t, c.rows...)
+		if !reflect.DeepEqual(b.Awards, c.awards) {
+			t.Errorf("%s: %q, expected %q", c.name, b.Awards, c.awards)
+		}
+	}
+
+	// the fixture gives every fifth book two awards
+	ctx := context.Background()
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+	logPath := filepath.Join(os.TempDir(), fmt.Sprintf("awards-tester-%d.log", os.Getpid()))
+	defer os.Remove(logPath)
+	logged := &memory.Storage{LogPath: logPath}
+	if err := logged.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c := crawler.NewCrawler(crawler.WithMaxDepth(3), crawler.WithMaxReadAlso(3))
+	c.Storage = logged
+	if err := c.Crawl(ctx, server.BookURL(5)); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Fixture Award (1955)", "Book 5 Prize"}
+	seed, err := c.Storage.GetBook(ctx, server.BookURL(5), 0)
+	if !(err == nil && seed != nil && reflect.DeepEqual(seed.Awards, expected)) {
+		t.Errorf("awards persisted: %q", seed.Awards)
+	}
+	withAwards, withoutAwards := 0, 0
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		if len(b.Awards) > 0 {
+			withAwards++
+		} else if b.Awards != nil {
+			withoutAwards++
+		}
+		return nil
+	})
+	if !(withAwards > 0 && withoutAwards > 0) {
+		t.Errorf("books without awards have an empty list (%d with, %d without)", withAwards, withoutAwards)
+	}
+	if err := c.Storage.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := &memory.Storage{LogPath: logPath}
+	if err := replayed.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	seed, err = replayed.GetBook(ctx, server.BookURL(5), 0)
+	if !(err == nil && seed != nil && reflect.DeepEqual(seed.Awards, expected)) {
+		t.Errorf("awards replayed from the storage log: %q", seed.Awards)
+	}
+
+	var out bytes.Buffer
+	if err := jsonl.ExportJSONL(ctx, replayed, &out); err != nil {
+		t.Fatal(err)
+	}
+	awardsByURL := map[string][]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var b jsonl.Book
+		if err := json.Unmarshal([]byte(line), &b); err != nil {
+			t.Fatal(err)
+		}
+		awardsByURL[b.URL] = b.Awards
+	}
+	if !reflect.DeepEqual(awardsByURL[server.BookURL(5)], expected) {
+		t.Errorf("awards in the jsonl output: %q", awardsByURL[server.BookURL(5)])
+	}
+	if !strings.Contains(out.String(), `"awards":[]`) {
+		t.Errorf("no awards written as an empty array in the jsonl output")
+	}
+
+	var saved bytes.Buffer
+	if err := book.SaveGraph(book.NewGraph(seed), &saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := book.LoadGraph(&saved)
+	if !(err == nil && len(loaded.Roots) == 1 && reflect.DeepEqual(loaded.Roots[0].Awards, expected)) {
+		t.Errorf("awards in saved graphs: %v", err)
+	}
+	replayed.Shutdown(ctx)
+
+}
@@ -5,7 +5,7 @@ import (
 	"strings"
 )
 
-func Collect(root *Book) []*Book {
+func Collect(roots ...*Book) []*Book {
 	bookMap := make(map[*Book]struct{})
 	var recurse func(*Book)
 	recurse = func(book *Book) {
@@ -16,7 +16,11 @@ func Collect(root *Book) []*Book {
 			}
 		}
 	}
-	recurse(root)
+	for _, root := range nonNil(roots) {
+		if _, has := bookMap[root]; !has {
+			recurse(root)
+		}
+	}
 
 	books := make([]*Book, len(bookMap))
 	idx := 0
@@ -24,16 +28,11 @@ func Collect(root *Book) []*Book {
 		books[idx] = book
 		idx++
 	}
-	sort.Slice(
-		books,
-		func(i int, j int) bool {
-			return strings.Compare(books[i].Title, books[j].Title) < 0
-		},
-	)
+	sortBooks(books)
 	return books
 }
 
-func CollectByDepth(root *Book) [][]*Book {
+func CollectByDepth(roots ...*Book) [][]*Book {
 	depthMap := map[*Book]int{}
 	maxDepth := 0
 	maxDepthP := &maxDepth
@@ -53,11 +52,111 @@ func CollectByDepth(root *Book) [][]*Book {
 			recurse(relatedBook.To, depth+1)
 		}
 	}
-	recurse(root, 0)
+	for _, root := range nonNil(roots) {
+		recurse(root, 0)
+	}
+	if len(depthMap) == 0 {
+		return [][]*Book{}
+	}
 
 	booksByDepth := make([][]*Book, maxDepth+1)
 	for book, depth := range depthMap {
 		booksByDepth[depth] = append(booksByDepth[depth], book)
 	}
+	for _, books := range booksByDepth {
+		sortBooks(books)
+	}
 	return booksByDepth
 }
+
+// WalkGraph calls node once for every book of graph.ByDepth, shallowest
+// first, and then edge for every edge in between those books, in the same
+// order. Edges to books outside of the graph, eg trimmed by TopRanked, are
+// left out. Used by the exporters writing nodes and edges separately
+func WalkGraph(graph Graph, node func(b *Book, depth int), edge func(from *Book, e Edge)) {
+	walked := map[*Book]struct{}{}
+	books := []*Book{}
+	for depth, byDepth := range graph.ByDepth {
+		for _, b := range byDepth {
+			if _, has := walked[b]; has {
+				continue
+			}
+			walked[b] = struct{}{}
+			books = append(books, b)
+			node(b, depth)
+		}
+	}
+	for _, b := range books {
+		for _, e := range b.AlsoRead {
+			if _, has := walked[e.To]; has {
+				edge(b, e)
+			}
+		}
+	}
+}
+
+// Roots picks the books a graph of all the given books is walked from: the ones
+// without incoming edges, plus one book per group of books none of those reach,
+// eg a component that is only a cycle. That book is the one with the smallest
+// url, so the same graph always gets the same roots
+func Roots(all []*Book) []*Book {
+	linked := map[*Book]struct{}{}
+	for _, b := range all {
+		for _, edge := range b.AlsoRead {
+			linked[edge.To] = struct{}{}
+		}
+	}
+	roots := []*Book{}
+	for _, b := range all {
+		if _, has := linked[b]; !has {
+			roots = append(roots, b)
+		}
+	}
+
+	reached := map[*Book]struct{}{}
+	for _, b := range Collect(roots...) {
+		reached[b] = struct{}{}
+	}
+	rest := []*Book{}
+	for _, b := range all {
+		if _, has := reached[b]; !has {
+			rest = append(rest, b)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool { return rest[i].URL < rest[j].URL })
+	for _, b := range rest {
+		if _, has := reached[b]; has {
+			continue
+		}
+		roots = append(roots, b)
+		for _, c := range Collect(b) {
+			reached[c] = struct{}{}
+		}
+	}
+	return roots
+}
+
+// sortBooks orders books by title, and by url when titles are the same, so
+// collecting the same graph always gives the same order even though books are
+// gathered from maps
+func sortBooks(books []*Book) {
+	sort.Slice(
+		books,
+		func(i int, j int) bool {
+			if cmp := strings.Compare(books[i].Title, books[j].Title); cmp != 0 {
+				return cmp < 0
+			}
+			return books[i].URL < books[j].URL
+		},
+	)
+}
+
+func nonNil(books []*Book) []*Book {
+	result := make([]*Book, 0, len(books))
+	for _, b := range books {
+		if b != nil {
+			result = append(result, b)
+		}
+	}
+	return result
+}
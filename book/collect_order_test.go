@@ -0,0 +1,95 @@
+package book_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+)
+
+func collectOrderUrls(books []*book.Book) []string {
+	result := make([]string, len(books))
+	for i, b := range books {
+		result[i] = b.URL
+	}
+	return result
+}
+
+func urlsByDepth(booksByDepth [][]*book.Book) [][]string {
+	result := make([][]string, len(booksByDepth))
+	for depth, books := range booksByDepth {
+		result[depth] = collectOrderUrls(books)
+	}
+	return result
+}
+
+// TestCollectOrder checks that book.Collect and book.CollectByDepth order
+// books by title and then by url, so collecting the same graph again, even
+// one with repeated or missing titles, always gives the same slices
+func TestCollectOrder(t *testing.T) {
+	// the root links to editions sharing a title and to books without one, in
+	// no particular order, and each of them to a book without a title
+	root := book.New("https://fixture/book/show/0")
+	root.Title = "Root"
+	linked := []struct {
+		url   string
+		title string
+	}{
+		{"https://fixture/book/show/5", "Dune"},
+		{"https://fixture/book/show/3", ""},
+		{"https://fixture/book/show/1", "Dune"},
+		{"https://fixture/book/show/4", "Children of Dune"},
+		{"https://fixture/book/show/2", ""},
+		{"https://fixture/book/show/6", "Dune"},
+	}
+	for i, child := range linked {
+		b := book.New(child.url)
+		b.Title = child.title
+		root.AlsoRead = append(root.AlsoRead, book.Edge{From: root, To: b, Priority: i + 1, Source: book.SourceAlsoRead})
+		grandchild := book.New(fmt.Sprintf("https://fixture/book/show/%d", 20+i))
+		b.AlsoRead = append(b.AlsoRead, book.Edge{From: b, To: grandchild, Priority: 1, Source: book.SourceAlsoRead})
+	}
+
+	first := collectOrderUrls(book.Collect(root))
+	untitled := []string{
+		"https://fixture/book/show/20",
+		"https://fixture/book/show/21",
+		"https://fixture/book/show/22",
+		"https://fixture/book/show/23",
+		"https://fixture/book/show/24",
+		"https://fixture/book/show/25",
+	}
+	children := []string{
+		"https://fixture/book/show/2",
+		"https://fixture/book/show/3",
+		"https://fixture/book/show/4",
+		"https://fixture/book/show/1",
+		"https://fixture/book/show/5",
+		"https://fixture/book/show/6",
+	}
+	// collectOrderUrls are compared as text, so 2 goes before 20
+	expected := append(append(append([]string{children[0]}, untitled...), children[1:]...), root.URL)
+	if !reflect.DeepEqual(first, expected) {
+		t.Errorf("collected by title and then url: %q", first)
+	}
+
+	firstByDepth := urlsByDepth(book.CollectByDepth(root))
+	expectedByDepth := [][]string{{root.URL}, children, untitled}
+	if !reflect.DeepEqual(firstByDepth, expectedByDepth) {
+		t.Errorf("collected by depth by title and then url: %q", firstByDepth)
+	}
+
+	same, sameByDepth := true, true
+	for i := 0; i < 50; i++ {
+		same = same && reflect.DeepEqual(collectOrderUrls(book.Collect(root)), first)
+		sameByDepth = sameByDepth && reflect.DeepEqual(urlsByDepth(book.CollectByDepth(root)), firstByDepth)
+	}
+	if !same {
+		t.Errorf("collecting again gives the same books in the same order")
+	}
+	if !sameByDepth {
+		t.Errorf("collecting by depth again gives the same books in the same order")
+	}
+
+}
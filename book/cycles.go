@@ -0,0 +1,76 @@
+package book
+
+import (
+	"sort"
+	"strings"
+)
+
+// FindCycles returns the books taking part in cycles of the graph reachable
+// from root, as its strongly connected components with more than one book.
+// Every book of a component can reach all the others by following AlsoRead
+// edges. Books in a component are sorted by title, and components from the
+// largest to the smallest
+func FindCycles(root *Book) [][]*Book {
+	if root == nil {
+		return [][]*Book{}
+	}
+
+	// Tarjan's algorithm
+	index := map[*Book]int{}
+	lowLink := map[*Book]int{}
+	onStack := map[*Book]bool{}
+	stack := []*Book{}
+	components := [][]*Book{}
+
+	var visit func(book *Book)
+	visit = func(book *Book) {
+		index[book] = len(index)
+		lowLink[book] = index[book]
+		stack = append(stack, book)
+		onStack[book] = true
+
+		for _, edge := range book.AlsoRead {
+			if _, visited := index[edge.To]; !visited {
+				visit(edge.To)
+				if lowLink[edge.To] < lowLink[book] {
+					lowLink[book] = lowLink[edge.To]
+				}
+			} else if onStack[edge.To] && index[edge.To] < lowLink[book] {
+				lowLink[book] = index[edge.To]
+			}
+		}
+
+		if lowLink[book] != index[book] {
+			return
+		}
+		// book is the root of a component, made of everything above it in the
+		// stack
+		var component []*Book
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == book {
+				break
+			}
+		}
+		if len(component) > 1 {
+			components = append(components, component)
+		}
+	}
+	visit(root)
+
+	for _, component := range components {
+		sort.Slice(component, func(i int, j int) bool {
+			return strings.Compare(component[i].Title, component[j].Title) < 0
+		})
+	}
+	sort.SliceStable(components, func(i int, j int) bool {
+		if len(components[i]) != len(components[j]) {
+			return len(components[i]) > len(components[j])
+		}
+		return strings.Compare(components[i][0].Title, components[j][0].Title) < 0
+	})
+	return components
+}
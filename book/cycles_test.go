@@ -0,0 +1,135 @@
+package book_test
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+// graph builds books named by letters, linked as "from:to,to"
+func graph(links ...string) map[string]*book.Book {
+	books := map[string]*book.Book{}
+	get := func(title string) *book.Book {
+		if books[title] == nil {
+			books[title] = book.New("https://fixture/" + title)
+			books[title].Title = title
+		}
+		return books[title]
+	}
+	for _, link := range links {
+		from, tos, _ := strings.Cut(link, ":")
+		for _, to := range strings.Split(tos, ",") {
+			if to == "" {
+				continue
+			}
+			f := get(from)
+			f.AlsoRead = append(f.AlsoRead, book.Edge{From: f, To: get(to), Priority: len(f.AlsoRead)})
+		}
+	}
+	return books
+}
+
+func cyclesDescribe(cycles [][]*book.Book) string {
+	parts := make([]string, len(cycles))
+	for idx, cycle := range cycles {
+		titles := make([]string, len(cycle))
+		for i, b := range cycle {
+			titles[i] = b.Title
+		}
+		parts[idx] = strings.Join(titles, "")
+	}
+	return strings.Join(parts, " ")
+}
+
+// TestCycles checks book.FindCycles on hand made graphs with known cycles,
+// and on a crawled fixture graph against a brute force reachability check
+func TestCycles(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	cases := []struct {
+		name     string
+		links    []string
+		expected string
+	}{
+		{"no cycles", []string{"a:b,c", "b:d", "c:d"}, ""},
+		{"self loop only", []string{"a:a,b"}, ""},
+		{"two books", []string{"a:b", "b:a"}, "ab"},
+		{"back to the root", []string{"a:b", "b:c", "c:a,d"}, "abc"},
+		{"two components", []string{"a:b,d", "b:c", "c:b", "d:e,f", "e:f", "f:d"}, "def bc"},
+		{"joined cycles", []string{"a:b", "b:a,c", "c:d", "d:c,b"}, "abcd"},
+	}
+	for _, c := range cases {
+		books := graph(c.links...)
+		result := cyclesDescribe(book.FindCycles(books["a"]))
+		if result != c.expected {
+			t.Errorf("%s: %q, expected %q", c.name, result, c.expected)
+		}
+	}
+	if len(book.FindCycles(nil)) != 0 {
+		t.Errorf("nil root has no cycles")
+	}
+
+	// crawled graph: two books are in the same cycle exactly when each can
+	// reach the other
+	ctx := context.Background()
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+	c := crawler.NewCrawler(crawler.WithMaxDepth(4), crawler.WithMaxReadAlso(3))
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.Storage.GetBook(ctx, server.BookURL(1), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cycles := book.FindCycles(root)
+
+	component := map[*book.Book]int{}
+	for idx, cycle := range cycles {
+		for _, b := range cycle {
+			component[b] = idx + 1
+		}
+	}
+	reaches := map[*book.Book]map[*book.Book]bool{}
+	all := book.Collect(root)
+	for _, b := range all {
+		reaches[b] = map[*book.Book]bool{}
+		for _, r := range book.Collect(b) {
+			if r != b {
+				reaches[b][r] = true
+			}
+		}
+	}
+	mismatches := 0
+	for _, x := range all {
+		for _, y := range all {
+			if x == y {
+				continue
+			}
+			together := component[x] != 0 && component[x] == component[y]
+			if together != (reaches[x][y] && reaches[y][x]) {
+				mismatches++
+			}
+		}
+	}
+	sizes := make([]int, len(cycles))
+	for idx, cycle := range cycles {
+		sizes[idx] = len(cycle)
+	}
+	if len(cycles) <= 0 {
+		t.Errorf("crawled graph has cycles (sizes %v)", sizes)
+	}
+	if mismatches != 0 {
+		t.Errorf("cycles match mutual reachability (%d mismatches)", mismatches)
+	}
+	if !sort.SliceIsSorted(sizes, func(i, j int) bool { return sizes[i] > sizes[j] }) {
+		t.Errorf("largest cycles first")
+	}
+
+}
@@ -0,0 +1,79 @@
+package book_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/jsonl"
+	"github.com/bcap/book-crawler/log"
+)
+
+func descriptionExtract(t *testing.T, body string) string {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><body>" + body + "</body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := book.New("")
+	book.Build(b, doc)
+	return b.Description
+}
+
+// TestDescription checks that book descriptions are extracted from the fuller
+// of the spans goodreads renders, cleaned, empty when missing, and that they
+// are kept by the storage and written to the jsonl output
+func TestDescription(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	full := "A desert planet, a spice & a family feud"
+	description := descriptionExtract(t, `<div id="description">
+<span id="freeTextContainer1">A desert planet...</span>
+<span id="freeText1" style="display:none">`+" "+`A desert planet, a spice &amp; a family feud </span>
+<a href="#">...more</a></div>`)
+	if description != full {
+		t.Errorf("fuller span is kept and cleaned: %q", description)
+	}
+	description = descriptionExtract(t, `<div id="description"><span>Short one</span></div>`)
+	if description != "Short one" {
+		t.Errorf("single span is kept: %q", description)
+	}
+	description = descriptionExtract(t, `<h1 id="bookTitle">No description</h1>`)
+	if description != "" {
+		t.Errorf("missing description is empty: %q", description)
+	}
+
+	site := fixture.NewServer(30, 2)
+	defer site.Close()
+	c := crawler.NewCrawler(crawler.WithMaxDepth(1))
+	if err := c.Crawl(ctx, site.BookURL(1)); err != nil {
+		t.Fatalf("crawl succeeded: %v", err)
+	}
+	expected := "Book 1 is about books, and the books related to them"
+	stored, err := c.Storage.GetBook(ctx, site.BookURL(1), 0)
+	if err != nil || stored == nil {
+		t.Fatalf("crawled book is stored: %v", err)
+	}
+	if stored.Description != expected {
+		t.Errorf("crawled description is stored: %q", stored.Description)
+	}
+
+	var out bytes.Buffer
+	if err := jsonl.ExportJSONL(ctx, c.Storage, &out); err != nil {
+		t.Errorf("jsonl export succeeded: %v", err)
+	}
+	var first jsonl.Book
+	err = json.NewDecoder(&out).Decode(&first)
+	if !(err == nil && strings.HasPrefix(first.Description, "Book ")) {
+		t.Errorf("jsonl output has the description: %q", first.Description)
+	}
+
+}
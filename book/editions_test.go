@@ -0,0 +1,83 @@
+package book_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/dot"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+func editionsExtract(t *testing.T, body string) *book.Book {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><body>" + body + "</body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := book.New("https://www.goodreads.com/book/show/1")
+	book.Build(b, doc)
+	return b
+}
+
+// TestEditions checks that the number of editions is extracted from the link
+// to the editions of the work, that it is -1 when the page has no count, and
+// that crawled books carry it into the dot output
+func TestEditions(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	cases := []struct {
+		name     string
+		body     string
+		editions int32
+	}{
+		{"work link", `<a href="/work/editions/3634639-dune">All Editions (123 editions)</a>`, 123},
+		{"thousands", `<a href="/work/editions/3634639-dune">1,234 editions</a>`, 1234},
+		{"single edition", `<a href="/work/editions/3634639-dune">1 edition</a>`, 1},
+		{"editions box", `<div id="bookEditions"><a href="/editions">Other editions: 57 Editions</a></div>`, 57},
+		{"no count", `<a href="/work/editions/3634639-dune">All editions</a>`, -1},
+		{"no link", `<h1 id="bookTitle">Dune</h1>`, -1},
+	}
+	for _, c := range cases {
+		b := editionsExtract(t, c.body)
+		if b.Editions != c.editions {
+			t.Errorf("%s: %d editions, expected %d", c.name, b.Editions, c.editions)
+		}
+	}
+
+	ctx := context.Background()
+	server := fixture.NewServer(100, 3)
+	server.Works = 10
+	defer server.Close()
+
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(3),
+		crawler.WithMaxReadAlso(3),
+	)
+	seed := server.BookURL(1)
+	if err := c.Crawl(ctx, seed); err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.Storage.GetBook(ctx, seed, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Editions != 2 {
+		t.Errorf("crawled book has the editions of its work (%d)", b.Editions)
+	}
+
+	var buf bytes.Buffer
+	if err := dot.PrintBookGraph(book.NewGraph(b), &buf, dot.PrintBookGraphOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `2 editions\l`) {
+		t.Errorf("dot label has the editions")
+	}
+
+}
@@ -0,0 +1,83 @@
+package book_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/dot"
+	"github.com/bcap/book-crawler/storage/memory"
+)
+
+// TestEmptyGraph checks that graphs without books, such as when a crawl
+// persists none of its root books, go through graph building, ranking,
+// serialization and the dot exporter without panicking, and that the dot
+// output is a valid empty graph
+func TestEmptyGraph(t *testing.T) {
+	ctx := context.Background()
+
+	// the storage has nothing for the root, so GetBook returns nil
+	missing, err := (&memory.Storage{}).GetBook(ctx, "https://www.goodreads.com/book/show/1", 0)
+	if !(err == nil && missing == nil) {
+		t.Errorf("storage returns no book for an unknown url")
+	}
+
+	graph := book.NewGraph(missing)
+	if len(graph.Roots) != 0 {
+		t.Errorf("nil roots are dropped (%d roots)", len(graph.Roots))
+	}
+	if len(graph.All) != 0 {
+		t.Errorf("graph has no books (%d books)", len(graph.All))
+	}
+	if len(graph.ByDepth) != 0 {
+		t.Errorf("graph has no depths (%d depths)", len(graph.ByDepth))
+	}
+	if len(book.NewGraph().All) != 0 {
+		t.Errorf("graph without roots has no books")
+	}
+	if len(book.Collect(nil, nil)) != 0 {
+		t.Errorf("collecting nil roots gives no books")
+	}
+	if len(book.CollectByDepth(nil)) != 0 {
+		t.Errorf("collecting nil roots by depth gives no depths")
+	}
+
+	b := book.New("https://www.goodreads.com/book/show/2")
+	mixed := book.NewGraph(nil, b, nil)
+	if !(len(mixed.Roots) == 1 && len(mixed.All) == 1 && len(mixed.ByDepth) == 1) {
+		t.Errorf("nil roots are ignored next to books (%d roots, %d books)", len(mixed.Roots), len(mixed.All))
+	}
+
+	var out strings.Builder
+	err = dot.PrintBookGraph(graph, &out, dot.DefaultPrintBookGraphOptions())
+	if !(err == nil && out.String() == "digraph G {}\n") {
+		t.Errorf("dot output is an empty graph: %q", out.String())
+	}
+
+	if len(book.PageRankByURL(graph)) != 0 {
+		t.Errorf("empty graph has no ranks")
+	}
+	top := book.TopRanked(graph, 10)
+	if !(len(top.Roots) == 0 && len(top.All) == 0) {
+		t.Errorf("top ranked subgraph of an empty graph is empty")
+	}
+
+	var saved bytes.Buffer
+	err = book.SaveGraph(graph, &saved)
+	if err != nil {
+		t.Errorf("empty graph is saved: %v", err)
+	}
+	loaded, err := book.LoadGraph(&saved)
+	if !(err == nil && len(loaded.All) == 0 && len(loaded.Roots) == 0) {
+		t.Errorf("empty graph is loaded back: %v", err)
+	}
+
+	_, err = book.RecommendPath(graph, b.URL, 3)
+	_, notInGraph := err.(book.ErrNotInGraph)
+	if !notInGraph {
+		t.Errorf("recommending from an empty graph fails with ErrNotInGraph: %v", err)
+	}
+
+}
@@ -1,8 +1,10 @@
 package book
 
 import (
+	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/bcap/book-crawler/html"
@@ -10,63 +12,130 @@ import (
 
 var ratingsRegex = regexp.MustCompile(`title=\\"(\d+) ratings\\"`)
 var pagesRegex = regexp.MustCompile(`(\d+) pages`)
+var workURLRegex = regexp.MustCompile(`/work/(?:editions|show|quotes|best_book)/(\d+)`)
+var publishedYearRegex = regexp.MustCompile(`(?s)^Published\b.*?\b(\d{4})\b`)
+var isbnRegex = regexp.MustCompile(`^(\d{9}[\dX])\b`)
+var isbn13Regex = regexp.MustCompile(`(?:^|ISBN13:\s*)(\d{13})\b`)
+var editionsRegex = regexp.MustCompile(`(?i)(\d[\d,]*)\s+editions?\b`)
+var asinRegex = regexp.MustCompile(`^[A-Z0-9]{10}$`)
+var amazonURLASINRegex = regexp.MustCompile(`amazon\.[a-z.]+/(?:.*/)?(?:dp|gp/product|ASIN)/([A-Z0-9]{10})`)
+var awardsToggleRegex = regexp.MustCompile(`\s*\.\.\.\s*(?:more|less)$`)
+var shelfRegex = regexp.MustCompile(`^(.+?)\s*\(\s*(\d[\d,]*)(?:\s+users?)?\s*\)$`)
 
+// Extractor builds a book out of its page. The returned book does not need to
+// have its URL set
+type Extractor interface {
+	Extract(doc *goquery.Document) (*Book, error)
+}
+
+// ExtractorFunc adapts a function to an Extractor
+type ExtractorFunc func(doc *goquery.Document) (*Book, error)
+
+func (f ExtractorFunc) Extract(doc *goquery.Document) (*Book, error) {
+	return f(doc)
+}
+
+// GoodreadsExtractor extracts books from goodreads book pages using BuildWith
+type GoodreadsExtractor struct {
+	// Selectors defaults to DefaultSelectors when nil
+	Selectors *Selectors
+}
+
+func (e GoodreadsExtractor) Extract(doc *goquery.Document) (*Book, error) {
+	selectors := DefaultSelectors()
+	if e.Selectors != nil {
+		selectors = *e.Selectors
+	}
+	b := New("")
+	BuildWith(b, doc, selectors)
+	return b, nil
+}
+
+// Build fills the book with what is extracted from its page, using the
+// DefaultSelectors
 func Build(book *Book, doc *goquery.Document) {
-	book.Title = extractTitle(doc)
-	book.Author = extractAuthor(doc)
-	book.AuthorURL = extractAuthorURL(doc)
-	book.Rating = extractRating(doc)
-	book.RatingsTotal = extractNumRatingsTotal(doc)
-	ratingsByStar := extractNumRatingsByStars(doc)
+	BuildWith(book, doc, DefaultSelectors())
+}
+
+// BuildWith is Build with custom selectors
+func BuildWith(book *Book, doc *goquery.Document, s Selectors) {
+	book.Title = extractTitle(doc, s)
+	book.Author = extractAuthor(doc, s)
+	book.AuthorURL = extractAuthorURL(doc, s)
+	book.Rating = extractRating(doc, s)
+	book.RatingsTotal = extractNumRatingsTotal(doc, s)
+	ratingsByStar := extractNumRatingsByStars(doc, s)
 	book.Ratings1 = ratingsByStar[1]
 	book.Ratings2 = ratingsByStar[2]
 	book.Ratings3 = ratingsByStar[3]
 	book.Ratings4 = ratingsByStar[4]
 	book.Ratings5 = ratingsByStar[5]
-	book.Reviews = extractNumReviews(doc)
-	book.Pages = extractNumPages(doc)
-	book.Genres = extractGenres(doc)
+	book.Reviews = extractNumReviews(doc, s)
+	book.Pages = extractNumPages(doc, s)
+	book.PublishedYear = extractPublishedYear(doc, s)
+	book.Language = extractLanguage(doc, s)
+	book.Genres = extractGenres(doc, s)
+	book.Awards = extractAwards(doc, s)
+	book.Shelves = extractShelves(doc, s)
+	book.Description = extractDescription(doc, s)
+	book.ASIN = extractASIN(doc, s)
+	book.ISBN, book.ISBN13 = extractISBNs(doc, s)
+	book.WorkURL = extractWorkURL(doc, s)
+	book.Editions = extractNumEditions(doc, s)
 }
 
-func extractTitle(doc *goquery.Document) string {
-	selection := doc.Find("h1#bookTitle")
+func extractTitle(doc *goquery.Document, s Selectors) string {
+	selection := doc.Find(s.Title)
 	if selection.Length() == 0 {
 		return ""
 	}
 	return html.CleanText(selection.Eq(0).Text())
 }
 
-func extractAuthor(doc *goquery.Document) string {
-	selection := doc.Find("a.authorName span")
+// goodreads renders a truncated description and hides the full one in a
+// second span, so the longest of them is kept
+func extractDescription(doc *goquery.Document, s Selectors) string {
+	description := ""
+	doc.Find(s.Description).Each(func(_ int, selection *goquery.Selection) {
+		if text := html.CleanText(selection.Text()); len(text) > len(description) {
+			description = text
+		}
+	})
+	return description
+}
+
+func extractAuthor(doc *goquery.Document, s Selectors) string {
+	selection := doc.Find(s.Author)
 	if selection.Length() == 0 {
 		return ""
 	}
 	return html.CleanText(selection.Eq(0).Text())
 }
 
-func extractAuthorURL(doc *goquery.Document) string {
-	selection := doc.Find("a.authorName")
+// ExtractAuthorURL returns the url of the author page linked from a book page
+func ExtractAuthorURL(doc *goquery.Document, s Selectors) string {
+	return extractAuthorURL(doc, s)
+}
+
+func extractAuthorURL(doc *goquery.Document, s Selectors) string {
+	selection := doc.Find(s.AuthorLink)
 	if selection.Length() == 0 {
 		return ""
 	}
 	return html.CleanText(selection.AttrOr("href", ""))
 }
 
-func extractRating(doc *goquery.Document) int32 {
-	selection := doc.Find("span[itemprop=ratingValue]")
+func extractRating(doc *goquery.Document, s Selectors) Rating {
+	selection := doc.Find(s.Rating)
 	if selection.Length() == 0 {
-		return -1
+		return NoRating
 	}
-	ratingStr := html.CleanText(selection.Eq(0).Text())
-	ratingFloat, err := strconv.ParseFloat(ratingStr, 32)
-	if err != nil {
-		return -1
-	}
-	return int32(ratingFloat * 100)
+	rating, _ := ParseRating(selection.Eq(0).Text())
+	return rating
 }
 
-func extractNumRatingsTotal(doc *goquery.Document) int32 {
-	ratingsStr, has := doc.Find("a meta[itemprop=ratingCount]").Attr("content")
+func extractNumRatingsTotal(doc *goquery.Document, s Selectors) int32 {
+	ratingsStr, has := doc.Find(s.RatingsTotal).Attr("content")
 	if !has {
 		return -1
 	}
@@ -77,13 +146,12 @@ func extractNumRatingsTotal(doc *goquery.Document) int32 {
 	return int32(ratings)
 }
 
-func extractNumRatingsByStars(doc *goquery.Document) map[int]int32 {
+func extractNumRatingsByStars(doc *goquery.Document, s Selectors) map[int]int32 {
 	// The following is super ugly
 	// The ratings by level are given by an ugly javascript inside a
 	// <script> + CDATA tags
 	// Here we use regexes to find such data
-	key := "a#rating_details + script"
-	ratingsScript := doc.Find(key).Text()
+	ratingsScript := doc.Find(s.RatingsByStars).Text()
 	matches := ratingsRegex.FindAllStringSubmatch(ratingsScript, -1)
 	results := map[int]int32{}
 	for idx, match := range matches {
@@ -96,8 +164,8 @@ func extractNumRatingsByStars(doc *goquery.Document) map[int]int32 {
 	return results
 }
 
-func extractNumReviews(doc *goquery.Document) int32 {
-	reviewsStr, has := doc.Find("a meta[itemprop=reviewCount]").Attr("content")
+func extractNumReviews(doc *goquery.Document, s Selectors) int32 {
+	reviewsStr, has := doc.Find(s.Reviews).Attr("content")
 	if !has {
 		return -1
 	}
@@ -108,8 +176,8 @@ func extractNumReviews(doc *goquery.Document) int32 {
 	return int32(reviews)
 }
 
-func extractNumPages(doc *goquery.Document) int32 {
-	pagesStr := doc.Find("div#details div.row span[itemprop=numberOfPages]").Text()
+func extractNumPages(doc *goquery.Document, s Selectors) int32 {
+	pagesStr := doc.Find(s.Pages).Text()
 	matches := pagesRegex.FindStringSubmatch(pagesStr)
 	if len(matches) < 2 {
 		return -1
@@ -121,11 +189,183 @@ func extractNumPages(doc *goquery.Document) int32 {
 	return int32(pages)
 }
 
-func extractGenres(doc *goquery.Document) []string {
-	sel := doc.Find("a.bookPageGenreLink")
+// extractPublishedYear reads the year out of the Published row of the book
+// details, eg "Published May 5th 2015 by Tor Books"
+func extractPublishedYear(doc *goquery.Document, s Selectors) int32 {
+	year := int32(0)
+	doc.Find(s.DetailsRow).EachWithBreak(func(_ int, row *goquery.Selection) bool {
+		matches := publishedYearRegex.FindStringSubmatch(html.CleanText(row.Text()))
+		if len(matches) < 2 {
+			return true
+		}
+		if parsed, err := strconv.Atoi(matches[1]); err == nil {
+			year = int32(parsed)
+		}
+		return false
+	})
+	return year
+}
+
+// extractASIN looks for the kindle edition ASIN, first in data-asin attributes,
+// then in amazon buy links and finally in the book details box
+func extractASIN(doc *goquery.Document, s Selectors) string {
+	asin := ""
+	doc.Find(s.ASIN).EachWithBreak(func(_ int, node *goquery.Selection) bool {
+		candidate := html.CleanText(node.AttrOr("data-asin", ""))
+		if asinRegex.MatchString(candidate) {
+			asin = candidate
+			return false
+		}
+		return true
+	})
+	if asin != "" {
+		return asin
+	}
+
+	doc.Find(s.AmazonLink).EachWithBreak(func(_ int, link *goquery.Selection) bool {
+		href, _ := url.QueryUnescape(link.AttrOr("href", ""))
+		if matches := amazonURLASINRegex.FindStringSubmatch(href); len(matches) == 2 {
+			asin = matches[1]
+			return false
+		}
+		return true
+	})
+	if asin != "" {
+		return asin
+	}
+
+	doc.Find(s.DataBoxRow).EachWithBreak(func(_ int, row *goquery.Selection) bool {
+		if html.CleanText(row.Find(s.DataBoxRowTitle).Text()) != "ASIN" {
+			return true
+		}
+		candidate := html.CleanText(row.Find(s.DataBoxRowItem).Text())
+		if asinRegex.MatchString(candidate) {
+			asin = candidate
+		}
+		return false
+	})
+	return asin
+}
+
+// extractISBNs reads the ISBN rows of the book details box. The ISBN row
+// usually has the ISBN13 in parentheses after the 10 digit ISBN, eg
+// "0441013597 (ISBN13: 9780441013593)", and only the ISBN13 when the edition
+// has no 10 digit ISBN
+func extractISBNs(doc *goquery.Document, s Selectors) (string, string) {
+	isbn, isbn13 := "", ""
+	doc.Find(s.DataBoxRow).Each(func(_ int, row *goquery.Selection) {
+		title := html.CleanText(row.Find(s.DataBoxRowTitle).Text())
+		if title != "ISBN" && title != "ISBN13" {
+			return
+		}
+		item := html.CleanText(row.Find(s.DataBoxRowItem).Text())
+		if matches := isbnRegex.FindStringSubmatch(item); title == "ISBN" && len(matches) == 2 && isbn == "" {
+			isbn = matches[1]
+		}
+		if matches := isbn13Regex.FindStringSubmatch(item); len(matches) == 2 && isbn13 == "" {
+			isbn13 = matches[1]
+		}
+	})
+	return isbn, isbn13
+}
+
+// extractLanguage reads the Edition Language row of the book details box
+func extractLanguage(doc *goquery.Document, s Selectors) string {
+	language := ""
+	doc.Find(s.DataBoxRow).EachWithBreak(func(_ int, row *goquery.Selection) bool {
+		if html.CleanText(row.Find(s.DataBoxRowTitle).Text()) != "Edition Language" {
+			return true
+		}
+		language = html.CleanText(row.Find(s.DataBoxRowItem).Text())
+		return false
+	})
+	return language
+}
+
+// extractAwards reads the Literary Awards row of the book details box, a comma
+// separated list of awards. Long lists are truncated behind a "...more" toggle
+// which is dropped, as are repeated awards
+func extractAwards(doc *goquery.Document, s Selectors) []string {
+	awards := []string{}
+	doc.Find(s.DataBoxRow).EachWithBreak(func(_ int, row *goquery.Selection) bool {
+		if html.CleanText(row.Find(s.DataBoxRowTitle).Text()) != "Literary Awards" {
+			return true
+		}
+		seen := map[string]bool{}
+		for _, award := range strings.Split(row.Find(s.DataBoxRowItem).Text(), ",") {
+			award = awardsToggleRegex.ReplaceAllString(html.CleanText(award), "")
+			award = strings.Join(strings.Fields(award), " ")
+			if award == "" || seen[award] {
+				continue
+			}
+			seen[award] = true
+			awards = append(awards, award)
+		}
+		return false
+	})
+	return awards
+}
+
+// extractShelves reads the name and the count in parentheses of every popular
+// shelf, eg "to-read (1,234)". Shelves without a count are ignored, and only
+// the first count of shelves listed more than once is kept
+func extractShelves(doc *goquery.Document, s Selectors) map[string]int32 {
+	shelves := map[string]int32{}
+	doc.Find(s.Shelf).Each(func(_ int, shelf *goquery.Selection) {
+		matches := shelfRegex.FindStringSubmatch(strings.Join(strings.Fields(html.CleanText(shelf.Text())), " "))
+		if len(matches) < 3 {
+			return
+		}
+		count, err := strconv.Atoi(strings.ReplaceAll(matches[2], ",", ""))
+		if err != nil {
+			return
+		}
+		if _, has := shelves[matches[1]]; !has {
+			shelves[matches[1]] = int32(count)
+		}
+	})
+	return shelves
+}
+
+// extractWorkURL finds the work of the edition, either from the canonical
+// link or from any link to the work pages (eg "All editions"). The url is
+// reduced to its work id, so every edition gives the same url. It is relative
+// to the page
+func extractWorkURL(doc *goquery.Document, s Selectors) string {
+	candidates := []string{doc.Find(s.Canonical).AttrOr("href", "")}
+	doc.Find(s.WorkLink).Each(func(_ int, link *goquery.Selection) {
+		candidates = append(candidates, link.AttrOr("href", ""))
+	})
+	for _, candidate := range candidates {
+		if matches := workURLRegex.FindStringSubmatch(candidate); len(matches) == 2 {
+			return "/work/editions/" + matches[1]
+		}
+	}
+	return ""
+}
+
+// extractNumEditions reads the count out of the link to the editions of the
+// work, eg "All Editions (123 editions)"
+func extractNumEditions(doc *goquery.Document, s Selectors) int32 {
+	editions := int32(-1)
+	doc.Find(s.Editions).EachWithBreak(func(_ int, link *goquery.Selection) bool {
+		matches := editionsRegex.FindStringSubmatch(html.CleanText(link.Text()))
+		if len(matches) < 2 {
+			return true
+		}
+		if parsed, err := strconv.Atoi(strings.ReplaceAll(matches[1], ",", "")); err == nil {
+			editions = int32(parsed)
+		}
+		return false
+	})
+	return editions
+}
+
+func extractGenres(doc *goquery.Document, s Selectors) []string {
+	sel := doc.Find(s.Genre)
 	genres := make([]string, sel.Length())
-	sel.Each(func(i int, s *goquery.Selection) {
-		genres[i] = s.Text()
+	sel.Each(func(i int, genre *goquery.Selection) {
+		genres[i] = genre.Text()
 	})
 	return genres
 }
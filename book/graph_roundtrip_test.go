@@ -0,0 +1,147 @@
+package book_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+const graphRoundtripNumBooks = 100
+const graphRoundtripNumLinks = 3
+const graphRoundtripMaxDepth = 5
+
+// TestGraphRoundtrip checks that a graph saved with book.SaveGraph and read
+// back with book.LoadGraph is the same graph: same books, edges, roots and
+// depths, with edges pointing to the loaded books themselves, even though the
+// crawled graph has cycles. Saving the loaded graph again, or marshaling it,
+// must give the same output
+func TestGraphRoundtrip(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(graphRoundtripNumBooks, graphRoundtripNumLinks)
+	defer server.Close()
+
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(graphRoundtripMaxDepth),
+		crawler.WithMaxReadAlso(graphRoundtripNumLinks),
+		crawler.WithDeterministic(true),
+	)
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatalf("Crawl succeeded: %v", err)
+	}
+	seed, err := c.Storage.GetBook(ctx, server.BookURL(1), 0)
+	if err != nil || seed == nil {
+		t.Fatalf("seed persisted: %v", err)
+	}
+	graph := book.NewGraph(seed)
+
+	var saved bytes.Buffer
+	err = book.SaveGraph(graph, &saved)
+	if err != nil {
+		t.Errorf("graph saved: %v", err)
+	}
+
+	loaded, err := book.LoadGraph(bytes.NewReader(saved.Bytes()))
+	if err != nil {
+		t.Errorf("graph loaded: %v", err)
+	}
+
+	if graphRoundtripDescribe(loaded.All) != graphRoundtripDescribe(graph.All) {
+		t.Errorf("same books and edges (%d books)", len(loaded.All))
+	}
+	if graphRoundtripUrls(loaded.Roots) != graphRoundtripUrls(graph.Roots) {
+		t.Errorf("same roots")
+	}
+	sameDepths := len(loaded.ByDepth) == len(graph.ByDepth)
+	for depth := 0; sameDepths && depth < len(graph.ByDepth); depth++ {
+		sameDepths = graphRoundtripUrls(loaded.ByDepth[depth]) == graphRoundtripUrls(graph.ByDepth[depth])
+	}
+	if !sameDepths {
+		t.Errorf("same books at each depth (%d depths)", len(loaded.ByDepth))
+	}
+
+	instances := map[*book.Book]struct{}{}
+	for _, b := range loaded.All {
+		instances[b] = struct{}{}
+	}
+	linked, cycles := true, false
+	for _, b := range loaded.All {
+		for _, edge := range b.AlsoRead {
+			_, has := instances[edge.To]
+			linked = linked && edge.From == b && has
+		}
+		cycles = cycles || reaches(b, b)
+	}
+	if !linked {
+		t.Errorf("edges point to the loaded books")
+	}
+	if !cycles {
+		t.Errorf("graph has cycles")
+	}
+
+	var resaved bytes.Buffer
+	err = book.SaveGraph(loaded, &resaved)
+	if !(err == nil && bytes.Equal(saved.Bytes(), resaved.Bytes())) {
+		t.Errorf("saving the loaded graph gives the same output: %v", err)
+	}
+
+	marshaled, err := json.Marshal(graph)
+	if !(err == nil && bytes.Equal(append(marshaled, '\n'), saved.Bytes())) {
+		t.Errorf("marshaling the graph gives the same output: %v", err)
+	}
+
+	_, err = book.LoadGraph(strings.NewReader(`{"roots":["x"],"books":[],"edges":[]}`))
+	if err == nil {
+		t.Errorf("unknown roots are reported: %v", err)
+	}
+
+}
+
+func graphRoundtripUrls(books []*book.Book) string {
+	var parts []string
+	for _, b := range books {
+		parts = append(parts, b.URL)
+	}
+	return strings.Join(parts, " ")
+}
+
+func graphRoundtripDescribe(books []*book.Book) string {
+	var s strings.Builder
+	for _, b := range books {
+		fmt.Fprintf(&s, "%s %q %v %d %v\n", b.URL, b.Title, b.Rating, b.Pages, b.Genres)
+		for _, edge := range b.AlsoRead {
+			fmt.Fprintf(&s, "  %s %d %s\n", edge.To.URL, edge.Priority, edge.Source)
+		}
+	}
+	return s.String()
+}
+
+func reaches(from *book.Book, target *book.Book) bool {
+	seen := map[*book.Book]struct{}{}
+	var visit func(*book.Book) bool
+	visit = func(b *book.Book) bool {
+		for _, edge := range b.AlsoRead {
+			if edge.To == target {
+				return true
+			}
+			if _, has := seen[edge.To]; has {
+				continue
+			}
+			seen[edge.To] = struct{}{}
+			if visit(edge.To) {
+				return true
+			}
+		}
+		return false
+	}
+	return visit(from)
+}
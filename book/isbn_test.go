@@ -0,0 +1,71 @@
+package book_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/dot"
+	"github.com/bcap/book-crawler/jsonl"
+)
+
+func isbnRow(title string, item string) string {
+	return fmt.Sprintf(`<div class="clearFloats"><div class="infoBoxRowTitle">%s</div><div class="infoBoxRowItem">%s</div></div>`, title, item)
+}
+
+func isbnExtract(t *testing.T, rows ...string) *book.Book {
+	t.Helper()
+	page := `<html><body><div id="bookDataBox">` + strings.Join(rows, "\n") + `</div></body></html>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := book.New("https://www.goodreads.com/book/show/1")
+	book.Build(b, doc)
+	return b
+}
+
+// TestIsbn checks that ISBNs are extracted from the rows of the book details
+// box, including the ISBN13 shown in parentheses after the 10 digit ISBN, and
+// that they make it to the jsonl output and the dot labels
+func TestIsbn(t *testing.T) {
+	cases := []struct {
+		name   string
+		rows   []string
+		isbn   string
+		isbn13 string
+	}{
+		{
+			"isbn13 in parentheses",
+			[]string{isbnRow("Original Title", "Dune"), isbnRow("ISBN", "\n  0441013597\n  <span class=\"greyText\">(ISBN13: <span itemprop=\"isbn\">9780441013593</span>)</span>\n")},
+			"0441013597", "9780441013593",
+		},
+		{"isbn ending in X", []string{isbnRow("ISBN", "080442957X")}, "080442957X", ""},
+		{"only an isbn13 in the isbn row", []string{isbnRow("ISBN", "9780441013593")}, "", "9780441013593"},
+		{"separate isbn13 row", []string{isbnRow("ISBN", "0441013597"), isbnRow("ISBN13", "9780441013593")}, "0441013597", "9780441013593"},
+		{"no isbn rows", []string{isbnRow("ASIN", "B00B7NPRY8")}, "", ""},
+		{"not an isbn", []string{isbnRow("ISBN", "unknown")}, "", ""},
+	}
+	for _, c := range cases {
+		b := isbnExtract(t, c.rows...)
+		if !(b.ISBN == c.isbn && b.ISBN13 == c.isbn13) {
+			t.Errorf("%s: isbn %q, isbn13 %q", c.name, b.ISBN, b.ISBN13)
+		}
+	}
+
+	b := isbnExtract(t, cases[0].rows...)
+	line := jsonl.NewBook(b)
+	if !(line.ISBN == "0441013597" && line.ISBN13 == "9780441013593") {
+		t.Errorf("jsonl has both isbns")
+	}
+
+	var out strings.Builder
+	err := dot.PrintBookGraph(book.NewGraph(b), &out, dot.DefaultPrintBookGraphOptions())
+	if !(err == nil && strings.Contains(out.String(), `isbn:9780441013593\l`)) {
+		t.Errorf("dot label has the isbn13: %v", err)
+	}
+
+}
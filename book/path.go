@@ -0,0 +1,40 @@
+package book
+
+// ShortestPath returns the fewest recommended AlsoRead edges leading from one
+// book to the other, as the sequence of books walked including both ends. A book is a path
+// to itself. Nil is returned when to cannot be reached from from. Among paths
+// as short, the one following the highest priority edges first is returned
+func ShortestPath(from, to *Book) []*Book {
+	if from == nil || to == nil {
+		return nil
+	}
+	if from == to {
+		return []*Book{from}
+	}
+
+	// breadth first search, remembering where each book was reached from
+	parent := map[*Book]*Book{from: nil}
+	queue := []*Book{from}
+	for len(queue) > 0 {
+		book := queue[0]
+		queue = queue[1:]
+		for _, edge := range book.AlsoRead {
+			if _, visited := parent[edge.To]; visited || edge.To == nil || !edge.Recommended() {
+				continue
+			}
+			parent[edge.To] = book
+			if edge.To == to {
+				path := []*Book{}
+				for b := to; b != nil; b = parent[b] {
+					path = append(path, b)
+				}
+				for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+					path[i], path[j] = path[j], path[i]
+				}
+				return path
+			}
+			queue = append(queue, edge.To)
+		}
+	}
+	return nil
+}
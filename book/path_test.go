@@ -0,0 +1,160 @@
+package book_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+)
+
+// TestPath checks book.ShortestPath: over a small hand built graph it finds
+// the path with the fewest edges, preferring higher priority edges on ties,
+// handles a book leading to itself and unreachable books. Over random graphs
+// the path lengths are compared with the distances found by brute force
+func TestPath(t *testing.T) {
+	books := map[string]*book.Book{}
+	for _, url := range []string{"a", "b", "c", "d", "e", "f", "z"} {
+		books[url] = book.New(url)
+	}
+	link := func(from string, to ...string) {
+		for idx, url := range to {
+			books[from].AlsoRead = append(books[from].AlsoRead, book.Edge{From: books[from], To: books[url], Priority: idx})
+		}
+	}
+
+	// a reaches e through c in 2 edges, through b d in 3 and through b d f in
+	// 4. f leads back to a
+	link("a", "b", "c")
+	link("b", "d")
+	link("c", "e")
+	link("d", "f", "e")
+	link("f", "e", "a")
+
+	urls := func(path []*book.Book) string {
+		var parts []string
+		for _, b := range path {
+			parts = append(parts, b.URL)
+		}
+		return strings.Join(parts, " ")
+	}
+
+	path := book.ShortestPath(books["a"], books["e"])
+	if urls(path) != "a c e" {
+		t.Errorf("finds the path with fewest edges (got %q)", urls(path))
+	}
+
+	path = book.ShortestPath(books["a"], books["f"])
+	if urls(path) != "a b d f" {
+		t.Errorf("follows edges in a chain (got %q)", urls(path))
+	}
+
+	path = book.ShortestPath(books["f"], books["c"])
+	if urls(path) != "f a c" {
+		t.Errorf("follows edges back through cycles (got %q)", urls(path))
+	}
+
+	path = book.ShortestPath(books["b"], books["b"])
+	if urls(path) != "b" {
+		t.Errorf("a book is a path to itself (got %q)", urls(path))
+	}
+
+	path = book.ShortestPath(books["e"], books["a"])
+	if path != nil {
+		t.Errorf("books with no recommendations reach nothing (got %q)", urls(path))
+	}
+
+	path = book.ShortestPath(books["a"], books["z"])
+	if path != nil {
+		t.Errorf("books out of the graph are unreachable (got %q)", urls(path))
+	}
+
+	if !(book.ShortestPath(nil, books["a"]) == nil && book.ShortestPath(books["a"], nil) == nil) {
+		t.Errorf("nil books have no path")
+	}
+
+	// ties are broken by edge priority: d is reached from a through b first
+	link("c", "d")
+	path = book.ShortestPath(books["a"], books["d"])
+	if urls(path) != "a b d" {
+		t.Errorf("prefers higher priority edges on ties (got %q)", urls(path))
+	}
+
+	random := rand.New(rand.NewSource(1))
+	mismatches := 0
+	for round := 0; round < 50; round++ {
+		size := 2 + random.Intn(15)
+		nodes := make([]*book.Book, size)
+		for idx := range nodes {
+			nodes[idx] = book.New(fmt.Sprint(idx))
+		}
+		for _, from := range nodes {
+			for edges := random.Intn(3); edges > 0; edges-- {
+				from.AlsoRead = append(from.AlsoRead, book.Edge{From: from, To: nodes[random.Intn(size)]})
+			}
+		}
+		distances := bruteForceDistances(nodes)
+		for _, from := range nodes {
+			for _, to := range nodes {
+				path := book.ShortestPath(from, to)
+				distance, reachable := distances[from][to]
+				if !reachable {
+					if path != nil {
+						mismatches++
+					}
+					continue
+				}
+				if len(path)-1 != distance || path[0] != from || path[len(path)-1] != to || !validPath(path) {
+					mismatches++
+				}
+			}
+		}
+	}
+	if mismatches != 0 {
+		t.Errorf("paths over random graphs are as short as the brute force distances (%d mismatches)", mismatches)
+	}
+
+}
+
+// bruteForceDistances relaxes every edge until no distance improves
+func bruteForceDistances(nodes []*book.Book) map[*book.Book]map[*book.Book]int {
+	distances := map[*book.Book]map[*book.Book]int{}
+	for _, node := range nodes {
+		distances[node] = map[*book.Book]int{node: 0}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, from := range nodes {
+			for _, node := range nodes {
+				distance, ok := distances[from][node]
+				if !ok {
+					continue
+				}
+				for _, edge := range node.AlsoRead {
+					current, ok := distances[from][edge.To]
+					if !ok || distance+1 < current {
+						distances[from][edge.To] = distance + 1
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return distances
+}
+
+func validPath(path []*book.Book) bool {
+	for idx := 1; idx < len(path); idx++ {
+		found := false
+		for _, edge := range path[idx-1].AlsoRead {
+			if edge.To == path[idx] {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package book
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	pageRankDamping       = 0.85
+	pageRankMaxIterations = 100
+	pageRankTolerance     = 1e-9
+)
+
+// PageRank ranks every book in the graph by how much it is recommended,
+// weighting recommendations from highly ranked books more. Ranks add up to 1.
+// Books without recommendations spread their rank evenly over all books. Each
+// iteration keeps damping of the rank flowing through edges, and iterations
+// stop early once ranks converge
+func PageRank(graph Graph, damping float64, iterations int) map[*Book]float64 {
+	// edge targets are not guaranteed to be the same instances as the books in
+	// the graph, so books are always identified by url, and ranked as the
+	// first instance found
+	books := []*Book{}
+	index := map[string]int{}
+	addBook := func(b *Book) {
+		if _, has := index[b.URL]; !has {
+			index[b.URL] = len(books)
+			books = append(books, b)
+		}
+	}
+	for _, b := range graph.All {
+		addBook(b)
+	}
+	for _, b := range graph.All {
+		for _, edge := range b.AlsoRead {
+			if edge.Recommended() {
+				addBook(edge.To)
+			}
+		}
+	}
+	outLinks := make([][]int, len(books))
+	for _, b := range graph.All {
+		from := index[b.URL]
+		for _, edge := range b.AlsoRead {
+			if !edge.Recommended() {
+				continue
+			}
+			outLinks[from] = append(outLinks[from], index[edge.To.URL])
+		}
+	}
+
+	n := len(books)
+	ranks := map[*Book]float64{}
+	if n == 0 {
+		return ranks
+	}
+	rank := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	next := make([]float64, n)
+	for iteration := 0; iteration < iterations; iteration++ {
+		dangling := 0.0
+		for i := range next {
+			next[i] = 0
+			if len(outLinks[i]) == 0 {
+				dangling += rank[i]
+			}
+		}
+		for from, targets := range outLinks {
+			for _, to := range targets {
+				next[to] += rank[from] / float64(len(targets))
+			}
+		}
+		base := (1-damping)/float64(n) + damping*dangling/float64(n)
+		delta := 0.0
+		for i := range next {
+			next[i] = base + damping*next[i]
+			delta += math.Abs(next[i] - rank[i])
+		}
+		rank, next = next, rank
+		if delta < pageRankTolerance {
+			break
+		}
+	}
+
+	for i, b := range books {
+		ranks[b] = rank[i]
+	}
+	return ranks
+}
+
+// PageRankByURL is PageRank with the usual damping of 0.85, keyed by url
+func PageRankByURL(graph Graph) map[string]float64 {
+	ranks := map[string]float64{}
+	for b, rank := range PageRank(graph, pageRankDamping, pageRankMaxIterations) {
+		ranks[b.URL] = rank
+	}
+	return ranks
+}
+
+// Ranked returns the books of the graph from the highest PageRank to the
+// lowest, along with the ranks of every book. Ties are broken by url so the
+// same graph always gives the same order
+func Ranked(graph Graph) ([]*Book, map[string]float64) {
+	ranks := PageRankByURL(graph)
+	books := make([]*Book, len(graph.All))
+	copy(books, graph.All)
+	sort.SliceStable(books, func(i, j int) bool {
+		ri, rj := ranks[books[i].URL], ranks[books[j].URL]
+		if ri != rj {
+			return ri > rj
+		}
+		return books[i].URL < books[j].URL
+	})
+	return books, ranks
+}
+
+// TopRanked returns the subgraph made of the n books of the graph with the
+// highest PageRank and the edges in between them. Books are copied, so the
+// given graph is left untouched. The roots of the graph that are kept stay
+// roots, and the best ranked books that cannot be reached from them become
+// roots as well, so every kept book has a depth
+func TopRanked(graph Graph, n int) Graph {
+	books, _ := Ranked(graph)
+	if n < len(books) {
+		books = books[:n]
+	}
+
+	kept := make(map[string]*Book, len(books))
+	for idx, b := range books {
+		copied := *b
+		books[idx] = &copied
+		kept[b.URL] = &copied
+	}
+	for _, b := range books {
+		edges := []Edge{}
+		for _, edge := range b.AlsoRead {
+			if to, has := kept[edge.To.URL]; has {
+				edges = append(edges, Edge{From: b, To: to, Priority: edge.Priority, Source: edge.Source})
+			}
+		}
+		b.AlsoRead = edges
+	}
+
+	roots := []*Book{}
+	for _, root := range graph.Roots {
+		if b, has := kept[root.URL]; has {
+			roots = append(roots, b)
+		}
+	}
+	reached := map[*Book]struct{}{}
+	for _, b := range Collect(roots...) {
+		reached[b] = struct{}{}
+	}
+	for _, b := range books {
+		if _, has := reached[b]; has {
+			continue
+		}
+		roots = append(roots, b)
+		for _, r := range Collect(b) {
+			reached[r] = struct{}{}
+		}
+	}
+
+	all := make([]*Book, len(books))
+	copy(all, books)
+	sort.Slice(all, func(i, j int) bool { return all[i].Title < all[j].Title })
+	return Graph{
+		Roots:   roots,
+		All:     all,
+		ByDepth: CollectByDepth(roots...),
+	}
+}
@@ -0,0 +1,179 @@
+package book_test
+
+import (
+	"context"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/dot"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+const rankNumBooks = 300
+const rankNumLinks = 4
+const rankMaxDepth = 4
+const topN = 15
+
+// TestRank checks book.PageRank, book.PageRankByURL, book.Ranked and
+// book.TopRanked: ranks add up to 1, also with books recommending nothing, the
+// most recommended book ranks first, without damping every book ranks the
+// same, ranked books are in rank order, and the top ranked subgraph of a
+// crawled graph keeps exactly the best ranked books, only edges in between
+// them, gives every kept book a depth and leaves the original graph untouched
+func TestRank(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	// a, b and c all recommend hub, which recommends a
+	books := map[string]*book.Book{}
+	for _, url := range []string{"a", "b", "c", "hub"} {
+		books[url] = book.New(url)
+	}
+	link := func(from string, to string) {
+		books[from].AlsoRead = append(books[from].AlsoRead, book.Edge{From: books[from], To: books[to]})
+	}
+	link("a", "hub")
+	link("b", "hub")
+	link("c", "hub")
+	link("hub", "a")
+	byBook := book.PageRank(book.NewGraph(books["b"], books["c"]), 0.85, 100)
+	sum := 0.0
+	var best *book.Book
+	for b, rank := range byBook {
+		sum += rank
+		if best == nil || rank > byBook[best] {
+			best = b
+		}
+	}
+	if math.Abs(sum-1) >= 1e-6 {
+		t.Errorf("ranks add up to 1 (%f)", sum)
+	}
+	if best != books["hub"] {
+		t.Errorf("most recommended book ranks first (%s)", best.URL)
+	}
+	for b, rank := range book.PageRank(book.NewGraph(books["b"], books["c"]), 0, 100) {
+		if math.Abs(rank-0.25) >= 1e-6 {
+			t.Errorf("without damping every book ranks the same (%s: %f)", b.URL, rank)
+		}
+	}
+
+	// dangling recommends nothing, so its rank is spread over every book
+	// instead of being lost
+	x, z, dangling := book.New("x"), book.New("z"), book.New("dangling")
+	x.AlsoRead = []book.Edge{{From: x, To: dangling}}
+	z.AlsoRead = []book.Edge{{From: z, To: dangling}}
+	ranks := book.PageRankByURL(book.NewGraph(x, z))
+	sum = ranks["x"] + ranks["z"] + ranks["dangling"]
+	if !(len(ranks) == 3 && math.Abs(sum-1) < 1e-6) {
+		t.Errorf("ranks add up to 1 with dangling books (%f)", sum)
+	}
+	if !(ranks["dangling"] > ranks["x"] && ranks["x"] == ranks["z"] && ranks["x"] > 0.15/3) {
+		t.Errorf("dangling book rank spread over every book (%v)", ranks)
+	}
+
+	server := fixture.NewServer(rankNumBooks, rankNumLinks)
+	defer server.Close()
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(rankMaxDepth),
+		crawler.WithMaxReadAlso(rankNumLinks),
+		crawler.WithDeterministic(true),
+	)
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatalf("Crawl succeeded: %v", err)
+	}
+	seed, _ := c.Storage.GetBook(ctx, server.BookURL(1), 0)
+	graph := book.NewGraph(seed)
+	edgesBefore := countEdges(graph.All)
+
+	top := book.TopRanked(graph, topN)
+	ranked, ranks := book.Ranked(graph)
+	inOrder := len(ranked) == len(graph.All)
+	for idx := 1; idx < len(ranked); idx++ {
+		inOrder = inOrder && ranks[ranked[idx-1].URL] >= ranks[ranked[idx].URL]
+	}
+	if !inOrder {
+		t.Errorf("every book ranked from the highest rank to the lowest (%d of %d)", len(ranked), len(graph.All))
+	}
+	if len(top.All) != topN {
+		t.Errorf("kept %d books (got %d)", topN, len(top.All))
+	}
+
+	kept := map[string]*book.Book{}
+	lowestKept := math.Inf(1)
+	for _, b := range top.All {
+		kept[b.URL] = b
+		lowestKept = math.Min(lowestKept, ranks[b.URL])
+	}
+	bestDropped := 0.0
+	for _, b := range graph.All {
+		if _, has := kept[b.URL]; !has {
+			bestDropped = math.Max(bestDropped, ranks[b.URL])
+		}
+	}
+	if lowestKept < bestDropped {
+		t.Errorf("kept the best ranked books (lowest kept %f, best dropped %f)", lowestKept, bestDropped)
+	}
+
+	inside, induced := true, true
+	for _, b := range top.All {
+		for _, edge := range b.AlsoRead {
+			inside = inside && kept[edge.To.URL] == edge.To
+		}
+		for _, edge := range graph.All[indexOf(graph.All, b.URL)].AlsoRead {
+			if _, has := kept[edge.To.URL]; has && !links(b, edge.To.URL) {
+				induced = false
+			}
+		}
+	}
+	if !inside {
+		t.Errorf("only edges in between kept books")
+	}
+	if !induced {
+		t.Errorf("every edge in between kept books is kept")
+	}
+
+	withDepth := 0
+	for _, books := range top.ByDepth {
+		withDepth += len(books)
+	}
+	if withDepth != topN {
+		t.Errorf("every kept book has a depth (%d of %d)", withDepth, topN)
+	}
+	if countEdges(graph.All) != edgesBefore {
+		t.Errorf("original graph untouched")
+	}
+	if dot.PrintBookGraph(top, io.Discard, dot.DefaultPrintBookGraphOptions()) != nil {
+		t.Errorf("subgraph printed as dot")
+	}
+
+}
+
+func countEdges(books []*book.Book) int {
+	edges := 0
+	for _, b := range books {
+		edges += len(b.AlsoRead)
+	}
+	return edges
+}
+
+func indexOf(books []*book.Book, url string) int {
+	for idx, b := range books {
+		if b.URL == url {
+			return idx
+		}
+	}
+	return -1
+}
+
+func links(b *book.Book, url string) bool {
+	for _, edge := range b.AlsoRead {
+		if edge.To.URL == url {
+			return true
+		}
+	}
+	return false
+}
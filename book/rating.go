@@ -0,0 +1,41 @@
+package book
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bcap/book-crawler/html"
+)
+
+// Rating is an average user rating scaled by 100 (eg 4.12 is stored as 412),
+// which keeps it an integer for storage and comparisons
+type Rating int32
+
+const ratingScale = 100
+
+// NoRating is used when a rating is unknown
+const NoRating Rating = -1
+
+func NewRating(rating float32) Rating {
+	return Rating(rating*ratingScale + 0.5)
+}
+
+// ParseRating parses ratings in their human form, eg "4.12"
+func ParseRating(s string) (Rating, bool) {
+	ratingFloat, err := strconv.ParseFloat(html.CleanText(s), 32)
+	if err != nil {
+		return NoRating, false
+	}
+	return NewRating(float32(ratingFloat)), true
+}
+
+func (r Rating) Float() float32 {
+	return float32(r) / ratingScale
+}
+
+func (r Rating) String() string {
+	if r < 0 {
+		return "?"
+	}
+	return fmt.Sprintf("%d.%02d", r/ratingScale, r%ratingScale)
+}
@@ -0,0 +1,49 @@
+package book_test
+
+import (
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+)
+
+// TestRating checks ratings are parsed from their human form, formatted back
+// to it and converted to floats with the same scale
+func TestRating(t *testing.T) {
+	parsed := []struct {
+		text   string
+		rating book.Rating
+		ok     bool
+	}{
+		{"4.12", 412, true},
+		{" 4.12\n", 412, true},
+		{"3.5", 350, true},
+		{"0", 0, true},
+		{"5.00", 500, true},
+		{"4.125", 413, true},
+		{"", book.NoRating, false},
+		{"four", book.NoRating, false},
+	}
+	for _, p := range parsed {
+		rating, ok := book.ParseRating(p.text)
+		if rating != p.rating || ok != p.ok {
+			t.Errorf("ParseRating(%q) = %d, %v, expected %d, %v", p.text, rating, ok, p.rating, p.ok)
+		}
+	}
+
+	for r := book.Rating(0); r <= 500; r++ {
+		parsed, ok := book.ParseRating(r.String())
+		if !ok || parsed != r {
+			t.Errorf("rating %d formatted as %q parsed back as %d", r, r.String(), parsed)
+		}
+		if book.NewRating(r.Float()) != r {
+			t.Errorf("rating %d as float %v converted back as %d", r, r.Float(), book.NewRating(r.Float()))
+		}
+	}
+
+	if book.Rating(407).String() != "4.07" {
+		t.Errorf("rating 407 formatted as %q", book.Rating(407).String())
+	}
+	if book.NoRating.String() != "?" {
+		t.Errorf("unknown rating formatted as %q", book.NoRating.String())
+	}
+}
@@ -0,0 +1,99 @@
+package book
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ErrNotInGraph is returned when a book is not part of a graph
+type ErrNotInGraph struct {
+	URL string
+}
+
+func (e ErrNotInGraph) Error() string {
+	return fmt.Sprintf("book %s is not in the graph", e.URL)
+}
+
+// RecommendPath suggests a reading list of up to length books starting at
+// startURL. It walks the graph greedily: at each step it picks the best
+// scored unread book recommended by any book already in the list, favouring
+// the recommendations of the last book read. The score weighs the rating and
+// how many books recommend it (in-degree) equally, each normalized to [0, 1].
+// The list is shorter than length when no more books can be reached
+func RecommendPath(graph Graph, startURL string, length int) ([]*Book, error) {
+	if length <= 0 {
+		return nil, fmt.Errorf("invalid reading list length %d", length)
+	}
+
+	// edge targets are not guaranteed to be the same instances as the books in
+	// the graph, so books are always looked up by url
+	byURL := make(map[string]*Book, len(graph.All))
+	for _, b := range graph.All {
+		byURL[b.URL] = b
+	}
+	start := byURL[startURL]
+	if start == nil {
+		return nil, ErrNotInGraph{URL: startURL}
+	}
+
+	inDegree := make(map[string]int, len(graph.All))
+	maxInDegree := 1
+	for _, b := range graph.All {
+		for _, edge := range b.AlsoRead {
+			inDegree[edge.To.URL]++
+			if inDegree[edge.To.URL] > maxInDegree {
+				maxInDegree = inDegree[edge.To.URL]
+			}
+		}
+	}
+	score := func(b *Book) float64 {
+		rating := 0.0
+		if b.Rating > 0 {
+			rating = float64(b.Rating.Float()) / 5
+		}
+		return rating + float64(inDegree[b.URL])/float64(maxInDegree)
+	}
+
+	path := []*Book{start}
+	visited := map[string]struct{}{startURL: {}}
+	for len(path) < length {
+		next := bestNeighbor(path[len(path)-1], byURL, visited, score)
+		// dead end, so backtrack to the most recent book with unread
+		// recommendations
+		for idx := len(path) - 2; next == nil && idx >= 0; idx-- {
+			next = bestNeighbor(path[idx], byURL, visited, score)
+		}
+		if next == nil {
+			break
+		}
+		path = append(path, next)
+		visited[next.URL] = struct{}{}
+	}
+	return path, nil
+}
+
+func bestNeighbor(b *Book, byURL map[string]*Book, visited map[string]struct{}, score func(*Book) float64) *Book {
+	var candidates []*Book
+	for _, edge := range b.AlsoRead {
+		neighbor := byURL[edge.To.URL]
+		if neighbor == nil {
+			continue
+		}
+		if _, has := visited[neighbor.URL]; has {
+			continue
+		}
+		candidates = append(candidates, neighbor)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	// ties are broken by url so the same graph always gives the same list
+	sort.SliceStable(candidates, func(i, j int) bool {
+		si, sj := score(candidates[i]), score(candidates[j])
+		if si != sj {
+			return si > sj
+		}
+		return candidates[i].URL < candidates[j].URL
+	})
+	return candidates[0]
+}
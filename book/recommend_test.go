@@ -0,0 +1,77 @@
+package book_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+)
+
+// TestRecommend checks book.RecommendPath over a small hand built graph: the
+// list starts at the given book, follows the best scored recommendation,
+// backtracks on dead ends, never repeats a book and stops early once the
+// graph is exhausted
+func TestRecommend(t *testing.T) {
+	books := map[string]*book.Book{}
+	newBook := func(url string, rating float32) {
+		b := book.New(url)
+		b.Title = url
+		b.Rating = book.NewRating(rating)
+		books[url] = b
+	}
+	link := func(from string, to ...string) {
+		for idx, url := range to {
+			books[from].AlsoRead = append(books[from].AlsoRead, book.Edge{From: books[from], To: books[url], Priority: idx})
+		}
+	}
+
+	// a recommends b and c. c is better rated, but b is recommended by more
+	// books. c is a dead end, so the list has to go back to a to reach b
+	newBook("a", 4.0)
+	newBook("b", 3.5)
+	newBook("c", 4.5)
+	newBook("d", 4.0)
+	newBook("e", 4.0)
+	newBook("f", 3.0)
+	link("a", "b", "c")
+	link("d", "b")
+	link("e", "b")
+	link("b", "f")
+	graph := book.NewGraph(books["a"], books["d"], books["e"])
+
+	urls := func(path []*book.Book) string {
+		var parts []string
+		for _, b := range path {
+			parts = append(parts, b.URL)
+		}
+		return strings.Join(parts, " ")
+	}
+
+	path, err := book.RecommendPath(graph, "a", 3)
+	if !(err == nil && urls(path) == "a b f") {
+		t.Errorf("follows the best scored recommendation (got %q, err: %v)", urls(path), err)
+	}
+
+	path, err = book.RecommendPath(graph, "a", 10)
+	if !(err == nil && urls(path) == "a b f c") {
+		t.Errorf("backtracks on dead ends and stops once exhausted (got %q, err: %v)", urls(path), err)
+	}
+
+	path, err = book.RecommendPath(graph, "c", 10)
+	if !(err == nil && urls(path) == "c") {
+		t.Errorf("a book with no recommendations is a list on its own (got %q, err: %v)", urls(path), err)
+	}
+
+	_, err = book.RecommendPath(graph, "z", 10)
+	var notInGraph book.ErrNotInGraph
+	if !(errors.As(err, &notInGraph) && notInGraph.URL == "z") {
+		t.Errorf("unknown books are reported: %v", err)
+	}
+
+	_, err = book.RecommendPath(graph, "a", 0)
+	if err == nil {
+		t.Errorf("invalid lengths are reported: %v", err)
+	}
+
+}
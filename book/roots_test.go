@@ -0,0 +1,46 @@
+package book_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+)
+
+// TestRoots checks the books without incoming edges are roots, and that a
+// component only made of cycles gets the book with the smallest url as its root,
+// so every book is reached from the roots
+func TestRoots(t *testing.T) {
+	tests := []struct {
+		name  string
+		links []string
+		roots string
+	}{
+		{"tree", []string{"a:b,c", "b:d"}, "a"},
+		{"cycle", []string{"c:b", "b:a", "a:c"}, "a"},
+		{"cycle below a root", []string{"r:b", "b:c", "c:b"}, "r"},
+		{"separate cycles", []string{"a:b", "b:a", "d:c", "c:d", "r:e"}, "r a c"},
+		{"cycle leading to another", []string{"c:d", "d:c", "d:a", "a:b", "b:a"}, "a c"},
+	}
+	for _, test := range tests {
+		books := graph(test.links...)
+		all := make([]*book.Book, 0, len(books))
+		for _, b := range books {
+			all = append(all, b)
+		}
+		sort.Slice(all, func(i, j int) bool { return all[i].Title > all[j].Title })
+
+		roots := book.Roots(all)
+		titles := make([]string, len(roots))
+		for idx, root := range roots {
+			titles[idx] = root.Title
+		}
+		if strings.Join(titles, " ") != test.roots {
+			t.Errorf("%s: expected roots %q, got %q", test.name, test.roots, strings.Join(titles, " "))
+		}
+		if reached := book.Collect(roots...); len(reached) != len(all) {
+			t.Errorf("%s: every book reached from the roots (%d of %d)", test.name, len(reached), len(all))
+		}
+	}
+}
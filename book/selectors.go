@@ -0,0 +1,57 @@
+package book
+
+// Selectors are the css selectors used to extract books from their pages.
+// Goodreads changes its markup every now and then, so they can be patched
+// without changing the extraction logic. Field names match the yaml keys
+// used in config files
+type Selectors struct {
+	Title          string `yaml:"title"`
+	Author         string `yaml:"author"`
+	AuthorLink     string `yaml:"author-link"`
+	Rating         string `yaml:"rating"`
+	RatingsTotal   string `yaml:"ratings-total"`
+	RatingsByStars string `yaml:"ratings-by-stars"`
+	Reviews        string `yaml:"reviews"`
+	Pages          string `yaml:"pages"`
+	DetailsRow     string `yaml:"details-row"`
+	Description    string `yaml:"description"`
+	Genre          string `yaml:"genre"`
+	Shelf          string `yaml:"shelf"`
+	ASIN           string `yaml:"asin"`
+	AmazonLink     string `yaml:"amazon-link"`
+	Canonical      string `yaml:"canonical"`
+	WorkLink       string `yaml:"work-link"`
+	Editions       string `yaml:"editions"`
+
+	// DataBoxRow is a row of the book data box, with its title in
+	// DataBoxRowTitle and its value in DataBoxRowItem. ASINs, ISBNs, the
+	// edition language and the literary awards are read from it
+	DataBoxRow      string `yaml:"data-box-row"`
+	DataBoxRowTitle string `yaml:"data-box-row-title"`
+	DataBoxRowItem  string `yaml:"data-box-row-item"`
+}
+
+func DefaultSelectors() Selectors {
+	return Selectors{
+		Title:           "h1#bookTitle",
+		Author:          "a.authorName span",
+		AuthorLink:      "a.authorName",
+		Rating:          "span[itemprop=ratingValue]",
+		RatingsTotal:    "a meta[itemprop=ratingCount]",
+		RatingsByStars:  "a#rating_details + script",
+		Reviews:         "a meta[itemprop=reviewCount]",
+		Pages:           "div#details div.row span[itemprop=numberOfPages]",
+		DetailsRow:      "div#details div.row",
+		Description:     "div#description span",
+		Genre:           "a.bookPageGenreLink",
+		Shelf:           "div.userShelf",
+		ASIN:            "[data-asin]",
+		AmazonLink:      "a[href*='amazon.']",
+		Canonical:       "link[rel=canonical]",
+		WorkLink:        "a[href*='/work/']",
+		Editions:        "div#bookEditions a, a[href*='/work/editions/']",
+		DataBoxRow:      "div#bookDataBox div.clearFloats",
+		DataBoxRowTitle: ".infoBoxRowTitle",
+		DataBoxRowItem:  ".infoBoxRowItem",
+	}
+}
@@ -0,0 +1,125 @@
+package book
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// savedGraph is the flat form of a graph written by SaveGraph. Books are
+// referenced by url everywhere, so cycles need no special handling
+type savedGraph struct {
+	Roots []string    `json:"roots"`
+	Books []*Book     `json:"books"`
+	Edges []savedEdge `json:"edges"`
+}
+
+type savedEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Priority int    `json:"priority"`
+	Source   string `json:"source,omitempty"`
+}
+
+// SaveGraph writes the graph as json, so it can be read back with LoadGraph
+// without querying the storage again. Books reached through edges but missing
+// from graph.All are written as well
+func SaveGraph(graph Graph, w io.Writer) error {
+	return json.NewEncoder(w).Encode(graph)
+}
+
+// MarshalJSON writes the graph in the same flat form as SaveGraph: the roots
+// as urls, every book once and the edges as {from, to, priority, source}
+func (g Graph) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newSavedGraph(g))
+}
+
+func newSavedGraph(graph Graph) savedGraph {
+	saved := savedGraph{
+		Roots: make([]string, len(graph.Roots)),
+		Books: []*Book{},
+		Edges: []savedEdge{},
+	}
+	for idx, root := range graph.Roots {
+		saved.Roots[idx] = root.URL
+	}
+	seen := map[string]struct{}{}
+	add := func(b *Book) {
+		if _, has := seen[b.URL]; !has {
+			seen[b.URL] = struct{}{}
+			// edges are saved apart from their books, as they can form cycles
+			withoutEdges := *b
+			withoutEdges.AlsoRead = nil
+			saved.Books = append(saved.Books, &withoutEdges)
+		}
+	}
+	for _, b := range graph.All {
+		add(b)
+	}
+	for _, b := range graph.All {
+		for _, edge := range b.AlsoRead {
+			add(edge.To)
+			saved.Edges = append(saved.Edges, savedEdge{
+				From:     b.URL,
+				To:       edge.To.URL,
+				Priority: edge.Priority,
+				Source:   edge.Source,
+			})
+		}
+	}
+	return saved
+}
+
+// LoadGraph reads a graph written by SaveGraph, linking the books back
+// together. ByDepth is computed again from the roots
+func LoadGraph(r io.Reader) (Graph, error) {
+	var saved savedGraph
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return Graph{}, fmt.Errorf("failed to decode graph: %w", err)
+	}
+
+	byURL := make(map[string]*Book, len(saved.Books))
+	for _, b := range saved.Books {
+		if b == nil {
+			return Graph{}, fmt.Errorf("failed to decode graph: null book")
+		}
+		if b.Genres == nil {
+			b.Genres = []string{}
+		}
+		if b.Awards == nil {
+			b.Awards = []string{}
+		}
+		if b.Shelves == nil {
+			b.Shelves = map[string]int32{}
+		}
+		b.AlsoRead = []Edge{}
+		byURL[b.URL] = b
+	}
+
+	for _, edge := range saved.Edges {
+		from, to := byURL[edge.From], byURL[edge.To]
+		if from == nil || to == nil {
+			return Graph{}, fmt.Errorf("failed to decode graph: edge from %s to %s links to an unknown book", edge.From, edge.To)
+		}
+		from.AlsoRead = append(from.AlsoRead, Edge{From: from, To: to, Priority: edge.Priority, Source: edge.Source})
+	}
+	for _, b := range saved.Books {
+		sort.SliceStable(b.AlsoRead, func(i, j int) bool {
+			return b.AlsoRead[i].Priority < b.AlsoRead[j].Priority
+		})
+	}
+
+	roots := make([]*Book, len(saved.Roots))
+	for idx, url := range saved.Roots {
+		if roots[idx] = byURL[url]; roots[idx] == nil {
+			return Graph{}, fmt.Errorf("failed to decode graph: unknown root %s", url)
+		}
+	}
+
+	return Graph{
+		Roots:   roots,
+		All:     saved.Books,
+		ByDepth: CollectByDepth(roots...),
+	}, nil
+}
@@ -0,0 +1,121 @@
+package book_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/jsonl"
+	"github.com/bcap/book-crawler/log"
+)
+
+func shelvesExtract(t *testing.T, page string) *book.Book {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><body>" + page + "</body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := book.New("https://www.goodreads.com/book/show/1")
+	book.Build(b, doc)
+	return b
+}
+
+// TestShelves checks that popular shelves are extracted with the count in
+// parentheses, apart from the genres, and that they are persisted by the
+// crawler and make it to saved graphs and the jsonl output
+func TestShelves(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	cases := []struct {
+		name    string
+		page    string
+		shelves map[string]int32
+	}{
+		{
+			"shelf links",
+			`<div class="userShelf"><a href="/shelf/show/to-read">to-read</a> (1,234,567)</div><div class="userShelf"><a href="/shelf/show/fantasy">fantasy</a> (89)</div>`,
+			map[string]int32{"to-read": 1234567, "fantasy": 89},
+		},
+		{
+			"spaced out with users",
+			"<div class=\"userShelf\">\n  <a>science-fiction</a>\n  ( 2,001 users )\n</div>",
+			map[string]int32{"science-fiction": 2001},
+		},
+		{
+			"repeated and without counts",
+			`<div class="userShelf"><a>classics</a> (12)</div><div class="userShelf"><a>classics</a> (3)</div><div class="userShelf"><a>favorites</a></div>`,
+			map[string]int32{"classics": 12},
+		},
+		{
+			"apart from genres",
+			`<a class="actionLinkLite bookPageGenreLink" href="/genres/fantasy">Fantasy</a><div class="userShelf"><a>fantasy</a> (7)</div>`,
+			map[string]int32{"fantasy": 7},
+		},
+		{"no shelves", `<h1 id="bookTitle">Dune</h1>`, map[string]int32{}},
+	}
+	for _, c := range cases {
+		b := shelvesExtract(t, c.page)
+		if !reflect.DeepEqual(b.Shelves, c.shelves) {
+			t.Errorf("%s: %v, expected %v", c.name, b.Shelves, c.shelves)
+		}
+	}
+	genres := shelvesExtract(t, cases[3].page).Genres
+	if !reflect.DeepEqual(genres, []string{"Fantasy"}) {
+		t.Errorf("genres unaffected by shelves: %q", genres)
+	}
+
+	// the fixture shelves book id as to-read by id*1001 users and as its
+	// genre by 1+id*2
+	ctx := context.Background()
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+	c := crawler.NewCrawler(crawler.WithMaxDepth(2), crawler.WithMaxReadAlso(3))
+	if err := c.Crawl(ctx, server.BookURL(3)); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int32{"to-read": 3003, "genre-3": 7}
+	seed, err := c.Storage.GetBook(ctx, server.BookURL(3), 0)
+	if !(err == nil && seed != nil && reflect.DeepEqual(seed.Shelves, expected)) {
+		t.Errorf("shelves persisted: %v", seed.Shelves)
+	}
+
+	var saved bytes.Buffer
+	if err := book.SaveGraph(book.NewGraph(seed), &saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := book.LoadGraph(&saved)
+	if !(err == nil && len(loaded.Roots) == 1 && reflect.DeepEqual(loaded.Roots[0].Shelves, expected)) {
+		t.Errorf("shelves in saved graphs: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := jsonl.ExportJSONL(ctx, c.Storage, &out); err != nil {
+		t.Fatal(err)
+	}
+	exported := jsonl.Book{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var b jsonl.Book
+		if err := json.Unmarshal([]byte(line), &b); err != nil {
+			t.Fatal(err)
+		}
+		if b.URL == seed.URL {
+			exported = b
+		}
+	}
+	if !reflect.DeepEqual(exported.Shelves, expected) {
+		t.Errorf("shelves in the jsonl output: %v", exported.Shelves)
+	}
+	noShelves, _ := json.Marshal(jsonl.NewBook(&book.Book{URL: "http://no-shelves"}))
+	if !strings.Contains(string(noShelves), `"shelves":{}`) {
+		t.Errorf("no shelves written as an empty object in the jsonl output")
+	}
+
+}
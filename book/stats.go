@@ -0,0 +1,70 @@
+package book
+
+// Stats summarizes the size and shape of a graph
+type Stats struct {
+	Books int
+	Edges int
+
+	// Components is how many weakly connected components the graph has: groups
+	// of books linked to each other when ignoring the direction of edges
+	Components int
+
+	MaxOutDegree int
+	AvgOutDegree float64
+
+	// BooksByDepth counts the books at each depth of Graph.ByDepth
+	BooksByDepth []int
+}
+
+// ComputeStats summarizes the graph. Only recommended edges between books of
+// the graph are counted, so graphs reduced with TopRanked are summarized as they are
+func ComputeStats(graph Graph) Stats {
+	stats := Stats{
+		Books:        len(graph.All),
+		BooksByDepth: []int{},
+	}
+
+	// union-find over the books, joining both ends of every edge
+	parent := make(map[*Book]*Book, len(graph.All))
+	for _, b := range graph.All {
+		parent[b] = b
+	}
+	var find func(b *Book) *Book
+	find = func(b *Book) *Book {
+		if parent[b] != b {
+			parent[b] = find(parent[b])
+		}
+		return parent[b]
+	}
+	stats.Components = len(graph.All)
+
+	for _, b := range graph.All {
+		outDegree := 0
+		for _, edge := range b.AlsoRead {
+			if _, has := parent[edge.To]; !has || !edge.Recommended() {
+				continue
+			}
+			outDegree++
+			if from, to := find(b), find(edge.To); from != to {
+				parent[from] = to
+				stats.Components--
+			}
+		}
+		stats.Edges += outDegree
+		if outDegree > stats.MaxOutDegree {
+			stats.MaxOutDegree = outDegree
+		}
+	}
+	if stats.Books > 0 {
+		stats.AvgOutDegree = float64(stats.Edges) / float64(stats.Books)
+	}
+
+	for _, books := range graph.ByDepth {
+		stats.BooksByDepth = append(stats.BooksByDepth, len(books))
+	}
+	// books found again at a deeper depth can leave the last levels empty
+	for len(stats.BooksByDepth) > 0 && stats.BooksByDepth[len(stats.BooksByDepth)-1] == 0 {
+		stats.BooksByDepth = stats.BooksByDepth[:len(stats.BooksByDepth)-1]
+	}
+	return stats
+}
@@ -0,0 +1,141 @@
+package book_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+func link(from *book.Book, to ...*book.Book) {
+	for idx, b := range to {
+		from.AlsoRead = append(from.AlsoRead, book.Edge{From: from, To: b, Priority: idx, Source: book.SourceAlsoRead})
+	}
+}
+
+func newBook(title string) *book.Book {
+	b := book.New("https://www.goodreads.com/book/show/" + title)
+	b.Title = title
+	return b
+}
+
+// components counts the weakly connected components with a breadth first
+// search over edges taken in both directions
+func components(books []*book.Book) int {
+	neighbours := map[*book.Book][]*book.Book{}
+	for _, b := range books {
+		for _, edge := range b.AlsoRead {
+			neighbours[b] = append(neighbours[b], edge.To)
+			neighbours[edge.To] = append(neighbours[edge.To], b)
+		}
+	}
+	seen := map[*book.Book]bool{}
+	count := 0
+	for _, b := range books {
+		if seen[b] {
+			continue
+		}
+		count++
+		queue := []*book.Book{b}
+		seen[b] = true
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for _, next := range neighbours[current] {
+				if !seen[next] {
+					seen[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+	}
+	return count
+}
+
+// TestStats checks the graph stats: book and edge counts, out degrees, the
+// depth distribution and weakly connected components, where edges count in
+// both directions. Components of crawled graphs are compared against a plain
+// breadth first search
+func TestStats(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	empty := book.ComputeStats(book.NewGraph())
+	if !reflect.DeepEqual(empty, book.Stats{BooksByDepth: []int{}}) {
+		t.Errorf("empty graph: %+v", empty)
+	}
+
+	// a and c both point to b, so they are in the same weak component even
+	// though neither reaches the other. d and e form a cycle of their own
+	a, b, c, d, e, f := newBook("a"), newBook("b"), newBook("c"), newBook("d"), newBook("e"), newBook("f")
+	link(a, b, f)
+	link(c, b)
+	link(d, e)
+	link(e, d)
+	stats := book.ComputeStats(book.NewGraph(a, c, d))
+	if stats.Books != 6 {
+		t.Errorf("books: %d", stats.Books)
+	}
+	if stats.Edges != 5 {
+		t.Errorf("edges: %d", stats.Edges)
+	}
+	if stats.Components != 2 {
+		t.Errorf("edges are undirected for components: %d", stats.Components)
+	}
+	if stats.MaxOutDegree != 2 {
+		t.Errorf("max out degree: %d", stats.MaxOutDegree)
+	}
+	if !(stats.AvgOutDegree > 0.83 && stats.AvgOutDegree < 0.84) {
+		t.Errorf("average out degree: %.3f", stats.AvgOutDegree)
+	}
+	if !reflect.DeepEqual(stats.BooksByDepth, []int{3, 3}) {
+		t.Errorf("books by depth: %v", stats.BooksByDepth)
+	}
+
+	// top ranked graphs keep edges to books left out, which are not counted
+	top := book.ComputeStats(book.Graph{All: []*book.Book{a, c}, Roots: []*book.Book{a, c}})
+	if !(top.Edges == 0 && top.Components == 2) {
+		t.Errorf("edges to books out of the graph ignored: %d edges, %d components", top.Edges, top.Components)
+	}
+
+	ctx := context.Background()
+	server := fixture.NewServer(300, 3)
+	defer server.Close()
+	bookCrawler := crawler.NewCrawler(crawler.WithMaxDepth(2), crawler.WithMaxReadAlso(2), crawler.WithMaxParallelism(10))
+	seeds := []string{server.BookURL(1), server.BookURL(150), server.BookURL(299)}
+	if err := bookCrawler.CrawlMany(ctx, seeds); err != nil {
+		t.Fatal(err)
+	}
+	var roots []*book.Book
+	for _, seed := range seeds {
+		root, err := bookCrawler.Storage.GetBook(ctx, seed, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+	}
+	graph := book.NewGraph(roots...)
+	stats = book.ComputeStats(graph)
+	edges := 0
+	for _, b := range graph.All {
+		edges += len(b.AlsoRead)
+	}
+	expected := components(graph.All)
+	if !(stats.Books == len(graph.All) && stats.Edges == edges) {
+		t.Errorf("crawled graph: %d books, %d edges", stats.Books, stats.Edges)
+	}
+	if stats.Components != expected {
+		t.Errorf("crawled graph: %d components, expected %d", stats.Components, expected)
+	}
+	total := 0
+	for _, count := range stats.BooksByDepth {
+		total += count
+	}
+	if total != stats.Books {
+		t.Errorf("crawled graph: every book at some depth (%d of %d)", total, stats.Books)
+	}
+
+}
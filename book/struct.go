@@ -1,16 +1,22 @@
 package book
 
+import "time"
+
 type Graph struct {
-	Root    *Book
+	Roots   []*Book
 	All     []*Book
 	ByDepth [][]*Book
 }
 
-func NewGraph(root *Book) Graph {
+// NewGraph builds the graph reachable from the given roots. Nil roots, such as
+// books missing from the storage, are ignored, so a graph without any roots is
+// empty rather than invalid
+func NewGraph(roots ...*Book) Graph {
+	roots = nonNil(roots)
 	return Graph{
-		Root:    root,
-		All:     Collect(root),
-		ByDepth: CollectByDepth(root),
+		Roots:   roots,
+		All:     Collect(roots...),
+		ByDepth: CollectByDepth(roots...),
 	}
 }
 
@@ -20,7 +26,7 @@ type Book struct {
 	Author    string
 	AuthorURL string
 
-	Rating       int32
+	Rating       Rating
 	RatingsTotal int32
 	Ratings1     int32
 	Ratings2     int32
@@ -32,10 +38,54 @@ type Book struct {
 
 	Pages int32
 
+	// PublishedYear is when the edition was published. Zero when unknown
+	PublishedYear int32
+
+	// Language is the language of the edition, eg English. Empty when unknown
+	Language string
+
+	// Editions is how many editions the work of the book has, which are
+	// listed in the WorkURL page. -1 when unknown
+	Editions int32
+
 	Genres []string
 
+	// Awards are the literary awards the book won or was nominated for, eg
+	// "Hugo Award for Best Novel (1966)"
+	Awards []string
+
+	// Shelves are the popular shelves users put the book in, eg to-read or
+	// fantasy, with how many users did so. Unlike Genres, they are free form
+	// user tags
+	Shelves map[string]int32
+
+	// Description is the synopsis of the book. Empty when the page has none
+	Description string
+
 	URL string
 
+	// ASIN is the amazon identifier of the kindle edition, when known
+	ASIN string
+
+	// ISBN and ISBN13 identify the edition, when known
+	ISBN   string
+	ISBN13 string
+
+	// WorkURL identifies the work this book is an edition of, when known.
+	// Different editions of the same book share it
+	WorkURL string
+
+	// Provenance tells how the book entered the graph, when tracked: the book
+	// it was first found from (empty for seeds), at which depth and from which
+	// seed
+	DiscoveredFrom  string
+	DiscoveredDepth int
+	DiscoveredSeed  string
+
+	// CrawledAt is when the crawl state of the book last changed, as recorded
+	// by the storage. Zero when unknown
+	CrawledAt time.Time
+
 	AlsoRead []Edge
 }
 
@@ -43,12 +93,34 @@ func New(url string) *Book {
 	return &Book{
 		URL:      url,
 		Genres:   make([]string, 0),
+		Awards:   make([]string, 0),
+		Shelves:  make(map[string]int32),
 		AlsoRead: make([]Edge, 0),
 	}
 }
 
+// Edge sources tell which kind of recommendation originated an edge
+const (
+	SourceAlsoRead      = "also_read"
+	SourceSimilarAuthor = "similar_author"
+	// SourceReadersAlsoEnjoyed edges go to the books in the "Readers also
+	// enjoyed" carousel of a book page
+	SourceReadersAlsoEnjoyed = "readers_also_enjoyed"
+	// SourceAuthor edges go to other books by the author of a book, as found
+	// in the author page
+	SourceAuthor = "author"
+)
+
 type Edge struct {
 	From     *Book
 	To       *Book
 	Priority int
+	Source   string
+}
+
+// Recommended tells whether the edge is a recommendation of the book it goes
+// to. Author edges only tell both books have the same author, so rankings,
+// paths and stats leave them out
+func (e Edge) Recommended() bool {
+	return e.Source != SourceAuthor
 }
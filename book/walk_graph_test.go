@@ -0,0 +1,38 @@
+package book_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+)
+
+// TestWalkGraph checks that every book of the graph is walked once with its
+// depth, and that only the edges in between books of the graph are walked
+func TestWalkGraph(t *testing.T) {
+	books := graph("a:b,c", "b:c,x", "c:a")
+	// x is trimmed from the graph, as book.TopRanked does
+	g := book.Graph{
+		Roots:   []*book.Book{books["a"]},
+		All:     []*book.Book{books["a"], books["b"], books["c"]},
+		ByDepth: [][]*book.Book{{books["a"]}, {books["b"], books["c"]}, {books["c"]}},
+	}
+
+	nodes := []string{}
+	edges := []string{}
+	book.WalkGraph(
+		g,
+		func(b *book.Book, depth int) {
+			nodes = append(nodes, b.Title+strings.Repeat("'", depth))
+		},
+		func(from *book.Book, e book.Edge) {
+			edges = append(edges, from.Title+e.To.Title)
+		},
+	)
+	if strings.Join(nodes, " ") != "a b' c'" {
+		t.Errorf("books walked once with their depth: %v", nodes)
+	}
+	if strings.Join(edges, " ") != "ab ac bc ca" {
+		t.Errorf("edges in between books of the graph walked: %v", edges)
+	}
+}
@@ -0,0 +1,96 @@
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is where time comes from for everything that waits or timestamps, so
+// time dependent behavior can be tested without actually waiting
+type Clock interface {
+	Now() time.Time
+	// Sleep waits for d or until ctx is done, in which case ctx's error is
+	// returned
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// Real is the wall clock
+var Real Clock = realClock{}
+
+// Or returns clock, or Real when clock is nil
+func Or(clock Clock) Clock {
+	if clock == nil {
+		return Real
+	}
+	return clock
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Fake is a clock that only moves when told to. Sleeping moves it forward by
+// the slept duration and returns right away, so code sleeping on it runs as
+// fast as possible while still seeing time pass. It is safe for concurrent use
+type Fake struct {
+	now   time.Time
+	slept time.Duration
+	mutex sync.Mutex
+}
+
+// NewFake returns a fake clock starting at now. Storage backends timestamp
+// with the real clock, so start at the current time when mixing both
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+func (f *Fake) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d <= 0 {
+		return nil
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.now = f.now.Add(d)
+	f.slept += d
+	return nil
+}
+
+// Advance moves the clock forward by d without counting it as slept
+func (f *Fake) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// Slept is the total time slept on the clock
+func (f *Fake) Slept() time.Duration {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.slept
+}
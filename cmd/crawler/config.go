@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bcap/book-crawler/crawler"
+)
+
+// cliConfig is everything that can be set from the command line. It can also
+// be loaded from a yaml or json file with --config, using the flag names as
+// keys. Flags explicitly passed in the command line take precedence over the
+// values in the file
+type cliConfig struct {
+	crawler.Config `yaml:",inline"`
+
+	List   bool   `yaml:"list"`
+	Search string `yaml:"search"`
+
+	Output             string `yaml:"output"`
+	Format             string `yaml:"format"`
+	Dot                bool   `yaml:"dot"`
+	JSON               bool   `yaml:"json"`
+	GraphML            bool   `yaml:"graphml"`
+	GEXF               bool   `yaml:"gexf"`
+	Mermaid            bool   `yaml:"mermaid"`
+	CSV                bool   `yaml:"csv"`
+	DotStream          bool   `yaml:"dot-stream"`
+	DotLayout          string `yaml:"dot-layout"`
+	DotConcentrate     bool   `yaml:"dot-concentrate"`
+	DotMaxEdgePriority int    `yaml:"dot-max-edge-priority"`
+	DotNodeTemplate    string `yaml:"dot-node-template"`
+	DotEdgeTemplate    string `yaml:"dot-edge-template"`
+	TopRank            int    `yaml:"top-rank"`
+	ReportCycles       bool   `yaml:"report-cycles"`
+	Stats              bool   `yaml:"stats"`
+	PageRank           int    `yaml:"pagerank"`
+
+	MemoryLog string `yaml:"memory-log"`
+
+	Neo4J         bool   `yaml:"neo4j"`
+	Neo4JURL      string `yaml:"neo4j-url"`
+	Neo4JUser     string `yaml:"neo4j-user"`
+	Neo4JPassword string `yaml:"neo4j-password"`
+
+	Neo4JBearerToken string `yaml:"neo4j-bearer-token"`
+
+	SQLite string `yaml:"sqlite"`
+
+	MetricsAddr string `yaml:"metrics-addr"`
+
+	Verbose   bool   `yaml:"verbose"`
+	LogFormat string `yaml:"log-format"`
+	Progress  bool   `yaml:"progress"`
+}
+
+func loadConfigFile(cmd *cobra.Command, path string) error {
+	if path == "" {
+		return nil
+	}
+
+	// yaml is a superset of json, so the same decoder handles both formats
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// slice flags are kept as slices, as their string form ("[a,b]") does not
+	// parse back, and setting them again would append instead of replace
+	explicit := map[*pflag.Flag][]string{}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			explicit[f] = slice.GetSlice()
+		} else {
+			explicit[f] = []string{f.Value.String()}
+		}
+	})
+
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	// flags given in the command line override the config file
+	for f, values := range explicit {
+		var err error
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			err = slice.Replace(values)
+		} else {
+			err = f.Value.Set(values[0])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply flag --%s over the config file: %w", f.Name, err)
+		}
+	}
+	return nil
+}
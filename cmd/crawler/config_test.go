@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bcap/book-crawler/crawler"
+)
+
+// loadConfig parses args into a new config, loading the config file if given
+func loadConfig(t *testing.T, args ...string) {
+	config = cliConfig{Config: crawler.DefaultConfig()}
+	cmd := parser()
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfigFile(&cmd, configFile); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestLoadConfigFile checks that settings are loaded from the config file,
+// with keys named as the flags, and that flags given in the command line take
+// precedence over it, slice flags included
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "" +
+		"max-depth: 5\n" +
+		"max-read-also: 7\n" +
+		"max-read-also-per-depth: [9, 8]\n" +
+		"language: [German]\n" +
+		"include-genre: [Fantasy]\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loadConfig(t, "--config", path)
+	if !(config.MaxDepth == 5 && reflect.DeepEqual(config.Languages, []string{"German"})) {
+		t.Errorf("max depth %d and languages %v, expected 5 and German from the file", config.MaxDepth, config.Languages)
+	}
+	if !reflect.DeepEqual(config.IncludeGenres, []string{"Fantasy"}) {
+		t.Errorf("included genres %v, expected Fantasy from the file", config.IncludeGenres)
+	}
+
+	loadConfig(t,
+		"--config", path,
+		"--max-depth", "2",
+		"--language", "Spanish,French",
+		"--exclude-genre", "Poetry",
+		"--max-read-also-per-depth", "3,2,1",
+		"--recommendation-source", "also_read",
+		"--recommendation-source", "readers_also_enjoyed",
+	)
+	if config.MaxDepth != 2 || config.MaxReadAlso != 7 {
+		t.Errorf("max depth %d and max read also %d, expected 2 from the flag and 7 from the file", config.MaxDepth, config.MaxReadAlso)
+	}
+	slices := []struct {
+		name     string
+		value    any
+		expected any
+	}{
+		{"language", config.Languages, []string{"Spanish", "French"}},
+		{"exclude-genre", config.ExcludeGenres, []string{"Poetry"}},
+		{"max-read-also-per-depth", config.MaxReadAlsoPerDepth, []int{3, 2, 1}},
+		{"recommendation-source", config.RecommendationSources, []string{"also_read", "readers_also_enjoyed"}},
+	}
+	for _, slice := range slices {
+		if !reflect.DeepEqual(slice.value, slice.expected) {
+			t.Errorf("--%s is %v, expected %v", slice.name, slice.value, slice.expected)
+		}
+	}
+}
+
+// TestValidateArgsAfterConfigFile checks that args are validated against the
+// settings of the config file: a search given in the file needs no book url,
+// and its invalid format is reported
+func TestValidateArgsAfterConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "" +
+		"search: dune\n" +
+		"format: bogus\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config = cliConfig{Config: crawler.DefaultConfig()}
+	cmd := parser()
+	cmd.SetArgs([]string{"--config", path})
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	err := cmd.Execute()
+	if !(err != nil && strings.Contains(err.Error(), `invalid format "bogus"`)) {
+		t.Errorf("format of the config file validated: %v", err)
+	}
+}
+
+// TestConfigKeysNameFlags checks that every key of the config file is named
+// after a flag, besides selectors which can only be set from config files
+func TestConfigKeysNameFlags(t *testing.T) {
+	cmd := parser()
+	var check func(typ reflect.Type)
+	check = func(typ reflect.Type) {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if key == "" && field.Anonymous {
+				check(field.Type)
+				continue
+			}
+			if key == "selectors" {
+				continue
+			}
+			if cmd.Flags().Lookup(key) == nil && cmd.PersistentFlags().Lookup(key) == nil {
+				t.Errorf("config key %q of field %s names no flag", key, field.Name)
+			}
+		}
+	}
+	check(reflect.TypeOf(cliConfig{}))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bcap/book-crawler/log"
+)
+
+func deleteCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <url>...",
+		Short: "delete books from the storage, so the next crawl fetches them again",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  deleteBooks,
+	}
+}
+
+func deleteBooks(cmd *cobra.Command, args []string) error {
+	setupLogging()
+
+	storage, err := newPersistentStorage()
+	if err != nil {
+		return err
+	}
+	if storage == nil {
+		return errors.New("delete requires a persistent storage, use --neo4j, --sqlite or --memory-log")
+	}
+
+	ctx := cmd.Context()
+	if err := storage.Initialize(ctx); err != nil {
+		return err
+	}
+	defer storage.Shutdown(ctx)
+
+	for _, url := range args {
+		if err := storage.DeleteBook(ctx, url); err != nil {
+			return err
+		}
+		log.Infof("deleted book %s", url)
+	}
+	return nil
+}
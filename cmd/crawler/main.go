@@ -3,35 +3,52 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/bcap/book-crawler/book"
 	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/csv"
 	"github.com/bcap/book-crawler/dot"
+	"github.com/bcap/book-crawler/gexf"
+	"github.com/bcap/book-crawler/graphml"
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/jsonl"
 	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/mermaid"
+	"github.com/bcap/book-crawler/metrics"
+	"github.com/bcap/book-crawler/progress"
+	"github.com/bcap/book-crawler/storage"
+	"github.com/bcap/book-crawler/storage/memory"
 	"github.com/bcap/book-crawler/storage/neo4j"
+	"github.com/bcap/book-crawler/storage/sqlite"
 
 	"github.com/spf13/cobra"
 )
 
-var maxDepth int
-var maxReadAlso int
-var minNumRatings int32
-var maxNumRatings int32
-var minRating int32
-var maxRating int32
-var maxParallelism int
-var maxRequestRetries int
-var minRequestRetryWait time.Duration
-var maxRequestRetryWait time.Duration
-var printDot bool
-var useNeo4J bool
-var neo4JURL string
-var neo4JUser string
-var neo4JPassword string
-var verbose bool
+const (
+	formatDot     = "dot"
+	formatJSONL   = "jsonl"
+	formatJSON    = "json"
+	formatGraphML = "graphml"
+	formatGEXF    = "gexf"
+	formatMermaid = "mermaid"
+	formatCSV     = "csv"
+)
+
+// drainTimeout bounds how long an interrupted crawl waits for in progress
+// work before exiting
+const drainTimeout = 30 * time.Second
+
+var config = cliConfig{Config: crawler.DefaultConfig()}
+var configFile string
 
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -44,95 +61,563 @@ func main() {
 func parser() cobra.Command {
 	cmd := cobra.Command{
 		Use:  "book-crawler",
-		Args: func(cmd *cobra.Command, args []string) error { return validateArgs(args) },
-		Run:  run,
-	}
-	cmd.Flags().IntVarP(&maxDepth, "max-depth", "d", 3, "controls how deep to traverse the graph")
-	cmd.Flags().IntVarP(&maxReadAlso, "max-read-also", "r", 5, "controls how many related books to follow from a given book")
-	cmd.Flags().Int32Var(&minNumRatings, "min-num-ratings", -1, "only persist and follow links for books that have at least this amount of ratings given by users. Set to a negative number to disable this check")
-	cmd.Flags().Int32Var(&maxNumRatings, "max-num-ratings", -1, "only persist and follow links for books that have at most this amount of ratings given by users. Set to a negative number to disable this check")
-	cmd.Flags().Int32Var(&minRating, "min-rating", -1, "only persist and follow links for books that have at least this rating. Set to a negative number to disable this check")
-	cmd.Flags().Int32Var(&maxRating, "max-rating", -1, "only persist and follow links for books that have at most this rating. Set to a negative number to disable this check")
-	cmd.Flags().IntVarP(&maxParallelism, "parallelism", "p", 10, "controls how requests are alowed in parallel")
-	cmd.Flags().IntVar(&maxRequestRetries, "max-retries", 4, "controls how many times the crawler will retry for a given URL")
-	cmd.Flags().DurationVar(&minRequestRetryWait, "min-retry-wait", 1*time.Second, "minimum time to wait in between retries")
-	cmd.Flags().DurationVar(&maxRequestRetryWait, "max-retry-wait", 15*time.Second, "maximum time to wait in between retries")
-	cmd.Flags().BoolVar(&printDot, "dot", false, "print the run results as a dot file (stdout)")
-	cmd.Flags().BoolVar(&useNeo4J, "neo4j", false, "use neo4j as storage")
-	cmd.Flags().StringVar(&neo4JURL, "neo4j-url", neo4j.DefaultURL, "neo4j database address")
-	cmd.Flags().StringVar(&neo4JUser, "neo4j-user", "", "user when connecting to the neo4j database")
-	cmd.Flags().StringVar(&neo4JPassword, "neo4j-password", "", "password when connecting to the neo4j database")
-	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "be more verbose by logging in debug mode")
+		Args: cobra.ArbitraryArgs,
+		// args are validated once the config file is loaded
+		PreRunE: func(cmd *cobra.Command, args []string) error { return validateArgs(args) },
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := loadConfigFile(cmd, configFile); err != nil {
+				return err
+			}
+			if _, ok := logFormats[config.LogFormat]; !ok {
+				return fmt.Errorf("invalid log format %q: expected text or json", config.LogFormat)
+			}
+			return crawler.ValidateRecommendationSources(config.RecommendationSources...)
+		},
+		Run: run,
+	}
+	cmd.PersistentFlags().StringVar(&configFile, "config", "", "load settings from a yaml or json file. Keys are the same as the flag names, and flags given in the command line take precedence")
+	cmd.Flags().IntVarP(&config.MaxDepth, "max-depth", "d", 3, "controls how deep to traverse the graph")
+	cmd.Flags().IntVarP(&config.MaxReadAlso, "max-read-also", "r", 5, "controls how many related books to follow from a given book. Set to a negative number to follow all of them")
+	cmd.Flags().IntVar(&config.MaxOutDegree, "max-out-degree", 0, "controls how many related books are linked to a given book, across every recommendation source. The most related ones are followed first and the rest are not followed from that book. Set to 0 to link all of them")
+	cmd.Flags().Int32Var(&config.MaxBooks, "max-books", 0, "stop crawling new books once this many were persisted in the run. Books already being crawled are still persisted and linked. Zero to disable this check")
+	cmd.Flags().DurationVar(&config.MaxDuration, "max-duration", 0, "stop the crawl once it ran for this long, eg 30m, printing the results crawled until then. Like for interrupted crawls, graph formats only include the books already linked, while jsonl lists every book persisted. Books left being crawled are crawled by the next run over the same storage. Set to 0 to disable")
+	cmd.Flags().IntSliceVar(&config.MaxReadAlsoPerDepth, "max-read-also-per-depth", nil, "how many related books to follow from books at each depth, eg 10,5,2 follows 10 from the seed, 5 from the books at depth 1 and 2 from any deeper book. Negative numbers follow all of them. Overrides --max-read-also")
+	cmd.Flags().Int32Var(&config.MinNumRatings, "min-num-ratings", -1, "only persist and follow links for books that have at least this amount of ratings given by users. Set to a negative number to disable this check")
+	cmd.Flags().Int32Var(&config.MaxNumRatings, "max-num-ratings", -1, "only persist and follow links for books that have at most this amount of ratings given by users. Set to a negative number to disable this check")
+	cmd.Flags().Int32Var((*int32)(&config.MinRating), "min-rating", -1, "only persist and follow links for books that have at least this rating. Set to a negative number to disable this check")
+	cmd.Flags().Int32Var((*int32)(&config.MaxRating), "max-rating", -1, "only persist and follow links for books that have at most this rating. Set to a negative number to disable this check")
+	cmd.Flags().Int32Var(&config.MinPublishedYear, "min-year", 0, "only persist and follow links for books published in this year or later. Books without a known publication year are skipped too. Set to 0 to disable this check")
+	cmd.Flags().Int32Var(&config.MaxPublishedYear, "max-year", 0, "only persist and follow links for books published in this year or earlier. Set to 0 to disable this check")
+	cmd.Flags().StringSliceVar(&config.Languages, "language", nil, "only persist and follow links for books whose edition language is one of these, eg English. Can be repeated or comma separated. Books without a known language are skipped too. Empty to disable this check")
+	cmd.Flags().StringSliceVar(&config.IncludeGenres, "include-genre", nil, "only persist and follow links for books with at least one of these genres, eg Science,History. Can be repeated or comma separated, matched case insensitively. Books without genres are skipped too. Empty to disable this check")
+	cmd.Flags().StringSliceVar(&config.ExcludeGenres, "exclude-genre", nil, "do not persist nor follow links for books with any of these genres, eg Romance. Can be repeated or comma separated, matched case insensitively")
+	cmd.Flags().BoolVar(&config.IncludeSeed, "include-seed", true, "persist the seed book. When false the seed is only used as a starting point and the books related to it become the roots of the graph")
+	cmd.Flags().StringSliceVar(&config.RecommendationSources, "recommendation-source", []string{book.SourceAlsoRead}, "which recommendations of each book to follow, also_read for the books members also liked in the similar books page and readers_also_enjoyed for the \"Readers also enjoyed\" books in the book page. Can be repeated or comma separated. Both are capped by --max-read-also and edges are tagged with their source")
+	cmd.Flags().BoolVar(&config.FollowSimilarAuthors, "follow-similar-authors", false, "also follow the top book of authors similar to the author of each book")
+	cmd.Flags().BoolVar(&config.CrawlAuthors, "crawl-authors", false, "also follow the other books in the author page of each book")
+	cmd.Flags().IntVar(&config.MaxAuthorBooks, "max-author-books", 5, "controls how many books to follow from an author page when using --crawl-authors. Set to a negative number to follow all of them")
+	cmd.Flags().BoolVar(&config.CanonicalizeWorks, "canonicalize-works", false, "treat different editions of the same book as a single book, keeping the first edition crawled")
+	cmd.Flags().BoolVar(&config.TrackProvenance, "track-provenance", false, "record on every book which book it was first found from, at which depth and from which seed. Included in the jsonl output and neo4j")
+	cmd.Flags().BoolVar(&config.SkipLinked, "skip-linked", false, "do not descend again into books linked by previous crawls over the same storage. Speeds up adding new seeds, but cannot be used to crawl a previous graph deeper")
+	cmd.Flags().BoolVar(&config.Resume, "resume", false, "trust the books linked by previous crawls over the same storage instead of updating them again, only fetching the books they lead to that are not linked yet. Use it to restart an interrupted crawl with the same depth")
+	cmd.Flags().BoolVar(&config.ContinueOnError, "continue-on-error", false, "keep crawling when a book cannot be fetched even after --max-retries, leaving it out instead of failing the whole crawl. Failed books are crawled again by later crawls over the same storage")
+	cmd.Flags().BoolVar(&config.DryRun, "dry-run", false, "fetch and parse pages as usual, logging the books that would be persisted, but write nothing to the storage and print no results. Use it to check the extraction works before crawling into --neo4j or --sqlite")
+	cmd.Flags().BoolVar(&config.List, "list", false, "treat the url as a goodreads list or shelf and crawl every book in it")
+	cmd.Flags().StringVar(&config.Search, "search", "", "search goodreads for this text and crawl from the top result instead of passing a url")
+	cmd.Flags().IntVar(&config.MaxListBooks, "max-list-books", 100, "when crawling a list, controls how many books from it are crawled. Set to a negative number to crawl all of them")
+	cmd.Flags().IntVarP(&config.MaxParallelism, "parallelism", "p", 10, "controls how requests are alowed in parallel")
+	cmd.Flags().IntVar(&config.MaxConcurrentDepth, "max-concurrent-depth", 0, "limit how many depth levels can be crawled at the same time, making deep crawls use less memory by crawling them in stages. Set to 0 to disable")
+	cmd.Flags().IntVar(&config.StorageConcurrency, "storage-concurrency", 0, "limit how many storage operations run at the same time, independently of --parallelism. With --neo4j keep it at most at the neo4j session pool size (16). Set to 0 to disable")
+	cmd.Flags().BoolVar(&config.Deterministic, "deterministic", false, "crawl sequentially in a fixed order so the same seed always produces the same graph. Much slower, overrides --parallelism")
+	cmd.Flags().IntVar(&config.MaxRetries, "max-retries", 4, "controls how many times the crawler will retry for a given URL")
+	cmd.Flags().IntVar(&config.MaxRedirects, "max-redirects", 10, "controls how many redirects the crawler will follow for a given URL")
+	cmd.Flags().DurationVar(&config.MinRetryWait, "min-retry-wait", 1*time.Second, "minimum time to wait in between retries")
+	cmd.Flags().DurationVar(&config.MaxRetryWait, "max-retry-wait", 15*time.Second, "maximum time to wait in between retries")
+	cmd.Flags().BoolVar(&config.RetryJitter, "retry-jitter", false, "wait a random time in between retries, from --min-retry-wait up to the exponential backoff wait, so requests failing at once do not all retry at once")
+	cmd.Flags().DurationVar(&config.RequestTimeout, "request-timeout", 0, "abort and retry request attempts taking longer than this, including reading the page. Set to 0 to wait indefinitely")
+	cmd.Flags().StringVarP(&config.Output, "output", "o", "", "write the run results to this file instead of stdout, truncating it when it exists. Logs stay on stderr. - is stdout")
+	cmd.Flags().StringVar(&config.Format, "format", "", "print the run results to stdout, or --output, in this format (dot, json, jsonl, graphml, gexf, mermaid, csv). json is the graph with books and edges listed separately, jsonl streams every stored book, one per line and csv is a table of the books, without edges")
+	cmd.Flags().StringVar(&config.Proxy, "proxy", "", "send every request through this proxy, eg http://proxy:3128 or socks5://localhost:1080. Defaults to the proxy set in the HTTP_PROXY and HTTPS_PROXY environment variables")
+	cmd.Flags().StringVar(&config.UserAgent, "user-agent", myhttp.DefaultUserAgent, "User-Agent header sent with every request. robots.txt rules are looked up for it as well")
+	cmd.Flags().BoolVar(&config.RespectRobots, "respect-robots", true, "skip pages disallowed by the robots.txt of goodreads and wait for its crawl delay in between requests")
+	cmd.Flags().StringSliceVar(&config.AllowedHosts, "allowed-host", nil, "only crawl pages on these hosts or their subdomains, eg goodreads.com, skipping links and redirects to anywhere else. Can be repeated or comma separated. Empty to allow every host")
+	cmd.Flags().Float64Var(&config.ThrottleThreshold, "throttle-threshold", myhttp.DefaultThrottleThreshold, "pause all requests once this ratio (0 to 1) of the recent responses were rate limited (403/429). Set to 0 to disable")
+	cmd.Flags().DurationVar(&config.ThrottleMaxPause, "throttle-max-pause", myhttp.DefaultThrottleMaxPause, "maximum time to pause all requests for when being rate limited")
+	cmd.Flags().Float64Var(&config.RateLimit, "rate-limit", 0, "make at most this many requests per second to each host, eg 0.5 for one request every 2 seconds. Set to 0 to disable")
+	cmd.Flags().IntVar(&config.RateBurst, "rate-burst", 1, "how many requests can be made at once before --rate-limit kicks in")
+	cmd.Flags().BoolVar(&config.Dot, "dot", false, "print the run results as a dot file (stdout). Same as --format dot")
+	cmd.Flags().BoolVar(&config.JSON, "json", false, "print the run results as a json graph (stdout). Same as --format json")
+	cmd.Flags().BoolVar(&config.GraphML, "graphml", false, "print the run results as a graphml file (stdout), which Gephi and yEd can load. Same as --format graphml")
+	cmd.Flags().BoolVar(&config.GEXF, "gexf", false, "print the run results as a gexf file (stdout), the native format of Gephi, with typed book attributes and edges weighted by recommendation priority. Same as --format gexf")
+	cmd.Flags().BoolVar(&config.Mermaid, "mermaid", false, "print the run results as a mermaid flowchart (stdout), to be embedded in markdown. Same as --format mermaid")
+	cmd.Flags().BoolVar(&config.CSV, "csv", false, "print the run results as a csv table (stdout) with a row per book, for spreadsheets. Same as --format csv")
+	cmd.Flags().BoolVar(&config.DotStream, "dot-stream", false, "print the graph as a dot file (stdout, or --output) while it is crawled, a line per book and edge as they are persisted, ending it once the crawl is over or interrupted. The dot flags apply, but books are not ranked by depth. Cannot be combined with other outputs")
+	cmd.Flags().StringVar(&config.DotLayout, "dot-layout", dot.LayoutAuto, "graphviz layout engine for the dot output (dot, sfdp, neato, fdp). When not set, sfdp is used for large graphs and dot otherwise")
+	cmd.Flags().BoolVar(&config.DotConcentrate, "dot-concentrate", false, "merge parallel edges in the dot output")
+	cmd.Flags().IntVar(&config.DotMaxEdgePriority, "dot-max-edge-priority", 0, "only draw the top N recommendation edges of each book in the dot output. Set to 0 to draw all of them")
+	cmd.Flags().StringVar(&config.DotNodeTemplate, "dot-node-template", "", `go template rendering the attributes of each node in the dot output, eg 'label={{quote .Title}} URL={{quote .URL}}'. Receives the book and its depth`)
+	cmd.Flags().StringVar(&config.DotEdgeTemplate, "dot-edge-template", "", `go template rendering the attributes of each edge in the dot output, eg 'label={{quote .Priority}}'. Receives the edge and its index`)
+	cmd.Flags().BoolVar(&config.ReportCycles, "report-cycles", false, "after crawling, print to stderr the groups of books that recommend each other in cycles")
+	cmd.Flags().BoolVar(&config.Stats, "stats", false, "after crawling, print to stderr a summary of the graph: how many books, edges and connected components it has, the out degree of books and how many books are at each depth")
+	cmd.Flags().IntVar(&config.PageRank, "pagerank", 0, "after crawling, print to stderr the N books with the highest PageRank, the most central ones in the recommendation graph, along with their score. Set to 0 to disable")
+	cmd.Flags().IntVar(&config.TopRank, "top-rank", 0, "only output the N books with the highest PageRank, and the edges in between them, in the dot, json, graphml, gexf, mermaid and csv outputs. Set to 0 to output all of them")
+	cmd.PersistentFlags().StringVar(&config.MemoryLog, "memory-log", "", "when using the in-memory storage, append every change to this file and replay it on start, so an interrupted crawl can be resumed. The other commands use it as their storage too")
+	cmd.PersistentFlags().BoolVar(&config.Neo4J, "neo4j", false, "use neo4j as storage")
+	cmd.PersistentFlags().StringVar(&config.Neo4JURL, "neo4j-url", "", "neo4j database address. Defaults to $NEO4J_URL or "+neo4j.DefaultURL)
+	cmd.PersistentFlags().StringVar(&config.Neo4JUser, "neo4j-user", "", "user when connecting to the neo4j database. Defaults to $NEO4J_USERNAME")
+	cmd.PersistentFlags().StringVar(&config.Neo4JPassword, "neo4j-password", "", "password when connecting to the neo4j database. Prefer setting $NEO4J_PASSWORD instead, as command line arguments can be seen by other users")
+	cmd.PersistentFlags().StringVar(&config.Neo4JBearerToken, "neo4j-bearer-token", "", "bearer token when connecting to the neo4j database. Prefer setting $NEO4J_BEARER_TOKEN instead")
+	cmd.PersistentFlags().StringVar(&config.SQLite, "sqlite", "", "use a sqlite database file as storage, created when missing. Needs no server")
+	cmd.Flags().StringVar(&config.RawHTMLDir, "raw-html-dir", "", "save the gzipped raw html of every fetched book page to this directory")
+	cmd.Flags().BoolVar(&config.ReducePages, "reduce-pages", false, "only parse the main content of book pages, which uses considerably less memory")
+	cmd.Flags().BoolVar(&config.Progress, "progress", false, "show the crawl counts and rate on a line of the terminal updated in place, with a bar and the time left when using --max-books, instead of logging them every 10 seconds. The line is drawn on stderr, so the logs are used as usual when stderr is not a terminal")
+	cmd.Flags().StringVar(&config.MetricsAddr, "metrics-addr", "", "serve prometheus metrics of the crawl progress at /metrics on this address, eg :9090")
+	cmd.Flags().StringVar(&config.CPUProfile, "cpu-profile", "", "write a pprof cpu profile of the crawl to this file")
+	cmd.Flags().StringVar(&config.MemProfile, "mem-profile", "", "write a pprof memory allocation profile of the crawl to this file")
+	cmd.PersistentFlags().BoolVarP(&config.Verbose, "verbose", "v", false, "be more verbose by logging in debug mode")
+	cmd.PersistentFlags().StringVar(&config.LogFormat, "log-format", "text", "how logs are written: text, or json for one json object per line with the level, ts and msg fields")
+
+	cmd.AddCommand(reextractCommand())
+	cmd.AddCommand(deleteCommand())
+	cmd.AddCommand(recommendCommand())
+	cmd.AddCommand(pathCommand())
 
 	return cmd
 }
 
-func run(cmd *cobra.Command, args []string) {
+// logFormats maps the --log-format values to log formats
+var logFormats = map[string]int{
+	"text": log.TextFormat,
+	"json": log.JSONFormat,
+}
+
+func setupLogging() {
 	log.Level = log.InfoLevel
-	if verbose {
+	if config.Verbose {
 		log.Level = log.DebugLevel
 	}
+	log.Format = logFormats[config.LogFormat]
+}
 
-	crawler := crawler.NewCrawler(
-		crawler.WithMaxDepth(maxDepth),
-		crawler.WithMaxReadAlso(maxReadAlso),
-		crawler.WithMinNumRatings(minNumRatings),
-		crawler.WithMinRating(minRating),
-		crawler.WithMinRating(maxRating),
-		crawler.WithMaxParallelism(maxParallelism),
-		crawler.WithRequestMaxRetries(maxRequestRetries),
-		crawler.WithRequestMinRetryWait(minRequestRetryWait),
-		crawler.WithRequestMaxRetryWait(maxRequestRetryWait),
-	)
-
-	if useNeo4J {
-		storage := neo4j.New(neo4JURL)
-		storage.User = neo4JUser
-		storage.Password = neo4JPassword
-		if err := storage.Initialize(cmd.Context()); err != nil {
-			panic(err)
+// startProgressBar draws the crawl progress on stderr until the returned
+// function is called. Logs go through the bar meanwhile, so they are printed
+// above it
+func startProgressBar(c *crawler.Crawler) func() {
+	bar := progress.NewBar(os.Stderr, c.Counts)
+	bar.Max = config.MaxBooks
+	setLogOutput(bar)
+	bar.Start(250 * time.Millisecond)
+	return func() {
+		bar.Stop()
+		setLogOutput(os.Stderr)
+	}
+}
+
+func setLogOutput(writer io.Writer) {
+	log.DebugLogger.SetOutput(writer)
+	log.InfoLogger.SetOutput(writer)
+	log.WarnLogger.SetOutput(writer)
+	log.ErrorLogger.SetOutput(writer)
+}
+
+// newNeo4JStorage builds the neo4j storage from the flags/config file,
+// falling back to the same environment variables used by the neo4j tooling
+func newNeo4JStorage() *neo4j.Storage {
+	storage := neo4j.New(firstNonEmpty(config.Neo4JURL, os.Getenv("NEO4J_URL"), neo4j.DefaultURL))
+	storage.User = firstNonEmpty(config.Neo4JUser, os.Getenv("NEO4J_USERNAME"))
+	storage.Password = firstNonEmpty(config.Neo4JPassword, os.Getenv("NEO4J_PASSWORD"))
+	storage.BearerToken = firstNonEmpty(config.Neo4JBearerToken, os.Getenv("NEO4J_BEARER_TOKEN"))
+	return storage
+}
+
+// newPersistentStorage builds the storage selected with --neo4j, --sqlite or
+// --memory-log, or returns nil when none was given
+func newPersistentStorage() (storage.Storage, error) {
+	switch {
+	case countTrue(config.Neo4J, config.SQLite != "", config.MemoryLog != "") > 1:
+		return nil, errors.New("only one of --neo4j, --sqlite and --memory-log can be used")
+	case config.Neo4J:
+		return newNeo4JStorage(), nil
+	case config.SQLite != "":
+		return sqlite.New(config.SQLite), nil
+	case config.MemoryLog != "":
+		return &memory.Storage{LogPath: config.MemoryLog}, nil
+	}
+	return nil, nil
+}
+
+func countTrue(values ...bool) int {
+	count := 0
+	for _, value := range values {
+		if value {
+			count++
 		}
-		defer storage.Shutdown(cmd.Context())
-		crawler.Storage = storage
 	}
+	return count
+}
 
-	if err := crawler.Storage.Initialize(cmd.Context()); err != nil {
-		panic(err)
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
 	}
+	return ""
+}
 
-	url := args[0]
+func run(cmd *cobra.Command, args []string) {
+	setupLogging()
 
-	err := crawler.Crawl(cmd.Context(), url)
+	dotOptions, err := newDotOptions()
 	if err != nil {
 		panic(err)
 	}
 
-	rootBook, err := crawler.Storage.GetBook(cmd.Context(), url, 0)
+	options := crawler.ConfigToOptions(config.Config)
+	if config.MetricsAddr != "" {
+		m := metrics.New()
+		stopMetrics, err := serveMetrics(config.MetricsAddr, m)
+		if err != nil {
+			panic(err)
+		}
+		defer stopMetrics()
+		options = append(options, crawler.WithMetrics(m))
+	}
+	showProgress := config.Progress && progress.IsTerminal(os.Stderr)
+	if showProgress {
+		options = append(options, crawler.WithProgressLogs(false))
+	}
+	output, err := openOutput(config.Output)
 	if err != nil {
 		panic(err)
 	}
+	defer closeOutput(output)
 
-	if printDot {
-		log.Infof("printing results as a dot file")
-		graph := book.NewGraph(rootBook)
+	var stream *dot.StreamWriter
+	if config.DotStream {
+		stream = dot.NewStreamWriter(output, dotOptions)
+		options = append(options, crawler.WithGraphListener(stream))
+	}
+	crawler := crawler.NewCrawler(options...)
+
+	persistent, err := newPersistentStorage()
+	if err != nil {
+		panic(err)
+	}
+	if config.DryRun {
+		// dry runs keep their own in-memory storage, so there is no need to
+		// even connect to the persistent one
+		persistent = nil
+	}
+	if persistent != nil {
+		crawler.Storage = persistent
+	}
+
+	if err := crawler.Storage.Initialize(cmd.Context()); err != nil {
+		panic(err)
+	}
+	// shuts down the in-memory storage as well, when not using a persistent one
+	defer func() {
+		if err := crawler.Close(cmd.Context()); err != nil {
+			log.Warnf("failed to close the crawler: %v", err)
+		}
+	}()
+
+	urls := args
+	if config.Search != "" {
+		searchResult, err := crawler.SearchBook(cmd.Context(), config.Search)
 		if err != nil {
 			panic(err)
 		}
-		dot.PrintBookGraph(graph, os.Stdout)
+		log.Infof("crawling from %s, the top search result for %q", searchResult, config.Search)
+		urls = []string{searchResult}
 	}
 
-	if err := crawler.Storage.Shutdown(cmd.Context()); err != nil {
+	// the first SIGINT or SIGTERM stops the crawl and drains it, a second one
+	// kills the process as usual
+	crawlCtx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	stopProgress := func() {}
+	if showProgress {
+		stopProgress = startProgressBar(crawler)
+	}
+	if config.List {
+		err = crawler.CrawlList(crawlCtx, urls[0])
+	} else {
+		err = crawler.CrawlMany(crawlCtx, urls)
+	}
+	stopProgress()
+	interrupted := crawlCtx.Err() != nil && cmd.Context().Err() == nil
+	stop()
+	if interrupted {
+		log.Warnf("interrupted, draining the crawl")
+		drainCtx, cancel := context.WithTimeout(cmd.Context(), drainTimeout)
+		defer cancel()
+		if err := crawler.Drain(drainCtx); err != nil {
+			log.Warnf("failed to drain the crawl, some books may be left being crawled: %v", err)
+		}
+		closeDotStream(stream)
+		if persistent != nil {
+			if err := persistent.Shutdown(cmd.Context()); err != nil {
+				log.Warnf("failed to shutdown the storage: %v", err)
+			}
+		}
+		return
+	}
+	closeDotStream(stream)
+	if stoppedEarly(err) {
+		log.Infof("stopped early: %v", err)
+		err = nil
+	}
+	if err != nil {
 		panic(err)
 	}
+	if failures := crawler.Failures(); failures > 0 {
+		log.Warnf("%d books could not be fetched and were left out, crawl again over the same storage to retry them", failures)
+	}
+	if config.DryRun {
+		log.Infof("dry run finished, nothing was persisted")
+		return
+	}
+
+	rootBooks := []*book.Book{}
+	for _, rootURL := range crawler.RootURLs() {
+		rootBook, err := crawler.Storage.GetBook(cmd.Context(), rootURL, 0)
+		if err != nil {
+			panic(err)
+		}
+		if rootBook != nil {
+			rootBooks = append(rootBooks, rootBook)
+		}
+	}
+
+	if len(rootBooks) == 0 {
+		log.Warnf("no books matched, the crawl did not persist any of the root books")
+	}
+
+	if config.ReportCycles {
+		reportCycles(cmd.ErrOrStderr(), rootBooks)
+	}
+	if config.Stats {
+		reportStats(cmd.ErrOrStderr(), book.ComputeStats(book.NewGraph(rootBooks...)))
+	}
+	if config.PageRank > 0 {
+		reportPageRank(cmd.ErrOrStderr(), book.NewGraph(rootBooks...), config.PageRank)
+	}
+
+	format := config.Format
+	if config.Dot {
+		format = formatDot
+	} else if config.JSON {
+		format = formatJSON
+	} else if config.GraphML {
+		format = formatGraphML
+	} else if config.GEXF {
+		format = formatGEXF
+	} else if config.Mermaid {
+		format = formatMermaid
+	} else if config.CSV {
+		format = formatCSV
+	}
+
+	newGraph := func() book.Graph {
+		graph := book.NewGraph(rootBooks...)
+		if config.TopRank > 0 {
+			graph = book.TopRanked(graph, config.TopRank)
+			log.Infof("only printing the %d books with the highest PageRank", len(graph.All))
+		}
+		return graph
+	}
+
+	switch format {
+	case formatDot:
+		log.Infof("printing results as a dot file")
+		if err := dot.PrintBookGraph(newGraph(), output, dotOptions); err != nil {
+			panic(err)
+		}
+	case formatJSON:
+		log.Infof("printing results as a json graph")
+		if err := book.SaveGraph(newGraph(), output); err != nil {
+			panic(err)
+		}
+	case formatGraphML:
+		log.Infof("printing results as a graphml file")
+		if err := graphml.PrintBookGraph(newGraph(), output); err != nil {
+			panic(err)
+		}
+	case formatGEXF:
+		log.Infof("printing results as a gexf file")
+		if err := gexf.PrintBookGraph(newGraph(), output); err != nil {
+			panic(err)
+		}
+	case formatMermaid:
+		log.Infof("printing results as a mermaid flowchart")
+		if err := mermaid.PrintBookGraph(newGraph(), output); err != nil {
+			panic(err)
+		}
+	case formatCSV:
+		log.Infof("printing results as a csv table")
+		if err := csv.WriteBooks(newGraph().All, output); err != nil {
+			panic(err)
+		}
+	case formatJSONL:
+		log.Infof("printing results as json lines")
+		if err := jsonl.ExportJSONL(cmd.Context(), crawler.Storage, output); err != nil {
+			panic(err)
+		}
+	}
+
+	if persistent != nil {
+		if err := persistent.Shutdown(cmd.Context()); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// openOutput opens where the run results are printed: the given file,
+// truncated, or stdout when the path is empty or -
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file: %w", err)
+	}
+	return file, nil
+}
+
+// closeOutput closes the output once the results were printed. Writes to
+// files can fail only then, eg on a full disk
+func closeOutput(output io.Closer) {
+	if err := output.Close(); err != nil {
+		log.Errorf("failed to write the output file: %v", err)
+	}
+}
+
+// nopCloser keeps stdout open when the output is closed
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// closeDotStream ends the streamed dot file, if any, once nothing else can be
+// added to it
+func closeDotStream(stream *dot.StreamWriter) {
+	if stream == nil {
+		return
+	}
+	if err := stream.Close(); err != nil {
+		log.Warnf("failed to write the dot stream: %v", err)
+	}
+}
+
+// stoppedEarly tells whether the crawl was cut short by --max-duration, in
+// which case the books crawled until then are printed as usual. Runs that also
+// failed for any other reason are not
+func stoppedEarly(err error) bool {
+	if !errors.As(err, &crawler.ErrMaxDuration{}) {
+		return false
+	}
+	errs := []error{err}
+	var joined crawler.Errors
+	if errors.As(err, &joined) {
+		errs = joined
+	}
+	for _, err := range errs {
+		if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+			return false
+		}
+	}
+	return true
+}
+
+func reportCycles(writer io.Writer, rootBooks []*book.Book) {
+	// cycles are components of the graph, so the ones reachable from more than
+	// one root are found again for each of them
+	seen := map[*book.Book]bool{}
+	cycles := [][]*book.Book{}
+	for _, root := range rootBooks {
+		for _, cycle := range book.FindCycles(root) {
+			if seen[cycle[0]] {
+				continue
+			}
+			for _, b := range cycle {
+				seen[b] = true
+			}
+			cycles = append(cycles, cycle)
+		}
+	}
+
+	fmt.Fprintf(writer, "found %d cycles\n", len(cycles))
+	for idx, cycle := range cycles {
+		titles := make([]string, len(cycle))
+		for i, b := range cycle {
+			titles[i] = b.Title
+		}
+		fmt.Fprintf(writer, "%2d. %d books: %s\n", idx+1, len(cycle), strings.Join(titles, ", "))
+	}
+}
+
+func reportStats(writer io.Writer, stats book.Stats) {
+	fmt.Fprintf(writer, "books: %d\n", stats.Books)
+	fmt.Fprintf(writer, "edges: %d\n", stats.Edges)
+	fmt.Fprintf(writer, "connected components: %d\n", stats.Components)
+	fmt.Fprintf(writer, "out degree: %d max, %.2f on average\n", stats.MaxOutDegree, stats.AvgOutDegree)
+	fmt.Fprintf(writer, "books by depth:\n")
+	for depth, books := range stats.BooksByDepth {
+		fmt.Fprintf(writer, "%3d: %d\n", depth, books)
+	}
+}
+
+func reportPageRank(writer io.Writer, graph book.Graph, n int) {
+	books, ranks := book.Ranked(graph)
+	if n < len(books) {
+		books = books[:n]
+	}
+	fmt.Fprintf(writer, "top %d books by pagerank\n", len(books))
+	for idx, b := range books {
+		fmt.Fprintf(writer, "%2d. %.4f %s by %s (%s)\n", idx+1, ranks[b.URL], b.Title, b.Author, b.URL)
+	}
+}
+
+func newDotOptions() (dot.PrintBookGraphOptions, error) {
+	options := dot.DefaultPrintBookGraphOptions()
+	options.Layout = config.DotLayout
+	options.Concentrate = config.DotConcentrate
+	options.MaxEdgePriority = config.DotMaxEdgePriority
+	if config.DotNodeTemplate != "" {
+		t, err := template.New("node").Funcs(dot.TemplateFuncs()).Parse(config.DotNodeTemplate)
+		if err != nil {
+			return options, fmt.Errorf("invalid dot node template: %w", err)
+		}
+		options = options.WithNodeTemplate(t)
+	}
+	if config.DotEdgeTemplate != "" {
+		t, err := template.New("edge").Funcs(dot.TemplateFuncs()).Parse(config.DotEdgeTemplate)
+		if err != nil {
+			return options, fmt.Errorf("invalid dot edge template: %w", err)
+		}
+		options = options.WithEdgeTemplate(t)
+	}
+	return options, nil
 }
 
 func validateArgs(args []string) error {
-	if len(args) != 1 {
-		return errors.New("invalid args: expected a single goodreads book url")
+	switch config.Format {
+	case "", formatDot, formatJSON, formatJSONL, formatGraphML, formatGEXF, formatMermaid, formatCSV:
+	default:
+		return fmt.Errorf("invalid format %q: expected one of %s, %s, %s, %s, %s, %s, %s", config.Format, formatDot, formatJSON, formatJSONL, formatGraphML, formatGEXF, formatMermaid, formatCSV)
 	}
-	bookURL := args[0]
-	if _, err := url.Parse(bookURL); err != nil {
-		return err
+	if countTrue(config.Dot, config.JSON, config.GraphML, config.GEXF, config.Mermaid, config.CSV) > 1 {
+		return errors.New("invalid args: only one of --dot, --json, --graphml, --gexf, --mermaid and --csv can be used")
+	}
+	if config.DotStream && (config.Format != "" || countTrue(config.Dot, config.JSON, config.GraphML, config.GEXF, config.Mermaid, config.CSV) > 0) {
+		return errors.New("invalid args: --dot-stream prints the results already, it cannot be combined with other outputs")
+	}
+	if config.Proxy != "" {
+		if _, err := myhttp.ParseProxy(config.Proxy); err != nil {
+			return err
+		}
+	}
+	if config.Search != "" {
+		if len(args) != 0 || config.List {
+			return errors.New("invalid args: --search cannot be combined with a url or --list")
+		}
+		return nil
+	}
+	if len(args) == 0 {
+		return errors.New("invalid args: expected one or more goodreads book urls, or a single list url")
+	}
+	if config.List && len(args) != 1 {
+		return errors.New("invalid args: --list expects a single list url")
+	}
+	for _, arg := range args {
+		if _, err := url.Parse(arg); err != nil {
+			return err
+		}
 	}
 	return nil
 }
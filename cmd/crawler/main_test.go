@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/crawler"
+)
+
+// TestStoppedEarly checks that only runs stopped by their max duration, and
+// for no other reason, are taken as stopped early
+func TestStoppedEarly(t *testing.T) {
+	maxDuration := crawler.ErrMaxDuration{MaxDuration: time.Minute}
+	failure := errors.New("failed to link books")
+	for _, test := range []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{failure, false},
+		{context.Canceled, false},
+		{maxDuration, true},
+		{fmt.Errorf("crawling: %w", maxDuration), true},
+		{crawler.Errors{maxDuration, context.Canceled}, true},
+		{crawler.Errors{maxDuration, failure}, false},
+		{fmt.Errorf("crawling: %w", crawler.Errors{maxDuration, failure}), false},
+		{crawler.Errors{failure, fmt.Errorf("writing profile: %w", maxDuration)}, false},
+	} {
+		if stoppedEarly(test.err) != test.expected {
+			t.Errorf("%v stopped early: expected %v", test.err, test.expected)
+		}
+	}
+}
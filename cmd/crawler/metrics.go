@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// serveMetrics serves m at /metrics on addr until the returned function is
+// called. Listening is done before returning, so a taken address fails the
+// crawl right away
+func serveMetrics(addr string, m *metrics.Metrics) (func(), error) {
+	registry := prometheus.NewRegistry()
+	if err := m.Register(registry); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Warnf("failed to serve metrics: %v", err)
+		}
+	}()
+	log.Infof("serving metrics at http://%s/metrics", listener.Addr())
+	return func() { server.Close() }, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bcap/book-crawler/book"
+)
+
+func pathCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "path <from-url> <to-url>",
+		Short: "print the shortest chain of also read recommendations leading from a book to another in the stored graph",
+		Args:  cobra.ExactArgs(2),
+		RunE:  shortestPath,
+	}
+}
+
+func shortestPath(cmd *cobra.Command, args []string) error {
+	setupLogging()
+
+	persistent, err := newPersistentStorage()
+	if err != nil {
+		return err
+	}
+	storage, ok := persistent.(fullGraphStorage)
+	if !ok {
+		return errors.New("path requires a persistent storage, use --neo4j, --sqlite or --memory-log")
+	}
+
+	ctx := cmd.Context()
+	if err := storage.Initialize(ctx); err != nil {
+		return err
+	}
+	defer storage.Shutdown(ctx)
+
+	graph, err := storage.GetFullGraph(ctx)
+	if err != nil {
+		return err
+	}
+	byURL := make(map[string]*book.Book, len(graph.All))
+	for _, b := range graph.All {
+		byURL[b.URL] = b
+	}
+	fromURL, toURL := args[0], args[1]
+	from, to := byURL[fromURL], byURL[toURL]
+	if from == nil {
+		return book.ErrNotInGraph{URL: fromURL}
+	}
+	if to == nil {
+		return book.ErrNotInGraph{URL: toURL}
+	}
+
+	path := book.ShortestPath(from, to)
+	if path == nil {
+		return fmt.Errorf("no path from %s to %s", fromURL, toURL)
+	}
+	for idx, b := range path {
+		fmt.Fprintf(cmd.OutOrStdout(), "%2d. %s by %s (%v) %s\n", idx+1, b.Title, b.Author, b.Rating, b.URL)
+	}
+	return nil
+}
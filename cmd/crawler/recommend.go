@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/storage"
+)
+
+var (
+	recommendURL    string
+	recommendLength int
+)
+
+// fullGraphStorage is a storage that can load the whole graph at once
+type fullGraphStorage interface {
+	storage.Storage
+	GetFullGraph(ctx context.Context) (book.Graph, error)
+}
+
+func recommendCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "recommend",
+		Short: "print a reading list starting at a book, walking the stored graph towards well rated and often recommended books",
+		Args:  cobra.NoArgs,
+		RunE:  recommend,
+	}
+	cmd.Flags().StringVar(&recommendURL, "url", "", "url of the book to start the reading list from. Must have been crawled before")
+	cmd.Flags().IntVar(&recommendLength, "length", 10, "how many books to put in the reading list, including the starting one")
+	cmd.MarkFlagRequired("url")
+	return cmd
+}
+
+func recommend(cmd *cobra.Command, args []string) error {
+	setupLogging()
+
+	persistent, err := newPersistentStorage()
+	if err != nil {
+		return err
+	}
+	storage, ok := persistent.(fullGraphStorage)
+	if !ok {
+		return errors.New("recommend requires a persistent storage, use --neo4j, --sqlite or --memory-log")
+	}
+
+	ctx := cmd.Context()
+	if err := storage.Initialize(ctx); err != nil {
+		return err
+	}
+	defer storage.Shutdown(ctx)
+
+	graph, err := storage.GetFullGraph(ctx)
+	if err != nil {
+		return err
+	}
+	path, err := book.RecommendPath(graph, recommendURL, recommendLength)
+	if err != nil {
+		return err
+	}
+	for idx, b := range path {
+		fmt.Fprintf(cmd.OutOrStdout(), "%2d. %s by %s (%v) %s\n", idx+1, b.Title, b.Author, b.Rating, b.URL)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/spf13/cobra"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/html"
+	"github.com/bcap/book-crawler/log"
+)
+
+var reextractHTMLDir string
+
+func reextractCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reextract",
+		Short: "re-run book extraction over raw html saved with --raw-html-dir and update the stored books",
+		Args:  cobra.NoArgs,
+		RunE:  reextract,
+	}
+	cmd.Flags().StringVar(&reextractHTMLDir, "html-dir", "", "directory containing the raw html saved by a previous crawl")
+	cmd.MarkFlagRequired("html-dir")
+	return cmd
+}
+
+func reextract(cmd *cobra.Command, args []string) error {
+	setupLogging()
+
+	storage, err := newPersistentStorage()
+	if err != nil {
+		return err
+	}
+	if storage == nil {
+		return errors.New("reextract requires a persistent storage, use --neo4j, --sqlite or --memory-log")
+	}
+
+	ctx := cmd.Context()
+	if err := storage.Initialize(ctx); err != nil {
+		return err
+	}
+	defer storage.Shutdown(ctx)
+
+	store := html.NewStore(reextractHTMLDir)
+	index, err := store.Index()
+	if err != nil {
+		return err
+	}
+	hashes, err := store.Hashes()
+	if err != nil {
+		return err
+	}
+
+	updated := 0
+	skipped := 0
+	for _, hash := range hashes {
+		url, has := index[hash]
+		if !has {
+			log.Warnf("no url indexed for stored page %s, skipping it", store.Path(hash))
+			skipped++
+			continue
+		}
+
+		existing, err := storage.GetBook(ctx, url, 0)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			log.Debugf("book %s is not stored, skipping it", url)
+			skipped++
+			continue
+		}
+
+		reader, err := store.Open(hash)
+		if err != nil {
+			return err
+		}
+		doc, err := goquery.NewDocumentFromReader(reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+
+		b := book.New(url)
+		book.BuildWith(b, doc, config.Selectors.Selectors)
+		if err := storage.SetBook(ctx, url, b); err != nil {
+			return err
+		}
+		log.Debugf("re-extracted book %s by %s (%s)", b.Title, b.Author, url)
+		updated++
+	}
+
+	log.Infof("re-extracted %d books, skipped %d stored pages", updated, skipped)
+	return nil
+}
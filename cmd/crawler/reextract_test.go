@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage/sqlite"
+)
+
+// TestReextract checks that the reextract command rebuilds the stored books
+// from the raw html saved by a crawl, overwriting what was stored, and leaves
+// their edges in place
+func TestReextract(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(50, 3)
+	defer server.Close()
+	dbPath := filepath.Join(t.TempDir(), "books.db")
+	htmlDir := t.TempDir()
+	seedURL := server.BookURL(1)
+
+	s := sqlite.New(dbPath)
+	if err := s.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c := crawler.NewCrawler(crawler.WithMaxDepth(1), crawler.WithMaxReadAlso(3), crawler.WithRawHTMLStore(htmlDir))
+	c.Storage = s
+	if err := c.Crawl(ctx, seedURL); err != nil {
+		t.Fatal(err)
+	}
+	seed, err := s.GetBook(ctx, seedURL, 1)
+	if err != nil || seed == nil {
+		t.Fatalf("seed persisted (%v)", err)
+	}
+	title, edges := seed.Title, len(seed.AlsoRead)
+	stale := book.New(seedURL)
+	stale.Title = "stale title"
+	if err := s.SetBook(ctx, seedURL, stale); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	loadConfig(t, "--sqlite", dbPath)
+	defer func() { config = cliConfig{Config: crawler.DefaultConfig()} }()
+	cmd := reextractCommand()
+	cmd.SetArgs([]string{"--html-dir", htmlDir})
+	if err := cmd.ExecuteContext(ctx); err != nil {
+		t.Fatalf("reextract succeeded: %v", err)
+	}
+	log.Level = log.ErrorLevel
+
+	s = sqlite.New(dbPath)
+	if err := s.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(ctx)
+	seed, err = s.GetBook(ctx, seedURL, 1)
+	if err != nil || seed == nil {
+		t.Fatalf("seed still stored (%v)", err)
+	}
+	if seed.Title != title || seed.Author == "" {
+		t.Errorf("seed re-extracted from its page (%q by %q, expected %q)", seed.Title, seed.Author, title)
+	}
+	if edges == 0 || len(seed.AlsoRead) != edges {
+		t.Errorf("seed edges kept (%d, expected %d)", len(seed.AlsoRead), edges)
+	}
+}
@@ -0,0 +1,107 @@
+package crawler_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+)
+
+// allowedHostsCrawl returns the urls of the books persisted by host
+func allowedHostsCrawl(t *testing.T, ctx context.Context, seed string, options ...crawler.CrawlerOption) (*crawler.Crawler, map[string][]string) {
+	t.Helper()
+	options = append([]crawler.CrawlerOption{
+		crawler.WithMaxDepth(3),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(10),
+		crawler.WithFollowSimilarAuthors(true),
+	}, options...)
+	c := crawler.NewCrawler(options...)
+	if err := c.Crawl(ctx, seed); err != nil {
+		t.Fatal(err)
+	}
+	byHost := map[string][]string{}
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		parsed, _ := url.Parse(b.URL)
+		byHost[parsed.Hostname()] = append(byHost[parsed.Hostname()], b.URL)
+		return nil
+	})
+	return c, byHost
+}
+
+// TestAllowedHosts checks that the allowed hosts and the url filter keep the
+// allowedHostsCrawl from wandering off: books on other hosts or not passing the filter
+// are skipped without failing the crawl, and books redirecting to other hosts
+// are skipped instead of crawled
+func TestAllowedHosts(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+
+	// book 1 links to book 9, which redirects to the same book on another host
+	// name of the same server
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/book/show/9" {
+			http.Redirect(w, r, server.URL+"/book/show/9", http.StatusMovedPermanently)
+			return
+		}
+		res, err := http.Get(server.URL + r.URL.RequestURI())
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+	defer redirecting.Close()
+	seed := strings.Replace(redirecting.URL, "127.0.0.1", "localhost", 1) + "/book/show/1"
+
+	_, wandering := allowedHostsCrawl(t, ctx, seed)
+	if !(len(wandering["localhost"]) > 1 && len(wandering["127.0.0.1"]) > 0) {
+		t.Errorf("without allowed hosts the crawl wanders off through redirects (%d local, %d off)", len(wandering["localhost"]), len(wandering["127.0.0.1"]))
+	}
+
+	c, guarded := allowedHostsCrawl(t, ctx, seed, crawler.WithAllowedHosts("LOCALHOST"))
+	if !(len(guarded["localhost"]) > 1 && len(guarded["127.0.0.1"]) == 0) {
+		t.Errorf("allowed hosts keep the crawl on them (%d local, %d off)", len(guarded["localhost"]), len(guarded["127.0.0.1"]))
+	}
+	redirected := strings.Replace(seed, "/book/show/1", "/book/show/9", 1)
+	state, err := c.Storage.GetBookState(ctx, redirected)
+	if !(err == nil && state.State == storage.Skipped) {
+		t.Errorf("book redirecting to another host skipped (%v)", state.State)
+	}
+
+	_, elsewhere := allowedHostsCrawl(t, ctx, seed, crawler.WithAllowedHosts("goodreads.com"))
+	if len(elsewhere) != 0 {
+		t.Errorf("seed on another host skipped without failing (%d hosts)", len(elsewhere))
+	}
+
+	_, rejected := allowedHostsCrawl(t, ctx, seed, crawler.WithAllowedHosts("localhost"), crawler.WithURLFilter(func(string) bool { return false }))
+	if len(rejected) != 0 {
+		t.Errorf("url filter applies on top of the allowed hosts (%d hosts)", len(rejected))
+	}
+
+	excluded := strings.Replace(seed, "/book/show/1", "/book/show/10", 1)
+	_, filtered := allowedHostsCrawl(t, ctx, seed, crawler.WithURLFilter(func(u string) bool { return u != excluded }))
+	persistedExcluded := false
+	for _, u := range filtered["localhost"] {
+		persistedExcluded = persistedExcluded || u == excluded
+	}
+	if !(len(filtered["localhost"]) > 1 && !persistedExcluded) {
+		t.Errorf("url filter skips the books it rejects (%d books)", len(filtered["localhost"]))
+	}
+
+}
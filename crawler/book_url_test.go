@@ -0,0 +1,72 @@
+package crawler_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/log"
+)
+
+const pageURL = "https://www.goodreads.com/book/similar/1"
+
+var books = []string{
+	"/book/show/2",
+	"/book/show/3-dune",
+	"/book/show/4.The_Hobbit",
+	"/book/show/5-dune?from_search=true&rank=1",
+	"/book/show/6-dune?ac=1&edition=2",
+	"/en/book/show/7-dune",
+	"/pt-BR/book/show/8",
+	"https://www.goodreads.com/book/show/9-dune/",
+	"//www.goodreads.com/book/show/10",
+}
+
+var notBooks = []string{
+	"/author/show/1.Frank_Herbert",
+	"/series/45935-dune",
+	"/list/show/1.Best_Books_Ever",
+	"/book/show/dune",
+	"/book/show/11/reviews",
+	"/book/similar/12",
+	"/en/author/show/1",
+	"/work/editions/13-dune",
+	"/shelf/show/sci-fi?book=/book/show/14",
+	"mailto:someone@example.com",
+}
+
+// TestBookUrl checks which links the goodreads adapter follows as books: book
+// pages with locale prefixes, slugs and query params must be followed, while
+// links to authors, series, lists and other pages under /book/ must not
+func TestBookUrl(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	for _, link := range books {
+		if len(follow(t, link)) != 1 {
+			t.Errorf("followed %s", link)
+		}
+	}
+	for _, link := range notBooks {
+		if len(follow(t, link)) != 0 {
+			t.Errorf("skipped %s", link)
+		}
+	}
+}
+
+// follow returns what the adapter follows from a related books page with a
+// single link
+func follow(t *testing.T, link string) []string {
+	t.Helper()
+	html := fmt.Sprintf(`<html><body><div class="responsiveMainContentContainer">
+<div class="membersAlsoLikedText">Readers also enjoyed</div>
+<div><a itemprop="url" href="%s">Book</a></div>
+</div></body></html>`, link)
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return (&crawler.GoodreadsAdapter{}).RelatedBookURLs(pageURL, doc)
+}
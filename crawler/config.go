@@ -0,0 +1,170 @@
+package crawler
+
+import (
+	"time"
+
+	"github.com/bcap/book-crawler/book"
+	myhttp "github.com/bcap/book-crawler/http"
+)
+
+// Config holds every crawler setting in a serializable form, so crawls can
+// be described by a config file. Field names match the cli flag names
+type Config struct {
+	MaxDepth       int `yaml:"max-depth"`
+	MaxReadAlso    int `yaml:"max-read-also"`
+	MaxOutDegree   int `yaml:"max-out-degree"`
+	MaxParallelism int `yaml:"parallelism"`
+
+	MaxBooks    int32         `yaml:"max-books"`
+	MaxDuration time.Duration `yaml:"max-duration"`
+
+	MaxReadAlsoPerDepth []int `yaml:"max-read-also-per-depth"`
+
+	Deterministic bool `yaml:"deterministic"`
+
+	MaxConcurrentDepth int `yaml:"max-concurrent-depth"`
+
+	StorageConcurrency int `yaml:"storage-concurrency"`
+
+	MinNumRatings int32       `yaml:"min-num-ratings"`
+	MaxNumRatings int32       `yaml:"max-num-ratings"`
+	MinRating     book.Rating `yaml:"min-rating"`
+	MaxRating     book.Rating `yaml:"max-rating"`
+
+	MinPublishedYear int32 `yaml:"min-year"`
+	MaxPublishedYear int32 `yaml:"max-year"`
+
+	Languages []string `yaml:"language"`
+
+	IncludeGenres []string `yaml:"include-genre"`
+	ExcludeGenres []string `yaml:"exclude-genre"`
+
+	IncludeSeed bool `yaml:"include-seed"`
+
+	RecommendationSources []string `yaml:"recommendation-source"`
+
+	FollowSimilarAuthors bool `yaml:"follow-similar-authors"`
+
+	CrawlAuthors   bool `yaml:"crawl-authors"`
+	MaxAuthorBooks int  `yaml:"max-author-books"`
+
+	MaxListBooks int `yaml:"max-list-books"`
+
+	CanonicalizeWorks bool `yaml:"canonicalize-works"`
+	TrackProvenance   bool `yaml:"track-provenance"`
+	SkipLinked        bool `yaml:"skip-linked"`
+	Resume            bool `yaml:"resume"`
+	DryRun            bool `yaml:"dry-run"`
+	ContinueOnError   bool `yaml:"continue-on-error"`
+
+	MaxRetries   int           `yaml:"max-retries"`
+	MaxRedirects int           `yaml:"max-redirects"`
+	MinRetryWait time.Duration `yaml:"min-retry-wait"`
+	MaxRetryWait time.Duration `yaml:"max-retry-wait"`
+	RetryJitter  bool          `yaml:"retry-jitter"`
+
+	RequestTimeout time.Duration `yaml:"request-timeout"`
+
+	Proxy string `yaml:"proxy"`
+
+	UserAgent     string `yaml:"user-agent"`
+	RespectRobots bool   `yaml:"respect-robots"`
+
+	AllowedHosts []string `yaml:"allowed-host"`
+
+	ThrottleThreshold float64       `yaml:"throttle-threshold"`
+	ThrottleMaxPause  time.Duration `yaml:"throttle-max-pause"`
+
+	RateLimit float64 `yaml:"rate-limit"`
+	RateBurst int     `yaml:"rate-burst"`
+
+	// Selectors can only be set from config files. Selectors missing from
+	// them keep their default
+	Selectors Selectors `yaml:"selectors"`
+
+	RawHTMLDir  string `yaml:"raw-html-dir"`
+	ReducePages bool   `yaml:"reduce-pages"`
+	CPUProfile  string `yaml:"cpu-profile"`
+	MemProfile  string `yaml:"mem-profile"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxDepth:       3,
+		MaxReadAlso:    5,
+		MaxParallelism: 1,
+		MinNumRatings:  -1,
+		MaxNumRatings:  -1,
+		MinRating:      -1,
+		MaxRating:      -1,
+		IncludeSeed:    true,
+		MaxListBooks:   -1,
+		MaxAuthorBooks: 5,
+		MaxRetries:     4,
+		MaxRedirects:   10,
+		MinRetryWait:   1 * time.Second,
+		MaxRetryWait:   30 * time.Second,
+		UserAgent:      myhttp.DefaultUserAgent,
+		RespectRobots:  true,
+
+		ThrottleThreshold: myhttp.DefaultThrottleThreshold,
+		ThrottleMaxPause:  myhttp.DefaultThrottleMaxPause,
+		RateBurst:         1,
+
+		Selectors: DefaultSelectors(),
+	}
+}
+
+func ConfigToOptions(config Config) []CrawlerOption {
+	return []CrawlerOption{
+		WithMaxDepth(config.MaxDepth),
+		WithMaxReadAlso(config.MaxReadAlso),
+		WithMaxOutDegree(config.MaxOutDegree),
+		WithMaxBooks(config.MaxBooks),
+		WithMaxDuration(config.MaxDuration),
+		WithMaxReadAlsoByDepth(MaxReadAlsoSchedule(config.MaxReadAlsoPerDepth)),
+		WithMaxParallelism(config.MaxParallelism),
+		WithMaxConcurrentDepth(config.MaxConcurrentDepth),
+		WithStorageConcurrency(config.StorageConcurrency),
+		WithMinNumRatings(config.MinNumRatings),
+		WithMaxNumRatings(config.MaxNumRatings),
+		WithMinRating(config.MinRating),
+		WithMaxRating(config.MaxRating),
+		WithMinPublishedYear(config.MinPublishedYear),
+		WithMaxPublishedYear(config.MaxPublishedYear),
+		WithLanguages(config.Languages...),
+		WithIncludeGenres(config.IncludeGenres...),
+		WithExcludeGenres(config.ExcludeGenres...),
+		WithIncludeSeed(config.IncludeSeed),
+		WithRecommendationSources(config.RecommendationSources...),
+		WithFollowSimilarAuthors(config.FollowSimilarAuthors),
+		WithCrawlAuthors(config.CrawlAuthors),
+		WithMaxAuthorBooks(config.MaxAuthorBooks),
+		WithMaxListBooks(config.MaxListBooks),
+		WithCanonicalizeWorks(config.CanonicalizeWorks),
+		WithTrackProvenance(config.TrackProvenance),
+		WithSkipLinked(config.SkipLinked),
+		WithResume(config.Resume),
+		WithDryRun(config.DryRun),
+		WithContinueOnError(config.ContinueOnError),
+		WithRequestMaxRetries(config.MaxRetries),
+		WithRequestMaxRedirects(config.MaxRedirects),
+		WithRequestMinRetryWait(config.MinRetryWait),
+		WithRequestMaxRetryWait(config.MaxRetryWait),
+		WithRetryJitter(config.RetryJitter),
+		WithRequestTimeout(config.RequestTimeout),
+		WithProxy(config.Proxy),
+		WithUserAgent(config.UserAgent),
+		WithRespectRobots(config.RespectRobots),
+		WithAllowedHosts(config.AllowedHosts...),
+		WithThrottle(config.ThrottleThreshold, config.ThrottleMaxPause),
+		WithRateLimit(config.RateLimit, config.RateBurst),
+		WithSelectors(config.Selectors),
+		WithRawHTMLStore(config.RawHTMLDir),
+		WithReducedPages(config.ReducePages),
+		WithCPUProfile(config.CPUProfile),
+		WithMemProfile(config.MemProfile),
+		// last, as it overrides the parallelism
+		WithDeterministic(config.Deterministic),
+	}
+}
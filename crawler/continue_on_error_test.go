@@ -0,0 +1,184 @@
+package crawler_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+)
+
+func continueOnErrorNewCrawler(options ...crawler.CrawlerOption) *crawler.Crawler {
+	options = append([]crawler.CrawlerOption{
+		crawler.WithMaxDepth(2),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithRequestMaxRetries(1),
+		crawler.WithRequestMinRetryWait(time.Millisecond),
+		crawler.WithRequestMaxRetryWait(time.Millisecond),
+	}, options...)
+	return crawler.NewCrawler(options...)
+}
+
+// flakyServer proxies books, failing path with a 500 while broken is 1
+func flakyServer(t *testing.T, books *fixture.Server, path string, broken *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == path && atomic.LoadInt32(broken) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		res, err := http.Get(books.URL + r.URL.RequestURI())
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+}
+
+func state(t *testing.T, ctx context.Context, s storage.Storage, url string) storage.State {
+	t.Helper()
+	change, err := s.GetBookState(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return change.State
+}
+
+// TestContinueOnError checks that a book failing to be fetched after retrying
+// fails the whole crawl by default, while with continue on error it is moved
+// to Failed and counted, the rest of the graph is crawled and linked without
+// it, the books related to it are left crawled but not linked, deleted books
+// are still skipped, and a later crawl fetches the failed book again and
+// links it
+func TestContinueOnError(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	books := fixture.NewServer(100, 3)
+	defer books.Close()
+	books.Missing = map[int]bool{10: true}
+
+	// book 1 links to books 8, 9 and 10, and book 9 keeps erroring while broken
+	var broken int32 = 1
+	server := flakyServer(t, books, "/book/show/9", &broken)
+	defer server.Close()
+	url := func(id int) string {
+		return fmt.Sprintf("%s/book/show/%d", server.URL, id)
+	}
+
+	c := continueOnErrorNewCrawler()
+	err := c.Crawl(ctx, url(1))
+	if !(err != nil && strings.Contains(err.Error(), "/book/show/9")) {
+		t.Errorf("failing book fails the crawl by default: %v", err)
+	}
+
+	c = continueOnErrorNewCrawler(crawler.WithContinueOnError(true))
+	err = c.Crawl(ctx, url(1))
+	if err != nil {
+		t.Errorf("crawl continues past the failing book: %v", err)
+	}
+	if state(t, ctx, c.Storage, url(9)) != storage.Failed {
+		t.Errorf("failing book moved to Failed (%v)", state(t, ctx, c.Storage, url(9)))
+	}
+	if state(t, ctx, c.Storage, url(10)) != storage.Skipped {
+		t.Errorf("deleted book still skipped (%v)", state(t, ctx, c.Storage, url(10)))
+	}
+	if c.Failures() != 1 {
+		t.Errorf("failures counted (%d)", c.Failures())
+	}
+	seed, err := c.Storage.GetBook(ctx, url(1), 1)
+	linked := []string{}
+	for _, edge := range seed.AlsoRead {
+		linked = append(linked, edge.To.URL)
+	}
+	if !(err == nil && len(linked) == 1 && linked[0] == url(8)) {
+		t.Errorf("seed linked to the books crawled: %v", linked)
+	}
+	if state(t, ctx, c.Storage, url(57)) != storage.Linked {
+		t.Errorf("books below the others crawled (%v)", state(t, ctx, c.Storage, url(57)))
+	}
+	if !(state(t, ctx, c.Storage, url(1)) == storage.Crawled && state(t, ctx, c.Storage, url(8)) == storage.Linked) {
+		t.Errorf("book related to the failing one left crawled but not linked (%v)", state(t, ctx, c.Storage, url(1)))
+	}
+
+	// the next crawl over the same storage fetches the failed book again
+	atomic.StoreInt32(&broken, 0)
+	again := continueOnErrorNewCrawler(crawler.WithContinueOnError(true))
+	again.Storage = c.Storage
+	err = again.Crawl(ctx, url(1))
+	seed, _ = again.Storage.GetBook(ctx, url(1), 1)
+	linked = linked[:0]
+	for _, edge := range seed.AlsoRead {
+		linked = append(linked, edge.To.URL)
+	}
+	if !(err == nil && state(t, ctx, again.Storage, url(9)) == storage.Linked && again.Failures() == 0) {
+		t.Errorf("failed book crawled by a later crawl (%v): %v", state(t, ctx, again.Storage, url(9)), err)
+	}
+	if strings.Join(linked, " ") != url(8)+" "+url(9) {
+		t.Errorf("seed linked to the failed book once crawled: %v", linked)
+	}
+}
+
+// TestContinueOnErrorRelatedPage checks that a page listing the books related to
+// a book failing to be fetched fails the whole crawl by default, while with
+// continue on error the book is left crawled but not linked, and a later crawl
+// follows the books related to it
+func TestContinueOnErrorRelatedPage(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	books := fixture.NewServer(100, 3)
+	defer books.Close()
+
+	// book 1 links to books 8, 9 and 10, and the books similar to 8 keep erroring
+	// while broken
+	var broken int32 = 1
+	server := flakyServer(t, books, "/book/similar/8", &broken)
+	defer server.Close()
+	url := func(id int) string {
+		return fmt.Sprintf("%s/book/show/%d", server.URL, id)
+	}
+
+	c := continueOnErrorNewCrawler()
+	err := c.Crawl(ctx, url(1))
+	if !(err != nil && strings.Contains(err.Error(), "/book/similar/8")) {
+		t.Errorf("failing page fails the crawl by default: %v", err)
+	}
+
+	c = continueOnErrorNewCrawler(crawler.WithContinueOnError(true))
+	err = c.Crawl(ctx, url(1))
+	if err != nil {
+		t.Errorf("crawl continues past the failing page: %v", err)
+	}
+	if state(t, ctx, c.Storage, url(8)) != storage.Crawled {
+		t.Errorf("book with the failing page left crawled (%v)", state(t, ctx, c.Storage, url(8)))
+	}
+	if state(t, ctx, c.Storage, url(1)) != storage.Linked {
+		t.Errorf("books above it still linked (%v)", state(t, ctx, c.Storage, url(1)))
+	}
+	if c.Failures() != 0 {
+		t.Errorf("no book failed (%d)", c.Failures())
+	}
+
+	// the next crawl over the same storage follows the books related to it
+	atomic.StoreInt32(&broken, 0)
+	again := continueOnErrorNewCrawler(crawler.WithContinueOnError(true))
+	again.Storage = c.Storage
+	err = again.Crawl(ctx, url(1))
+	related, _ := again.Storage.GetBook(ctx, url(8), 1)
+	if !(err == nil && state(t, ctx, again.Storage, url(8)) == storage.Linked && related != nil && len(related.AlsoRead) > 0) {
+		t.Errorf("book linked by a later crawl (%v): %v", state(t, ctx, again.Storage, url(8)), err)
+	}
+}
@@ -0,0 +1,161 @@
+package crawler_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+)
+
+type result struct {
+	books       int
+	authorEdges int
+	maxPerBook  int
+	otherAuthor int
+	duplicates  int
+	selfEdges   int
+}
+
+func authorsCrawl(t *testing.T, ctx context.Context, server *fixture.Server, options ...crawler.CrawlerOption) result {
+	t.Helper()
+	options = append([]crawler.CrawlerOption{
+		crawler.WithMaxDepth(2),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(10),
+	}, options...)
+	c := crawler.NewCrawler(options...)
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	byURL := map[string]*book.Book{}
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		byURL[b.URL] = b
+		return nil
+	})
+	r := result{books: len(byURL)}
+	for _, b := range byURL {
+		perBook := 0
+		linked := map[string]bool{}
+		for _, edge := range b.AlsoRead {
+			if linked[edge.To.URL] {
+				r.duplicates++
+			}
+			linked[edge.To.URL] = true
+			if edge.To.URL == b.URL {
+				r.selfEdges++
+			}
+			if edge.Source != book.SourceAuthor {
+				continue
+			}
+			r.authorEdges++
+			perBook++
+			if to := byURL[edge.To.URL]; to == nil || to.AuthorURL != b.AuthorURL {
+				r.otherAuthor++
+			}
+		}
+		if perBook > r.maxPerBook {
+			r.maxPerBook = perBook
+		}
+	}
+	return r
+}
+
+// TestCrawlAuthors checks that crawling authors follows other books by the
+// author of each book, up to the max author books, links them with author
+// edges and never links a book twice to the same book nor to itself
+func TestCrawlAuthors(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	// 8 books by each of the 50 authors
+	server := fixture.NewServer(400, 3)
+	defer server.Close()
+
+	plain := authorsCrawl(t, ctx, server)
+	if plain.authorEdges != 0 {
+		t.Errorf("not crawling authors: no author edges (%d)", plain.authorEdges)
+	}
+
+	authors := authorsCrawl(t, ctx, server, crawler.WithCrawlAuthors(true), crawler.WithMaxAuthorBooks(3))
+	if authors.books <= plain.books {
+		t.Errorf("crawling authors: more books crawled (%d, %d without)", authors.books, plain.books)
+	}
+	if authors.authorEdges <= 0 {
+		t.Errorf("crawling authors: author edges (%d)", authors.authorEdges)
+	}
+	if authors.maxPerBook != 3 {
+		t.Errorf("crawling authors: at most the max author books per book (%d)", authors.maxPerBook)
+	}
+	if authors.otherAuthor != 0 {
+		t.Errorf("crawling authors: edges only to books by the same author (%d not)", authors.otherAuthor)
+	}
+	if authors.duplicates != 0 {
+		t.Errorf("crawling authors: no book linked twice to the same book (%d)", authors.duplicates)
+	}
+	if authors.selfEdges != 0 {
+		t.Errorf("crawling authors: no book linked to itself (%d)", authors.selfEdges)
+	}
+
+	all := authorsCrawl(t, ctx, server, crawler.WithCrawlAuthors(true), crawler.WithMaxAuthorBooks(-1))
+	if all.maxPerBook != 7 {
+		t.Errorf("negative max author books: every other book by the author (%d)", all.maxPerBook)
+	}
+	if !(all.duplicates == 0 && all.selfEdges == 0 && all.otherAuthor == 0) {
+		t.Errorf("negative max author books: edges still deduped (%d, %d, %d)", all.duplicates, all.selfEdges, all.otherAuthor)
+	}
+}
+
+// TestCrawlAuthorsPageCache checks that the page of an author is fetched once
+// per run, however many of their books are crawled
+func TestCrawlAuthorsPageCache(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(400, 3)
+	defer server.Close()
+
+	var mutex sync.Mutex
+	authorFetches := map[string]int{}
+	fetcher := crawler.HTTPFetcher{Client: myhttp.NewClient(semaphore.NewWeighted(10), nil)}
+	counting := crawler.FetcherFunc(func(ctx context.Context, pageURL string) (*goquery.Document, error) {
+		if strings.Contains(pageURL, "/author/show/") {
+			mutex.Lock()
+			authorFetches[pageURL]++
+			mutex.Unlock()
+		}
+		return fetcher.Fetch(ctx, pageURL)
+	})
+
+	for run := 0; run < 2; run++ {
+		authorFetches = map[string]int{}
+		c := crawler.NewCrawler(
+			crawler.WithMaxDepth(2),
+			crawler.WithMaxReadAlso(3),
+			crawler.WithMaxParallelism(1),
+			crawler.WithCrawlAuthors(true),
+			crawler.WithMaxAuthorBooks(3),
+			crawler.WithFetcher(counting),
+		)
+		if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+			t.Fatal(err)
+		}
+		if len(authorFetches) == 0 {
+			t.Errorf("run %d: author pages fetched", run)
+		}
+		for url, fetches := range authorFetches {
+			if fetches != 1 {
+				t.Errorf("run %d: author page %s fetched once (%d times)", run, url, fetches)
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package crawler_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+// BenchmarkCrawl crawls a synthetic graph of interlinked book pages served by
+// an in-process http server, once for every parallelism level. Combine with
+// -cpuprofile/-memprofile to find bottlenecks in the hot paths
+func BenchmarkCrawl(b *testing.B) {
+	const numBooks = 500
+	const numLinks = 5
+	const maxDepth = 4
+
+	log.Level = log.WarnLevel
+
+	server := fixture.NewServer(numBooks, numLinks)
+	defer server.Close()
+
+	for _, parallelism := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("parallelism-%d", parallelism), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c := crawler.NewCrawler(
+					crawler.WithMaxDepth(maxDepth),
+					crawler.WithMaxReadAlso(numLinks),
+					crawler.WithMaxParallelism(parallelism),
+					crawler.WithRequestMaxRetries(0),
+				)
+				if err := c.Crawl(context.Background(), server.BookURL(0)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package crawler_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+const cancelNumBooks = 1000
+const cancelNumLinks = 5
+const cancelParallelism = 8
+const cancelPageDelay = 200 * time.Millisecond
+const cancelCancelAfter = 1 * time.Second
+const gracePeriod = 1 * time.Second
+
+// TestCrawlCancel checks that cancelling the context given to Crawl promptly
+// stops the whole crawl: Crawl must return a context error shortly after the
+// cancellation, no goroutines can be left behind and the parallelism
+// semaphore must be fully released
+func TestCrawlCancel(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	server := fixture.NewServer(cancelNumBooks, cancelNumLinks)
+	server.Delay = cancelPageDelay
+	defer server.Close()
+
+	goroutinesBefore := runtime.NumGoroutine()
+
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(10),
+		crawler.WithMaxReadAlso(cancelNumLinks),
+		crawler.WithMaxParallelism(cancelParallelism),
+		crawler.WithRequestMaxRetries(0),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(cancelCancelAfter, cancel)
+
+	start := time.Now()
+	err := c.Crawl(ctx, server.BookURL(0))
+	cancelledFor := time.Since(start) - cancelCancelAfter
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Crawl returned a context error: %v", err)
+	}
+	if cancelledFor >= gracePeriod {
+		t.Errorf("Crawl returned %v after cancellation (grace period: %v)", cancelledFor, gracePeriod)
+	}
+
+	ok := c.Client.ParallelismSem.TryAcquire(cancelParallelism)
+	if !ok {
+		t.Errorf("parallelism semaphore fully released")
+	} else {
+		c.Client.ParallelismSem.Release(cancelParallelism)
+	}
+
+	// give goroutines that are already finishing a chance to exit
+	server.CloseClientConnections()
+	goroutinesAfter := runtime.NumGoroutine()
+	for deadline := time.Now().Add(gracePeriod); goroutinesAfter > goroutinesBefore && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		goroutinesAfter = runtime.NumGoroutine()
+	}
+	if goroutinesAfter > goroutinesBefore {
+		t.Errorf("no leaked goroutines (before: %d, after: %d)", goroutinesBefore, goroutinesAfter)
+	}
+
+}
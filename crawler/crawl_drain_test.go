@@ -0,0 +1,135 @@
+package crawler_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+	"github.com/bcap/book-crawler/storage/memory"
+)
+
+const drainNumBooks = 300
+const drainNumLinks = 3
+const drainMaxDepth = 4
+const drainParallelism = 8
+const drainPageDelay = 100 * time.Millisecond
+const drainCancelAfter = 500 * time.Millisecond
+
+func drainNewCrawler(s storage.Storage) *crawler.Crawler {
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(drainMaxDepth),
+		crawler.WithMaxReadAlso(drainNumLinks),
+		crawler.WithMaxParallelism(drainParallelism),
+		crawler.WithRequestMaxRetries(0),
+	)
+	c.Storage = s
+	return c
+}
+
+func countStates(t *testing.T, ctx context.Context, s storage.Storage, server *fixture.Server) map[storage.State]int {
+	t.Helper()
+	urls := make([]string, drainNumBooks)
+	for id := range urls {
+		urls[id] = server.BookURL(id)
+	}
+	states, err := s.GetBookStates(ctx, urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[storage.State]int{}
+	for _, stateChange := range states {
+		counts[stateChange.State]++
+	}
+	return counts
+}
+
+func drainCountBooks(ctx context.Context, s storage.Storage) int {
+	count := 0
+	s.GetAllBooks(ctx, func(*book.Book) error {
+		count++
+		return nil
+	})
+	return count
+}
+
+// TestCrawlDrain checks Crawler.Drain: a cancelled crawl leaves books in
+// BeingCrawled, which Drain moves back to NotCrawled, and a later crawl over
+// the same storage then ends up with the same books as an uninterrupted one.
+// Draining while still crawling gives up once its context is done
+func TestCrawlDrain(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	fast := fixture.NewServer(drainNumBooks, drainNumLinks)
+	defer fast.Close()
+	full := &memory.Storage{}
+	full.Initialize(ctx)
+	if err := drainNewCrawler(full).Crawl(ctx, fast.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	expected := drainCountBooks(ctx, full)
+
+	server := fixture.NewServer(drainNumBooks, drainNumLinks)
+	server.Delay = drainPageDelay
+	defer server.Close()
+	s := &memory.Storage{}
+	s.Initialize(ctx)
+	c := drainNewCrawler(s)
+
+	// draining while still crawling gives up
+	crawlCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- c.Crawl(crawlCtx, server.BookURL(1)) }()
+	time.Sleep(drainCancelAfter)
+	drainCtx, cancelDrain := context.WithTimeout(ctx, 50*time.Millisecond)
+	err := c.Drain(drainCtx)
+	cancelDrain()
+	if err == nil {
+		t.Errorf("drain while crawling gives up: %v", err)
+	}
+
+	cancel()
+	crawlErr := <-done
+	if crawlErr == nil {
+		t.Errorf("cancelled crawl returned an error: %v", crawlErr)
+	}
+	before := countStates(t, ctx, s, server)
+	if before[storage.BeingCrawled] <= 0 {
+		t.Errorf("cancelled crawl left books being crawled (%d)", before[storage.BeingCrawled])
+	}
+
+	err = c.Drain(ctx)
+	after := countStates(t, ctx, s, server)
+	if err != nil {
+		t.Errorf("drain succeeded: %v", err)
+	}
+	if after[storage.BeingCrawled] != 0 {
+		t.Errorf("no books left being crawled after draining (%d)", after[storage.BeingCrawled])
+	}
+	if after[storage.Crawled] != before[storage.Crawled] {
+		t.Errorf("crawled books untouched (%d before, %d after)", before[storage.Crawled], after[storage.Crawled])
+	}
+
+	err = drainNewCrawler(s).Crawl(ctx, server.BookURL(1))
+	resumed := drainCountBooks(ctx, s)
+	final := countStates(t, ctx, s, server)
+	if err != nil {
+		t.Errorf("crawl after draining succeeded: %v", err)
+	}
+	if resumed != expected {
+		t.Errorf("resumed crawl has every book (%d, expected %d)", resumed, expected)
+	}
+	if final[storage.BeingCrawled] != 0 {
+		t.Errorf("no books left being crawled at the end (%d)", final[storage.BeingCrawled])
+	}
+
+	if drainNewCrawler(s).Drain(ctx) != nil {
+		t.Errorf("draining a crawler that never ran does nothing")
+	}
+
+}
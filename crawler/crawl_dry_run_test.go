@@ -0,0 +1,115 @@
+package crawler_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+	"github.com/bcap/book-crawler/storage/memory"
+)
+
+// writeCountingStorage counts the writes reaching the storage
+type writeCountingStorage struct {
+	storage.Storage
+	writes int32
+}
+
+func (s *writeCountingStorage) SetBookState(ctx context.Context, url string, previous storage.StateChange, new storage.State) (storage.StateChange, bool, error) {
+	atomic.AddInt32(&s.writes, 1)
+	return s.Storage.SetBookState(ctx, url, previous, new)
+}
+
+func (s *writeCountingStorage) SetBook(ctx context.Context, url string, b *book.Book) error {
+	atomic.AddInt32(&s.writes, 1)
+	return s.Storage.SetBook(ctx, url, b)
+}
+
+func (s *writeCountingStorage) LinkBook(ctx context.Context, url string, related string, priority int) error {
+	atomic.AddInt32(&s.writes, 1)
+	return s.Storage.LinkBook(ctx, url, related, priority)
+}
+
+func (s *writeCountingStorage) LinkBookWithSource(ctx context.Context, url string, related string, priority int, source string) error {
+	atomic.AddInt32(&s.writes, 1)
+	return s.Storage.LinkBookWithSource(ctx, url, related, priority, source)
+}
+
+func dryRunNewStorage() *writeCountingStorage {
+	memoryStorage := &memory.Storage{}
+	memoryStorage.Initialize(context.Background())
+	return &writeCountingStorage{Storage: memoryStorage}
+}
+
+// TestCrawlDryRun checks that a dry run crawl writes nothing to the storage
+// while still walking the same books a regular crawl persists, logging each
+// of them once, and that every dry run starts from scratch
+func TestCrawlDryRun(t *testing.T) {
+	ctx := context.Background()
+	server := fixture.NewServer(200, 3)
+	defer server.Close()
+
+	options := []crawler.CrawlerOption{
+		crawler.WithMaxDepth(3),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(10),
+		crawler.WithMinRating(book.NewRating(2)),
+	}
+
+	regular := crawler.NewCrawler(options...)
+	if err := regular.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	persisted := 0
+	regular.Storage.GetAllBooks(ctx, func(*book.Book) error {
+		persisted++
+		return nil
+	})
+
+	var logs bytes.Buffer
+	log.Level = log.InfoLevel
+	log.InfoLogger.SetOutput(&logs)
+
+	dryRun := crawler.NewCrawler(append(options, crawler.WithDryRun(true))...)
+	counting := dryRunNewStorage()
+	dryRun.Storage = counting
+	if err := dryRun.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&counting.writes) != 0 {
+		t.Errorf("nothing written to the storage (%d writes)", counting.writes)
+	}
+	stored := 0
+	counting.GetAllBooks(ctx, func(*book.Book) error {
+		stored++
+		return nil
+	})
+	if stored != 0 {
+		t.Errorf("no books in the storage (%d)", stored)
+	}
+
+	wouldPersist := strings.Count(logs.String(), "dry run: would persist book")
+	if !(persisted > 1 && wouldPersist == persisted) {
+		t.Errorf("logged the %d books a regular crawl persists (%d)", persisted, wouldPersist)
+	}
+
+	// a second dry run does not see the books of the first one
+	logs.Reset()
+	if err := dryRun.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	wouldPersist = strings.Count(logs.String(), "dry run: would persist book")
+	if wouldPersist != persisted {
+		t.Errorf("dry runs start from scratch (%d books logged again)", wouldPersist)
+	}
+	if atomic.LoadInt32(&counting.writes) != 0 {
+		t.Errorf("still nothing written to the storage (%d writes)", counting.writes)
+	}
+
+}
@@ -0,0 +1,99 @@
+package crawler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+const fanoutNumBooks = 2000
+const fanoutNumLinks = 8
+const fanoutMaxDepth = 4
+
+var schedule = []int{6, 3, 1}
+
+// TestCrawlFanout checks that WithMaxReadAlsoByDepth caps how many related
+// books are followed from books at each depth: no book links to more books
+// than the cap at the depth it was crawled at, the cap is reached at every
+// depth, and books past the end of the schedule use its last cap
+func TestCrawlFanout(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(fanoutNumBooks, fanoutNumLinks)
+	defer server.Close()
+
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(fanoutMaxDepth),
+		crawler.WithMaxReadAlso(fanoutNumLinks),
+		crawler.WithMaxReadAlsoByDepth(crawler.MaxReadAlsoSchedule(schedule)),
+		crawler.WithMaxParallelism(10),
+		crawler.WithTrackProvenance(true),
+	)
+	crawlErr := c.Crawl(ctx, server.BookURL(1))
+
+	if crawlErr != nil {
+		t.Errorf("Crawl succeeded: %v", crawlErr)
+	}
+
+	// the highest out degree seen at each depth
+	maxOutDegree := make([]int, fanoutMaxDepth+1)
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		if len(b.AlsoRead) > maxOutDegree[b.DiscoveredDepth] {
+			maxOutDegree[b.DiscoveredDepth] = len(b.AlsoRead)
+		}
+		return nil
+	})
+	for depth := 0; depth < fanoutMaxDepth; depth++ {
+		expected := schedule[len(schedule)-1]
+		if depth < len(schedule) {
+			expected = schedule[depth]
+		}
+		if maxOutDegree[depth] != expected {
+			t.Errorf("books at depth %d link to at most %d books (got %d)", depth, expected, maxOutDegree[depth])
+		}
+	}
+	if maxOutDegree[fanoutMaxDepth] != 0 {
+		t.Errorf("books at the max depth are not followed (got %d)", maxOutDegree[fanoutMaxDepth])
+	}
+}
+
+// TestCrawlFanoutUnlimited checks that a negative max read also, either for
+// every depth or for some depth in the schedule, follows every related book
+// from every recommendation source
+func TestCrawlFanoutUnlimited(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(100, fanoutNumLinks)
+	defer server.Close()
+
+	options := map[string]crawler.CrawlerOption{
+		"max read also":  crawler.WithMaxReadAlso(-1),
+		"depth schedule": crawler.WithMaxReadAlsoByDepth(crawler.MaxReadAlsoSchedule([]int{-1})),
+	}
+	for name, option := range options {
+		c := crawler.NewCrawler(
+			crawler.WithMaxDepth(1),
+			option,
+			crawler.WithRecommendationSources(book.SourceAlsoRead, book.SourceReadersAlsoEnjoyed),
+		)
+		err := c.Crawl(ctx, server.BookURL(1))
+		seed, _ := c.Storage.GetBook(ctx, server.BookURL(1), 1)
+		sources := map[string]int{}
+		if seed != nil {
+			for _, edge := range seed.AlsoRead {
+				sources[edge.Source]++
+			}
+		}
+		// book 1 is similar to books 7 to 14, and its readers also enjoyed books
+		// 11 to 18, the ones in both kept as also read
+		if !(err == nil && sources[book.SourceAlsoRead] == fanoutNumLinks && sources[book.SourceReadersAlsoEnjoyed] == 4) {
+			t.Errorf("%s: every related book followed (%v): %v", name, sources, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package crawler_test
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+const listNumBooks = 25
+const listID = 5
+
+// listCrawl crawls only the books in the fixture list, taking up to
+// maxListBooks of them, and returns the persisted urls and the roots
+func listCrawl(t *testing.T, server *fixture.Server, maxListBooks int) ([]string, []string) {
+	t.Helper()
+	ctx := context.Background()
+	c := crawler.NewCrawler(crawler.WithMaxDepth(0), crawler.WithMaxListBooks(maxListBooks))
+	if err := c.CrawlList(ctx, server.ListURL(listID)); err != nil {
+		t.Fatalf("crawl from the list succeeded: %v", err)
+	}
+	persisted := []string{}
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		persisted = append(persisted, b.URL)
+		return nil
+	})
+	sort.Strings(persisted)
+	roots := c.RootURLs()
+	sort.Strings(roots)
+	return persisted, roots
+}
+
+// listURLs is the sorted urls of the books from first up to last, inclusive
+func listURLs(server *fixture.Server, first int, last int) []string {
+	urls := []string{}
+	for id := first; id <= last; id++ {
+		urls = append(urls, server.BookURL(id))
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// TestCrawlList checks that CrawlList follows the next page links of a list
+// and seeds the crawl with every book in it, and that WithMaxListBooks takes
+// only the first books of the list, even when the cap ends in a later page
+func TestCrawlList(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	server := fixture.NewServer(listNumBooks, 3)
+	defer server.Close()
+	if listNumBooks-listID <= fixture.ListPageSize {
+		t.Fatalf("the list spans more than one page")
+	}
+
+	persisted, roots := listCrawl(t, server, -1)
+	expected := listURLs(server, listID, listNumBooks-1)
+	if strings.Join(persisted, " ") != strings.Join(expected, " ") {
+		t.Errorf("every book in the list crawled (%d of %d books)", len(persisted), len(expected))
+	}
+	if strings.Join(roots, " ") != strings.Join(expected, " ") {
+		t.Errorf("every book in the list is a root (%d of %d roots)", len(roots), len(expected))
+	}
+
+	maxListBooks := fixture.ListPageSize + 5
+	persisted, roots = listCrawl(t, server, maxListBooks)
+	expected = listURLs(server, listID, listID+maxListBooks-1)
+	if strings.Join(persisted, " ") != strings.Join(expected, " ") {
+		t.Errorf("the first %d books in the list crawled (%v)", maxListBooks, persisted)
+	}
+	if strings.Join(roots, " ") != strings.Join(expected, " ") {
+		t.Errorf("the first %d books in the list are roots (%v)", maxListBooks, roots)
+	}
+}
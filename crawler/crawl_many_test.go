@@ -0,0 +1,142 @@
+package crawler_test
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+	"github.com/bcap/book-crawler/storage/memory"
+)
+
+const manyNumBooks = 300
+const manyNumLinks = 3
+const manyMaxDepth = 3
+
+var seeds = []int{1, 2, 150}
+
+// manyCountingStorage counts how many times each book is persisted
+type manyCountingStorage struct {
+	storage.Storage
+	mutex sync.Mutex
+	sets  map[string]int
+}
+
+func (s *manyCountingStorage) SetBook(ctx context.Context, url string, b *book.Book) error {
+	s.mutex.Lock()
+	s.sets[url]++
+	s.mutex.Unlock()
+	return s.Storage.SetBook(ctx, url, b)
+}
+
+func manyNewCrawler(s storage.Storage) *crawler.Crawler {
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(manyMaxDepth),
+		crawler.WithMaxReadAlso(manyNumLinks),
+		crawler.WithMaxParallelism(10),
+	)
+	c.Storage = s
+	return c
+}
+
+// edges lists every book, and every edge as "from -> to", in url order
+func edges(ctx context.Context, s storage.Storage, into map[string]struct{}) {
+	s.GetAllBooks(ctx, func(b *book.Book) error {
+		into[b.URL] = struct{}{}
+		for _, edge := range b.AlsoRead {
+			into[b.URL+" -> "+edge.To.URL] = struct{}{}
+		}
+		return nil
+	})
+}
+
+func describe(set map[string]struct{}) string {
+	lines := make([]string, 0, len(set))
+	for line := range set {
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// TestCrawlMany checks Crawler.CrawlMany: crawling several seeds in one run
+// persists every book once, even the ones reachable from more than one seed,
+// gives the same books and edges as crawling each seed into its own storage,
+// and keeps every seed as a root
+func TestCrawlMany(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(manyNumBooks, manyNumLinks)
+	defer server.Close()
+	urls := make([]string, len(seeds))
+	for idx, seed := range seeds {
+		urls[idx] = server.BookURL(seed)
+	}
+
+	// every seed crawled on its own, into its own storage
+	separate := map[string]struct{}{}
+	overlap := map[string]int{}
+	for _, url := range urls {
+		s := &memory.Storage{}
+		s.Initialize(ctx)
+		if err := manyNewCrawler(s).Crawl(ctx, url); err != nil {
+			t.Fatalf("crawl from %s succeeded: %v", url, err)
+		}
+		books := map[string]struct{}{}
+		edges(ctx, s, books)
+		for key := range books {
+			separate[key] = struct{}{}
+			if !strings.Contains(key, " -> ") {
+				overlap[key]++
+			}
+		}
+	}
+	shared := 0
+	for _, seen := range overlap {
+		if seen > 1 {
+			shared++
+		}
+	}
+	if shared <= 0 {
+		t.Errorf("seeds reach common books (%d shared)", shared)
+	}
+
+	s := &manyCountingStorage{Storage: &memory.Storage{}, sets: map[string]int{}}
+	s.Initialize(ctx)
+	c := manyNewCrawler(s)
+	err := c.CrawlMany(ctx, urls)
+	if err != nil {
+		t.Errorf("crawl from all seeds succeeded: %v", err)
+	}
+
+	recrawled := 0
+	for _, sets := range s.sets {
+		if sets > 1 {
+			recrawled++
+		}
+	}
+	if recrawled != 0 {
+		t.Errorf("every book persisted once (%d books, %d more than once)", len(s.sets), recrawled)
+	}
+
+	together := map[string]struct{}{}
+	edges(ctx, s, together)
+	if describe(together) != describe(separate) {
+		t.Errorf("same books and edges as separate crawls (%d books and edges)", len(together))
+	}
+
+	roots := c.RootURLs()
+	sort.Strings(roots)
+	sort.Strings(urls)
+	if strings.Join(roots, " ") != strings.Join(urls, " ") {
+		t.Errorf("every seed is a root: %v", roots)
+	}
+
+}
@@ -0,0 +1,96 @@
+package crawler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+)
+
+const redirectNumBooks = 200
+const redirectNumLinks = 3
+const redirectMaxDepth = 3
+
+// TestCrawlRedirect checks that books redirecting to another book, like
+// goodreads books merged into others, are stored under the url they redirect
+// to: the redirecting url must be recorded as merged and never persisted nor
+// linked to, books linking to it must link to the book it redirects to
+// instead, and a redirecting seed must be replaced by its target as root
+func TestCrawlRedirect(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(redirectNumBooks, redirectNumLinks)
+	defer server.Close()
+	redirectedID := 8 // directly related to the seed
+	targetID := 50
+	server.Redirects = map[int]int{redirectedID: targetID, 2: 1}
+	redirectedURL := server.BookURL(redirectedID)
+	targetURL := server.BookURL(targetID)
+	seedURL := server.BookURL(1)
+
+	for _, deterministic := range []bool{true, false} {
+		mode := "parallel"
+		if deterministic {
+			mode = "deterministic"
+		}
+		c := crawler.NewCrawler(
+			crawler.WithMaxDepth(redirectMaxDepth),
+			crawler.WithMaxReadAlso(redirectNumLinks),
+			crawler.WithMaxParallelism(10),
+			crawler.WithDeterministic(deterministic),
+		)
+		err := c.Crawl(ctx, seedURL)
+		if err != nil {
+			t.Errorf("%s: Crawl succeeded: %v", mode, err)
+		}
+
+		state, err := c.Storage.GetBookState(ctx, redirectedURL)
+		if !(err == nil && state.State == storage.Merged) {
+			t.Errorf("%s: redirecting book recorded as merged (state: %v, err: %v)", mode, state.State, err)
+		}
+
+		redirected, err := c.Storage.GetBook(ctx, redirectedURL, 0)
+		if !(err == nil && redirected == nil) {
+			t.Errorf("%s: redirecting book not persisted", mode)
+		}
+
+		linked := false
+		c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+			for _, edge := range b.AlsoRead {
+				linked = linked || edge.To.URL == redirectedURL
+			}
+			return nil
+		})
+		if linked {
+			t.Errorf("%s: no book links to the redirecting book", mode)
+		}
+
+		seed, err := c.Storage.GetBook(ctx, seedURL, 0)
+		linksTarget := false
+		if err == nil && seed != nil {
+			for _, edge := range seed.AlsoRead {
+				linksTarget = linksTarget || edge.To.URL == targetURL
+			}
+		}
+		if !linksTarget {
+			t.Errorf("%s: seed links to the book it redirects to instead", mode)
+		}
+	}
+
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(redirectMaxDepth),
+		crawler.WithMaxReadAlso(redirectNumLinks),
+		crawler.WithDeterministic(true),
+	)
+	err := c.Crawl(ctx, server.BookURL(2))
+	roots := c.RootURLs()
+	if !(err == nil && len(roots) == 1 && roots[0] == seedURL) {
+		t.Errorf("redirecting seed replaced by its target as root (roots: %v, err: %v)", roots, err)
+	}
+
+}
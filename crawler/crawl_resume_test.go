@@ -0,0 +1,171 @@
+package crawler_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+	"github.com/bcap/book-crawler/storage/memory"
+)
+
+const resumeNumBooks = 100
+const resumeNumLinks = 3
+// resumeMaxDepth reaches every book, as with a shallower limit which books are
+// crawled depends on the depth each is first reached at, which varies between
+// parallel crawls
+const resumeMaxDepth = resumeNumBooks
+const resumeParallelism = 8
+
+// resumeCountingStorage records which books are persisted and which have their
+// state changed
+type resumeCountingStorage struct {
+	storage.Storage
+	mutex   sync.Mutex
+	sets    map[string]int
+	touched map[string]int
+}
+
+func resumeNewStorage(ctx context.Context) *resumeCountingStorage {
+	s := &resumeCountingStorage{Storage: &memory.Storage{}}
+	s.Initialize(ctx)
+	s.reset()
+	return s
+}
+
+func (s *resumeCountingStorage) reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sets = map[string]int{}
+	s.touched = map[string]int{}
+}
+
+func (s *resumeCountingStorage) SetBook(ctx context.Context, url string, b *book.Book) error {
+	s.mutex.Lock()
+	s.sets[url]++
+	s.mutex.Unlock()
+	return s.Storage.SetBook(ctx, url, b)
+}
+
+func (s *resumeCountingStorage) SetBookState(ctx context.Context, url string, previous storage.StateChange, new storage.State) (storage.StateChange, bool, error) {
+	s.mutex.Lock()
+	s.touched[url]++
+	s.mutex.Unlock()
+	return s.Storage.SetBookState(ctx, url, previous, new)
+}
+
+func resumeCrawl(ctx context.Context, s storage.Storage, server *fixture.Server, depth int, resume bool) (*crawler.Crawler, error) {
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(depth),
+		crawler.WithMaxReadAlso(resumeNumLinks),
+		crawler.WithMaxParallelism(resumeParallelism),
+		crawler.WithRequestMaxRetries(0),
+		crawler.WithResume(resume),
+	)
+	c.Storage = s
+	return c, c.Crawl(ctx, server.BookURL(1))
+}
+
+// persisted returns the books stored, with the time of their last state change
+func persisted(ctx context.Context, s storage.Storage) map[string]time.Time {
+	books := map[string]time.Time{}
+	s.GetAllBooks(ctx, func(b *book.Book) error {
+		stateChange, err := s.GetBookState(ctx, b.URL)
+		if err != nil {
+			return err
+		}
+		books[b.URL] = stateChange.When
+		return nil
+	})
+	return books
+}
+
+// TestCrawlResume checks WithResume: a resumed crawl neither persists nor
+// changes the state of books linked by previous runs, and restarting a
+// cancelled and drained crawl with it ends with the same books as an
+// uninterrupted crawl
+func TestCrawlResume(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(resumeNumBooks, resumeNumLinks)
+	defer server.Close()
+
+	full := resumeNewStorage(ctx)
+	if _, err := resumeCrawl(ctx, full, server, resumeMaxDepth, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := persisted(ctx, full)
+
+	// a finished crawl resumed
+	s := resumeNewStorage(ctx)
+	if _, err := resumeCrawl(ctx, s, server, resumeMaxDepth, false); err != nil {
+		t.Fatal(err)
+	}
+	before := persisted(ctx, s)
+	s.reset()
+	_, err := resumeCrawl(ctx, s, server, resumeMaxDepth, true)
+	if err != nil {
+		t.Errorf("resumed crawl succeeded: %v", err)
+	}
+	after := persisted(ctx, s)
+
+	repersisted, retouched, changed := 0, 0, 0
+	for url, when := range before {
+		repersisted += s.sets[url]
+		retouched += s.touched[url]
+		if !after[url].Equal(when) {
+			changed++
+		}
+	}
+	if repersisted != 0 {
+		t.Errorf("previously linked books not persisted again (%d times)", repersisted)
+	}
+	if !(retouched == 0 && changed == 0) {
+		t.Errorf("previously linked books untouched (%d state changes, %d changed)", retouched, changed)
+	}
+	if len(after) != len(expected) {
+		t.Errorf("resumed crawl has every book (%d, expected %d)", len(after), len(expected))
+	}
+
+	// without resuming, previously linked books are touched again
+	s.reset()
+	resumeCrawl(ctx, s, server, resumeMaxDepth, false)
+	retouched = 0
+	for url := range before {
+		retouched += s.touched[url]
+	}
+	if retouched <= 0 {
+		t.Errorf("without it previously linked books are touched again (%d state changes)", retouched)
+	}
+
+	// an interrupted crawl, drained and resumed
+	slow := fixture.NewServer(resumeNumBooks, resumeNumLinks)
+	slow.Delay = 50 * time.Millisecond
+	defer slow.Close()
+	s = resumeNewStorage(ctx)
+	cancelCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(300*time.Millisecond, cancel)
+	c, err := resumeCrawl(cancelCtx, s, slow, resumeMaxDepth, false)
+	if err == nil {
+		t.Errorf("interrupted crawl returned an error: %v", err)
+	}
+	if err := c.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	interrupted := len(persisted(ctx, s))
+	_, err = resumeCrawl(ctx, s, slow, resumeMaxDepth, true)
+	resumed := len(persisted(ctx, s))
+	if err != nil {
+		t.Errorf("restarted crawl succeeded: %v", err)
+	}
+	if resumed != len(expected) {
+		t.Errorf("restarted crawl has every book (%d after the interruption, %d after resuming, expected %d)", interrupted, resumed, len(expected))
+	}
+
+}
@@ -0,0 +1,104 @@
+package crawler_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+	"github.com/bcap/book-crawler/storage/memory"
+)
+
+const skipLinkedNumBooks = 500
+const skipLinkedNumLinks = 3
+const skipLinkedMaxDepth = 3
+
+// TestCrawlSkipLinked checks WithSkipLinked when adding a new seed to an
+// existing graph: books linked by the previous crawl must not be descended
+// into again, while new books must still be linked to them. Without the
+// option, previously linked books must still be descended into
+func TestCrawlSkipLinked(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(skipLinkedNumBooks, skipLinkedNumLinks)
+	defer server.Close()
+
+	count := func(s storage.Storage) int {
+		books := 0
+		s.GetAllBooks(ctx, func(*book.Book) error {
+			books++
+			return nil
+		})
+		return books
+	}
+
+	crawl := func(s storage.Storage, seed int, depth int, skipLinked bool) error {
+		c := crawler.NewCrawler(
+			crawler.WithMaxDepth(depth),
+			crawler.WithMaxReadAlso(skipLinkedNumLinks),
+			crawler.WithMaxParallelism(10),
+			crawler.WithSkipLinked(skipLinked),
+		)
+		c.Storage = s
+		return c.Crawl(ctx, server.BookURL(seed))
+	}
+
+	s := &skipLinkedCountingStorage{Storage: &memory.Storage{}}
+	s.Initialize(ctx)
+	err := crawl(s, 1, skipLinkedMaxDepth, false)
+	if err != nil {
+		t.Errorf("first crawl succeeded: %v", err)
+	}
+	before := count(s)
+
+	// book 144 is not part of the first graph, but links to 9, 10 and 11, the
+	// first two being linked by the first crawl
+	atomic.StoreInt64(&s.getBooks, 0)
+	err = crawl(s, 144, skipLinkedMaxDepth, true)
+	if err != nil {
+		t.Errorf("crawl from a new seed succeeded: %v", err)
+	}
+	if atomic.LoadInt64(&s.getBooks) != 0 {
+		t.Errorf("previously linked books not descended into (%d loaded)", atomic.LoadInt64(&s.getBooks))
+	}
+	seed, err := s.GetBook(ctx, server.BookURL(144), 0)
+	linked := false
+	if err == nil && seed != nil {
+		for _, edge := range seed.AlsoRead {
+			linked = linked || edge.To.URL == server.BookURL(9)
+		}
+	}
+	if !linked {
+		t.Errorf("new seed linked to a previously linked book")
+	}
+	if count(s) <= before {
+		t.Errorf("new books crawled (%d before, %d after)", before, count(s))
+	}
+
+	s = &skipLinkedCountingStorage{Storage: &memory.Storage{}}
+	s.Initialize(ctx)
+	crawl(s, 1, skipLinkedMaxDepth, false)
+	atomic.StoreInt64(&s.getBooks, 0)
+	err = crawl(s, 144, skipLinkedMaxDepth, false)
+	if !(err == nil && atomic.LoadInt64(&s.getBooks) > 0) {
+		t.Errorf("without it previously linked books are descended into (%d loaded): %v", atomic.LoadInt64(&s.getBooks), err)
+	}
+
+}
+
+// skipLinkedCountingStorage counts how many times books are loaded, which happens for
+// every previously linked book descended into
+type skipLinkedCountingStorage struct {
+	storage.Storage
+	getBooks int64
+}
+
+func (s *skipLinkedCountingStorage) GetBook(ctx context.Context, url string, maxDepth int) (*book.Book, error) {
+	atomic.AddInt64(&s.getBooks, 1)
+	return s.Storage.GetBook(ctx, url, maxDepth)
+}
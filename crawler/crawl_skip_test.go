@@ -0,0 +1,75 @@
+package crawler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+)
+
+const skipNumBooks = 200
+const skipNumLinks = 3
+const skipMaxDepth = 4
+
+// TestCrawlSkip checks that a book answering with a 404 is skipped instead of
+// aborting the crawl: Crawl must succeed, the missing book must be recorded
+// as skipped and never linked to, and the rest of the graph must still be
+// crawled
+func TestCrawlSkip(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(skipNumBooks, skipNumLinks)
+	defer server.Close()
+	missingID := 8 // directly related to the seed
+	server.Missing = map[int]bool{missingID: true}
+	missingURL := server.BookURL(missingID)
+	seedURL := server.BookURL(1)
+
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(skipMaxDepth),
+		crawler.WithMaxReadAlso(skipNumLinks),
+		crawler.WithDeterministic(true),
+	)
+	crawlErr := c.Crawl(ctx, seedURL)
+
+	if crawlErr != nil {
+		t.Errorf("Crawl succeeded: %v", crawlErr)
+	}
+
+	state, err := c.Storage.GetBookState(ctx, missingURL)
+	if !(err == nil && state.State == storage.Skipped) {
+		t.Errorf("missing book recorded as skipped (state: %v, err: %v)", state.State, err)
+	}
+
+	missing, err := c.Storage.GetBook(ctx, missingURL, 0)
+	if !(err == nil && missing == nil) {
+		t.Errorf("missing book not persisted")
+	}
+
+	linked := false
+	crawled := 0
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		crawled++
+		for _, edge := range b.AlsoRead {
+			linked = linked || edge.To.URL == missingURL
+		}
+		return nil
+	})
+	if linked {
+		t.Errorf("no book links to the missing book")
+	}
+
+	seed, err := c.Storage.GetBook(ctx, seedURL, 0)
+	if !(err == nil && seed != nil && len(seed.AlsoRead) == skipNumLinks-1) {
+		t.Errorf("seed linked to its other related books")
+	}
+	if crawled <= skipNumLinks {
+		t.Errorf("rest of the graph crawled (%d books)", crawled)
+	}
+
+}
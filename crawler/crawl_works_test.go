@@ -0,0 +1,117 @@
+package crawler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+)
+
+const worksNumBooks = 200
+const worksNumLinks = 3
+const numWorks = 30
+const worksMaxDepth = 4
+
+// TestCrawlWorks checks that editions of the same work are merged when
+// canonicalizing works: every persisted book must stand for a different work,
+// editions merged away must be recorded as such and never linked to, and
+// books must not end up linking to themselves through another edition.
+// Without canonicalization the same fixture must persist several editions of
+// the same work
+func TestCrawlWorks(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(worksNumBooks, worksNumLinks)
+	defer server.Close()
+	server.Works = numWorks
+
+	for _, deterministic := range []bool{true, false} {
+		mode := "parallel"
+		if deterministic {
+			mode = "deterministic"
+		}
+		c := crawler.NewCrawler(
+			crawler.WithMaxDepth(worksMaxDepth),
+			crawler.WithMaxReadAlso(worksNumLinks),
+			crawler.WithMaxParallelism(10),
+			crawler.WithDeterministic(deterministic),
+			crawler.WithCanonicalizeWorks(true),
+		)
+		err := c.Crawl(ctx, server.BookURL(1))
+		if err != nil {
+			t.Errorf("%s: Crawl succeeded: %v", mode, err)
+		}
+		checkCanonical(t, ctx, mode, c.Storage, server)
+	}
+
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(worksMaxDepth),
+		crawler.WithMaxReadAlso(worksNumLinks),
+		crawler.WithDeterministic(true),
+	)
+	err := c.Crawl(ctx, server.BookURL(1))
+	if err != nil {
+		t.Errorf("not canonicalizing: Crawl succeeded: %v", err)
+	}
+	books, works := 0, map[string]struct{}{}
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		books++
+		works[b.WorkURL] = struct{}{}
+		return nil
+	})
+	if books <= len(works) {
+		t.Errorf("not canonicalizing: editions kept apart (%d books, %d works)", books, len(works))
+	}
+
+}
+
+func checkCanonical(t *testing.T, ctx context.Context, mode string, s storage.Storage, server *fixture.Server) {
+	persisted := map[string]struct{}{}
+	works := map[string]string{}
+	var edges []book.Edge
+	duplicated := 0
+	s.GetAllBooks(ctx, func(b *book.Book) error {
+		persisted[b.URL] = struct{}{}
+		if _, has := works[b.WorkURL]; has || b.WorkURL == "" {
+			duplicated++
+		}
+		works[b.WorkURL] = b.URL
+		edges = append(edges, b.AlsoRead...)
+		return nil
+	})
+	if !(duplicated == 0 && len(persisted) > 1) {
+		t.Errorf("%s: every book is a different work (%d books)", mode, len(persisted))
+	}
+
+	dangling, selfLinks := 0, 0
+	for _, edge := range edges {
+		if _, has := persisted[edge.To.URL]; !has {
+			dangling++
+		}
+		if edge.To.URL == edge.From.URL {
+			selfLinks++
+		}
+	}
+	if dangling != 0 {
+		t.Errorf("%s: no book links to a merged edition (%d links do)", mode, dangling)
+	}
+	if selfLinks != 0 {
+		t.Errorf("%s: no book links to itself (%d links do)", mode, selfLinks)
+	}
+
+	merged := 0
+	for id := 0; id < worksNumBooks; id++ {
+		state, err := s.GetBookState(ctx, server.BookURL(id))
+		if err == nil && state.State == storage.Merged {
+			merged++
+		}
+	}
+	if merged <= 0 {
+		t.Errorf("%s: merged editions recorded as merged (%d books)", mode, merged)
+	}
+}
@@ -1,49 +1,269 @@
 package crawler
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	urllib "net/url"
+	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 
 	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/html"
 	myhttp "github.com/bcap/book-crawler/http"
 	"github.com/bcap/book-crawler/log"
 	"github.com/bcap/book-crawler/storage"
 )
 
 func (c *Crawler) Crawl(ctx context.Context, url string) error {
+	return c.CrawlMany(ctx, []string{url})
+}
+
+// CrawlMany crawls from several seeds into the same graph. Seeds are crawled
+// in parallel, sharing the parallelism limit, and books reachable from more
+// than one seed are crawled once and linked from all of them
+func (c *Crawler) CrawlMany(ctx context.Context, urls []string) error {
+	return c.run(ctx, func(ctx context.Context) error {
+		return c.crawlSeeds(ctx, urls)
+	})
+}
+
+// CrawlList crawls every book found in a goodreads list or shelf, following
+// the list pagination. Each book in the list is handled as a seed
+func (c *Crawler) CrawlList(ctx context.Context, listURL string) error {
+	return c.run(ctx, func(ctx context.Context) error {
+		urls, err := c.extractListBookURLs(ctx, listURL)
+		if err != nil {
+			return err
+		}
+		log.Infof("found %d books in list %s", len(urls), listURL)
+		return c.crawlSeeds(ctx, urls)
+	})
+}
+
+func (c *Crawler) run(ctx context.Context, fn func(context.Context) error) error {
+	parentCtx := ctx
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	if c.maxDuration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.maxDuration)
+		defer cancel()
+	}
 
 	if !c.runLock.TryLock() {
 		return errors.New("Crawl cannot be called concurrently")
 	}
+	// running is closed only after the lock is released, so Drain and Close
+	// are never refused once the crawl is seen stopped
+	running := make(chan struct{})
+	defer close(running)
 	defer c.runLock.Unlock()
+	c.runningMutex.Lock()
+	c.running = running
+	c.runningMutex.Unlock()
 
+	// storage backends timestamp states with the wall clock, so that is what
+	// tells the states changed in this run apart
 	c.start = time.Now()
+	c.startProgress = progress{at: c.clock.Now(), crawled: atomic.LoadInt32(c.crawled)}
+	c.progress = c.startProgress
+	c.roots = nil
+	c.rootsSet = map[string]struct{}{}
+	c.inFlight = &sync.Map{}
+	c.unpersisted = &sync.Map{}
+	c.failures = &sync.Map{}
+	c.incomplete = &sync.Map{}
+	c.works = &sync.Map{}
+	c.aliases = &sync.Map{}
+	c.seeds = &sync.Map{}
+	c.resumed = &sync.Map{}
+	c.authorBooks = &sync.Map{}
+	c.outDegrees = &sync.Map{}
+	c.reserved = 0
+	c.pending = 0
+	c.reservedCond = sync.NewCond(&sync.Mutex{})
+	c.maxBooksReached = &sync.Once{}
+	c.storage = c.Storage
+	if c.dryRun {
+		c.storage = newDryRunStorage()
+		log.Infof("dry run, nothing will be persisted")
+	}
+	if c.storageConcurrency > 0 {
+		c.storage = &limitedStorage{Storage: c.storage, sem: semaphore.NewWeighted(int64(c.storageConcurrency))}
+	}
 
 	log.Infof(
 		"Crawling up at most %d books in parallel, up to depth %d and following up to %d book recommendations per book",
 		c.maxParallelism, c.maxDepth, c.maxReadAlso,
 	)
 
-	go c.keepLoggingProgress(ctx)
-
-	err := c.crawl(ctx, url, 0, 0)
+	stopCPUProfile, err := c.startCPUProfile()
 	if err != nil {
 		return err
 	}
+	defer stopCPUProfile()
+
+	if c.progressLogs {
+		go c.keepLoggingProgress(ctx)
+	}
+
+	err = fn(ctx)
+	errs := []error{}
+	// books failing to be fetched once out of time may not fail the run, so it
+	// is the context that tells whether the run was cut short
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && parentCtx.Err() == nil {
+		log.Warnf("reached the max duration of %s, stopping the crawl", c.maxDuration)
+		errs = append(errs, ErrMaxDuration{MaxDuration: c.maxDuration})
+		// errors of running out of time are what ErrMaxDuration stands for
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			errs = append(errs, err)
+		}
+		if reset, err := c.resetBeingCrawled(parentCtx); err != nil {
+			errs = append(errs, err)
+		} else {
+			log.Infof("%d books left being crawled can be crawled again", reset)
+		}
+	} else if err != nil {
+		errs = append(errs, err)
+	}
 
 	c.logProgress()
+	if err := c.writeMemProfile(); err != nil {
+		errs = append(errs, err)
+	}
+	return joinErrors(errs...)
+}
+
+// Close releases what the crawler holds once it is no longer needed: the idle
+// connections and the cache of its Client, and the in-memory storage it
+// created unless Storage was replaced. Storages set by callers are theirs to
+// shut down. Programs embedding the crawler should defer Close, and Drain
+// first when the crawl was cancelled
+func (c *Crawler) Close(ctx context.Context) error {
+	if !c.runLock.TryLock() {
+		return errors.New("Close cannot be called while crawling")
+	}
+	defer c.runLock.Unlock()
+
+	err := c.Client.Close()
+	if c.ownStorage != nil && c.Storage == c.ownStorage {
+		if shutdownErr := c.ownStorage.Shutdown(ctx); err == nil {
+			err = shutdownErr
+		}
+	}
+	c.ownStorage = nil
+	return err
+}
+
+// Drain cleans up after a cancelled crawl: it waits for the crawl to stop and
+// moves the books it left in BeingCrawled back to NotCrawled, so a later crawl
+// over the same storage picks them up again. ctx bounds the whole drain. When
+// it is done before the crawl stops nothing is reset, as those books may still
+// be handled
+func (c *Crawler) Drain(ctx context.Context) error {
+	c.runningMutex.Lock()
+	running := c.running
+	c.runningMutex.Unlock()
+	if running == nil {
+		return nil
+	}
+	select {
+	case <-running:
+	case <-ctx.Done():
+		return fmt.Errorf("crawl did not stop in time to be drained: %w", ctx.Err())
+	}
+
+	if !c.runLock.TryLock() {
+		return errors.New("Drain cannot be called while crawling")
+	}
+	defer c.runLock.Unlock()
+
+	reset, err := c.resetBeingCrawled(ctx)
+	if err != nil {
+		return err
+	}
+	log.Infof("drained the crawl, %d books left being crawled can be crawled again", reset)
 	return nil
 }
 
+// resetBeingCrawled moves the books the last run left in BeingCrawled back to
+// NotCrawled, returning how many were moved. The run must be over
+func (c *Crawler) resetBeingCrawled(ctx context.Context) (int, error) {
+	// every book moved to BeingCrawled in the last run has an in flight
+	// channel
+	urls := []string{}
+	c.inFlight.Range(func(url, _ any) bool {
+		urls = append(urls, url.(string))
+		return true
+	})
+	stateChanges, err := c.storage.GetBookStates(ctx, urls)
+	if err != nil {
+		return 0, err
+	}
+	reset := 0
+	for url, stateChange := range stateChanges {
+		if stateChange.State != storage.BeingCrawled {
+			continue
+		}
+		if _, set, err := c.storage.SetBookState(ctx, url, stateChange, storage.NotCrawled); err != nil {
+			return 0, err
+		} else if set {
+			reset++
+		}
+	}
+	return reset, nil
+}
+
+func (c *Crawler) crawlSeeds(ctx context.Context, urls []string) error {
+	if c.includeSeed {
+		c.addRoots(urls)
+	}
+	return c.forEachURL(ctx, urls, func(ctx context.Context, idx int, url string) error {
+		return c.crawl(ctx, url, "", 0, idx)
+	})
+}
+
+// RootURLs returns the urls of the books that act as roots of the last crawl.
+// These are the seed urls unless the crawler was configured to not include
+// seeds, in which case the books directly related to the seeds are returned
+// instead
+func (c *Crawler) RootURLs() []string {
+	c.rootsMutex.Lock()
+	defer c.rootsMutex.Unlock()
+	roots := make([]string, 0, len(c.roots))
+	seen := map[string]struct{}{}
+	for _, url := range c.roots {
+		// seeds merged into other books are represented by them
+		url = c.canonicalURL(url)
+		if _, has := seen[url]; has {
+			continue
+		}
+		seen[url] = struct{}{}
+		roots = append(roots, url)
+	}
+	return roots
+}
+
+func (c *Crawler) addRoots(urls []string) {
+	c.rootsMutex.Lock()
+	defer c.rootsMutex.Unlock()
+	for _, url := range urls {
+		if _, has := c.rootsSet[url]; has {
+			continue
+		}
+		c.rootsSet[url] = struct{}{}
+		c.roots = append(c.roots, url)
+	}
+}
+
 func (c *Crawler) keepLoggingProgress(ctx context.Context) {
 	ticker := time.NewTicker(10 * time.Second)
 	for {
@@ -57,18 +277,82 @@ func (c *Crawler) keepLoggingProgress(ctx context.Context) {
 	}
 }
 
+// Counts returns how many books were crawled and checked by every run of the
+// crawler so far. It can be called while crawling
+func (c *Crawler) Counts() (crawled int32, checked int32) {
+	return atomic.LoadInt32(c.crawled), atomic.LoadInt32(c.checked)
+}
+
+// Failures returns how many books could not be fetched and were left behind
+// with WithContinueOnError, over all the runs of the crawler
+func (c *Crawler) Failures() int32 {
+	return atomic.LoadInt32(c.failed)
+}
+
+// progress is the crawl count at a given point in time, used to compute the
+// crawl rate in between progress logs
+type progress struct {
+	at      time.Time
+	crawled int32
+}
+
 func (c *Crawler) logProgress() {
-	log.Infof("Crawled %d books in %d book checks", atomic.LoadInt32(c.crawled), atomic.LoadInt32(c.checked))
+	now := c.clock.Now()
+	crawled := atomic.LoadInt32(c.crawled)
+	checked := atomic.LoadInt32(c.checked)
+	failed := atomic.LoadInt32(c.failed)
+
+	c.progressMutex.Lock()
+	previous := c.progress
+	c.progress = progress{at: now, crawled: crawled}
+	c.progressMutex.Unlock()
+
+	// rates are computed from the actual elapsed time, as ticks are not exact
+	// and the final log happens at any point in between ticks
+	rate := 0.0
+	if elapsed := now.Sub(previous.at).Seconds(); elapsed > 0 {
+		rate = float64(crawled-previous.crawled) / elapsed
+	}
+	averageRate := 0.0
+	if elapsed := now.Sub(c.startProgress.at).Seconds(); elapsed > 0 {
+		averageRate = float64(crawled-c.startProgress.crawled) / elapsed
+	}
+
+	log.Infof(
+		"Crawled %d books in %d book checks, %d failed, currently at %.1f books/s (%.1f books/s on average)",
+		crawled, checked, failed, rate, averageRate,
+	)
+	if c.depthGate != nil {
+		span, peakSpan := c.depthGate.spans()
+		log.Infof("%d depth levels currently open, at most %d so far (limit: %d)", span, peakSpan, c.depthGate.max)
+	}
 }
 
-func (c *Crawler) crawl(ctx context.Context, url string, depth int, index int) error {
+// crawl handles a book found from the book at the from url, which is empty
+// for seeds
+func (c *Crawler) crawl(ctx context.Context, url string, from string, depth int, index int) error {
 	if depth > c.maxDepth {
 		return nil
 	}
+	if !c.allowedURL(url) {
+		log.Debugf("skipping book %s, not allowed by the url filters", url)
+		return nil
+	}
+
+	// storage backends are not required to observe ctx, so make sure we stop
+	// walking previously linked books once the crawl is cancelled
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	checked := atomic.AddInt32(c.checked, 1)
+	c.metrics.IncBooksChecked()
 
-	stateChange, err := c.Storage.GetBookState(ctx, url)
+	if c.trackProvenance {
+		c.recordSeed(url, from)
+	}
+
+	stateChange, err := c.storage.GetBookState(ctx, url)
 	if err != nil {
 		return err
 	}
@@ -84,8 +368,40 @@ func (c *Crawler) crawl(ctx context.Context, url string, depth int, index int) e
 		return nil
 	}
 
+	// skipped books failed permanently, use Storage.DeleteBook to retry them
+	if stateChange.State == storage.Skipped {
+		log.Debugf("not crawling previously skipped book %s", url)
+		return nil
+	}
+
+	// an excluded seed never has its links persisted, so we need to always
+	// fetch it again to know which books it relates to
+	isExcludedSeed := depth == 0 && !c.includeSeed
+	if isExcludedSeed {
+		c.unpersisted.Store(url, struct{}{})
+	}
+
+	// books linked by previous runs are walked without touching their state,
+	// so the resumed set makes sure they are walked once per run instead
+	if c.resume && !isExcludedSeed && stateChange.State == storage.Linked && !c.skipLinked {
+		if _, walked := c.resumed.LoadOrStore(url, struct{}{}); walked {
+			return nil
+		}
+		return c.handlePreviouslyLinked(ctx, url, stateChange, depth, index, checked)
+	}
+
 	if stateChange.State == storage.Crawled {
-		if stateChange, set, err := c.Storage.SetBookState(ctx, url, stateChange, storage.Crawled); err != nil {
+		if stateChange, set, err := c.storage.SetBookState(ctx, url, stateChange, storage.Crawled); err != nil {
+			return err
+		} else if !set {
+			return nil
+		} else {
+			return c.handleCrawled(ctx, url, stateChange, depth, index, checked, nil)
+		}
+	}
+
+	if stateChange.State == storage.Linked && isExcludedSeed {
+		if stateChange, set, err := c.storage.SetBookState(ctx, url, stateChange, storage.Linked); err != nil {
 			return err
 		} else if !set {
 			return nil
@@ -94,8 +410,13 @@ func (c *Crawler) crawl(ctx context.Context, url string, depth int, index int) e
 		}
 	}
 
+	if stateChange.State == storage.Linked && c.skipLinked {
+		log.Debugf("not descending into previously linked book %s", url)
+		return nil
+	}
+
 	if stateChange.State == storage.Linked {
-		if stateChange, set, err := c.Storage.SetBookState(ctx, url, stateChange, storage.Linked); err != nil {
+		if stateChange, set, err := c.storage.SetBookState(ctx, url, stateChange, storage.Linked); err != nil {
 			return err
 		} else if !set {
 			return nil
@@ -104,188 +425,895 @@ func (c *Crawler) crawl(ctx context.Context, url string, depth int, index int) e
 		}
 	}
 
-	if stateChange, set, err := c.Storage.SetBookState(ctx, url, stateChange, storage.BeingCrawled); err != nil {
+	// the limit is checked before the book is marked as being crawled, so
+	// books over it are left as they are for a later run
+	if !isExcludedSeed && !c.reserveBook() {
+		log.Debugf("not crawling book %s, the limit of %d books was reached", url, c.maxBooks)
+		return nil
+	}
+
+	inFlight := c.inFlightChannel(url)
+	if stateChange, set, err := c.storage.SetBookState(ctx, url, stateChange, storage.BeingCrawled); err != nil {
+		c.settleBook(isExcludedSeed, false)
 		return err
 	} else if !set {
+		c.settleBook(isExcludedSeed, false)
 		return nil
 	} else {
-		return c.handleNotCrawled(ctx, url, stateChange, depth, index, checked)
+		return c.handleNotCrawled(ctx, url, from, stateChange, depth, index, checked, inFlight)
 	}
 }
 
-func (c *Crawler) handleNotCrawled(ctx context.Context, url string, prevState storage.StateChange, depth int, index int, checked int32) error {
-	b := book.New(url)
+// reserveBook takes one of the books left under the limit of books, if any.
+// While the limit is taken up by books still being crawled it waits for them
+// to settle, as those filtered out give their reservation back
+func (c *Crawler) reserveBook() bool {
+	if c.maxBooks <= 0 {
+		return true
+	}
+	c.reservedCond.L.Lock()
+	defer c.reservedCond.L.Unlock()
+	for c.reserved >= c.maxBooks && c.pending > 0 {
+		c.reservedCond.Wait()
+	}
+	if c.reserved >= c.maxBooks {
+		c.maxBooksReached.Do(func() {
+			log.Infof("reached the limit of %d books, not crawling any new book", c.maxBooks)
+		})
+		return false
+	}
+	c.reserved++
+	c.pending++
+	return true
+}
 
-	doc, err := c.fetch(ctx, url)
+// settleBook marks a reserved book as no longer being crawled, giving its
+// reservation back when it ended up not being persisted, eg because it was
+// filtered out
+func (c *Crawler) settleBook(isExcludedSeed bool, persisted bool) {
+	if c.maxBooks <= 0 || isExcludedSeed {
+		return
+	}
+	c.reservedCond.L.Lock()
+	defer c.reservedCond.L.Unlock()
+	c.pending--
+	if !persisted {
+		c.reserved--
+	}
+	c.reservedCond.Broadcast()
+}
+
+// recordSeed remembers from which seed a book was first reached in the
+// current run, which is the seed its parent was reached from
+func (c *Crawler) recordSeed(url string, from string) {
+	seed := url
+	if from != "" {
+		if fromSeed, has := c.seeds.Load(from); has {
+			seed = fromSeed.(string)
+		}
+	}
+	c.seeds.LoadOrStore(url, seed)
+}
+
+func (c *Crawler) handleNotCrawled(ctx context.Context, url string, from string, prevState storage.StateChange, depth int, index int, checked int32, inFlight chan struct{}) error {
+	isExcludedSeed := depth == 0 && !c.includeSeed
+
+	// books waiting on this one only need to wait until it is either persisted
+	// or discarded, never for the whole subgraph below it
+	settled := false
+	persisted := false
+	settle := func() {
+		if !settled {
+			settled = true
+			close(inFlight)
+			c.settleBook(isExcludedSeed, persisted)
+		}
+	}
+	defer settle()
+
+	var doc *goquery.Document
+	var finalURL string
+	err := c.atDepth(ctx, depth, func() (err error) {
+		doc, finalURL, err = c.fetch(ctx, url)
+		return err
+	})
+	var fetchErr ErrFetch
+	var disallowed myhttp.ErrDisallowedByRobots
+	var notAllowed ErrURLNotAllowed
+	if (errors.As(err, &fetchErr) && fetchErr.Permanent()) || errors.As(err, &disallowed) || errors.As(err, &notAllowed) {
+		if _, set, err := c.storage.SetBookState(ctx, url, prevState, storage.Skipped); err != nil {
+			return err
+		} else if !set {
+			return ErrStateTransition{URL: url, From: storage.BeingCrawled, To: storage.Skipped}
+		}
+		if notAllowed.URL != "" {
+			log.Debugf("skipping book %s: %v", url, err)
+		} else {
+			log.Warnf("skipping book %s: %v", url, err)
+		}
+		return nil
+	}
+	// the run being cancelled is not a failure of this book
+	if err != nil && c.continueOnError && ctx.Err() == nil {
+		if _, set, err := c.storage.SetBookState(ctx, url, prevState, storage.Failed); err != nil {
+			return err
+		} else if !set {
+			return ErrStateTransition{URL: url, From: storage.BeingCrawled, To: storage.Failed}
+		}
+		atomic.AddInt32(c.failed, 1)
+		c.failures.Store(url, struct{}{})
+		log.Warnf("failed to crawl book %s, continuing without it: %v", url, err)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	book.Build(b, doc)
+	if finalURL != url {
+		return c.handleRedirected(ctx, url, finalURL, from, prevState, depth, index, settle)
+	}
 
-	if (c.minNumRatings >= 0 && b.RatingsTotal < c.minNumRatings) ||
+	extractor := c.extractor
+	if extractor == nil {
+		extractor = c.site
+	}
+	b, err := extractor.Extract(doc)
+	if err == nil && b == nil {
+		err = errors.New("extractor returned no book")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract book %s: %w", url, err)
+	}
+	b.URL = url
+	if b.WorkURL != "" {
+		b.WorkURL, _ = resolveURL(url, b.WorkURL)
+	}
+	if b.Genres == nil {
+		b.Genres = []string{}
+	}
+	if b.Awards == nil {
+		b.Awards = []string{}
+	}
+	if b.Shelves == nil {
+		b.Shelves = map[string]int32{}
+	}
+	if b.AlsoRead == nil {
+		b.AlsoRead = []book.Edge{}
+	}
+	if c.trackProvenance {
+		seed, _ := c.seeds.Load(url)
+		b.DiscoveredFrom = from
+		b.DiscoveredDepth = depth
+		b.DiscoveredSeed = seed.(string)
+	}
+
+	if merged, err := c.mergeEdition(ctx, url, b, prevState); err != nil || merged {
+		return err
+	}
+
+	if !isExcludedSeed && ((c.minNumRatings >= 0 && b.RatingsTotal < c.minNumRatings) ||
 		(c.maxNumRatings >= 0 && b.RatingsTotal > c.maxNumRatings) ||
 		(c.minRating >= 0 && b.Rating < c.minRating) ||
-		(c.maxRating >= 0 && b.Rating > c.maxRating) {
+		(c.maxRating >= 0 && b.Rating > c.maxRating) ||
+		(c.minPublishedYear > 0 && b.PublishedYear < c.minPublishedYear) ||
+		(c.maxPublishedYear > 0 && b.PublishedYear > c.maxPublishedYear) ||
+		(len(c.languages) > 0 && !c.languages[strings.ToLower(b.Language)]) ||
+		(len(c.includeGenres) > 0 && !hasGenre(b.Genres, c.includeGenres)) ||
+		hasGenre(b.Genres, c.excludeGenres)) {
+		if _, set, err := c.storage.SetBookState(ctx, url, prevState, storage.Filtered); err != nil {
+			return err
+		} else if !set {
+			return ErrStateTransition{URL: url, From: storage.BeingCrawled, To: storage.Filtered}
+		}
+		log.Debugf("filtered out book %s by %s (%s)", b.Title, b.Author, url)
 		return nil
 	}
 
-	if err := c.Storage.SetBook(ctx, url, b); err != nil {
+	if isExcludedSeed {
+		log.Infof("not persisting seed book %s by %s (%s)", b.Title, b.Author, url)
+	} else if err := c.storage.SetBook(ctx, url, b); err != nil {
 		return err
+	} else if c.graphListener != nil {
+		if err := c.graphListener.AddBook(b, depth); err != nil {
+			return err
+		}
 	}
 
-	stateChange, set, err := c.Storage.SetBookState(ctx, url, prevState, storage.Crawled)
+	stateChange, set, err := c.storage.SetBookState(ctx, url, prevState, storage.Crawled)
 	if err != nil {
 		return err
 	} else if !set {
-		return fmt.Errorf(
-			"invalid state transition: book at %s could not be transitioned from state %v to %v",
-			url, storage.BeingCrawled, storage.Crawled,
-		)
+		return ErrStateTransition{URL: url, From: storage.BeingCrawled, To: storage.Crawled}
 	}
+	persisted = true
+	settle()
 
-	crawled := atomic.AddInt32(c.crawled, 1)
+	if !isExcludedSeed {
+		crawled := atomic.AddInt32(c.crawled, 1)
+		c.metrics.IncBooksCrawled()
 
-	log.Infof(
-		"[%03d, %03d, %02d/%02d] crawled book %s by %s (%s)",
-		checked, crawled, depth, index, b.Title, b.Author, url,
-	)
+		log.Infof(
+			"[%03d, %03d, %02d/%02d] crawled book %s by %s (%s)",
+			checked, crawled, depth, index, b.Title, b.Author, url,
+		)
+	}
 
 	return c.handleCrawled(ctx, url, stateChange, depth, index, checked, doc)
 }
 
 func (c *Crawler) handleCrawled(ctx context.Context, url string, prevState storage.StateChange, depth int, index int, checked int32, doc *goquery.Document) error {
 	if doc == nil {
-		var err error
-		doc, err = c.fetch(ctx, url)
+		err := c.atDepth(ctx, depth, func() (err error) {
+			doc, _, err = c.fetch(ctx, url)
+			return err
+		})
+		if err != nil && c.skipRelatedPage(ctx, url, url, err) {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
 	}
 
-	alsoReadLink, hasAlsoReadLink := doc.Find("a.actionLink.seeMoreLink").Attr("href")
-	if !hasAlsoReadLink {
-		return errors.New("book has no related books")
+	alsoReadLink := ""
+	if c.recommendationSources[book.SourceAlsoRead] {
+		link, hasLink := c.site.RelatedPageURL(url, doc)
+		if !hasLink {
+			return ErrNoRelated{URL: url}
+		}
+		alsoReadLink = link
 	}
 
-	alsoReadLink, err := myhttp.AbsoluteURL(url, alsoReadLink)
-	if err != nil {
-		return err
+	// take everything needed from the page before going deeper, so it does not
+	// stay in memory while the books below this one are crawled
+	var alsoEnjoyed []string
+	if site, ok := c.site.(ReadersAlsoEnjoyedSite); ok && c.recommendationSources[book.SourceReadersAlsoEnjoyed] {
+		alsoEnjoyed = c.limitReadAlso(site.ReadersAlsoEnjoyedURLs(url, doc), depth)
 	}
+	authorURL := c.site.AuthorURL(url, doc)
+	doc = nil
 
-	if depth < c.maxDepth {
-		if err := c.crawlAlsoRead(ctx, url, alsoReadLink, depth); err != nil {
+	var alsoRead []string
+	if depth < c.maxDepth && alsoReadLink != "" {
+		var err error
+		if alsoRead, err = c.crawlAlsoRead(ctx, url, alsoReadLink, depth); err != nil {
 			return err
 		}
 	}
 
-	if _, set, err := c.Storage.SetBookState(ctx, url, prevState, storage.Linked); err != nil {
+	// books members also liked keep that source when readers also enjoyed
+	// them too
+	followed := make(map[string]struct{}, len(alsoRead))
+	for _, u := range alsoRead {
+		followed[u] = struct{}{}
+	}
+	enjoyed := []string{}
+	for _, u := range alsoEnjoyed {
+		if _, has := followed[u]; !has {
+			enjoyed = append(enjoyed, u)
+		}
+	}
+	alsoEnjoyed = enjoyed
+	if depth < c.maxDepth && len(alsoEnjoyed) > 0 {
+		log.Debugf("following the books readers of %q also enjoyed: %v", url, alsoEnjoyed)
+		if err := c.crawlRelated(ctx, url, alsoEnjoyed, depth, book.SourceReadersAlsoEnjoyed); err != nil {
+			return err
+		}
+		alsoRead = append(alsoRead, alsoEnjoyed...)
+	}
+
+	if depth < c.maxDepth && c.followSimilarAuthors && authorURL != "" {
+		if err := c.crawlSimilarAuthors(ctx, url, authorURL, depth); err != nil {
+			return err
+		}
+	}
+
+	if depth < c.maxDepth && c.crawlAuthors && authorURL != "" {
+		if err := c.crawlAuthorBooks(ctx, url, authorURL, alsoRead, depth); err != nil {
+			return err
+		}
+	}
+
+	if _, incomplete := c.incomplete.Load(url); incomplete {
+		log.Debugf("leaving book %s crawled but not linked, as some of its related books failed", url)
+		return nil
+	}
+
+	if _, set, err := c.storage.SetBookState(ctx, url, prevState, storage.Linked); err != nil {
 		return err
 	} else if !set {
-		return fmt.Errorf(
-			"invalid state transition: book at %s could not be transitioned from state %v to %v",
-			url, storage.Crawled, storage.Linked,
-		)
+		return ErrStateTransition{URL: url, From: storage.Crawled, To: storage.Linked}
 	}
 
 	return nil
 }
 
+// handleRedirected handles a book whose url redirects to another one, which
+// is how goodreads answers for books merged into others. The book is recorded
+// as merged into the one it redirects to, which is crawled in its place
+func (c *Crawler) handleRedirected(ctx context.Context, url string, finalURL string, from string, prevState storage.StateChange, depth int, index int, settle func()) error {
+	c.aliases.Store(url, finalURL)
+	if _, set, err := c.storage.SetBookState(ctx, url, prevState, storage.Merged); err != nil {
+		return err
+	} else if !set {
+		return ErrStateTransition{URL: url, From: storage.BeingCrawled, To: storage.Merged}
+	}
+	settle()
+	log.Debugf("book %s redirects to %s, crawling the latter instead", url, finalURL)
+	if depth == 0 && c.includeSeed {
+		c.addRoots([]string{finalURL})
+	}
+	return c.crawl(ctx, finalURL, from, depth, index)
+}
+
+// mergeEdition records which book stands for its work in the current run
+// when canonicalizing works. If another edition of the same work got there
+// first, this book is marked as merged into it instead of being persisted
+func (c *Crawler) mergeEdition(ctx context.Context, url string, b *book.Book, prevState storage.StateChange) (bool, error) {
+	if !c.canonicalizeWorks || b.WorkURL == "" {
+		return false, nil
+	}
+	owner, loaded := c.works.LoadOrStore(b.WorkURL, url)
+	if !loaded || owner.(string) == url {
+		return false, nil
+	}
+	c.aliases.Store(url, owner.(string))
+	if _, set, err := c.storage.SetBookState(ctx, url, prevState, storage.Merged); err != nil {
+		return false, err
+	} else if !set {
+		return false, ErrStateTransition{URL: url, From: storage.BeingCrawled, To: storage.Merged}
+	}
+	log.Debugf("merged book %s into %s, both editions of %s", url, owner, b.WorkURL)
+	return true, nil
+}
+
+// canonicalURL returns the book that stands for url in the current run, which
+// is url itself unless it was merged into another book, either by redirecting
+// to it or as another edition of the same work
+func (c *Crawler) canonicalURL(url string) string {
+	if c.aliases == nil {
+		return url
+	}
+	// a book can redirect to an edition merged into yet another one
+	seen := map[string]struct{}{}
+	for {
+		owner, has := c.aliases.Load(url)
+		if !has {
+			return url
+		}
+		if _, loop := seen[url]; loop {
+			return url
+		}
+		seen[url] = struct{}{}
+		url = owner.(string)
+	}
+}
+
 func (c *Crawler) handlePreviouslyLinked(ctx context.Context, url string, prevState storage.StateChange, depth int, index int, checked int32) error {
-	b, err := c.Storage.GetBook(ctx, url, 1)
+	b, err := c.storage.GetBook(ctx, url, 1)
 	if err != nil {
 		return err
 	}
-	errGroup := errgroup.Group{}
-	for _idx, _relatedBook := range b.AlsoRead {
-		idx := _idx
-		relatedURL := _relatedBook.To.URL
-		errGroup.Go(func() error {
-			return c.crawl(ctx, relatedURL, depth+1, idx)
-		})
+	if b == nil {
+		return nil
 	}
-	err = errGroup.Wait()
-	return err
+	if c.canonicalizeWorks && b.WorkURL != "" {
+		c.works.LoadOrStore(b.WorkURL, url)
+	}
+	relatedURLs := make([]string, len(b.AlsoRead))
+	for idx, relatedBook := range b.AlsoRead {
+		relatedURLs[idx] = relatedBook.To.URL
+	}
+	return c.forEachURL(ctx, relatedURLs, func(ctx context.Context, idx int, relatedURL string) error {
+		return c.crawl(ctx, relatedURL, url, depth+1, idx)
+	})
 }
 
-func (c *Crawler) crawlAlsoRead(ctx context.Context, bookURL string, similarBooksURL string, depth int) error {
-	toCrawl, err := c.extractRelatedBookURLs(ctx, similarBooksURL)
-	if err != nil {
+// crawlAlsoRead returns the related books it followed
+func (c *Crawler) crawlAlsoRead(ctx context.Context, bookURL string, similarBooksURL string, depth int) ([]string, error) {
+	var toCrawl []string
+	err := c.atDepth(ctx, depth, func() (err error) {
+		toCrawl, err = c.extractRelatedBookURLs(ctx, similarBooksURL, depth)
 		return err
+	})
+	var disallowed myhttp.ErrDisallowedByRobots
+	if errors.As(err, &disallowed) {
+		log.Warnf("not following books related to %s: %v", bookURL, err)
+		return nil, nil
+	}
+	var notAllowed ErrURLNotAllowed
+	if errors.As(err, &notAllowed) {
+		log.Debugf("not following books related to %s: %v", bookURL, err)
+		return nil, nil
+	}
+	if err != nil && c.skipRelatedPage(ctx, bookURL, similarBooksURL, err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	log.Debugf("extracted the following urls from %q: %v", similarBooksURL, toCrawl)
 
-	group, ctx := errgroup.WithContext(ctx)
-	for _idx, _linkURL := range toCrawl {
-		idx := _idx
-		linkURL := _linkURL
-		group.Go(func() error {
-			err := c.crawl(ctx, linkURL, depth+1, idx)
-			if err != nil {
-				return err
+	return toCrawl, c.crawlRelated(ctx, bookURL, toCrawl, depth, book.SourceAlsoRead)
+}
+
+func (c *Crawler) crawlSimilarAuthors(ctx context.Context, bookURL string, authorURL string, depth int) error {
+	var toCrawl []string
+	err := c.atDepth(ctx, depth, func() (err error) {
+		toCrawl, err = c.extractSimilarAuthorsBookURLs(ctx, authorURL, depth)
+		return err
+	})
+	var disallowed myhttp.ErrDisallowedByRobots
+	if errors.As(err, &disallowed) {
+		log.Warnf("not following books of authors similar to %s: %v", authorURL, err)
+		return nil
+	}
+	var notAllowed ErrURLNotAllowed
+	if errors.As(err, &notAllowed) {
+		log.Debugf("not following books of authors similar to %s: %v", authorURL, err)
+		return nil
+	}
+	if err != nil && c.skipRelatedPage(ctx, bookURL, authorURL, err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("extracted the following urls from authors similar to %q: %v", authorURL, toCrawl)
+
+	return c.crawlRelated(ctx, bookURL, toCrawl, depth, book.SourceSimilarAuthor)
+}
+
+// crawlAuthorBooks follows the other books of the author of a book. Books in
+// alsoRead were already followed as related books, so they are not linked
+// again
+func (c *Crawler) crawlAuthorBooks(ctx context.Context, bookURL string, authorURL string, alsoRead []string, depth int) error {
+	var toCrawl []string
+	err := c.atDepth(ctx, depth, func() (err error) {
+		toCrawl, err = c.extractAuthorBookURLs(ctx, bookURL, authorURL, alsoRead)
+		return err
+	})
+	var disallowed myhttp.ErrDisallowedByRobots
+	if errors.As(err, &disallowed) {
+		log.Warnf("not following books of author %s: %v", authorURL, err)
+		return nil
+	}
+	var notAllowed ErrURLNotAllowed
+	if errors.As(err, &notAllowed) {
+		log.Debugf("not following books of author %s: %v", authorURL, err)
+		return nil
+	}
+	if err != nil && c.skipRelatedPage(ctx, bookURL, authorURL, err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("extracted the following urls from author %q: %v", authorURL, toCrawl)
+
+	return c.crawlRelated(ctx, bookURL, toCrawl, depth, book.SourceAuthor)
+}
+
+// skipRelatedPage tells whether a page listing books related to bookURL that
+// could not be fetched can be skipped, which is when continuing on errors. The
+// book is then left crawled but not linked, so a later crawl follows the books
+// related to it again
+func (c *Crawler) skipRelatedPage(ctx context.Context, bookURL string, pageURL string, err error) bool {
+	// the run being cancelled is not a failure of this book
+	if !c.continueOnError || ctx.Err() != nil {
+		return false
+	}
+	c.incomplete.Store(bookURL, struct{}{})
+	log.Warnf("failed to fetch %s, continuing without the books it lists: %v", pageURL, err)
+	return true
+}
+
+func (c *Crawler) crawlRelated(ctx context.Context, bookURL string, toCrawl []string, depth int, source string) error {
+	isExcludedSeed := depth == 0 && !c.includeSeed
+	if isExcludedSeed {
+		c.addRoots(toCrawl)
+	}
+
+	// on dense graphs most related books were already handled in this run, so
+	// we check all of them at once instead of one round trip each
+	states, err := c.storage.GetBookStates(ctx, toCrawl)
+	if err != nil {
+		return err
+	}
+
+	// editions merged into the same work must only be linked once
+	linked := sync.Map{}
+
+	// the out degree only counts the books actually linked, so related books
+	// are crawled in batches of as many as there is room left for, best
+	// priority first, until it is reached
+	outDegree := c.outDegree(bookURL)
+	for start := 0; start < len(toCrawl); {
+		end := len(toCrawl)
+		if c.maxOutDegree > 0 && !isExcludedSeed {
+			room := c.maxOutDegree - int(atomic.LoadInt32(outDegree))
+			if room <= 0 {
+				log.Debugf("not following more books from %s, it links to %d already", bookURL, c.maxOutDegree)
+				return nil
+			}
+			if start+room < end {
+				end = start + room
+			}
+		}
+		offset := start
+		err := c.forEachURL(ctx, toCrawl[start:end], func(ctx context.Context, idx int, linkURL string) error {
+			linkedBook, err := c.linkRelated(ctx, bookURL, linkURL, states[linkURL], depth, offset+idx, source, isExcludedSeed, &linked)
+			if linkedBook {
+				atomic.AddInt32(outDegree, 1)
 			}
-			if err := c.Storage.LinkBook(ctx, bookURL, linkURL, idx); err != nil {
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// outDegree counts the books linked to the given one in the current run
+func (c *Crawler) outDegree(url string) *int32 {
+	count, _ := c.outDegrees.LoadOrStore(url, new(int32))
+	return count.(*int32)
+}
+
+// linkRelated crawls the related book at position idx, then links the book to
+// it, telling whether it did
+func (c *Crawler) linkRelated(ctx context.Context, bookURL string, linkURL string, state storage.StateChange, depth int, idx int, source string, isExcludedSeed bool, linked *sync.Map) (bool, error) {
+	if !c.isSettled(state) {
+		if err := c.crawl(ctx, linkURL, bookURL, depth+1, idx); err != nil {
+			return false, err
+		}
+		state = storage.StateChange{}
+	}
+	if isExcludedSeed {
+		return false, nil
+	}
+	// only known to be merged into another book once settled
+	if err := c.waitSettled(ctx, linkURL); err != nil {
+		return false, err
+	}
+	if canonicalURL := c.canonicalURL(linkURL); canonicalURL != linkURL {
+		linkURL = canonicalURL
+		state = storage.StateChange{}
+	}
+	if linkURL == bookURL {
+		return false, nil
+	}
+	if _, loaded := linked.LoadOrStore(linkURL, struct{}{}); loaded {
+		return false, nil
+	}
+	if persisted, err := c.isPersisted(ctx, linkURL, state); err != nil {
+		return false, err
+	} else if !persisted {
+		if _, failed := c.failures.Load(linkURL); failed {
+			c.incomplete.Store(bookURL, struct{}{})
+		}
+		log.Debugf("not linking %s to %s as the latter was not persisted", bookURL, linkURL)
+		return false, nil
+	}
+	err := c.storage.LinkBookWithSource(ctx, bookURL, linkURL, idx, source)
+	var notFound storage.ErrBookNotFound
+	if errors.As(err, &notFound) {
+		log.Debugf("not linking %s to %s: %v", bookURL, linkURL, err)
+		return false, nil
+	}
+	if err == nil && c.graphListener != nil {
+		err = c.graphListener.AddEdge(bookURL, linkURL, idx, source)
+	}
+	return err == nil, err
+}
+
+// forEachURL calls fn for every url in parallel. In deterministic mode urls
+// are processed sequentially and in lexicographical order instead. idx is
+// always the url position in the given slice
+func (c *Crawler) forEachURL(ctx context.Context, urls []string, fn func(ctx context.Context, idx int, url string) error) error {
+	if c.deterministic {
+		order := make([]int, len(urls))
+		for idx := range urls {
+			order[idx] = idx
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return urls[order[i]] < urls[order[j]]
+		})
+		for _, idx := range order {
+			if err := fn(ctx, idx, urls[idx]); err != nil {
 				return err
 			}
-			return nil
+		}
+		return nil
+	}
+
+	group, ctx := errgroup.WithContext(ctx)
+	for _idx, _url := range urls {
+		idx := _idx
+		url := _url
+		group.Go(func() error {
+			return fn(ctx, idx, url)
 		})
 	}
+	return group.Wait()
+}
 
-	if err := group.Wait(); err != nil {
-		return err
+func (c *Crawler) inFlightChannel(url string) chan struct{} {
+	ch, _ := c.inFlight.LoadOrStore(url, make(chan struct{}))
+	return ch.(chan struct{})
+}
+
+// isPersisted tells whether a book was persisted and can be linked to,
+// waiting for it to be settled in case it is still being crawled elsewhere. A
+// settled state, if already known, saves a storage round trip
+func (c *Crawler) isPersisted(ctx context.Context, url string, known storage.StateChange) (bool, error) {
+	if err := c.waitSettled(ctx, url); err != nil {
+		return false, err
+	}
+	if _, has := c.unpersisted.Load(url); has {
+		return false, nil
+	}
+	stateChange := known
+	if !c.isSettled(stateChange) {
+		var err error
+		stateChange, err = c.storage.GetBookState(ctx, url)
+		if err != nil {
+			return false, err
+		}
 	}
+	return stateChange.State == storage.Crawled || stateChange.State == storage.Linked, nil
+}
 
-	return nil
+// waitSettled waits until a book being crawled in the current run is either
+// persisted or discarded
+func (c *Crawler) waitSettled(ctx context.Context, url string) error {
+	ch, has := c.inFlight.Load(url)
+	if !has {
+		return nil
+	}
+	select {
+	case <-ch.(chan struct{}):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func (c *Crawler) fetch(ctx context.Context, url string) (*goquery.Document, error) {
-	res, err := c.Client.Request(ctx, "GET", url, nil, nil)
-	if err != nil {
-		return nil, err
+// allowedURL tells whether url is on one of the allowed hosts and passes the
+// url filter
+func (c *Crawler) allowedURL(rawURL string) bool {
+	if len(c.allowedHosts) > 0 {
+		parsed, err := urllib.Parse(rawURL)
+		if err != nil {
+			return false
+		}
+		allowed := false
+		for host := strings.ToLower(parsed.Hostname()); host != "" && !allowed; {
+			allowed = c.allowedHosts[host]
+			_, host, _ = strings.Cut(host, ".")
+		}
+		if !allowed {
+			return false
+		}
 	}
+	return c.urlFilter == nil || c.urlFilter(rawURL)
+}
 
-	if res.StatusCode/100 != 2 {
-		err := fmt.Errorf("failed to fetch: %s returned status code %d", url, res.StatusCode)
-		return nil, err
+// hasGenre tells whether any of the genres is in the lower cased set
+func hasGenre(genres []string, set map[string]bool) bool {
+	for _, genre := range genres {
+		if set[strings.ToLower(strings.TrimSpace(genre))] {
+			return true
+		}
+	}
+	return false
+}
+
+// isSettled tells whether crawling a book again in this run would do nothing,
+// as it was already handled in it or permanently skipped. A book being crawled
+// is not settled, as it can still be persisted or discarded
+func (c *Crawler) isSettled(stateChange storage.StateChange) bool {
+	switch stateChange.State {
+	case storage.Skipped:
+		return true
+	case storage.Crawled, storage.Linked, storage.Filtered, storage.Merged, storage.Failed:
+		return stateChange.When.After(c.start)
 	}
+	return false
+}
 
-	return goquery.NewDocumentFromReader(res.Body)
+// fetch fetches a book page. The url of the page after following redirects
+// is also returned
+func (c *Crawler) fetch(ctx context.Context, url string) (*goquery.Document, string, error) {
+	if !c.allowedURL(url) {
+		return nil, "", ErrURLNotAllowed{URL: url}
+	}
+	content, finalURL, err := c.fetchContent(ctx, url)
+	if err != nil {
+		return nil, "", err
+	}
+	if !c.allowedURL(finalURL) {
+		return nil, "", ErrURLNotAllowed{URL: finalURL}
+	}
+	if c.rawHTMLStore != nil {
+		if err := c.rawHTMLStore.Save(finalURL, content); err != nil {
+			log.Warnf("failed to store raw html of %s: %v", finalURL, err)
+		}
+	}
+	if c.reducePages {
+		reduced, err := html.Reduce(content, html.DefaultRegions)
+		if err != nil {
+			return nil, "", err
+		}
+		content = reduced
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+	return doc, finalURL, err
 }
 
-func (c *Crawler) extractRelatedBookURLs(ctx context.Context, url string) ([]string, error) {
-	resp, err := c.Client.Request(ctx, "GET", url, nil, nil)
+func (c *Crawler) fetchPage(ctx context.Context, url string) (*goquery.Document, error) {
+	if !c.allowedURL(url) {
+		return nil, ErrURLNotAllowed{URL: url}
+	}
+	doc, err := c.getFetcher().Fetch(ctx, url)
 	if err != nil {
 		return nil, err
 	}
+	if doc.Url != nil && !c.allowedURL(doc.Url.String()) {
+		return nil, ErrURLNotAllowed{URL: doc.Url.String()}
+	}
+	return doc, nil
+}
+
+// fetchContent returns the raw page and the url of the page after following
+// redirects. Pages of fetchers without access to the raw pages are rendered
+// back from the parsed document
+func (c *Crawler) fetchContent(ctx context.Context, url string) ([]byte, string, error) {
+	fetcher := c.getFetcher()
+	if contentFetcher, ok := fetcher.(contentFetcher); ok {
+		return contentFetcher.fetchContent(ctx, url)
+	}
+	doc, err := fetcher.Fetch(ctx, url)
+	if err != nil {
+		return nil, "", err
+	}
+	content, err := goquery.OuterHtml(doc.Selection)
+	if err != nil {
+		return nil, "", err
+	}
+	finalURL := url
+	if doc.Url != nil {
+		finalURL = doc.Url.String()
+	}
+	return []byte(content), finalURL, nil
+}
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+func (c *Crawler) getFetcher() Fetcher {
+	if c.fetcher != nil {
+		return c.fetcher
+	}
+	return HTTPFetcher{Client: c.Client}
+}
+
+func (c *Crawler) extractRelatedBookURLs(ctx context.Context, url string, depth int) ([]string, error) {
+	doc, err := c.fetchPage(ctx, url)
 	if err != nil {
 		return nil, err
 	}
+	urls := c.limitReadAlso(c.site.RelatedBookURLs(url, doc), depth)
+	return urls, nil
+}
+
+// maxReadAlsoAt is how many related books are followed from a book at depth.
+// Negative means all of them
+func (c *Crawler) maxReadAlsoAt(depth int) int {
+	if c.maxReadAlsoByDepth == nil {
+		return c.maxReadAlso
+	}
+	return c.maxReadAlsoByDepth(depth)
+}
 
+// limitReadAlso keeps the urls of the related books followed from a book at
+// depth
+func (c *Crawler) limitReadAlso(urls []string, depth int) []string {
+	if maxReadAlso := c.maxReadAlsoAt(depth); maxReadAlso >= 0 && len(urls) > maxReadAlso {
+		return urls[:maxReadAlso]
+	}
+	return urls
+}
+
+func (c *Crawler) extractListBookURLs(ctx context.Context, listURL string) ([]string, error) {
 	urls := []string{}
-	doc.Find("div.responsiveMainContentContainer div.membersAlsoLikedText").
-		NextAll().
-		Find("a[itemprop=url]").
-		Each(func(_ int, node *goquery.Selection) {
-			if len(urls) == c.maxReadAlso {
-				return
-			}
-			linkURL, hasUrl := node.Attr("href")
-			if !hasUrl {
-				return
-			}
-			absoluteLinkURL, err := myhttp.AbsoluteURL(url, linkURL)
-			if err != nil {
-				log.Warnf("found bad url, skipping it: %s", linkURL)
-				return
+	seen := map[string]struct{}{}
+	visitedPages := map[string]struct{}{}
+	pageURL := listURL
+	for pageURL != "" {
+		if _, visited := visitedPages[pageURL]; visited {
+			break
+		}
+		visitedPages[pageURL] = struct{}{}
+
+		doc, err := c.fetchPage(ctx, pageURL)
+		if err != nil {
+			return nil, err
+		}
+
+		pageURLs, nextPageURL := c.site.ListBookURLs(pageURL, doc)
+		for _, url := range pageURLs {
+			if c.maxListBooks >= 0 && len(urls) >= c.maxListBooks {
+				return urls, nil
 			}
-			if !strings.Contains(absoluteLinkURL, "/book/show/") {
-				return
+			if _, has := seen[url]; has {
+				continue
 			}
-			urls = append(urls, absoluteLinkURL)
-		})
+			seen[url] = struct{}{}
+			urls = append(urls, url)
+		}
+		pageURL = nextPageURL
+	}
+	return urls, nil
+}
+
+// extractAuthorBookURLs returns the books in the author page, except for the
+// book itself and the ones in exclude
+func (c *Crawler) extractAuthorBookURLs(ctx context.Context, bookURL string, authorURL string, exclude []string) ([]string, error) {
+	var authorBooks []string
+	if cached, ok := c.authorBooks.Load(authorURL); ok {
+		authorBooks = cached.([]string)
+	} else {
+		doc, err := c.fetchPage(ctx, authorURL)
+		if err != nil {
+			return nil, err
+		}
+		authorBooks = c.site.AuthorBookURLs(authorURL, doc)
+		c.authorBooks.Store(authorURL, authorBooks)
+	}
+	skip := map[string]struct{}{bookURL: {}}
+	for _, url := range exclude {
+		skip[url] = struct{}{}
+	}
+	urls := []string{}
+	for _, url := range authorBooks {
+		if _, has := skip[url]; has {
+			continue
+		}
+		skip[url] = struct{}{}
+		urls = append(urls, url)
+		if c.maxAuthorBooks >= 0 && len(urls) >= c.maxAuthorBooks {
+			break
+		}
+	}
+	return urls, nil
+}
+
+// extractSimilarAuthorsBookURLs goes through the authors goodreads considers
+// similar to the given one and returns the top book of each of them
+func (c *Crawler) extractSimilarAuthorsBookURLs(ctx context.Context, authorURL string, depth int) ([]string, error) {
+	similarURL, hasSimilar := c.site.SimilarAuthorsPageURL(authorURL)
+	if !hasSimilar {
+		return nil, nil
+	}
+	doc, err := c.fetchPage(ctx, similarURL)
+	if err != nil {
+		return nil, err
+	}
 
+	similarAuthorURLs := c.limitReadAlso(c.site.SimilarAuthorURLs(similarURL, authorURL, doc), depth)
+
+	urls := []string{}
+	for _, similarAuthorURL := range similarAuthorURLs {
+		doc, err := c.fetchPage(ctx, similarAuthorURL)
+		if err != nil {
+			return nil, err
+		}
+		if topBookURL, hasTopBook := c.site.AuthorTopBookURL(similarAuthorURL, doc); hasTopBook {
+			urls = append(urls, topBookURL)
+		}
+	}
 	return urls, nil
 }
@@ -0,0 +1,174 @@
+package crawler_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+	"github.com/bcap/book-crawler/storage/memory"
+)
+
+// closingCache counts how many times it was closed
+type closingCache struct {
+	*myhttp.MemoryCache
+	closed int
+}
+
+func (c *closingCache) Close() error {
+	c.closed++
+	return nil
+}
+
+// shutdownStorage counts how many times it was shut down
+type shutdownStorage struct {
+	storage.Storage
+	shutdowns int
+}
+
+func (s *shutdownStorage) Shutdown(ctx context.Context) error {
+	s.shutdowns++
+	return s.Storage.Shutdown(ctx)
+}
+
+// connections tracks the connections open to a server
+type connections struct {
+	mutex  sync.Mutex
+	opened int
+	closed int
+}
+
+func (c *connections) track(_ net.Conn, state http.ConnState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switch state {
+	case http.StateNew:
+		c.opened++
+	case http.StateClosed, http.StateHijacked:
+		c.closed++
+	}
+}
+
+func (c *connections) open() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.opened - c.closed
+}
+
+func crawlerCloseCountBooks(ctx context.Context, s storage.Storage) int {
+	books := 0
+	s.GetAllBooks(ctx, func(*book.Book) error {
+		books++
+		return nil
+	})
+	return books
+}
+
+// TestCrawlerClose checks that closing a crawler closes the idle connections
+// and the cache of its client, shuts down the in-memory storage it created
+// but not storages set by callers, cannot be done while crawling and can be
+// done more than once
+func TestCrawlerClose(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	books := fixture.NewServer(100, 3)
+	defer books.Close()
+	conns := &connections{}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := http.Get(books.URL + r.URL.RequestURI())
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+	server.Config.ConnState = conns.track
+	server.Start()
+	defer server.Close()
+
+	c := crawler.NewCrawler(crawler.WithMaxDepth(2), crawler.WithMaxReadAlso(3), crawler.WithMaxParallelism(4))
+	cache := &closingCache{MemoryCache: myhttp.NewMemoryCache(0)}
+	c.Client.Cache = cache
+	if err := c.Crawl(ctx, server.URL+"/book/show/1"); err != nil {
+		t.Fatal(err)
+	}
+	owned := c.Storage
+	before := crawlerCloseCountBooks(ctx, owned)
+	idle := conns.open()
+
+	err := c.Close(ctx)
+	if err != nil {
+		t.Errorf("closed: %v", err)
+	}
+	for i := 0; i < 100 && conns.open() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !(idle > 0 && conns.open() == 0) {
+		t.Errorf("idle connections closed (%d before, %d after)", idle, conns.open())
+	}
+	if cache.closed != 1 {
+		t.Errorf("cache closed (%d times)", cache.closed)
+	}
+	after := crawlerCloseCountBooks(ctx, owned)
+	if !(before > 0 && after == 0) {
+		t.Errorf("in-memory storage created by the crawler shut down (%d books before, %d after)", before, after)
+	}
+
+	err = c.Close(ctx)
+	if !(err == nil && cache.closed == 2) {
+		t.Errorf("closed again: %v", err)
+	}
+
+	// storages set by callers are left alone
+	callers := &shutdownStorage{Storage: &memory.Storage{}}
+	callers.Initialize(ctx)
+	c = crawler.NewCrawler(crawler.WithMaxDepth(2), crawler.WithMaxReadAlso(3))
+	c.Storage = callers
+	if err := c.Crawl(ctx, books.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	err = c.Close(ctx)
+	if !(err == nil && callers.shutdowns == 0 && crawlerCloseCountBooks(ctx, callers) > 0) {
+		t.Errorf("storage set by the caller not shut down (%d shutdowns): %v", callers.shutdowns, err)
+	}
+
+	// closing while crawling fails
+	slow := fixture.NewServer(100, 3)
+	defer slow.Close()
+	slow.Delay = 20 * time.Millisecond
+	c = crawler.NewCrawler(crawler.WithMaxDepth(2), crawler.WithMaxReadAlso(3))
+	done := make(chan error)
+	go func() {
+		done <- c.Crawl(ctx, slow.BookURL(1))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	err = c.Close(ctx)
+	if err == nil {
+		t.Errorf("closing while crawling refused: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !(crawlerCloseCountBooks(ctx, c.Storage) > 1) {
+		t.Errorf("crawl unaffected by the refused close (%d books)", crawlerCloseCountBooks(ctx, c.Storage))
+	}
+	err = c.Close(ctx)
+	if err != nil {
+		t.Errorf("closed once the crawl is over: %v", err)
+	}
+
+}
@@ -0,0 +1,107 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+)
+
+// depthGate limits how many depth levels have fetches in progress at once.
+// A fetch at a given depth is only admitted while the span between the
+// shallowest and deepest open levels, including its own, stays within max.
+// Deeper fetches wait for shallower levels to drain and vice versa, which
+// turns a deep depth first traversal into a staged, breadth first like one
+type depthGate struct {
+	max int
+
+	active  map[int]int
+	changed chan struct{}
+	mutex   sync.Mutex
+
+	// peakSpan is the widest span of open levels seen, for instrumentation
+	peakSpan int
+}
+
+func newDepthGate(max int) *depthGate {
+	return &depthGate{
+		max:     max,
+		active:  map[int]int{},
+		changed: make(chan struct{}),
+	}
+}
+
+// enter blocks until depth can be opened. Every enter must be followed by a
+// leave once the work at that depth is done. Work done in between must never
+// wait on other work going through the gate, otherwise it can deadlock
+func (g *depthGate) enter(ctx context.Context, depth int) error {
+	if g == nil {
+		return nil
+	}
+	for {
+		g.mutex.Lock()
+		if span := g.spanWith(depth); span <= g.max {
+			g.active[depth]++
+			if span > g.peakSpan {
+				g.peakSpan = span
+			}
+			g.mutex.Unlock()
+			return nil
+		}
+		changed := g.changed
+		g.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (g *depthGate) leave(depth int) {
+	if g == nil {
+		return
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.active[depth]--
+	if g.active[depth] == 0 {
+		delete(g.active, depth)
+		// wake up everyone waiting, as the open levels changed
+		close(g.changed)
+		g.changed = make(chan struct{})
+	}
+}
+
+// spans returns the current and peak span of open levels
+func (g *depthGate) spans() (int, int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.spanWith(-1), g.peakSpan
+}
+
+// spanWith returns how many levels would be open if depth was opened too.
+// A negative depth is ignored
+func (g *depthGate) spanWith(depth int) int {
+	min, max := depth, depth
+	for open := range g.active {
+		if min < 0 || open < min {
+			min = open
+		}
+		if max < 0 || open > max {
+			max = open
+		}
+	}
+	if min < 0 {
+		return 0
+	}
+	return max - min + 1
+}
+
+// atDepth runs fn, usually a fetch, as work at depth
+func (c *Crawler) atDepth(ctx context.Context, depth int, fn func() error) error {
+	if err := c.depthGate.enter(ctx, depth); err != nil {
+		return err
+	}
+	defer c.depthGate.leave(depth)
+	return fn()
+}
@@ -0,0 +1,134 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bcap/book-crawler/storage"
+)
+
+type ErrFetch struct {
+	URL        string
+	StatusCode int
+}
+
+func (e ErrFetch) Error() string {
+	return fmt.Sprintf("failed to fetch: %s returned status code %d", e.URL, e.StatusCode)
+}
+
+// Permanent tells whether fetching again will keep failing, which is the case
+// for client errors other than the ones we retry on
+func (e ErrFetch) Permanent() bool {
+	if e.StatusCode < 400 || e.StatusCode >= 500 {
+		return false
+	}
+	if e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests {
+		return false
+	}
+	for _, code := range extraStatusCodesToRetry {
+		if code == e.StatusCode {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrURLNotAllowed is returned when fetching a page whose url, or the url it
+// redirected to, is not allowed by the allowed hosts or the url filter
+type ErrURLNotAllowed struct {
+	URL string
+}
+
+func (e ErrURLNotAllowed) Error() string {
+	return fmt.Sprintf("%s is not allowed by the url filters", e.URL)
+}
+
+// ErrMaxDuration is returned by runs stopped for reaching the max duration.
+// It is a context.DeadlineExceeded as well
+type ErrMaxDuration struct {
+	MaxDuration time.Duration
+}
+
+func (e ErrMaxDuration) Error() string {
+	return fmt.Sprintf("crawl stopped after its max duration of %s", e.MaxDuration)
+}
+
+func (e ErrMaxDuration) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// Errors are the errors of a run returned together, eg a run stopped for
+// reaching its max duration that also failed to write its memory profile.
+// errors.Is and errors.As match any of them
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for idx, err := range e {
+		messages[idx] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Errors) As(target any) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinErrors returns nil without errors, the error itself when there is only
+// one and Errors otherwise
+func joinErrors(errs ...error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return Errors(errs)
+}
+
+type ErrNoRelated struct {
+	URL string
+}
+
+func (e ErrNoRelated) Error() string {
+	return fmt.Sprintf("book has no related books: %s", e.URL)
+}
+
+type ErrNoSearchResults struct {
+	Query string
+}
+
+func (e ErrNoSearchResults) Error() string {
+	return fmt.Sprintf("no books found when searching for %q", e.Query)
+}
+
+type ErrStateTransition struct {
+	URL  string
+	From storage.State
+	To   storage.State
+}
+
+func (e ErrStateTransition) Error() string {
+	return fmt.Sprintf(
+		"invalid state transition: book at %s could not be transitioned from state %v to %v",
+		e.URL, e.From, e.To,
+	)
+}
@@ -0,0 +1,50 @@
+package crawler_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+// TestCrawlExtractor checks that books are built by the extractor given with
+// WithExtractor, and that an extractor returning no book fails the crawl
+// instead of crashing it
+func TestCrawlExtractor(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(20, 3)
+	defer server.Close()
+
+	titled := book.ExtractorFunc(func(doc *goquery.Document) (*book.Book, error) {
+		b, err := book.GoodreadsExtractor{}.Extract(doc)
+		if err == nil {
+			b.Title = "extracted " + b.Title
+		}
+		return b, err
+	})
+	c := crawler.NewCrawler(crawler.WithMaxDepth(1), crawler.WithMaxReadAlso(3), crawler.WithExtractor(titled))
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	seed, err := c.Storage.GetBook(ctx, server.BookURL(1), 0)
+	if !(err == nil && seed != nil && strings.HasPrefix(seed.Title, "extracted ")) {
+		t.Errorf("books built by the extractor: %v %v", seed, err)
+	}
+
+	none := book.ExtractorFunc(func(*goquery.Document) (*book.Book, error) {
+		return nil, nil
+	})
+	c = crawler.NewCrawler(crawler.WithMaxDepth(1), crawler.WithMaxReadAlso(3), crawler.WithExtractor(none))
+	err = c.Crawl(ctx, server.BookURL(1))
+	if !(err != nil && strings.Contains(err.Error(), "failed to extract book")) {
+		t.Errorf("no book extracted fails the crawl: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+
+	"github.com/PuerkitoBio/goquery"
+
+	myhttp "github.com/bcap/book-crawler/http"
+)
+
+// Fetcher fetches the pages the crawler reads. When a page was redirected, the
+// Url of the returned document should be the url it was redirected to, which
+// is how the crawler notices merged books. Pages that do not exist should
+// fail with an ErrFetch carrying a 404 status code
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (*goquery.Document, error)
+}
+
+// FetcherFunc adapts a function to a Fetcher
+type FetcherFunc func(ctx context.Context, url string) (*goquery.Document, error)
+
+func (f FetcherFunc) Fetch(ctx context.Context, url string) (*goquery.Document, error) {
+	return f(ctx, url)
+}
+
+// HTTPFetcher fetches pages over http, used by default with the crawler Client
+type HTTPFetcher struct {
+	Client *myhttp.Client
+}
+
+func (f HTTPFetcher) Fetch(ctx context.Context, url string) (*goquery.Document, error) {
+	content, finalURL, err := f.fetchContent(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return newDocument(content, finalURL)
+}
+
+// fetchContent returns the raw page and the url of the page after following
+// redirects
+func (f HTTPFetcher) fetchContent(ctx context.Context, url string) ([]byte, string, error) {
+	res, err := f.Client.Request(ctx, "GET", url, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return nil, "", ErrFetch{URL: url, StatusCode: res.StatusCode}
+	}
+
+	finalURL := url
+	if res.Request != nil && res.Request.URL != nil {
+		finalURL = res.Request.URL.String()
+	}
+	content, err := io.ReadAll(res.Body)
+	return content, finalURL, err
+}
+
+// contentFetcher is implemented by fetchers with access to the raw pages, which
+// are then stored and reduced as they are instead of rendered back from the
+// parsed document
+type contentFetcher interface {
+	fetchContent(ctx context.Context, url string) ([]byte, string, error)
+}
+
+func newDocument(content []byte, pageURL string) (*goquery.Document, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	doc.Url, _ = url.Parse(pageURL)
+	return doc, nil
+}
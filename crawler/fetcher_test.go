@@ -0,0 +1,147 @@
+package crawler_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+)
+
+type page struct {
+	content  string
+	finalURL string
+}
+
+// pages serves saved pages, as a fixture backed fetcher would in tests
+type pages struct {
+	mutex   sync.Mutex
+	byURL   map[string]page
+	fetched int
+}
+
+func (p *pages) Fetch(ctx context.Context, pageURL string) (*goquery.Document, error) {
+	p.mutex.Lock()
+	saved, has := p.byURL[pageURL]
+	p.fetched++
+	p.mutex.Unlock()
+	if !has {
+		return nil, crawler.ErrFetch{URL: pageURL, StatusCode: http.StatusNotFound}
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(saved.content))
+	if err != nil {
+		return nil, err
+	}
+	doc.Url, err = url.Parse(saved.finalURL)
+	return doc, err
+}
+
+// record saves every page fetched over http
+func record(saved *pages) crawler.Fetcher {
+	fetcher := crawler.HTTPFetcher{Client: myhttp.NewClient(semaphore.NewWeighted(10), nil)}
+	return crawler.FetcherFunc(func(ctx context.Context, pageURL string) (*goquery.Document, error) {
+		doc, err := fetcher.Fetch(ctx, pageURL)
+		if err != nil {
+			return nil, err
+		}
+		content, err := goquery.OuterHtml(doc.Selection)
+		if err != nil {
+			return nil, err
+		}
+		saved.mutex.Lock()
+		saved.byURL[pageURL] = page{content: content, finalURL: doc.Url.String()}
+		saved.mutex.Unlock()
+		return doc, nil
+	})
+}
+
+// fetcherCrawl returns the edges of every book crawled, by book url
+func fetcherCrawl(t *testing.T, ctx context.Context, seed string, options ...crawler.CrawlerOption) map[string][]string {
+	t.Helper()
+	options = append([]crawler.CrawlerOption{
+		crawler.WithMaxDepth(2),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(10),
+		crawler.WithFollowSimilarAuthors(true),
+	}, options...)
+	c := crawler.NewCrawler(options...)
+	if err := c.Crawl(ctx, seed); err != nil {
+		t.Fatal(err)
+	}
+	graph := map[string][]string{}
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		edges := []string{}
+		for _, edge := range b.AlsoRead {
+			edges = append(edges, edge.To.URL+" "+edge.Source)
+		}
+		sort.Strings(edges)
+		graph[b.URL] = edges
+		return nil
+	})
+	return graph
+}
+
+// TestFetcher checks that a crawl can be replayed without network access from
+// pages saved by a fetcher, giving the same graph including redirected books,
+// also when pages are reduced, and that pages missing from the fetcher are
+// skipped like deleted books
+func TestFetcher(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(200, 3)
+	server.Redirects = map[int]int{1: 120}
+	seed := server.BookURL(1)
+
+	saved := &pages{byURL: map[string]page{}}
+	live := fetcherCrawl(t, ctx, seed, crawler.WithFetcher(record(saved)))
+	server.Close()
+	if len(live) <= 10 {
+		t.Errorf("live crawl: %d books, %d pages saved", len(live), len(saved.byURL))
+	}
+	_, hasRedirected := live[seed]
+	redirect := saved.byURL[seed]
+	if !(redirect.finalURL == server.BookURL(120) && !hasRedirected) {
+		t.Errorf("live crawl: redirected book saved with its final url %q and not crawled", redirect.finalURL)
+	}
+
+	// the server is gone, so anything not served by the fetcher fails
+	replayed := fetcherCrawl(t, ctx, seed, crawler.WithFetcher(saved))
+	if !reflect.DeepEqual(live, replayed) {
+		t.Errorf("replayed crawl: same graph (%d books, %d live)", len(replayed), len(live))
+	}
+	if saved.fetched <= 0 {
+		t.Errorf("replayed crawl: pages served by the fetcher (%d)", saved.fetched)
+	}
+
+	reduced := fetcherCrawl(t, ctx, seed, crawler.WithFetcher(saved), crawler.WithReducedPages(true))
+	if !reflect.DeepEqual(live, reduced) {
+		t.Errorf("replayed crawl with reduced pages: same graph (%d books)", len(reduced))
+	}
+
+	// a page missing from the fetcher is skipped like a deleted book
+	var missing string
+	for _, edge := range live[server.BookURL(120)] {
+		missing = strings.Fields(edge)[0]
+		break
+	}
+	delete(saved.byURL, missing)
+	withMissing := fetcherCrawl(t, ctx, seed, crawler.WithFetcher(saved))
+	_, hasMissing := withMissing[missing]
+	if !(missing != "" && !hasMissing && len(withMissing) > 1) {
+		t.Errorf("missing page %s skipped, %d books crawled", missing, len(withMissing))
+	}
+
+}
@@ -0,0 +1,103 @@
+package crawler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+)
+
+const genreFilterNumBooks = 200
+
+// genreFilterCrawl returns how many books were persisted by genre, and how many were
+// filtered
+func genreFilterCrawl(t *testing.T, ctx context.Context, server *fixture.Server, options ...crawler.CrawlerOption) (map[string]int, int) {
+	t.Helper()
+	options = append([]crawler.CrawlerOption{
+		crawler.WithMaxDepth(4),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(10),
+	}, options...)
+	c := crawler.NewCrawler(options...)
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	byGenre := map[string]int{}
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		for _, genre := range b.Genres {
+			byGenre[genre]++
+		}
+		return nil
+	})
+
+	urls := make([]string, genreFilterNumBooks)
+	for id := range urls {
+		urls[id] = server.BookURL(id)
+	}
+	states, err := c.Storage.GetBookStates(ctx, urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtered := 0
+	for _, state := range states {
+		if state.State == storage.Filtered {
+			filtered++
+		}
+	}
+	return byGenre, filtered
+}
+
+// TestGenreFilter checks that the genre filters, matched case insensitively,
+// only persist books with an included genre and never books with an excluded
+// one, filtering out the others, and that no genres disables them
+func TestGenreFilter(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	// the fixture gives book id the single genre "Genre <id%10>"
+	server := fixture.NewServer(genreFilterNumBooks, 3)
+	defer server.Close()
+
+	all, filtered := genreFilterCrawl(t, ctx, server)
+	if !(len(all) > 3 && filtered == 0) {
+		t.Errorf("no genres disables the filters (%d genres, %d filtered)", len(all), filtered)
+	}
+
+	// book 1 links to books 8, 9 and 10, which link to books of genres 8 and
+	// 9 among others
+	included, filtered := genreFilterCrawl(t, ctx, server, crawler.WithIncludeGenres("genre 1", " GENRE 8 ", "Genre 9"))
+	others := 0
+	for genre, count := range included {
+		if genre != "Genre 1" && genre != "Genre 8" && genre != "Genre 9" {
+			others += count
+		}
+	}
+	if !(included["Genre 8"] > 1 && included["Genre 9"] > 1) {
+		t.Errorf("books with included genres persisted (%v)", included)
+	}
+	if others != 0 {
+		t.Errorf("no books with other genres persisted (%d)", others)
+	}
+	if filtered <= 0 {
+		t.Errorf("books with other genres filtered (%d)", filtered)
+	}
+
+	excluded, filtered := genreFilterCrawl(t, ctx, server, crawler.WithExcludeGenres("Genre 4", "genre 8"))
+	if !(len(excluded) > 3 && excluded["Genre 4"] == 0 && excluded["Genre 8"] == 0) {
+		t.Errorf("no books with excluded genres persisted (%v)", excluded)
+	}
+	if filtered <= 0 {
+		t.Errorf("books with excluded genres filtered (%d)", filtered)
+	}
+
+	both, _ := genreFilterCrawl(t, ctx, server, crawler.WithIncludeGenres("Genre 1", "Genre 8", "Genre 9"), crawler.WithExcludeGenres("genre 9"))
+	if !(both["Genre 8"] > 0 && both["Genre 9"] == 0 && len(both) == 2) {
+		t.Errorf("exclusions win over inclusions (%v)", both)
+	}
+
+}
@@ -0,0 +1,84 @@
+package crawler_test
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+// includeSeedCrawl crawls from the seed and returns the crawler and the
+// sorted urls of the persisted books
+func includeSeedCrawl(t *testing.T, server *fixture.Server, seed int, includeSeed bool) (*crawler.Crawler, []string) {
+	t.Helper()
+	ctx := context.Background()
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(2),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithIncludeSeed(includeSeed),
+	)
+	if err := c.Crawl(ctx, server.BookURL(seed)); err != nil {
+		t.Fatalf("crawl with include seed %v succeeded: %v", includeSeed, err)
+	}
+	persisted := []string{}
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		persisted = append(persisted, b.URL)
+		return nil
+	})
+	sort.Strings(persisted)
+	return c, persisted
+}
+
+// TestIncludeSeed checks that WithIncludeSeed(false) crawls the same books
+// from the seed without persisting the seed itself, and that the books the
+// seed links to become the roots of the crawl instead
+func TestIncludeSeed(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+	seed := 1
+	seedURL := server.BookURL(seed)
+
+	included, includedBooks := includeSeedCrawl(t, server, seed, true)
+	if roots := included.RootURLs(); strings.Join(roots, " ") != seedURL {
+		t.Errorf("the seed is the root when included (%v)", roots)
+	}
+	seedBook, err := included.Storage.GetBook(ctx, seedURL, 1)
+	if err != nil || seedBook == nil {
+		t.Fatalf("the seed is persisted when included (%v)", err)
+	}
+	seedLinks := []string{}
+	for _, edge := range seedBook.AlsoRead {
+		seedLinks = append(seedLinks, edge.To.URL)
+	}
+	sort.Strings(seedLinks)
+	if len(seedLinks) == 0 {
+		t.Fatalf("the seed links to other books")
+	}
+
+	excluded, excludedBooks := includeSeedCrawl(t, server, seed, false)
+	if b, err := excluded.Storage.GetBook(ctx, seedURL, 0); err != nil || b != nil {
+		t.Errorf("the seed is not persisted when excluded (%v, %v)", b, err)
+	}
+	expectedBooks := []string{}
+	for _, url := range includedBooks {
+		if url != seedURL {
+			expectedBooks = append(expectedBooks, url)
+		}
+	}
+	if strings.Join(excludedBooks, " ") != strings.Join(expectedBooks, " ") {
+		t.Errorf("the same books crawled without the seed (%d, expected %d)", len(excludedBooks), len(expectedBooks))
+	}
+	roots := excluded.RootURLs()
+	sort.Strings(roots)
+	if strings.Join(roots, " ") != strings.Join(seedLinks, " ") {
+		t.Errorf("the books the seed links to are the roots when excluded (%v, expected %v)", roots, seedLinks)
+	}
+}
@@ -0,0 +1,125 @@
+package crawler_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+)
+
+func languageExtract(t *testing.T, rows map[string]string) *book.Book {
+	t.Helper()
+	page := `<html><body><div id="bookDataBox">`
+	for title, item := range rows {
+		page += `<div class="clearFloats"><div class="infoBoxRowTitle">` + title + `</div>` +
+			`<div class="infoBoxRowItem">` + item + `</div></div>`
+	}
+	page += `</div></body></html>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := book.New("https://www.goodreads.com/book/show/1")
+	book.Build(b, doc)
+	return b
+}
+
+// TestLanguage checks that the edition language is extracted from the book
+// data box, and that the language filter neither persists nor follows books
+// in other languages
+func TestLanguage(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	cases := []struct {
+		name     string
+		rows     map[string]string
+		language string
+	}{
+		{"language row", map[string]string{"ISBN": "0441013597", "Edition Language": "English"}, "English"},
+		{"spaced out", map[string]string{"Edition Language": "\n  Portuguese\n"}, "Portuguese"},
+		{"no language row", map[string]string{"ISBN": "0441013597"}, ""},
+	}
+	for _, c := range cases {
+		b := languageExtract(t, c.rows)
+		if b.Language != c.language {
+			t.Errorf("%s: %q, expected %q", c.name, b.Language, c.language)
+		}
+	}
+
+	ctx := context.Background()
+	server := fixture.NewServer(200, 3)
+	defer server.Close()
+
+	// the fixture has every fourth book in spanish, the others in english
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(4),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(10),
+		crawler.WithLanguages(" english"),
+	)
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	persisted, other := 0, 0
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		persisted++
+		if b.Language != "English" {
+			other++
+		}
+		return nil
+	})
+	if persisted <= 1 {
+		t.Errorf("books in the allowed languages persisted (%d)", persisted)
+	}
+	if other != 0 {
+		t.Errorf("no books in other languages persisted (%d)", other)
+	}
+
+	urls := make([]string, 200)
+	for id := range urls {
+		urls[id] = server.BookURL(id)
+	}
+	states, err := c.Storage.GetBookStates(ctx, urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtered := 0
+	for _, state := range states {
+		if state.State == storage.Filtered {
+			filtered++
+		}
+	}
+	if filtered <= 0 {
+		t.Errorf("books in other languages filtered (%d)", filtered)
+	}
+
+	// no languages allows every language
+	c = crawler.NewCrawler(
+		crawler.WithMaxDepth(4),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(10),
+		crawler.WithLanguages(),
+	)
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	spanish := 0
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		if b.Language == "Spanish" {
+			spanish++
+		}
+		return nil
+	})
+	if spanish <= 0 {
+		t.Errorf("no languages disables the check (%d spanish books)", spanish)
+	}
+
+}
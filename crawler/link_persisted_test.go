@@ -0,0 +1,60 @@
+package crawler_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+// TestLinkPersisted checks that when filters drop some of the related books,
+// books are only linked to the related books that were persisted, leaving no
+// dangling edges behind
+func TestLinkPersisted(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	// the seed is related to books 15, 16 and 17, rated 1.15, 2.16 and 3.17
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(3),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMinRating(book.NewRating(2)),
+	)
+	if err := c.Crawl(ctx, server.BookURL(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	persisted := map[string]*book.Book{}
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		persisted[b.URL] = b
+		return nil
+	})
+	edges := 0
+	for _, b := range persisted {
+		for _, edge := range b.AlsoRead {
+			edges++
+			if persisted[edge.To.URL] == nil {
+				t.Errorf("book %s linked to %s, which was not persisted", b.URL, edge.To.URL)
+			}
+		}
+	}
+	if edges == 0 {
+		t.Errorf("books linked to the persisted ones")
+	}
+
+	seed := persisted[server.BookURL(2)]
+	linked := []string{}
+	for _, edge := range seed.AlsoRead {
+		linked = append(linked, edge.To.URL)
+	}
+	if expected := []string{server.BookURL(16), server.BookURL(17)}; !reflect.DeepEqual(linked, expected) {
+		t.Errorf("seed linked to %v, expected %v", linked, expected)
+	}
+}
@@ -0,0 +1,123 @@
+package crawler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+)
+
+const maxBooksNumBooks = 200
+
+func maxBooksCrawl(t *testing.T, ctx context.Context, server *fixture.Server, options ...crawler.CrawlerOption) *crawler.Crawler {
+	t.Helper()
+	options = append([]crawler.CrawlerOption{
+		crawler.WithMaxDepth(5),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(10),
+	}, options...)
+	c := crawler.NewCrawler(options...)
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func maxBooksCountBooks(t *testing.T, ctx context.Context, c *crawler.Crawler) int {
+	t.Helper()
+	count := 0
+	err := c.Storage.GetAllBooks(ctx, func(*book.Book) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func countBeingCrawled(t *testing.T, ctx context.Context, server *fixture.Server, c *crawler.Crawler) int {
+	t.Helper()
+	urls := make([]string, maxBooksNumBooks)
+	for id := range urls {
+		urls[id] = server.BookURL(id)
+	}
+	states, err := c.Storage.GetBookStates(ctx, urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for _, state := range states {
+		if state.State == storage.BeingCrawled {
+			count++
+		}
+	}
+	return count
+}
+
+// TestMaxBooks checks that a crawl limited to a number of books persists at
+// most that many books, even when crawling in parallel and filtering books
+// out, finishes without errors and leaves no book being crawled behind
+func TestMaxBooks(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	ctx := context.Background()
+	server := fixture.NewServer(maxBooksNumBooks, 3)
+	defer server.Close()
+
+	// how many books fit within a max depth depends on the order parallel
+	// paths reach them, so compare crawls deep enough to reach every book
+	deep := crawler.WithMaxDepth(maxBooksNumBooks)
+	unlimited := maxBooksCountBooks(t, ctx, maxBooksCrawl(t, ctx, server, deep))
+	if unlimited <= 20 {
+		t.Errorf("an unlimited crawl persists enough books for the checks (%d)", unlimited)
+	}
+
+	zero := maxBooksCountBooks(t, ctx, maxBooksCrawl(t, ctx, server, deep, crawler.WithMaxBooks(0)))
+	if zero != unlimited {
+		t.Errorf("zero disables the limit (%d books, expected %d)", zero, unlimited)
+	}
+
+	for _, limit := range []int32{1, 7, 20} {
+		c := maxBooksCrawl(t, ctx, server, crawler.WithMaxBooks(limit))
+		persisted := maxBooksCountBooks(t, ctx, c)
+		if persisted != int(limit) {
+			t.Errorf("limit of %d: persisted %d books", limit, persisted)
+		}
+		beingCrawled := countBeingCrawled(t, ctx, server, c)
+		if beingCrawled != 0 {
+			t.Errorf("limit of %d: no books left being crawled (%d)", limit, beingCrawled)
+		}
+	}
+
+	// filtered books do not count towards the limit
+	c := maxBooksCrawl(t, ctx, server, crawler.WithMaxBooks(10), crawler.WithLanguages("english"))
+	persisted := maxBooksCountBooks(t, ctx, c)
+	if persisted != 10 {
+		t.Errorf("filtered books do not take up the limit (%d books)", persisted)
+	}
+
+	// an excluded seed does not count either
+	c = maxBooksCrawl(t, ctx, server, crawler.WithMaxBooks(5), crawler.WithIncludeSeed(false))
+	persisted = maxBooksCountBooks(t, ctx, c)
+	if persisted != 5 {
+		t.Errorf("an excluded seed does not take up the limit (%d books)", persisted)
+	}
+
+	// the limit is per run
+	c = crawler.NewCrawler(crawler.WithMaxDepth(5), crawler.WithMaxReadAlso(3), crawler.WithMaxBooks(5))
+	for run := 1; run <= 2; run++ {
+		if err := c.Crawl(ctx, server.BookURL(run*50)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	persisted = maxBooksCountBooks(t, ctx, c)
+	if persisted != 10 {
+		t.Errorf("every run persists up to the limit (%d books in 2 runs)", persisted)
+	}
+
+}
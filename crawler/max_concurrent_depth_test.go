@@ -0,0 +1,121 @@
+package crawler_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+// fetchSpan is when a page of a book was being served
+type fetchSpan struct {
+	id         string
+	start, end time.Time
+}
+
+// fetchRecorder serves the fixture pages while recording when each book and
+// similar books page was served
+type fetchRecorder struct {
+	*httptest.Server
+	mutex sync.Mutex
+	spans []fetchSpan
+}
+
+func newFetchRecorder(server *fixture.Server) *fetchRecorder {
+	r := &fetchRecorder{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		server.Config.Handler.ServeHTTP(w, req)
+		parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/"), "/")
+		if len(parts) == 3 && parts[0] == "book" {
+			r.mutex.Lock()
+			r.spans = append(r.spans, fetchSpan{id: parts[2], start: start, end: time.Now()})
+			r.mutex.Unlock()
+		}
+	}))
+	return r
+}
+
+// maxConcurrentDepthCrawl crawls the fixture through a recorder, returning
+// the sorted urls crawled and the widest span of depth levels seen served at
+// the same time
+func maxConcurrentDepthCrawl(t *testing.T, maxConcurrentDepth int) ([]string, int) {
+	t.Helper()
+	ctx := context.Background()
+	server := fixture.NewServer(300, 3)
+	defer server.Close()
+	server.Delay = 2 * time.Millisecond
+	recorder := newFetchRecorder(server)
+	defer recorder.Close()
+
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(4),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(8),
+		crawler.WithMaxConcurrentDepth(maxConcurrentDepth),
+		crawler.WithTrackProvenance(true),
+	)
+	if err := c.Crawl(ctx, recorder.URL+"/book/show/1"); err != nil {
+		t.Fatal(err)
+	}
+
+	depths := map[string]int{}
+	urls := []string{}
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		depths[b.URL[strings.LastIndex(b.URL, "/")+1:]] = b.DiscoveredDepth
+		urls = append(urls, strings.TrimPrefix(b.URL, recorder.URL))
+		return nil
+	})
+	sort.Strings(urls)
+
+	// a page is served while its fetch is admitted by the gate, so pages
+	// served at the same time are of depth levels open at the same time
+	widest := 0
+	for i, a := range recorder.spans {
+		min, max := depths[a.id], depths[a.id]
+		for j, b := range recorder.spans {
+			if i == j || !(b.start.Before(a.end) && a.start.Before(b.end)) {
+				continue
+			}
+			if depth := depths[b.id]; depth < min {
+				min = depth
+			} else if depth > max {
+				max = depth
+			}
+		}
+		if span := max - min + 1; span > widest {
+			widest = span
+		}
+	}
+	return urls, widest
+}
+
+// TestMaxConcurrentDepth checks that WithMaxConcurrentDepth never has pages
+// of more depth levels than allowed being fetched at the same time, and that
+// it crawls the same books as a crawl without the limit
+func TestMaxConcurrentDepth(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	expected, _ := maxConcurrentDepthCrawl(t, 0)
+	for _, maxConcurrentDepth := range []int{1, 2} {
+		t.Run(fmt.Sprint(maxConcurrentDepth), func(t *testing.T) {
+			urls, widest := maxConcurrentDepthCrawl(t, maxConcurrentDepth)
+			if widest > maxConcurrentDepth {
+				t.Errorf("at most %d depth levels fetched at once (%d)", maxConcurrentDepth, widest)
+			}
+			if strings.Join(urls, " ") != strings.Join(expected, " ") {
+				t.Errorf("same books as without the limit (%d, expected %d)", len(urls), len(expected))
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package crawler_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+)
+
+// states counts the books of server in s by state, including the ones not
+// persisted yet
+func states(t *testing.T, ctx context.Context, server *fixture.Server, s storage.Storage) map[storage.State]int {
+	t.Helper()
+	urls := []string{}
+	for id := 0; id < server.NumBooks; id++ {
+		urls = append(urls, server.BookURL(id))
+	}
+	changes, err := s.GetBookStates(ctx, urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[storage.State]int{}
+	for _, change := range changes {
+		counts[change.State]++
+	}
+	persisted := 0
+	s.GetAllBooks(ctx, func(*book.Book) error {
+		persisted++
+		return nil
+	})
+	if persisted != counts[storage.Crawled]+counts[storage.Linked] {
+		t.Fatalf("%d books persisted but %v by state", persisted, counts)
+	}
+	return counts
+}
+
+// TestMaxDuration checks that a crawl with a max duration stops once it is
+// reached with ErrMaxDuration, keeping the books persisted until then and
+// leaving none being crawled, so a later crawl over the same storage finishes
+// the graph, and that crawls finishing in time or cancelled by their caller
+// are not affected. Also checks the memory profile is still written when the
+// max duration is reached, and that failing to write it is reported along
+// with ErrMaxDuration
+func TestMaxDuration(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	slow := fixture.NewServer(100, 3)
+	defer slow.Close()
+	slow.Delay = 20 * time.Millisecond
+
+	c := crawler.NewCrawler(crawler.WithMaxDepth(4), crawler.WithMaxReadAlso(3), crawler.WithMaxDuration(200*time.Millisecond))
+	start := time.Now()
+	err := c.Crawl(ctx, slow.BookURL(1))
+	took := time.Since(start)
+	var maxDuration crawler.ErrMaxDuration
+	if !(errors.As(err, &maxDuration) && maxDuration.MaxDuration == 200*time.Millisecond) {
+		t.Errorf("stopped with ErrMaxDuration: %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ErrMaxDuration is a deadline exceeded")
+	}
+	if took >= time.Second {
+		t.Errorf("stopped soon after the max duration (%s)", took)
+	}
+	stoppedStorage := c.Storage
+	stopped := states(t, ctx, slow, stoppedStorage)
+	if stopped[storage.Crawled]+stopped[storage.Linked] <= 0 {
+		t.Errorf("books crawled until then kept: %v", stopped)
+	}
+	if stopped[storage.BeingCrawled] != 0 {
+		t.Errorf("no books left being crawled: %v", stopped)
+	}
+
+	// the same graph, crawled in time
+	fast := fixture.NewServer(100, 3)
+	defer fast.Close()
+	c = crawler.NewCrawler(crawler.WithMaxDepth(4), crawler.WithMaxReadAlso(3), crawler.WithMaxDuration(time.Minute))
+	err = c.Crawl(ctx, fast.BookURL(1))
+	whole := states(t, ctx, fast, c.Storage)
+	if !(err == nil && whole[storage.Linked] > 0) {
+		t.Errorf("crawl finishing in time unaffected: %v %v", whole, err)
+	}
+
+	// the next crawl without a limit finishes the graph
+	resumed := crawler.NewCrawler(crawler.WithMaxDepth(4), crawler.WithMaxReadAlso(3))
+	resumed.Storage = stoppedStorage
+	err = resumed.Crawl(ctx, slow.BookURL(1))
+	finished := states(t, ctx, slow, resumed.Storage)
+	if !(err == nil && finished[storage.Linked] == whole[storage.Linked] && finished[storage.Crawled] == 0) {
+		t.Errorf("later crawl finishes the graph: %v %v", finished, err)
+	}
+
+	cancelled, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	c = crawler.NewCrawler(crawler.WithMaxDepth(4), crawler.WithMaxReadAlso(3), crawler.WithMaxDuration(time.Minute))
+	err = c.Crawl(cancelled, slow.BookURL(1))
+	if !(err != nil && !errors.As(err, &maxDuration)) {
+		t.Errorf("crawl cancelled by its caller not reported as its max duration: %v", err)
+	}
+
+	profile := filepath.Join(t.TempDir(), "mem.pprof")
+	c = crawler.NewCrawler(crawler.WithMaxDepth(4), crawler.WithMaxReadAlso(3), crawler.WithMaxDuration(100*time.Millisecond), crawler.WithMemProfile(profile))
+	err = c.Crawl(ctx, slow.BookURL(1))
+	if _, statErr := os.Stat(profile); !(errors.As(err, &maxDuration) && statErr == nil) {
+		t.Errorf("memory profile written once the max duration is reached (%v): %v", statErr, err)
+	}
+	unwritable := filepath.Join(t.TempDir(), "missing", "mem.pprof")
+	c = crawler.NewCrawler(crawler.WithMaxDepth(4), crawler.WithMaxReadAlso(3), crawler.WithMaxDuration(100*time.Millisecond), crawler.WithMemProfile(unwritable))
+	err = c.Crawl(ctx, slow.BookURL(1))
+	if !(errors.As(err, &maxDuration) && errors.Is(err, context.DeadlineExceeded) && strings.Contains(fmt.Sprint(err), "memory profile")) {
+		t.Errorf("failing to write the memory profile reported along with the max duration: %v", err)
+	}
+}
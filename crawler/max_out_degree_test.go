@@ -0,0 +1,116 @@
+package crawler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+const maxOutDegreeNumBooks = 200
+const maxOutDegreeNumLinks = 5
+
+func maxOutDegreeCrawl(t *testing.T, server *fixture.Server, options ...crawler.CrawlerOption) []*book.Book {
+	t.Helper()
+	ctx := context.Background()
+	options = append([]crawler.CrawlerOption{
+		crawler.WithMaxReadAlso(maxOutDegreeNumLinks),
+		crawler.WithRecommendationSources(book.SourceAlsoRead, book.SourceReadersAlsoEnjoyed),
+	}, options...)
+	c := crawler.NewCrawler(options...)
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	books := []*book.Book{}
+	err := c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		books = append(books, b)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return books
+}
+
+// TestMaxOutDegree checks that WithMaxOutDegree caps how many books each book
+// links to across every recommendation source, following the related books
+// with the best priority first, that related books which could not be linked
+// leave room for others, and that no book is crawled without being linked
+func TestMaxOutDegree(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	server := fixture.NewServer(maxOutDegreeNumBooks, maxOutDegreeNumLinks)
+	defer server.Close()
+	// the first of the similar books of the seed (8 to 12) is gone
+	server.Missing = map[int]bool{8: true}
+
+	edgesOf := func(books []*book.Book, url string) map[string][]string {
+		edges := map[string][]string{}
+		for _, b := range books {
+			if b.URL != url {
+				continue
+			}
+			for _, edge := range b.AlsoRead {
+				edges[edge.Source] = append(edges[edge.Source], edge.To.URL)
+			}
+		}
+		return edges
+	}
+
+	// the missing book does not take up room, so the next ones are linked
+	books := maxOutDegreeCrawl(t, server, crawler.WithMaxDepth(1), crawler.WithMaxOutDegree(3))
+	edges := edgesOf(books, server.BookURL(1))
+	expected := []string{server.BookURL(9), server.BookURL(10), server.BookURL(11)}
+	if !(len(edges) == 1 && equalSets(edges[book.SourceAlsoRead], expected)) {
+		t.Errorf("seed links to the best similar books that could be linked: %v", edges)
+	}
+	if len(books) != 1+len(expected) {
+		t.Errorf("only the linked books are crawled (%d books)", len(books))
+	}
+
+	// readers also enjoyed books take what is left once the similar ones
+	// (9 to 12) are linked, from 13 on as 12 is among the similar ones
+	books = maxOutDegreeCrawl(t, server, crawler.WithMaxDepth(1), crawler.WithMaxOutDegree(6))
+	edges = edgesOf(books, server.BookURL(1))
+	enjoyed := []string{server.BookURL(13), server.BookURL(14)}
+	if !(len(edges[book.SourceAlsoRead]) == 4 && equalSets(edges[book.SourceReadersAlsoEnjoyed], enjoyed)) {
+		t.Errorf("the cap is shared between recommendation sources: %v", edges)
+	}
+
+	// deeper down no book goes over the cap, and every book but the seed is
+	// linked from another one
+	books = maxOutDegreeCrawl(t, server, crawler.WithMaxDepth(3), crawler.WithMaxOutDegree(2))
+	linked := map[string]bool{server.BookURL(1): true}
+	for _, b := range books {
+		if len(b.AlsoRead) > 2 {
+			t.Errorf("%s links to at most 2 books (%d)", b.URL, len(b.AlsoRead))
+		}
+		for _, edge := range b.AlsoRead {
+			linked[edge.To.URL] = true
+		}
+	}
+	for _, b := range books {
+		if !linked[b.URL] {
+			t.Errorf("crawled book %s is linked", b.URL)
+		}
+	}
+}
+
+func equalSets(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := map[string]bool{}
+	for _, s := range a {
+		set[s] = true
+	}
+	for _, s := range b {
+		if !set[s] {
+			return false
+		}
+	}
+	return true
+}
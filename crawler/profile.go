@@ -0,0 +1,51 @@
+package crawler
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+
+	"github.com/bcap/book-crawler/log"
+)
+
+func (c *Crawler) startCPUProfile() (func(), error) {
+	if c.cpuProfilePath == "" {
+		return func() {}, nil
+	}
+	f, err := os.Create(c.cpuProfilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cpu profile file: %w", err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to start cpu profile: %w", err)
+	}
+	stop := func() {
+		pprof.StopCPUProfile()
+		if err := f.Close(); err != nil {
+			log.Warnf("failed to close cpu profile file %s: %v", c.cpuProfilePath, err)
+			return
+		}
+		log.Infof("cpu profile written to %s", c.cpuProfilePath)
+	}
+	return stop, nil
+}
+
+func (c *Crawler) writeMemProfile() error {
+	if c.memProfilePath == "" {
+		return nil
+	}
+	f, err := os.Create(c.memProfilePath)
+	if err != nil {
+		return fmt.Errorf("failed to create memory profile file: %w", err)
+	}
+	defer f.Close()
+	// get up-to-date statistics
+	runtime.GC()
+	if err := pprof.Lookup("allocs").WriteTo(f, 0); err != nil {
+		return fmt.Errorf("failed to write memory profile: %w", err)
+	}
+	log.Infof("memory profile written to %s", c.memProfilePath)
+	return nil
+}
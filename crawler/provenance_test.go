@@ -0,0 +1,80 @@
+package crawler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+// provenanceCrawl crawls the fixture from the seeds and returns every book
+// persisted by url
+func provenanceCrawl(t *testing.T, server *fixture.Server, seeds []string, trackProvenance bool) map[string]*book.Book {
+	t.Helper()
+	ctx := context.Background()
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(3),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(8),
+		crawler.WithTrackProvenance(trackProvenance),
+	)
+	if err := c.CrawlMany(ctx, seeds); err != nil {
+		t.Fatal(err)
+	}
+	books := map[string]*book.Book{}
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		books[b.URL] = b
+		return nil
+	})
+	return books
+}
+
+// TestTrackProvenance checks that WithTrackProvenance records on every book
+// the book it was first found from, which links to it, one depth level above
+// it and reached from the same seed, with seeds found from nowhere at depth 0,
+// and that nothing is recorded without it
+func TestTrackProvenance(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	server := fixture.NewServer(300, 3)
+	defer server.Close()
+	seeds := []string{server.BookURL(1), server.BookURL(150)}
+
+	books := provenanceCrawl(t, server, seeds, true)
+	for _, seed := range seeds {
+		b := books[seed]
+		if b == nil || b.DiscoveredFrom != "" || b.DiscoveredDepth != 0 || b.DiscoveredSeed != seed {
+			t.Errorf("seed %s found from nowhere at depth 0 (%+v)", seed, b)
+		}
+	}
+	for url, b := range books {
+		if b.DiscoveredFrom == "" {
+			continue
+		}
+		from := books[b.DiscoveredFrom]
+		if from == nil {
+			t.Errorf("%s found from a persisted book (%s)", url, b.DiscoveredFrom)
+			continue
+		}
+		linked := false
+		for _, edge := range from.AlsoRead {
+			linked = linked || edge.To.URL == url
+		}
+		if !linked {
+			t.Errorf("%s found from a book linking to it (%s)", url, b.DiscoveredFrom)
+		}
+		if b.DiscoveredDepth != from.DiscoveredDepth+1 || b.DiscoveredSeed != from.DiscoveredSeed {
+			t.Errorf("%s found one level below %s from the same seed (%d, %s and %d, %s)",
+				url, from.URL, b.DiscoveredDepth, b.DiscoveredSeed, from.DiscoveredDepth, from.DiscoveredSeed)
+		}
+	}
+
+	for url, b := range provenanceCrawl(t, server, seeds, false) {
+		if b.DiscoveredFrom != "" || b.DiscoveredDepth != 0 || b.DiscoveredSeed != "" {
+			t.Errorf("no provenance recorded on %s without tracking (%s, %d, %s)", url, b.DiscoveredFrom, b.DiscoveredDepth, b.DiscoveredSeed)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package crawler_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+)
+
+func publishedYearExtract(t *testing.T, rows ...string) *book.Book {
+	t.Helper()
+	page := `<html><body><div id="details">`
+	for _, row := range rows {
+		page += `<div class="row">` + row + `</div>`
+	}
+	page += `</div></body></html>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := book.New("https://www.goodreads.com/book/show/1")
+	book.Build(b, doc)
+	return b
+}
+
+// TestPublishedYear checks that the publication year is extracted from the
+// Published row of the book details, and that the min and max year filters
+// neither persist nor follow books outside of the range
+func TestPublishedYear(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	cases := []struct {
+		name string
+		rows []string
+		year int32
+	}{
+		{"full date", []string{"Hardcover, 412 pages", "Published May 5th 2015 by Tor Books"}, 2015},
+		{"multi line", []string{"\n  Published\n  August 1st 1965\n  by Chilton Books\n  <nobr class=\"greyText\">(first published 1965)</nobr>\n"}, 1965},
+		{"only the year", []string{"Published 1999"}, 1999},
+		{"year like publisher", []string{"Published 2003 by 1984 Publishing"}, 2003},
+		{"no published row", []string{"Hardcover, 412 pages"}, 0},
+		{"no year", []string{"Published by Tor Books"}, 0},
+	}
+	for _, c := range cases {
+		b := publishedYearExtract(t, c.rows...)
+		if b.PublishedYear != c.year {
+			t.Errorf("%s: %d, expected %d", c.name, b.PublishedYear, c.year)
+		}
+	}
+
+	ctx := context.Background()
+	server := fixture.NewServer(200, 3)
+	defer server.Close()
+
+	const minYear, maxYear = 1955, 1990
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(4),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(10),
+		crawler.WithMinPublishedYear(minYear),
+		crawler.WithMaxPublishedYear(maxYear),
+	)
+	// the seed, book 30, is published in 1980
+	if err := c.Crawl(ctx, server.BookURL(30)); err != nil {
+		t.Fatal(err)
+	}
+
+	persisted, outside := 0, 0
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		persisted++
+		if b.PublishedYear < minYear || b.PublishedYear > maxYear {
+			outside++
+		}
+		return nil
+	})
+	if persisted <= 1 {
+		t.Errorf("books in range persisted (%d)", persisted)
+	}
+	if outside != 0 {
+		t.Errorf("no books outside of the range persisted (%d)", outside)
+	}
+
+	urls := make([]string, 200)
+	for id := range urls {
+		urls[id] = server.BookURL(id)
+	}
+	states, err := c.Storage.GetBookStates(ctx, urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtered, followedFiltered := 0, 0
+	for _, state := range states {
+		if state.State == storage.Filtered {
+			filtered++
+		}
+	}
+	root, err := c.Storage.GetBook(ctx, server.BookURL(30), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range book.Collect(root) {
+		for _, edge := range b.AlsoRead {
+			if edge.To.PublishedYear != 0 && (edge.To.PublishedYear < minYear || edge.To.PublishedYear > maxYear) {
+				followedFiltered++
+			}
+		}
+	}
+	if filtered <= 0 {
+		t.Errorf("books outside of the range filtered (%d)", filtered)
+	}
+	if followedFiltered != 0 {
+		t.Errorf("no edges to books outside of the range (%d)", followedFiltered)
+	}
+
+}
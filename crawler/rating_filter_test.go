@@ -0,0 +1,64 @@
+package crawler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+)
+
+// TestRatingFilter checks the min and max rating set in the config are both
+// honored: books rated out of their range are filtered instead of persisted
+func TestRatingFilter(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	// books are rated from 1.00 to 5.99, and the seed 3.02
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+
+	config := crawler.DefaultConfig()
+	config.MaxDepth = 3
+	config.MaxReadAlso = 3
+	config.MinRating = book.NewRating(2)
+	config.MaxRating = book.NewRating(4)
+	c := crawler.NewCrawler(crawler.ConfigToOptions(config)...)
+	if err := c.Crawl(ctx, server.BookURL(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	persisted := 0
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		persisted++
+		if b.Rating < config.MinRating || b.Rating > config.MaxRating {
+			t.Errorf("book %s rated %v persisted", b.URL, b.Rating)
+		}
+		return nil
+	})
+	if persisted < 2 {
+		t.Errorf("books in the rating range persisted (%d)", persisted)
+	}
+
+	filtered := map[string]bool{}
+	for id := 0; id < server.NumBooks; id++ {
+		state, err := c.Storage.GetBookState(ctx, server.BookURL(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state.State != storage.Filtered {
+			continue
+		}
+		if rating := book.NewRating(float32(1+id%5) + float32(id%100)/100); rating <= config.MaxRating {
+			filtered["below"] = true
+		} else {
+			filtered["above"] = true
+		}
+	}
+	if !filtered["below"] || !filtered["above"] {
+		t.Errorf("books rated below and above the range filtered: %v", filtered)
+	}
+}
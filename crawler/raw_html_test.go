@@ -0,0 +1,92 @@
+package crawler_test
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/html"
+	"github.com/bcap/book-crawler/log"
+)
+
+// TestRawHTMLStore checks that WithRawHTMLStore saves the page of every book
+// crawled, indexed by its url, and that extracting the saved pages again
+// gives back the books persisted by the crawl
+func TestRawHTMLStore(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(50, 3)
+	defer server.Close()
+	dir := t.TempDir()
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(2),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithRawHTMLStore(dir),
+	)
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	persisted := map[string]*book.Book{}
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		persisted[b.URL] = b
+		return nil
+	})
+
+	store := html.NewStore(dir)
+	index, err := store.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes, err := store.Hashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := []string{}
+	for _, hash := range hashes {
+		url, has := index[hash]
+		if !has {
+			t.Errorf("stored page %s is indexed", hash)
+			continue
+		}
+		stored = append(stored, url)
+
+		reader, err := store.Open(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := goquery.NewDocumentFromReader(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		reextracted := book.New(url)
+		book.Build(reextracted, doc)
+		original := persisted[url]
+		if original == nil {
+			t.Errorf("stored page %s is of a persisted book", url)
+			continue
+		}
+		if reextracted.Title != original.Title || reextracted.Author != original.Author ||
+			reextracted.Rating != original.Rating || reextracted.RatingsTotal != original.RatingsTotal ||
+			strings.Join(reextracted.Genres, ",") != strings.Join(original.Genres, ",") {
+			t.Errorf("re-extracting %s gives the persisted book (%+v, expected %+v)", url, reextracted, original)
+		}
+	}
+
+	expected := make([]string, 0, len(persisted))
+	for url := range persisted {
+		expected = append(expected, url)
+	}
+	sort.Strings(expected)
+	sort.Strings(stored)
+	if len(expected) == 0 || strings.Join(stored, " ") != strings.Join(expected, " ") {
+		t.Errorf("a page stored per crawled book (%d pages, %d books)", len(stored), len(expected))
+	}
+}
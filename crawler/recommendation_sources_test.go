@@ -0,0 +1,128 @@
+package crawler_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+func recommendationSourcesExtract(t *testing.T, page string) []string {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><body>" + page + "</body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return (&crawler.GoodreadsAdapter{}).ReadersAlsoEnjoyedURLs("https://www.goodreads.com/book/show/1", doc)
+}
+
+// recommendationSourcesCrawl returns the edges of the seed, as target url by source
+func recommendationSourcesCrawl(ctx context.Context, seed string, options ...crawler.CrawlerOption) (map[string][]string, error) {
+	options = append([]crawler.CrawlerOption{crawler.WithMaxDepth(2), crawler.WithMaxReadAlso(2)}, options...)
+	c := crawler.NewCrawler(options...)
+	if err := c.Crawl(ctx, seed); err != nil {
+		return nil, err
+	}
+	b, err := c.Storage.GetBook(ctx, seed, 1)
+	if err != nil {
+		return nil, err
+	}
+	edges := map[string][]string{}
+	for _, edge := range b.AlsoRead {
+		edges[edge.Source] = append(edges[edge.Source], edge.To.URL)
+	}
+	return edges, nil
+}
+
+// TestRecommendationSources checks that the "Readers also enjoyed" books are
+// extracted from the book page once each, that only the recommendation
+// sources chosen are followed, capped by the max read also, that edges are
+// tagged with their source and that books recommended by both sources keep
+// the also read one
+func TestRecommendationSources(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	carousel := `<div class="BookPage__relatedTopContent"><div class="Carousel">` +
+		`<a href="/book/show/2-dune-messiah"><img/></a><a href="/book/show/2-dune-messiah">Dune Messiah</a>` +
+		`<a href="/book/show/3"><img/></a><a href="/book/show/3">Children of Dune</a>` +
+		`<a href="/series/45935-dune">Dune series</a></div></div>`
+	expected := []string{"https://www.goodreads.com/book/show/2-dune-messiah", "https://www.goodreads.com/book/show/3"}
+	urls := recommendationSourcesExtract(t, carousel)
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("carousel books extracted once each, in order: %q", urls)
+	}
+	urls = recommendationSourcesExtract(t, `<a class="actionLink seeMoreLink" href="/book/similar/1">See similar books</a><a href="/book/show/4">Book 4</a>`)
+	if len(urls) != 0 {
+		t.Errorf("no carousel, no books: %q", urls)
+	}
+
+	// the fixture book id links to (id*7+i)%100 from its similar page and to
+	// (id*11+i)%100 from its carousel
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+
+	edges, err := recommendationSourcesCrawl(ctx, server.BookURL(1))
+	expected = []string{server.BookURL(8), server.BookURL(9)}
+	if !(err == nil && len(edges) == 1 && reflect.DeepEqual(edges[book.SourceAlsoRead], expected)) {
+		t.Errorf("only also read followed by default: %v %v", edges, err)
+	}
+
+	edges, err = recommendationSourcesCrawl(ctx, server.BookURL(1), crawler.WithRecommendationSources(book.SourceReadersAlsoEnjoyed))
+	expected = []string{server.BookURL(12), server.BookURL(13)}
+	if !(err == nil && len(edges) == 1 && reflect.DeepEqual(edges[book.SourceReadersAlsoEnjoyed], expected)) {
+		t.Errorf("only readers also enjoyed followed when chosen: %v %v", edges, err)
+	}
+
+	edges, err = recommendationSourcesCrawl(ctx, server.BookURL(1), crawler.WithRecommendationSources(book.SourceAlsoRead, book.SourceReadersAlsoEnjoyed))
+	if !(err == nil && len(edges[book.SourceAlsoRead]) == 2 && len(edges[book.SourceReadersAlsoEnjoyed]) == 2) {
+		t.Errorf("both followed and tagged with their source: %v %v", edges, err)
+	}
+
+	// book 25 recommends books 76 to 78 from both sources
+	edges, err = recommendationSourcesCrawl(ctx, server.BookURL(25), crawler.WithRecommendationSources(book.SourceAlsoRead, book.SourceReadersAlsoEnjoyed))
+	expected = []string{server.BookURL(76), server.BookURL(77)}
+	if !(err == nil && len(edges) == 1 && reflect.DeepEqual(edges[book.SourceAlsoRead], expected)) {
+		t.Errorf("books recommended by both linked once as also read: %v %v", edges, err)
+	}
+
+	// pages without a similar books link are fine when it is not followed
+	broken := crawler.DefaultSelectors()
+	broken.RelatedPageLink = "a.doesNotExist"
+	_, err = recommendationSourcesCrawl(ctx, server.BookURL(1), crawler.WithSelectors(broken))
+	_, noRelated := err.(crawler.ErrNoRelated)
+	if !noRelated {
+		t.Errorf("no similar books link fails following also read: %v", err)
+	}
+	edges, err = recommendationSourcesCrawl(ctx, server.BookURL(1), crawler.WithSelectors(broken), crawler.WithRecommendationSources(book.SourceReadersAlsoEnjoyed))
+	if !(err == nil && len(edges[book.SourceReadersAlsoEnjoyed]) == 2) {
+		t.Errorf("no similar books link fine when only following readers also enjoyed: %v %v", edges, err)
+	}
+
+	// invalid sources are ignored, falling back to also read when none is left
+	edges, err = recommendationSourcesCrawl(ctx, server.BookURL(1), crawler.WithRecommendationSources("bogus"))
+	if !(err == nil && len(edges) == 1 && len(edges[book.SourceAlsoRead]) == 2) {
+		t.Errorf("invalid source ignored: %v %v", edges, err)
+	}
+	edges, err = recommendationSourcesCrawl(ctx, server.BookURL(1), crawler.WithRecommendationSources("bogus", book.SourceReadersAlsoEnjoyed))
+	if !(err == nil && len(edges) == 1 && len(edges[book.SourceReadersAlsoEnjoyed]) == 2) {
+		t.Errorf("valid sources kept along with an invalid one: %v %v", edges, err)
+	}
+	if crawler.ValidateRecommendationSources(book.SourceAlsoRead, "bogus") == nil {
+		t.Errorf("invalid source fails validation")
+	}
+
+	// sites without readers also enjoyed recommendations follow none
+	site := struct{ crawler.SiteAdapter }{&crawler.GoodreadsAdapter{}}
+	edges, err = recommendationSourcesCrawl(ctx, server.BookURL(1), crawler.WithSiteAdapter(site), crawler.WithRecommendationSources(book.SourceAlsoRead, book.SourceReadersAlsoEnjoyed))
+	if !(err == nil && len(edges) == 1 && len(edges[book.SourceAlsoRead]) == 2) {
+		t.Errorf("site without readers also enjoyed follows also read alone: %v %v", edges, err)
+	}
+}
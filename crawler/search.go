@@ -0,0 +1,26 @@
+package crawler
+
+import (
+	"context"
+)
+
+// SearchBook searches the site for query and returns the url of the top
+// result, so crawls can be started from a title instead of a url. Returns
+// ErrNoSearchResults when nothing is found
+func (c *Crawler) SearchBook(ctx context.Context, query string) (string, error) {
+	searchURL, err := c.site.SearchPageURL(query)
+	if err != nil {
+		return "", err
+	}
+
+	doc, err := c.fetchPage(ctx, searchURL)
+	if err != nil {
+		return "", err
+	}
+
+	bookURL, found := c.site.SearchResultURL(searchURL, doc)
+	if !found {
+		return "", ErrNoSearchResults{Query: query}
+	}
+	return bookURL, nil
+}
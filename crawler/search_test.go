@@ -0,0 +1,39 @@
+package crawler_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+// TestSearchBook checks that SearchBook returns the top result of the search
+// page, and ErrNoSearchResults with the query when the page has no results
+func TestSearchBook(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(20, 3)
+	defer server.Close()
+	c := crawler.NewCrawler(crawler.WithSearchURL(server.URL + "/search"))
+
+	bookURL, err := c.SearchBook(ctx, "book 7")
+	if err != nil {
+		t.Fatalf("search with results succeeded: %v", err)
+	}
+	if bookURL != server.BookURL(7) {
+		t.Errorf("top result returned (%s)", bookURL)
+	}
+
+	bookURL, err = c.SearchBook(ctx, "no such book")
+	var noResults crawler.ErrNoSearchResults
+	if !errors.As(err, &noResults) || noResults.Query != "no such book" {
+		t.Errorf("search without results fails with ErrNoSearchResults (%v)", err)
+	}
+	if bookURL != "" {
+		t.Errorf("no url returned without results (%s)", bookURL)
+	}
+}
@@ -0,0 +1,73 @@
+package crawler
+
+import (
+	"reflect"
+
+	"github.com/bcap/book-crawler/book"
+)
+
+// Selectors are the css selectors the GoodreadsAdapter uses to find related
+// books, lists, authors and search results, along with the ones used to
+// extract books. Field names match the yaml keys used in config files, so a
+// config file only needs to list the selectors it changes
+type Selectors struct {
+	book.Selectors `yaml:",inline"`
+
+	// RelatedPageLink is the link from a book page to its related books page
+	RelatedPageLink string `yaml:"related-page-link"`
+	// RelatedSection is the heading of the related books, which are found
+	// with RelatedBook in the elements following it
+	RelatedSection string `yaml:"related-section"`
+	RelatedBook    string `yaml:"related-book"`
+	// ReadersAlsoEnjoyedBook are the links to the books recommended in the
+	// book page itself
+	ReadersAlsoEnjoyedBook string `yaml:"readers-also-enjoyed-book"`
+
+	ListBook     string `yaml:"list-book"`
+	ListNextPage string `yaml:"list-next-page"`
+
+	SimilarAuthor string `yaml:"similar-author"`
+	AuthorTopBook string `yaml:"author-top-book"`
+	AuthorBook    string `yaml:"author-book"`
+
+	SearchResult string `yaml:"search-result"`
+}
+
+func DefaultSelectors() Selectors {
+	return Selectors{
+		Selectors:              book.DefaultSelectors(),
+		RelatedPageLink:        "a.actionLink.seeMoreLink",
+		RelatedSection:         "div.responsiveMainContentContainer div.membersAlsoLikedText",
+		RelatedBook:            "a[itemprop=url]",
+		ReadersAlsoEnjoyedBook: "div.BookPage__relatedTopContent div.Carousel a[href*='/book/show/']",
+		ListBook:               "a.bookTitle",
+		ListNextPage:           "a.next_page",
+		SimilarAuthor:          "a[href*='/author/show/']",
+		AuthorTopBook:          "a.bookTitle[href*='/book/show/']",
+		AuthorBook:             "a.bookTitle[href*='/book/show/']",
+		SearchResult:           "a.bookTitle, a[href*='/book/show/']",
+	}
+}
+
+// withDefaults returns the selectors with the ones left empty taken from
+// DefaultSelectors
+func (s Selectors) withDefaults() Selectors {
+	fillEmpty(reflect.ValueOf(&s).Elem(), reflect.ValueOf(DefaultSelectors()))
+	return s
+}
+
+// fillEmpty sets the empty string fields of v, including the ones of embedded
+// structs, to the same fields of defaults
+func fillEmpty(v reflect.Value, defaults reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.Struct:
+			fillEmpty(field, defaults.Field(i))
+		case reflect.String:
+			if field.String() == "" {
+				field.Set(defaults.Field(i))
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package crawler_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+func parse(t *testing.T, page string) *goquery.Document {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// selectorsCrawl returns how many books are persisted when crawling from book 1
+func selectorsCrawl(server *fixture.Server, selectors crawler.Selectors) (int, error) {
+	ctx := context.Background()
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(2),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithSelectors(selectors),
+	)
+	err := c.Crawl(ctx, server.BookURL(1))
+	persisted := 0
+	c.Storage.GetAllBooks(ctx, func(b *book.Book) error {
+		persisted++
+		return nil
+	})
+	return persisted, err
+}
+
+// TestSelectors checks that books are extracted and related books found with
+// patched selectors, that selectors loaded from a config file keep the
+// defaults of the ones not listed, that selectors left empty in code fall back
+// to the defaults too, and that crawling with broken selectors does not follow
+// anything
+func TestSelectors(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	// a redesigned book page
+	page := parse(t, `<html><body>
+<h1 data-testid="bookTitle">Dune</h1>
+<span class="ContributorLink__name">Frank Herbert</span>
+<div class="RatingStatistics__rating">4.27</div>
+</body></html>`)
+	selectors := book.DefaultSelectors()
+	selectors.Title = "h1[data-testid=bookTitle]"
+	selectors.Author = "span.ContributorLink__name"
+	selectors.Rating = "div.RatingStatistics__rating"
+	b, err := book.GoodreadsExtractor{Selectors: &selectors}.Extract(page)
+	if !(err == nil && b.Title == "Dune" && b.Author == "Frank Herbert" && b.Rating.String() == "4.27") {
+		t.Errorf("extracted with patched selectors: %q by %q (%s)", b.Title, b.Author, b.Rating)
+	}
+	b, _ = book.GoodreadsExtractor{}.Extract(page)
+	if !(b.Title == "" && b.Author == "") {
+		t.Errorf("default selectors do not match the redesigned page")
+	}
+
+	config := crawler.DefaultConfig()
+	content := "max-depth: 2\nselectors:\n  related-book: a.bookTitle\n  title: h1.title\n"
+	err = yaml.Unmarshal([]byte(content), &config)
+	defaults := crawler.DefaultSelectors()
+	if !(err == nil && config.Selectors.RelatedBook == "a.bookTitle" && config.Selectors.Title == "h1.title") {
+		t.Errorf("selectors loaded from yaml: %v", err)
+	}
+	if !(config.Selectors.RelatedPageLink == defaults.RelatedPageLink && config.Selectors.Author == defaults.Author) {
+		t.Errorf("selectors missing from yaml keep their defaults")
+	}
+
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+
+	byDefault, err := selectorsCrawl(server, crawler.DefaultSelectors())
+	if !(err == nil && byDefault > 1) {
+		t.Errorf("crawl with default selectors persists related books (%d): %v", byDefault, err)
+	}
+
+	patched := crawler.DefaultSelectors()
+	patched.RelatedBook = "a[href*='/book/show/']"
+	patched.RelatedSection = "div.membersAlsoLikedText"
+	persisted, err := selectorsCrawl(server, patched)
+	if !(err == nil && persisted == byDefault) {
+		t.Errorf("crawl with equivalent selectors persists the same books (%d): %v", persisted, err)
+	}
+
+	broken := crawler.DefaultSelectors()
+	broken.RelatedPageLink = "a.doesNotExist"
+	persisted, err = selectorsCrawl(server, broken)
+	_, noRelated := err.(crawler.ErrNoRelated)
+	if !(noRelated && persisted == 1) {
+		t.Errorf("crawl with a broken related link selector only persists the seed (%d): %v", persisted, err)
+	}
+
+	partial := crawler.Selectors{}
+	partial.RelatedBook = "a[href*='/book/show/']"
+	partial.RelatedSection = "div.membersAlsoLikedText"
+	persisted, err = selectorsCrawl(server, partial)
+	if !(err == nil && persisted == byDefault) {
+		t.Errorf("crawl with only some selectors set uses the defaults for the rest (%d): %v", persisted, err)
+	}
+}
@@ -0,0 +1,250 @@
+package crawler
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/bcap/book-crawler/book"
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+)
+
+// SiteAdapter bundles everything the crawler needs to know about a book site:
+// how books are extracted from their pages and how related books, lists,
+// authors and searches are discovered. The crawler handles fetching, limits,
+// storage and traversal. All returned urls must be absolute
+type SiteAdapter interface {
+	book.Extractor
+
+	// RelatedPageURL returns the url of the page listing the books related to
+	// the book in doc
+	RelatedPageURL(bookURL string, doc *goquery.Document) (string, bool)
+	// RelatedBookURLs returns the books in a related books page, best
+	// recommendations first
+	RelatedBookURLs(pageURL string, doc *goquery.Document) []string
+
+	// ListBookURLs returns the books in a page of a list and the url of its
+	// next page, or an empty string if it is the last one
+	ListBookURLs(pageURL string, doc *goquery.Document) ([]string, string)
+
+	// AuthorURL returns the url of the author page of the book in doc
+	AuthorURL(bookURL string, doc *goquery.Document) string
+	// SimilarAuthorsPageURL returns the url of the page listing the authors
+	// similar to an author. Sites without this concept return false
+	SimilarAuthorsPageURL(authorURL string) (string, bool)
+	// SimilarAuthorURLs returns the authors in a similar authors page, most
+	// similar first. It must not include the author itself
+	SimilarAuthorURLs(pageURL string, authorURL string, doc *goquery.Document) []string
+	// AuthorTopBookURL returns the most relevant book in an author page
+	AuthorTopBookURL(pageURL string, doc *goquery.Document) (string, bool)
+	// AuthorBookURLs returns the books in an author page, most relevant first
+	AuthorBookURLs(pageURL string, doc *goquery.Document) []string
+
+	// SearchPageURL returns the url of the results page when searching for
+	// query
+	SearchPageURL(query string) (string, error)
+	// SearchResultURL returns the top book in a search results page
+	SearchResultURL(pageURL string, doc *goquery.Document) (string, bool)
+}
+
+// ReadersAlsoEnjoyedSite is implemented by the SiteAdapters of sites whose book
+// pages recommend other books themselves, followed with
+// book.SourceReadersAlsoEnjoyed. Other sites have no such recommendations
+type ReadersAlsoEnjoyedSite interface {
+	// ReadersAlsoEnjoyedURLs returns the books recommended in the page of the
+	// book in doc, best recommendations first
+	ReadersAlsoEnjoyedURLs(bookURL string, doc *goquery.Document) []string
+}
+
+const DefaultSearchURL = "https://www.goodreads.com/search"
+
+// GoodreadsAdapter is the SiteAdapter for goodreads, used by default
+type GoodreadsAdapter struct {
+	// SearchURL is where searches are sent to. Defaults to DefaultSearchURL
+	SearchURL string
+
+	// Selectors defaults to DefaultSelectors when nil
+	Selectors *Selectors
+}
+
+func (a *GoodreadsAdapter) selectors() Selectors {
+	if a.Selectors == nil {
+		return DefaultSelectors()
+	}
+	return *a.Selectors
+}
+
+func (a *GoodreadsAdapter) Extract(doc *goquery.Document) (*book.Book, error) {
+	selectors := a.selectors().Selectors
+	return book.GoodreadsExtractor{Selectors: &selectors}.Extract(doc)
+}
+
+func (a *GoodreadsAdapter) RelatedPageURL(bookURL string, doc *goquery.Document) (string, bool) {
+	link, hasLink := doc.Find(a.selectors().RelatedPageLink).Attr("href")
+	if !hasLink {
+		return "", false
+	}
+	return resolveURL(bookURL, link)
+}
+
+func (a *GoodreadsAdapter) RelatedBookURLs(pageURL string, doc *goquery.Document) []string {
+	selectors := a.selectors()
+	links := doc.Find(selectors.RelatedSection).
+		NextAll().
+		Find(selectors.RelatedBook)
+	return bookURLs(pageURL, links)
+}
+
+// ReadersAlsoEnjoyedURLs returns the books in the "Readers also enjoyed"
+// carousel. Both the cover and the title of a book link to it, so repeated
+// books are only returned once
+func (a *GoodreadsAdapter) ReadersAlsoEnjoyedURLs(bookURL string, doc *goquery.Document) []string {
+	urls := []string{}
+	seen := map[string]struct{}{}
+	for _, url := range bookURLs(bookURL, doc.Find(a.selectors().ReadersAlsoEnjoyedBook)) {
+		if _, has := seen[url]; has {
+			continue
+		}
+		seen[url] = struct{}{}
+		urls = append(urls, url)
+	}
+	return urls
+}
+
+func (a *GoodreadsAdapter) ListBookURLs(pageURL string, doc *goquery.Document) ([]string, string) {
+	selectors := a.selectors()
+	urls := bookURLs(pageURL, doc.Find(selectors.ListBook))
+	nextPage, hasNextPage := doc.Find(selectors.ListNextPage).Attr("href")
+	if !hasNextPage {
+		return urls, ""
+	}
+	nextPageURL, _ := resolveURL(pageURL, nextPage)
+	return urls, nextPageURL
+}
+
+func (a *GoodreadsAdapter) AuthorURL(bookURL string, doc *goquery.Document) string {
+	authorURL := book.ExtractAuthorURL(doc, a.selectors().Selectors)
+	if authorURL == "" {
+		return ""
+	}
+	authorURL, _ = resolveURL(bookURL, authorURL)
+	return authorURL
+}
+
+func (a *GoodreadsAdapter) SimilarAuthorsPageURL(authorURL string) (string, bool) {
+	if !strings.Contains(authorURL, "/author/show/") {
+		return "", false
+	}
+	return strings.Replace(authorURL, "/author/show/", "/author/similar/", 1), true
+}
+
+func (a *GoodreadsAdapter) SimilarAuthorURLs(pageURL string, authorURL string, doc *goquery.Document) []string {
+	urls := []string{}
+	seen := map[string]struct{}{authorPathID(authorURL): {}}
+	doc.Find(a.selectors().SimilarAuthor).Each(func(_ int, node *goquery.Selection) {
+		absoluteLinkURL, ok := resolveURL(pageURL, node.AttrOr("href", ""))
+		if !ok {
+			return
+		}
+		id := authorPathID(absoluteLinkURL)
+		if _, has := seen[id]; has {
+			return
+		}
+		seen[id] = struct{}{}
+		urls = append(urls, absoluteLinkURL)
+	})
+	return urls
+}
+
+func (a *GoodreadsAdapter) AuthorTopBookURL(pageURL string, doc *goquery.Document) (string, bool) {
+	urls := bookURLs(pageURL, doc.Find(a.selectors().AuthorTopBook).First())
+	if len(urls) == 0 {
+		return "", false
+	}
+	return urls[0], true
+}
+
+func (a *GoodreadsAdapter) AuthorBookURLs(pageURL string, doc *goquery.Document) []string {
+	return bookURLs(pageURL, doc.Find(a.selectors().AuthorBook))
+}
+
+func (a *GoodreadsAdapter) SearchPageURL(query string) (string, error) {
+	searchURL := a.SearchURL
+	if searchURL == "" {
+		searchURL = DefaultSearchURL
+	}
+	parsed, err := url.Parse(searchURL)
+	if err != nil {
+		return "", err
+	}
+	params := parsed.Query()
+	params.Set("q", query)
+	params.Set("search_type", "books")
+	parsed.RawQuery = params.Encode()
+	return parsed.String(), nil
+}
+
+func (a *GoodreadsAdapter) SearchResultURL(pageURL string, doc *goquery.Document) (string, bool) {
+	urls := bookURLs(pageURL, doc.Find(a.selectors().SearchResult))
+	if len(urls) == 0 {
+		return "", false
+	}
+	return urls[0], true
+}
+
+// bookPathRegex matches the path of goodreads book pages, which can have a
+// locale prefix (eg /en/book/show/1) and a slug after the id (eg
+// /book/show/1-dune or /book/show/1.Dune)
+var bookPathRegex = regexp.MustCompile(`^(?:/[a-z]{2}(?:[-_][A-Za-z]{2})?)?/book/show/\d+(?:[-.][^/]*)?/?$`)
+
+// bookURLs resolves the book links in links, skipping anything that is not a
+// goodreads book page
+func bookURLs(pageURL string, links *goquery.Selection) []string {
+	urls := []string{}
+	links.Each(func(_ int, node *goquery.Selection) {
+		linkURL, hasURL := node.Attr("href")
+		if !hasURL {
+			return
+		}
+		absoluteLinkURL, ok := resolveURL(pageURL, linkURL)
+		if !ok {
+			return
+		}
+		if !isBookURL(absoluteLinkURL) {
+			log.Debugf("skipping link to %s from %s, not a book page", absoluteLinkURL, pageURL)
+			return
+		}
+		urls = append(urls, absoluteLinkURL)
+	})
+	return urls
+}
+
+func isBookURL(bookURL string) bool {
+	parsed, err := url.Parse(bookURL)
+	if err != nil {
+		return false
+	}
+	return bookPathRegex.MatchString(parsed.Path)
+}
+
+func resolveURL(pageURL string, linkURL string) (string, bool) {
+	absoluteLinkURL, err := myhttp.AbsoluteURL(pageURL, linkURL)
+	if err != nil {
+		log.Warnf("found bad url, skipping it: %s", linkURL)
+		return "", false
+	}
+	return absoluteLinkURL, true
+}
+
+func authorPathID(authorURL string) string {
+	_, path, _ := strings.Cut(authorURL, "/author/show/")
+	id, _, _ := strings.Cut(path, ".")
+	id, _, _ = strings.Cut(id, "?")
+	return id
+}
+
+// Making sure GoodreadsAdapter implements SiteAdapter
+var _ SiteAdapter = &GoodreadsAdapter{}
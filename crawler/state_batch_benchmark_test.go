@@ -0,0 +1,86 @@
+package crawler_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+	"github.com/bcap/book-crawler/storage/memory"
+)
+
+// BenchmarkStateBatch crawls a small but densely linked synthetic graph, where
+// most related books were already crawled, over a memory storage with
+// simulated round trip latency. Compares checking the state of related books
+// in batches against one round trip per book
+func BenchmarkStateBatch(b *testing.B) {
+	const numBooks = 100
+	const numLinks = 10
+	const maxDepth = 4
+	const parallelism = 8
+
+	log.Level = log.WarnLevel
+
+	server := fixture.NewServer(numBooks, numLinks)
+	defer server.Close()
+
+	for _, batched := range []bool{false, true} {
+		b.Run(fmt.Sprintf("batched-%v", batched), func(b *testing.B) {
+			var roundTrips int64
+			for i := 0; i < b.N; i++ {
+				s := &latencyStorage{Storage: &memory.Storage{}, batched: batched, latency: 2 * time.Millisecond}
+				if err := s.Initialize(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+				c := crawler.NewCrawler(
+					crawler.WithMaxDepth(maxDepth),
+					crawler.WithMaxReadAlso(numLinks),
+					crawler.WithMaxParallelism(parallelism),
+					crawler.WithRequestMaxRetries(0),
+				)
+				c.Storage = s
+				if err := c.Crawl(context.Background(), server.BookURL(0)); err != nil {
+					b.Fatal(err)
+				}
+				roundTrips += atomic.LoadInt64(&s.roundTrips)
+			}
+			b.ReportMetric(float64(roundTrips)/float64(b.N), "round-trips/op")
+		})
+	}
+}
+
+// latencyStorage adds latency to every state read. When not batched,
+// GetBookStates does one round trip per book, like a storage without batching
+// support would
+type latencyStorage struct {
+	storage.Storage
+	batched    bool
+	latency    time.Duration
+	roundTrips int64
+}
+
+func (s *latencyStorage) roundTrip() {
+	atomic.AddInt64(&s.roundTrips, 1)
+	time.Sleep(s.latency)
+}
+
+func (s *latencyStorage) GetBookState(ctx context.Context, url string) (storage.StateChange, error) {
+	s.roundTrip()
+	return s.Storage.GetBookState(ctx, url)
+}
+
+func (s *latencyStorage) GetBookStates(ctx context.Context, urls []string) (map[string]storage.StateChange, error) {
+	if s.batched {
+		s.roundTrip()
+	} else {
+		for range urls {
+			s.roundTrip()
+		}
+	}
+	return s.Storage.GetBookStates(ctx, urls)
+}
@@ -0,0 +1,121 @@
+package crawler
+
+import (
+	"context"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+	"github.com/bcap/book-crawler/storage/memory"
+)
+
+// limitedStorage bounds how many storage calls run at the same time,
+// independently of how many requests are fetching pages
+type limitedStorage struct {
+	storage.Storage
+	sem *semaphore.Weighted
+}
+
+func (s *limitedStorage) acquire(ctx context.Context) error {
+	return s.sem.Acquire(ctx, 1)
+}
+
+func (s *limitedStorage) GetBookState(ctx context.Context, url string) (storage.StateChange, error) {
+	if err := s.acquire(ctx); err != nil {
+		return storage.StateChange{}, err
+	}
+	defer s.sem.Release(1)
+	return s.Storage.GetBookState(ctx, url)
+}
+
+func (s *limitedStorage) GetBookStates(ctx context.Context, urls []string) (map[string]storage.StateChange, error) {
+	if err := s.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer s.sem.Release(1)
+	return s.Storage.GetBookStates(ctx, urls)
+}
+
+func (s *limitedStorage) SetBookState(ctx context.Context, url string, previous storage.StateChange, new storage.State) (storage.StateChange, bool, error) {
+	if err := s.acquire(ctx); err != nil {
+		return storage.StateChange{}, false, err
+	}
+	defer s.sem.Release(1)
+	return s.Storage.SetBookState(ctx, url, previous, new)
+}
+
+func (s *limitedStorage) GetBook(ctx context.Context, url string, maxDepth int) (*book.Book, error) {
+	if err := s.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer s.sem.Release(1)
+	return s.Storage.GetBook(ctx, url, maxDepth)
+}
+
+func (s *limitedStorage) GetAllBooks(ctx context.Context, fn func(*book.Book) error) error {
+	if err := s.acquire(ctx); err != nil {
+		return err
+	}
+	defer s.sem.Release(1)
+	return s.Storage.GetAllBooks(ctx, fn)
+}
+
+func (s *limitedStorage) SetBook(ctx context.Context, url string, b *book.Book) error {
+	if err := s.acquire(ctx); err != nil {
+		return err
+	}
+	defer s.sem.Release(1)
+	return s.Storage.SetBook(ctx, url, b)
+}
+
+func (s *limitedStorage) LinkBook(ctx context.Context, url string, related string, priority int) error {
+	if err := s.acquire(ctx); err != nil {
+		return err
+	}
+	defer s.sem.Release(1)
+	return s.Storage.LinkBook(ctx, url, related, priority)
+}
+
+func (s *limitedStorage) LinkBookWithSource(ctx context.Context, url string, related string, priority int, source string) error {
+	if err := s.acquire(ctx); err != nil {
+		return err
+	}
+	defer s.sem.Release(1)
+	return s.Storage.LinkBookWithSource(ctx, url, related, priority, source)
+}
+
+func (s *limitedStorage) DeleteBook(ctx context.Context, url string) error {
+	if err := s.acquire(ctx); err != nil {
+		return err
+	}
+	defer s.sem.Release(1)
+	return s.Storage.DeleteBook(ctx, url)
+}
+
+// dryRunStorage keeps the crawl state of a dry run in memory, logging the
+// writes that would have gone to the actual storage
+type dryRunStorage struct {
+	storage.Storage
+}
+
+func newDryRunStorage() *dryRunStorage {
+	memoryStorage := &memory.Storage{}
+	memoryStorage.Initialize(context.Background())
+	return &dryRunStorage{Storage: memoryStorage}
+}
+
+func (s *dryRunStorage) SetBook(ctx context.Context, url string, b *book.Book) error {
+	log.Infof("dry run: would persist book %s by %s (%s)", b.Title, b.Author, url)
+	return s.Storage.SetBook(ctx, url, b)
+}
+
+func (s *dryRunStorage) LinkBook(ctx context.Context, url string, related string, priority int) error {
+	return s.LinkBookWithSource(ctx, url, related, priority, book.SourceAlsoRead)
+}
+
+func (s *dryRunStorage) LinkBookWithSource(ctx context.Context, url string, related string, priority int, source string) error {
+	log.Debugf("dry run: would link book %s to %s (%s, priority %d)", url, related, source, priority)
+	return s.Storage.LinkBookWithSource(ctx, url, related, priority, source)
+}
@@ -0,0 +1,116 @@
+package crawler_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+	"github.com/bcap/book-crawler/storage/memory"
+)
+
+const storageConcurrencyNumBooks = 300
+const storageConcurrencyNumLinks = 5
+const storageConcurrencyMaxDepth = 3
+const storageConcurrencyParallelism = 20
+const limit = 3
+
+// TestStorageConcurrency checks that WithStorageConcurrency bounds how many
+// storage calls run at the same time, independently of the fetch parallelism:
+// over a storage with simulated latency, the limit must never be exceeded but
+// still be reached, while without a limit more calls run at once
+func TestStorageConcurrency(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(storageConcurrencyNumBooks, storageConcurrencyNumLinks)
+	defer server.Close()
+
+	crawl := func(storageConcurrency int) (int64, error) {
+		s := &storageConcurrencyCountingStorage{Storage: &memory.Storage{}}
+		if err := s.Initialize(ctx); err != nil {
+			return 0, err
+		}
+		c := crawler.NewCrawler(
+			crawler.WithMaxDepth(storageConcurrencyMaxDepth),
+			crawler.WithMaxReadAlso(storageConcurrencyNumLinks),
+			crawler.WithMaxParallelism(storageConcurrencyParallelism),
+			crawler.WithStorageConcurrency(storageConcurrency),
+		)
+		c.Storage = s
+		err := c.Crawl(ctx, server.BookURL(1))
+		return atomic.LoadInt64(&s.peak), err
+	}
+
+	peak, err := crawl(limit)
+	if err != nil {
+		t.Errorf("limited: Crawl succeeded: %v", err)
+	}
+	if peak != limit {
+		t.Errorf("limited: at most %d storage calls at the same time (peak: %d)", limit, peak)
+	}
+
+	peak, err = crawl(0)
+	if err != nil {
+		t.Errorf("unlimited: Crawl succeeded: %v", err)
+	}
+	if peak <= limit {
+		t.Errorf("unlimited: more than %d storage calls at the same time (peak: %d)", limit, peak)
+	}
+
+}
+
+// storageConcurrencyCountingStorage tracks the peak number of concurrent calls, adding some
+// latency to every call so they overlap
+type storageConcurrencyCountingStorage struct {
+	storage.Storage
+	current int64
+	peak    int64
+}
+
+func (s *storageConcurrencyCountingStorage) enter() func() {
+	current := atomic.AddInt64(&s.current, 1)
+	for {
+		peak := atomic.LoadInt64(&s.peak)
+		if current <= peak || atomic.CompareAndSwapInt64(&s.peak, peak, current) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return func() { atomic.AddInt64(&s.current, -1) }
+}
+
+func (s *storageConcurrencyCountingStorage) GetBookState(ctx context.Context, url string) (storage.StateChange, error) {
+	defer s.enter()()
+	return s.Storage.GetBookState(ctx, url)
+}
+
+func (s *storageConcurrencyCountingStorage) GetBookStates(ctx context.Context, urls []string) (map[string]storage.StateChange, error) {
+	defer s.enter()()
+	return s.Storage.GetBookStates(ctx, urls)
+}
+
+func (s *storageConcurrencyCountingStorage) SetBookState(ctx context.Context, url string, previous storage.StateChange, new storage.State) (storage.StateChange, bool, error) {
+	defer s.enter()()
+	return s.Storage.SetBookState(ctx, url, previous, new)
+}
+
+func (s *storageConcurrencyCountingStorage) GetBook(ctx context.Context, url string, maxDepth int) (*book.Book, error) {
+	defer s.enter()()
+	return s.Storage.GetBook(ctx, url, maxDepth)
+}
+
+func (s *storageConcurrencyCountingStorage) SetBook(ctx context.Context, url string, b *book.Book) error {
+	defer s.enter()()
+	return s.Storage.SetBook(ctx, url, b)
+}
+
+func (s *storageConcurrencyCountingStorage) LinkBookWithSource(ctx context.Context, url string, related string, priority int, source string) error {
+	defer s.enter()()
+	return s.Storage.LinkBookWithSource(ctx, url, related, priority, source)
+}
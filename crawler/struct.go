@@ -2,49 +2,173 @@ package crawler
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"golang.org/x/sync/semaphore"
 
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/clock"
+	"github.com/bcap/book-crawler/html"
 	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/metrics"
 	"github.com/bcap/book-crawler/storage"
 	"github.com/bcap/book-crawler/storage/memory"
 )
 
 var extraStatusCodesToRetry = []int{
 	403, // sometimes goodreads returns 403 (Forbidden), but we should retry on it
+	429, // rate limited (Too Many Requests), retried once the Retry-After wait passes
 }
 
 type Crawler struct {
 	Client  *myhttp.Client
 	Storage storage.Storage
 
+	// ownStorage is the in-memory storage created along with the crawler,
+	// which Close shuts down unless Storage was replaced
+	ownStorage storage.Storage
+
+	// storage is what the current run uses, which is Storage limited to
+	// storageConcurrency calls at a time when set
+	storage            storage.Storage
+	storageConcurrency int
+
 	maxDepth    int
 	maxReadAlso int
+	// maxOutDegree caps how many books a book links to, zero or less for no
+	// limit
+	maxOutDegree int
+	// maxBooks bounds how many books a run persists, zero or less for no
+	// limit. reserved counts the books persisted or being crawled towards it,
+	// pending the ones among them still being crawled, both under reservedCond
+	maxBooks        int32
+	reserved        int32
+	pending         int32
+	reservedCond    *sync.Cond
+	maxBooksReached *sync.Once
+	// maxDuration bounds how long a run crawls, zero or less for no limit
+	maxDuration time.Duration
+	// maxReadAlsoByDepth overrides maxReadAlso when set
+	maxReadAlsoByDepth func(depth int) int
 
 	minNumRatings int32
 	maxNumRatings int32
-	minRating     int32
-	maxRating     int32
+	minRating     book.Rating
+	maxRating     book.Rating
+
+	minPublishedYear int32
+	maxPublishedYear int32
+
+	// languages are lower cased. Empty allows every language
+	languages map[string]bool
+	// genres are lower cased. Empty includes every genre and excludes none
+	includeGenres map[string]bool
+	excludeGenres map[string]bool
 
 	maxParallelism int
+	deterministic  bool
+	depthGate      *depthGate
+
+	includeSeed bool
+
+	// recommendationSources are the recommendations of the book pages that
+	// are followed, by edge source
+	recommendationSources map[string]bool
+
+	followSimilarAuthors bool
+
+	crawlAuthors   bool
+	maxAuthorBooks int
+
+	maxListBooks int
+
+	canonicalizeWorks bool
+	trackProvenance   bool
+	skipLinked        bool
+	resume            bool
+	dryRun            bool
+	continueOnError   bool
+
+	site      SiteAdapter
+	extractor book.Extractor
+	fetcher   Fetcher
+
+	// allowedHosts are lower cased. Empty allows every host
+	allowedHosts map[string]bool
+	urlFilter    func(url string) bool
+
+	// books being crawled in the current run and seeds that were not persisted
+	inFlight    *sync.Map
+	unpersisted *sync.Map
+	// books that failed in the current run and the books that could not be
+	// linked to them, which are left Crawled instead of Linked so the next run
+	// fetches them again and retries the failed ones
+	failures   *sync.Map
+	incomplete *sync.Map
+
+	// works maps a work to the book standing for it and aliases maps merged
+	// books to the book they were merged into, both for the current run
+	works   *sync.Map
+	aliases *sync.Map
+	// seeds maps books to the seed they were first reached from in the
+	// current run, when tracking provenance
+	seeds *sync.Map
+	// resumed holds the books linked by previous runs already walked in the
+	// current run, when resuming
+	resumed *sync.Map
+	// authorBooks maps authors to the books in their page, fetched once per
+	// run when crawling authors
+	authorBooks *sync.Map
+	// outDegrees counts the books linked to each book in the current run, see
+	// WithMaxOutDegree
+	outDegrees *sync.Map
 
-	crawled *int32
-	checked *int32
+	roots      []string
+	rootsSet   map[string]struct{}
+	rootsMutex sync.Mutex
 
+	rawHTMLStore  *html.Store
+	graphListener GraphListener
+	reducePages   bool
+
+	cpuProfilePath string
+	memProfilePath string
+
+	crawled      *int32
+	checked      *int32
+	failed       *int32
+	metrics      *metrics.Metrics
+	progressLogs bool
+
+	clock   clock.Clock
 	runLock sync.Mutex
-	start   time.Time
+	// running is closed once the current run stops, see Drain
+	running      chan struct{}
+	runningMutex sync.Mutex
+	start        time.Time
+
+	startProgress progress
+	progress      progress
+	progressMutex sync.Mutex
 }
 
 func NewCrawler(options ...CrawlerOption) *Crawler {
 	var crawled int32
 	var checked int32
+	var failed int32
 	var inMemoryStorage = &memory.Storage{}
 	inMemoryStorage.Initialize(context.Background())
+	client := myhttp.NewClient(semaphore.NewWeighted(1), extraStatusCodesToRetry)
+	client.Throttle = myhttp.NewThrottle()
+	client.Robots = myhttp.NewRobots("")
 	crawler := &Crawler{
-		Client:         myhttp.NewClient(semaphore.NewWeighted(1), extraStatusCodesToRetry),
+		Client:         client,
 		Storage:        inMemoryStorage,
+		ownStorage:     inMemoryStorage,
 		maxDepth:       3,
 		maxReadAlso:    5,
 		maxParallelism: 1,
@@ -52,8 +176,18 @@ func NewCrawler(options ...CrawlerOption) *Crawler {
 		maxNumRatings:  -1,
 		minRating:      -1,
 		maxRating:      -1,
+		includeSeed:    true,
+		maxListBooks:   -1,
+		maxAuthorBooks: 5,
+		site:           &GoodreadsAdapter{},
+		clock:          clock.Real,
 		crawled:        &crawled,
 		checked:        &checked,
+		failed:         &failed,
+		progressLogs:   true,
+		recommendationSources: map[string]bool{
+			book.SourceAlsoRead: true,
+		},
 	}
 	for _, option := range options {
 		option(crawler)
@@ -69,12 +203,69 @@ func WithMaxDepth(maxDepth int) CrawlerOption {
 	}
 }
 
+// WithMaxBooks stops crawling new books once a run persisted this many.
+// Books already being crawled are still persisted and linked, but no new ones
+// are fetched. Zero or less disables the limit
+func WithMaxBooks(maxBooks int32) CrawlerOption {
+	return func(c *Crawler) {
+		c.maxBooks = maxBooks
+	}
+}
+
+// WithMaxDuration stops a run once it crawled for this long. Books being
+// crawled are abandoned and moved back to NotCrawled, as Drain does, so a later
+// crawl picks them up, and the run returns ErrMaxDuration. Whatever was
+// persisted until then is kept. Zero or less disables the limit
+func WithMaxDuration(maxDuration time.Duration) CrawlerOption {
+	return func(c *Crawler) {
+		c.maxDuration = maxDuration
+	}
+}
+
+// WithMaxReadAlso controls how many related books are followed from a book.
+// Negative follows all of them
 func WithMaxReadAlso(maxReadAlso int) CrawlerOption {
 	return func(c *Crawler) {
 		c.maxReadAlso = maxReadAlso
 	}
 }
 
+// WithMaxOutDegree controls how many related books are linked to a book,
+// across every recommendation source. Related books are followed best
+// priority first until that many were linked, and the rest are not followed
+// from this book. Books that end up not linked, eg filtered out, do not count
+// towards it. Zero or less links all of them
+func WithMaxOutDegree(maxOutDegree int) CrawlerOption {
+	return func(c *Crawler) {
+		c.maxOutDegree = maxOutDegree
+	}
+}
+
+// WithMaxReadAlsoByDepth controls how many related books are followed from a
+// book depending on its depth, eg to crawl wide near the seed and narrow
+// deeper. Overrides WithMaxReadAlso, and negative numbers follow all of them
+// too. Set to nil to use the same number at every depth
+func WithMaxReadAlsoByDepth(maxReadAlso func(depth int) int) CrawlerOption {
+	return func(c *Crawler) {
+		c.maxReadAlsoByDepth = maxReadAlso
+	}
+}
+
+// MaxReadAlsoSchedule returns a function for WithMaxReadAlsoByDepth taking
+// the number at each depth from schedule. Depths past the end of the schedule
+// use its last number
+func MaxReadAlsoSchedule(schedule []int) func(depth int) int {
+	if len(schedule) == 0 {
+		return nil
+	}
+	return func(depth int) int {
+		if depth >= len(schedule) {
+			return schedule[len(schedule)-1]
+		}
+		return schedule[depth]
+	}
+}
+
 func WithMinNumRatings(minNumRatings int32) CrawlerOption {
 	return func(c *Crawler) {
 		c.minNumRatings = minNumRatings
@@ -87,18 +278,359 @@ func WithMaxNumRatings(maxNumRatings int32) CrawlerOption {
 	}
 }
 
-func WithMinRating(minRating int32) CrawlerOption {
+func WithMinRating(minRating book.Rating) CrawlerOption {
 	return func(c *Crawler) {
 		c.minRating = minRating
 	}
 }
 
-func WithMaxRating(maxRating int32) CrawlerOption {
+func WithMaxRating(maxRating book.Rating) CrawlerOption {
 	return func(c *Crawler) {
 		c.maxRating = maxRating
 	}
 }
 
+// WithMinPublishedYear only persists and follows books published in this
+// year or later. Books without a known publication year are filtered out as
+// well. Zero disables the check
+func WithMinPublishedYear(minPublishedYear int32) CrawlerOption {
+	return func(c *Crawler) {
+		c.minPublishedYear = minPublishedYear
+	}
+}
+
+// WithMaxPublishedYear only persists and follows books published in this
+// year or earlier. Zero disables the check
+func WithMaxPublishedYear(maxPublishedYear int32) CrawlerOption {
+	return func(c *Crawler) {
+		c.maxPublishedYear = maxPublishedYear
+	}
+}
+
+// WithLanguages only persists and follows books whose edition language is one
+// of the given, compared case insensitively. Books without a known language
+// are filtered out as well. No languages disables the check
+func WithLanguages(languages ...string) CrawlerOption {
+	return func(c *Crawler) {
+		c.languages = lowerCaseSet(languages)
+	}
+}
+
+// WithIncludeGenres only persists and follows books with at least one of the
+// given genres, compared case insensitively. Books without genres are filtered
+// out as well. No genres disables the check
+func WithIncludeGenres(genres ...string) CrawlerOption {
+	return func(c *Crawler) {
+		c.includeGenres = lowerCaseSet(genres)
+	}
+}
+
+// WithExcludeGenres neither persists nor follows books with any of the given
+// genres, compared case insensitively
+func WithExcludeGenres(genres ...string) CrawlerOption {
+	return func(c *Crawler) {
+		c.excludeGenres = lowerCaseSet(genres)
+	}
+}
+
+func lowerCaseSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[strings.ToLower(strings.TrimSpace(value))] = true
+	}
+	return set
+}
+
+// WithIncludeSeed controls whether the seed book is persisted. When false the
+// seed is still fetched and its related books are followed, but the seed
+// itself is only used as a reference point and is never written to storage
+func WithIncludeSeed(includeSeed bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.includeSeed = includeSeed
+	}
+}
+
+// WithRecommendationSources chooses which recommendations of a book page are
+// followed: book.SourceAlsoRead, the books goodreads members also liked listed
+// in the similar books page, and book.SourceReadersAlsoEnjoyed, the "Readers
+// also enjoyed" carousel of the book page. Edges are tagged with the source
+// they come from. Both are capped by WithMaxReadAlso. Defaults to
+// book.SourceAlsoRead alone, which is also used when no valid sources are
+// given. Invalid sources are logged and ignored, see
+// ValidateRecommendationSources
+func WithRecommendationSources(sources ...string) CrawlerOption {
+	return func(c *Crawler) {
+		c.recommendationSources = map[string]bool{}
+		for _, source := range sources {
+			if err := ValidateRecommendationSources(source); err != nil {
+				log.Warnf("%v, ignoring it", err)
+				continue
+			}
+			c.recommendationSources[source] = true
+		}
+		if len(c.recommendationSources) == 0 {
+			c.recommendationSources[book.SourceAlsoRead] = true
+		}
+	}
+}
+
+// ValidateRecommendationSources fails on the first source that is not one of
+// the recommendation sources WithRecommendationSources can follow
+func ValidateRecommendationSources(sources ...string) error {
+	for _, source := range sources {
+		if source != book.SourceAlsoRead && source != book.SourceReadersAlsoEnjoyed {
+			return fmt.Errorf("invalid recommendation source %q: expected %s or %s", source, book.SourceAlsoRead, book.SourceReadersAlsoEnjoyed)
+		}
+	}
+	return nil
+}
+
+// WithFollowSimilarAuthors also traverses goodreads' author similarity: from
+// a book we go to its author, then to similar authors and follow their top
+// book. These edges are tagged with book.SourceSimilarAuthor
+func WithFollowSimilarAuthors(followSimilarAuthors bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.followSimilarAuthors = followSimilarAuthors
+	}
+}
+
+// WithCrawlAuthors also follows the other books in the author page of every
+// book, up to WithMaxAuthorBooks of them. Books already followed as related
+// books are left out. These edges are tagged with book.SourceAuthor, and are
+// not recommendations, see book.Edge.Recommended. Author pages are fetched once
+// per run
+func WithCrawlAuthors(crawlAuthors bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.crawlAuthors = crawlAuthors
+	}
+}
+
+// WithMaxAuthorBooks caps how many books are followed from an author page
+// when crawling authors. Set to a negative number to follow all of them
+func WithMaxAuthorBooks(maxAuthorBooks int) CrawlerOption {
+	return func(c *Crawler) {
+		c.maxAuthorBooks = maxAuthorBooks
+	}
+}
+
+// WithMaxListBooks caps how many books are taken from a list when using
+// CrawlList. Set to a negative number to take all books in the list
+func WithMaxListBooks(maxListBooks int) CrawlerOption {
+	return func(c *Crawler) {
+		c.maxListBooks = maxListBooks
+	}
+}
+
+// WithCanonicalizeWorks dedups books on the work they are an edition of, so
+// different editions of the same book found while crawling end up as a single
+// book. Links to the other editions point to the first edition crawled
+func WithCanonicalizeWorks(canonicalizeWorks bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.canonicalizeWorks = canonicalizeWorks
+	}
+}
+
+// WithTrackProvenance records on every book crawled how it entered the graph:
+// which book it was first found from, at which depth and from which seed. See
+// book.Book.DiscoveredFrom
+func WithTrackProvenance(trackProvenance bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.trackProvenance = trackProvenance
+	}
+}
+
+// WithSkipLinked stops the crawl at books linked in previous runs instead of
+// descending into their related books again. This makes adding new seeds to
+// an existing graph much faster, but a previous crawl cannot be extended to a
+// larger depth with it
+func WithSkipLinked(skipLinked bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.skipLinked = skipLinked
+	}
+}
+
+// WithResume trusts the books linked by previous runs over the same storage:
+// their state is not updated again, which saves a storage write per book, and
+// the crawl only walks their stored edges to reach the books still to be
+// crawled. Books persisted but not linked, as their run was interrupted, are
+// fetched again to link them. Meant for restarting interrupted crawls with
+// the same depth, see Drain
+func WithResume(resume bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.resume = resume
+	}
+}
+
+// GraphListener is told about every book and edge persisted by a crawl, as
+// they are persisted, eg to stream the graph while it grows. Calls are
+// concurrent. Errors stop the crawl
+type GraphListener interface {
+	AddBook(b *book.Book, depth int) error
+	AddEdge(fromURL string, toURL string, priority int, source string) error
+}
+
+// WithGraphListener sends the books and edges persisted to l. Books and edges
+// persisted by previous runs are not sent
+func WithGraphListener(l GraphListener) CrawlerOption {
+	return func(c *Crawler) {
+		c.graphListener = l
+	}
+}
+
+// WithProgressLogs controls whether the crawl counts and rate are logged every
+// 10 seconds while crawling, eg to show them some other way with Counts. They
+// are still logged once at the end of every run. Defaults to true
+func WithProgressLogs(progressLogs bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.progressLogs = progressLogs
+	}
+}
+
+// WithMetrics counts the books checked and crawled, along with the requests
+// made, on m
+func WithMetrics(m *metrics.Metrics) CrawlerOption {
+	return func(c *Crawler) {
+		c.metrics = m
+		c.Client.Metrics = m
+	}
+}
+
+// WithContinueOnError keeps crawling when a book cannot be fetched even after
+// retrying, instead of failing the whole run. The book is logged, moved to
+// storage.Failed and counted in Failures. The books it was related to are
+// left Crawled rather than Linked, so the next run over the same storage
+// fetches them again and retries it. Books failing for good, like deleted
+// ones, are skipped either way
+func WithContinueOnError(continueOnError bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.continueOnError = continueOnError
+	}
+}
+
+// WithDryRun fetches and parses pages as usual but writes nothing to Storage.
+// Each run keeps its own in-memory storage instead, so the crawl is walked as
+// if nothing had been persisted before, logging the books it would persist
+func WithDryRun(dryRun bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.dryRun = dryRun
+	}
+}
+
+// WithSiteAdapter points the crawler to a different book site. Defaults to
+// GoodreadsAdapter
+func WithSiteAdapter(site SiteAdapter) CrawlerOption {
+	return func(c *Crawler) {
+		c.site = site
+	}
+}
+
+// WithExtractor replaces how books are extracted from their pages, eg for a
+// different page layout, while keeping the rest of the site adapter. Defaults
+// to the site adapter extractor
+func WithExtractor(extractor book.Extractor) CrawlerOption {
+	return func(c *Crawler) {
+		c.extractor = extractor
+	}
+}
+
+// WithAllowedHosts only crawls books and fetches pages on the given hosts or
+// their subdomains, eg goodreads.com allows www.goodreads.com. Pages that
+// redirect to other hosts are discarded. No hosts disables the check
+func WithAllowedHosts(hosts ...string) CrawlerOption {
+	return func(c *Crawler) {
+		c.allowedHosts = lowerCaseSet(hosts)
+	}
+}
+
+// WithURLFilter only crawls books and fetches pages whose url passes filter,
+// on top of the allowed hosts. Pages that redirect to urls not passing it are
+// discarded. A nil filter disables the check
+func WithURLFilter(filter func(url string) bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.urlFilter = filter
+	}
+}
+
+// WithFetcher replaces how pages are fetched, eg to serve saved pages without
+// network access. Defaults to an HTTPFetcher using the crawler Client, which
+// is left unused otherwise
+func WithFetcher(fetcher Fetcher) CrawlerOption {
+	return func(c *Crawler) {
+		c.fetcher = fetcher
+	}
+}
+
+// WithSearchURL changes where SearchBook sends its queries to when using the
+// GoodreadsAdapter. Defaults to DefaultSearchURL
+func WithSearchURL(searchURL string) CrawlerOption {
+	return func(c *Crawler) {
+		if goodreads, ok := c.site.(*GoodreadsAdapter); ok {
+			goodreads.SearchURL = searchURL
+		}
+	}
+}
+
+// WithSelectors patches the css selectors of the GoodreadsAdapter, eg after
+// goodreads changes its markup. Defaults to DefaultSelectors, which also fill
+// the selectors left empty. Pages reduced with WithReducedPages only keep their
+// main content, so selectors outside of it find nothing
+func WithSelectors(selectors Selectors) CrawlerOption {
+	return func(c *Crawler) {
+		if goodreads, ok := c.site.(*GoodreadsAdapter); ok {
+			selectors = selectors.withDefaults()
+			goodreads.Selectors = &selectors
+		}
+	}
+}
+
+// WithStorageConcurrency caps how many storage calls run at the same time,
+// independently of WithMaxParallelism, which only bounds requests. Every
+// crawled book needs several storage calls, so high parallelism can easily
+// outnumber what the storage handles well. For neo4j, set it at most to the
+// session pool size (neo4j.DefaultSessionPoolSize unless changed), so calls
+// queue in the crawler instead of timing out waiting for a session. Set to 0
+// for no limit
+func WithStorageConcurrency(storageConcurrency int) CrawlerOption {
+	return func(c *Crawler) {
+		c.storageConcurrency = storageConcurrency
+	}
+}
+
+// WithRawHTMLStore saves the raw html of every successfully fetched book page
+// to dir, so books can be re-extracted later without crawling again
+func WithRawHTMLStore(dir string) CrawlerOption {
+	return func(c *Crawler) {
+		if dir == "" {
+			c.rawHTMLStore = nil
+			return
+		}
+		c.rawHTMLStore = html.NewStore(dir)
+	}
+}
+
+// WithReducedPages trims book pages down to the regions the extractors read
+// from with a streaming tokenizer before building their DOM, which greatly
+// reduces allocations on large crawls
+func WithReducedPages(reducePages bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.reducePages = reducePages
+	}
+}
+
+// WithCPUProfile writes a pprof cpu profile covering the whole crawl to path
+func WithCPUProfile(path string) CrawlerOption {
+	return func(c *Crawler) {
+		c.cpuProfilePath = path
+	}
+}
+
+// WithMemProfile writes a pprof allocation profile to path once the crawl ends
+func WithMemProfile(path string) CrawlerOption {
+	return func(c *Crawler) {
+		c.memProfilePath = path
+	}
+}
+
 func WithMaxParallelism(maxParallelism int) CrawlerOption {
 	return func(c *Crawler) {
 		c.maxParallelism = maxParallelism
@@ -106,12 +638,117 @@ func WithMaxParallelism(maxParallelism int) CrawlerOption {
 	}
 }
 
+// WithMaxConcurrentDepth bounds how many depth levels can have fetches in
+// progress at the same time, which bounds memory on very deep crawls. Fetches
+// at a level wait while levels too far above or below it are still busy, so
+// the traversal becomes staged: shallower books tend to be crawled before
+// deeper ones instead of each branch being followed all the way down first.
+// Zero disables the limit
+func WithMaxConcurrentDepth(maxConcurrentDepth int) CrawlerOption {
+	return func(c *Crawler) {
+		if maxConcurrentDepth <= 0 {
+			c.depthGate = nil
+			return
+		}
+		c.depthGate = newDepthGate(maxConcurrentDepth)
+	}
+}
+
+// WithDeterministic makes crawls reproducible: requests are done one at a time
+// and related books are visited sequentially in lexicographical url order, so
+// the same seed and pages always produce the same graph. This is considerably
+// slower than a parallel crawl and is mostly meant for testing
+func WithDeterministic(deterministic bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.deterministic = deterministic
+		if deterministic {
+			WithMaxParallelism(1)(c)
+		}
+	}
+}
+
+// WithClock makes the crawler and its http client wait and tell time with
+// clock, eg a clock.Fake so throttling and retries do not actually wait.
+// Storage backends keep timestamping states with the wall clock
+func WithClock(clock clock.Clock) CrawlerOption {
+	return func(c *Crawler) {
+		c.clock = clock
+		c.Client.Clock = clock
+		if c.Client.Throttle != nil {
+			c.Client.Throttle.Clock = clock
+		}
+		if c.Client.RateLimit != nil {
+			c.Client.RateLimit.Clock = clock
+		}
+	}
+}
+
+// WithRateLimit makes at most rps requests per second to each host, after an
+// initial burst of up to burst requests. A rps of 0 or less disables the limit
+func WithRateLimit(rps float64, burst int) CrawlerOption {
+	return func(c *Crawler) {
+		if rps <= 0 {
+			c.Client.RateLimit = nil
+			return
+		}
+		limiter := myhttp.NewRateLimiter(rps, burst)
+		limiter.Clock = c.clock
+		c.Client.RateLimit = limiter
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request, which is also
+// the agent robots.txt rules are looked up for
+func WithUserAgent(userAgent string) CrawlerOption {
+	return func(c *Crawler) {
+		c.Client.UserAgent = userAgent
+	}
+}
+
+// WithRespectRobots makes the crawler skip urls disallowed by the robots.txt
+// of their host and wait for its crawl delay. Enabled by default
+func WithRespectRobots(respect bool) CrawlerOption {
+	return func(c *Crawler) {
+		if !respect {
+			c.Client.Robots = nil
+		} else if c.Client.Robots == nil {
+			c.Client.Robots = myhttp.NewRobots("")
+		}
+	}
+}
+
+// WithThrottle pauses all requests once more than threshold (0 to 1) of the
+// recent responses were rate limited, doubling the pause up to maxPause while
+// that lasts. A threshold of 0 or less disables the throttle
+func WithThrottle(threshold float64, maxPause time.Duration) CrawlerOption {
+	return func(c *Crawler) {
+		if threshold <= 0 {
+			c.Client.Throttle = nil
+			return
+		}
+		throttle := myhttp.NewThrottle()
+		throttle.Threshold = threshold
+		throttle.MaxPause = maxPause
+		throttle.Clock = c.clock
+		if throttle.MinPause > maxPause {
+			throttle.MinPause = maxPause
+		}
+		c.Client.Throttle = throttle
+	}
+}
+
 func WithRequestMaxRetries(maxRetries int) CrawlerOption {
 	return func(c *Crawler) {
 		c.Client.RetryMax(maxRetries)
 	}
 }
 
+func WithRequestMaxRedirects(maxRedirects int) CrawlerOption {
+	return func(c *Crawler) {
+		c.Client.MaxRedirects(maxRedirects)
+	}
+}
+
 func WithRequestMaxRetryWait(maxWait time.Duration) CrawlerOption {
 	return func(c *Crawler) {
 		c.Client.RetryWaitMax(maxWait)
@@ -123,3 +760,48 @@ func WithRequestMinRetryWait(minWait time.Duration) CrawlerOption {
 		c.Client.RetryWaitMin(minWait)
 	}
 }
+
+// WithConditionalRequests revalidates pages fetched before by the crawler with
+// their ETag and Last-Modified headers, reusing the page when it was not
+// modified. Up to myhttp.DefaultMemoryCacheSize pages are cached in memory,
+// for as long as the crawler is around, so later runs in other processes fetch
+// them again
+func WithConditionalRequests(conditionalRequests bool) CrawlerOption {
+	return func(c *Crawler) {
+		if conditionalRequests {
+			c.Client.Cache = myhttp.NewMemoryCache(0)
+		} else {
+			c.Client.Cache = nil
+		}
+	}
+}
+
+// WithRequestTimeout aborts request attempts taking longer than timeout,
+// retrying them as usual. Only the attempt is aborted, never the crawl. Zero
+// disables it
+func WithRequestTimeout(timeout time.Duration) CrawlerOption {
+	return func(c *Crawler) {
+		c.Client.RequestTimeout(timeout)
+	}
+}
+
+// WithProxy sends every request through the proxy at proxyURL, either a
+// http(s) or a socks5 proxy, eg socks5://localhost:1080. Empty uses the proxy
+// from the environment, if any. An invalid url fails every request instead of
+// connecting without the proxy
+func WithProxy(proxyURL string) CrawlerOption {
+	return func(c *Crawler) {
+		if err := c.Client.Proxy(proxyURL); err != nil {
+			log.Errorf("%v, every request will fail", err)
+		}
+	}
+}
+
+// WithRetryJitter randomizes the wait in between retries, still bounded by
+// the max retry wait, so the many requests failing at once when goodreads
+// starts refusing them do not all retry at the same time
+func WithRetryJitter(jitter bool) CrawlerOption {
+	return func(c *Crawler) {
+		c.Client.RetryJitter(jitter)
+	}
+}
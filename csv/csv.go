@@ -0,0 +1,45 @@
+package csv
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bcap/book-crawler/book"
+)
+
+var header = []string{
+	"title", "author", "author_url", "rating", "ratings",
+	"ratings1", "ratings2", "ratings3", "ratings4", "ratings5",
+	"reviews", "pages", "genres", "url",
+}
+
+// WriteBooks writes a header row and then one row per book, in the given
+// order. Unknown ratings are left empty and genres are joined by commas
+func WriteBooks(books []*book.Book, w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, b := range books {
+		rating := ""
+		if b.Rating >= 0 {
+			rating = b.Rating.String()
+		}
+		row := []string{
+			b.Title, b.Author, b.AuthorURL, rating, itoa(b.RatingsTotal),
+			itoa(b.Ratings1), itoa(b.Ratings2), itoa(b.Ratings3), itoa(b.Ratings4), itoa(b.Ratings5),
+			itoa(b.Reviews), itoa(b.Pages), strings.Join(b.Genres, ","), b.URL,
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func itoa(i int32) string {
+	return strconv.Itoa(int(i))
+}
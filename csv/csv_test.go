@@ -0,0 +1,93 @@
+package csv_test
+
+import (
+	"context"
+	stdcsv "encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/csv"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+func write(t *testing.T, books []*book.Book) [][]string {
+	t.Helper()
+	var out strings.Builder
+	if err := csv.WriteBooks(books, &out); err != nil {
+		t.Fatal(err)
+	}
+	records, err := stdcsv.NewReader(strings.NewReader(out.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// TestCsv checks the csv output: a header and a row per book that reads back
+// to the same values, including fields with commas, quotes and line breaks
+func TestCsv(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	tricky := book.New("https://www.goodreads.com/book/show/1")
+	tricky.Title = `The "Quoted", the Comma, and the` + "\nLine Break"
+	tricky.Author = "Doe, Jane"
+	tricky.AuthorURL = "https://www.goodreads.com/author/show/1"
+	tricky.Rating = book.NewRating(4.05)
+	tricky.RatingsTotal = 15
+	tricky.Ratings1, tricky.Ratings2, tricky.Ratings3, tricky.Ratings4, tricky.Ratings5 = 1, 2, 3, 4, 5
+	tricky.Reviews = 6
+	tricky.Pages = 320
+	tricky.Genres = []string{"Fantasy", "Science Fiction"}
+	unrated := book.New("https://www.goodreads.com/book/show/2")
+	unrated.Title = "Unrated"
+	unrated.Rating = book.NoRating
+
+	records := write(t, []*book.Book{tricky, unrated})
+	if len(records) != 3 {
+		t.Errorf("header and a row per book (%d records)", len(records))
+	}
+	if strings.Join(records[0], " ") != "title author author_url rating ratings ratings1 ratings2 ratings3 ratings4 ratings5 reviews pages genres url" {
+		t.Errorf("header (%v)", records[0])
+	}
+	expected := []string{
+		tricky.Title, "Doe, Jane", tricky.AuthorURL, "4.05", "15", "1", "2", "3", "4", "5", "6", "320", "Fantasy,Science Fiction", tricky.URL,
+	}
+	if strings.Join(records[1], "|") != strings.Join(expected, "|") {
+		t.Errorf("fields read back escaped (%q)", records[1])
+	}
+	if !(records[2][3] == "" && records[2][12] == "") {
+		t.Errorf("unknown ratings and no genres are empty (%q)", records[2])
+	}
+
+	if len(write(t, nil)) != 1 {
+		t.Errorf("no books is only the header")
+	}
+
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+	c := crawler.NewCrawler(crawler.WithMaxDepth(3), crawler.WithMaxReadAlso(3))
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.Storage.GetBook(ctx, server.BookURL(1), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	books := book.Collect(root)
+	records = write(t, books)
+	matching := 0
+	for idx, b := range books {
+		row := records[idx+1]
+		if row[0] == b.Title && row[1] == b.Author && row[3] == b.Rating.String() && row[13] == b.URL {
+			matching++
+		}
+	}
+	if !(len(records) == len(books)+1 && matching == len(books)) {
+		t.Errorf("a row per crawled book, in order (%d of %d)", matching, len(books))
+	}
+
+}
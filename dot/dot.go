@@ -4,37 +4,114 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/bcap/book-crawler/book"
 )
 
-type recurseFn = func(visited map[*book.Book]struct{}, book *book.Book, depth int)
+type recurseFn = func(visited map[*book.Book]struct{}, book *book.Book, depth int) error
 
-func PrintBookGraph(graph book.Graph, writer io.Writer) {
+const (
+	LayoutAuto  = ""
+	LayoutDot   = "dot"
+	LayoutSfdp  = "sfdp"
+	LayoutNeato = "neato"
+	LayoutFdp   = "fdp"
+)
+
+type PrintBookGraphOptions struct {
+	// Layout is the graphviz engine to render with. When left as LayoutAuto,
+	// LayoutDot is used unless the graph has more than LargeGraphThreshold
+	// books, in which case the force directed LayoutSfdp is used
+	Layout              string
+	LargeGraphThreshold int
+
+	// Overlap controls how overlapping nodes are handled by force directed
+	// layouts. Ignored by LayoutDot
+	Overlap string
+
+	// Concentrate merges parallel edges
+	Concentrate bool
+
+	// MaxEdgePriority only draws edges with a priority lower than it (eg 3
+	// draws only the top 3 recommendations of each book). All books are still
+	// drawn. Zero means no limit
+	MaxEdgePriority int
+
+	// NodeTemplate and EdgeTemplate, when set, render the attributes of each
+	// node and edge (eg `label={{quote .Title}} URL={{quote .URL}}`), replacing
+	// the default ones. Nodes are executed with a Node and edges with an Edge.
+	// Templates can use the functions in TemplateFuncs
+	NodeTemplate *template.Template
+	EdgeTemplate *template.Template
+}
+
+// Node is the data given to PrintBookGraphOptions.NodeTemplate
+type Node struct {
+	*book.Book
+	Depth int
+}
+
+// Edge is the data given to PrintBookGraphOptions.EdgeTemplate
+type Edge struct {
+	*book.Edge
+	Index int
+}
+
+// TemplateFuncs are helpers for node and edge templates. quote turns any
+// value into a quoted dot string
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"quote": func(v any) string {
+			return strconv.Quote(fmt.Sprint(v))
+		},
+	}
+}
+
+// WithNodeTemplate returns a copy of the options rendering nodes with t
+func (o PrintBookGraphOptions) WithNodeTemplate(t *template.Template) PrintBookGraphOptions {
+	o.NodeTemplate = t
+	return o
+}
+
+// WithEdgeTemplate returns a copy of the options rendering edges with t
+func (o PrintBookGraphOptions) WithEdgeTemplate(t *template.Template) PrintBookGraphOptions {
+	o.EdgeTemplate = t
+	return o
+}
+
+func DefaultPrintBookGraphOptions() PrintBookGraphOptions {
+	return PrintBookGraphOptions{
+		Layout:              LayoutAuto,
+		LargeGraphThreshold: 200,
+		Overlap:             "prune",
+	}
+}
+
+func (o PrintBookGraphOptions) layout(graph book.Graph) string {
+	if o.Layout != LayoutAuto {
+		return o.Layout
+	}
+	if o.LargeGraphThreshold > 0 && len(graph.All) > o.LargeGraphThreshold {
+		return LayoutSfdp
+	}
+	return LayoutDot
+}
+
+func PrintBookGraph(graph book.Graph, writer io.Writer, options PrintBookGraphOptions) error {
 	// analysis := analyzeGraph(graph)
 
-	genNodes := func() {
+	genNodes := func() error {
 		for depth, books := range graph.ByDepth {
 			for _, book := range books {
-				label := fmt.Sprintf(
-					"%s\\l%s\\l%d (%d ratings)\\l%d reviews\\ldepth:%d\\l",
-					book.Title,
-					book.Author,
-					book.Rating,
-					book.RatingsTotal,
-					book.Reviews,
-					depth,
-				)
-				fmt.Fprintf(
-					writer,
-					"%q [nojustify=false label=\"%s\" URL=\"%s\"]\n",
-					bookID(book),
-					label,
-					book.URL,
-				)
+				if err := writeNode(writer, options, book, depth); err != nil {
+					return err
+				}
 			}
 		}
+		return nil
 	}
 
 	genRanks := func() {
@@ -52,35 +129,139 @@ func PrintBookGraph(graph book.Graph, writer io.Writer) {
 	}
 
 	var genEdges recurseFn
-	genEdges = func(visited map[*book.Book]struct{}, book *book.Book, depth int) {
+	genEdges = func(visited map[*book.Book]struct{}, book *book.Book, depth int) error {
 		visited[book] = struct{}{}
-		for idx, relatedBook := range book.AlsoRead {
-			label := fmt.Sprintf("idx:%d", idx)
-			fmt.Fprintf(writer, "%q -> %q [label=%q]\n", bookID(book), bookID(relatedBook.To), label)
+		for idx := range book.AlsoRead {
+			// books reached through author edges are still walked, so their own
+			// recommendations are drawn
+			if !book.AlsoRead[idx].Recommended() {
+				continue
+			}
+			if err := writeEdge(writer, options, book, &book.AlsoRead[idx], idx); err != nil {
+				return err
+			}
 		}
 		for _, relatedBook := range book.AlsoRead {
 			if _, v := visited[relatedBook.To]; !v {
-				genEdges(visited, relatedBook.To, depth+1)
+				if err := genEdges(visited, relatedBook.To, depth+1); err != nil {
+					return err
+				}
 			}
 		}
+		return nil
 	}
 
-	fmt.Fprint(writer, "digraph G {\n")
-	fmt.Fprint(writer, "\n// styling\n")
-	fmt.Fprint(writer, "rankdir=LR\n")
-	fmt.Fprint(writer, "splines=ortho\n")
-	fmt.Fprint(writer, "node [shape=box]\n")
+	// an empty graph still has to be a valid dot file
+	if len(graph.All) == 0 && len(graph.Roots) == 0 {
+		fmt.Fprint(writer, "digraph G {}\n")
+		return nil
+	}
+
+	layout := options.layout(graph)
+	writeHeader(writer, options, layout)
 
 	fmt.Fprint(writer, "\n// node declarations\n")
-	genNodes()
+	if err := genNodes(); err != nil {
+		return err
+	}
 
-	fmt.Fprint(writer, "\n// rank adjustments\n")
-	genRanks()
+	// ranks are only honored by the dot layout
+	if layout == LayoutDot {
+		fmt.Fprint(writer, "\n// rank adjustments\n")
+		genRanks()
+	}
 
 	fmt.Fprint(writer, "\n// edges\n")
-	genEdges(map[*book.Book]struct{}{}, graph.Root, 0)
+	visited := map[*book.Book]struct{}{}
+	for _, root := range graph.Roots {
+		if _, v := visited[root]; !v {
+			if err := genEdges(visited, root, 0); err != nil {
+				return err
+			}
+		}
+	}
 
 	fmt.Fprint(writer, "\n}\n")
+	return nil
+}
+
+// writeHeader opens the digraph and styles it
+func writeHeader(writer io.Writer, options PrintBookGraphOptions, layout string) {
+	fmt.Fprint(writer, "digraph G {\n")
+	fmt.Fprint(writer, "\n// styling\n")
+	fmt.Fprintf(writer, "layout=%s\n", layout)
+	if layout == LayoutDot {
+		fmt.Fprint(writer, "rankdir=LR\n")
+		fmt.Fprint(writer, "splines=ortho\n")
+	} else if options.Overlap != "" {
+		fmt.Fprintf(writer, "overlap=%s\n", options.Overlap)
+	}
+	if options.Concentrate {
+		fmt.Fprint(writer, "concentrate=true\n")
+	}
+	fmt.Fprint(writer, "node [shape=box]\n")
+}
+
+func writeNode(writer io.Writer, options PrintBookGraphOptions, book *book.Book, depth int) error {
+	if options.NodeTemplate != nil {
+		attrs, err := execute(options.NodeTemplate, Node{Book: book, Depth: depth})
+		if err != nil {
+			return fmt.Errorf("failed to render node %s: %w", book.URL, err)
+		}
+		_, err = fmt.Fprintf(writer, "%q [%s]\n", bookID(book), attrs)
+		return err
+	}
+	label := fmt.Sprintf(
+		"%s\\l%s\\l%s (%d ratings)\\l%d reviews\\ldepth:%d\\l",
+		book.Title,
+		book.Author,
+		book.Rating,
+		book.RatingsTotal,
+		book.Reviews,
+		depth,
+	)
+	if isbn := firstNonEmpty(book.ISBN13, book.ISBN); isbn != "" {
+		label += fmt.Sprintf("isbn:%s\\l", isbn)
+	}
+	if book.Editions > 0 {
+		label += fmt.Sprintf("%d editions\\l", book.Editions)
+	}
+	_, err := fmt.Fprintf(
+		writer,
+		"%q [nojustify=false label=\"%s\" URL=\"%s\"]\n",
+		bookID(book),
+		label,
+		book.URL,
+	)
+	return err
+}
+
+// writeEdge skips edges beyond options.MaxEdgePriority. idx is the position
+// of the edge among the edges of from
+func writeEdge(writer io.Writer, options PrintBookGraphOptions, from *book.Book, edge *book.Edge, idx int) error {
+	if options.MaxEdgePriority > 0 && edge.Priority >= options.MaxEdgePriority {
+		return nil
+	}
+	if options.EdgeTemplate != nil {
+		attrs, err := execute(options.EdgeTemplate, Edge{Edge: edge, Index: idx})
+		if err != nil {
+			return fmt.Errorf("failed to render edge from %s to %s: %w", from.URL, edge.To.URL, err)
+		}
+		_, err = fmt.Fprintf(writer, "%q -> %q [%s]\n", bookID(from), bookID(edge.To), attrs)
+		return err
+	}
+	label := fmt.Sprintf("idx:%d", idx)
+	_, err := fmt.Fprintf(writer, "%q -> %q [label=%q%s]\n", bookID(from), bookID(edge.To), label, edgeStyle(*edge))
+	return err
+}
+
+func execute(t *template.Template, data any) (string, error) {
+	var buf strings.Builder
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	// attributes must stay in a single line
+	return strings.Join(strings.Fields(buf.String()), " "), nil
 }
 
 type analysis struct {
@@ -121,6 +302,26 @@ func processMinMax(graph book.Graph, result *analysis) {
 	}
 }
 
+// edgeStyle returns extra edge attributes to tell edge sources apart
+func edgeStyle(edge book.Edge) string {
+	switch edge.Source {
+	case book.SourceSimilarAuthor:
+		return " style=dashed"
+	case book.SourceReadersAlsoEnjoyed:
+		return " style=bold"
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
 func bookID(b *book.Book) string {
 	return fmt.Sprintf("%s by %s", b.Title, b.Author)
 }
@@ -0,0 +1,146 @@
+package dot_test
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/dot"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+// syncBuffer can be read while the crawl writes to it
+type syncBuffer struct {
+	buf   bytes.Buffer
+	mutex sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+// lines returns the sorted node and edge lines of a dot file
+func lines(output string) (nodes []string, edges []string) {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, " -> ") {
+			edges = append(edges, line)
+		} else if strings.HasPrefix(line, `"`) {
+			nodes = append(nodes, line[:strings.Index(line, " [")])
+		}
+	}
+	sort.Strings(nodes)
+	sort.Strings(edges)
+	return nodes, edges
+}
+
+func valid(output string) bool {
+	return strings.HasPrefix(output, "digraph G {\n") && strings.HasSuffix(output, "\n}\n") && strings.Count(output, "}") == 1
+}
+
+// TestDotStream checks that the streamed dot output has a node per persisted
+// book and the same edges as the dot output printed after the crawl, that it
+// is written while crawling and only ended once closed, including when the
+// crawl is cancelled
+func TestDotStream(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+	options := dot.DefaultPrintBookGraphOptions()
+
+	var empty syncBuffer
+	stream := dot.NewStreamWriter(&empty, options)
+	if !(stream.Close() == nil && valid(empty.String())) {
+		t.Errorf("an empty stream is a valid dot file:\n%s", empty.String())
+	}
+	if stream.Close() != nil {
+		t.Errorf("closing twice is fine")
+	}
+	if stream.AddBook(book.New("https://www.goodreads.com/book/show/1"), 0) == nil {
+		t.Errorf("books cannot be added once closed")
+	}
+
+	server := fixture.NewServer(200, 3)
+	defer server.Close()
+
+	var output syncBuffer
+	stream = dot.NewStreamWriter(&output, options)
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(3),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(10),
+		crawler.WithGraphListener(stream),
+	)
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	partial := output.String()
+	if !(strings.HasPrefix(partial, "digraph G {\n") && !strings.HasSuffix(partial, "}\n")) {
+		t.Errorf("written while crawling, not ended until closed")
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	streamed := output.String()
+	if !valid(streamed) {
+		t.Errorf("ended once closed")
+	}
+
+	root, err := c.Storage.GetBook(ctx, server.BookURL(1), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph := book.NewGraph(root)
+	var printed strings.Builder
+	if err := dot.PrintBookGraph(graph, &printed, options); err != nil {
+		t.Fatal(err)
+	}
+	streamedNodes, streamedEdges := lines(streamed)
+	printedNodes, printedEdges := lines(printed.String())
+	if !(len(streamedNodes) == len(graph.All) && strings.Join(streamedNodes, "\n") == strings.Join(printedNodes, "\n")) {
+		t.Errorf("a node per persisted book (%d streamed, %d books)", len(streamedNodes), len(graph.All))
+	}
+	if !(len(streamedEdges) > 0 && strings.Join(streamedEdges, "\n") == strings.Join(printedEdges, "\n")) {
+		t.Errorf("same edges as printed after the crawl (%d streamed, %d printed)", len(streamedEdges), len(printedEdges))
+	}
+
+	// a cancelled crawl still ends up as a valid dot file once closed
+	slow := fixture.NewServer(200, 3)
+	slow.Delay = 20 * time.Millisecond
+	defer slow.Close()
+	var cancelledOutput syncBuffer
+	stream = dot.NewStreamWriter(&cancelledOutput, options)
+	c = crawler.NewCrawler(
+		crawler.WithMaxDepth(5),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(4),
+		crawler.WithGraphListener(stream),
+	)
+	cancelCtx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	err = c.Crawl(cancelCtx, slow.BookURL(1))
+	if err == nil {
+		t.Errorf("crawl cancelled: %v", err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	nodes, _ := lines(cancelledOutput.String())
+	if !(valid(cancelledOutput.String()) && len(nodes) > 0) {
+		t.Errorf("a cancelled crawl is a valid dot file once closed (%d nodes)", len(nodes))
+	}
+
+}
@@ -0,0 +1,74 @@
+package dot_test
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/dot"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+const golden = "testdata/graph.dot"
+
+var update = flag.Bool("update", false, "overwrite the golden file with the current output")
+
+// TestGolden crawls a fixture graph in deterministic mode and compares the
+// resulting dot output with a golden file. Pass -update to regenerate the
+// golden file after intended output changes
+func TestGolden(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+
+	first := render(t, server)
+	second := render(t, server)
+	if !bytes.Equal(first, second) {
+		t.Fatal("two deterministic crawls produced different dot outputs")
+	}
+
+	if *update {
+		if err := os.WriteFile(golden, first, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, first) {
+		t.Errorf("dot output differs from %s, run with -update if this is intended", golden)
+	}
+}
+
+func render(t *testing.T, server *fixture.Server) []byte {
+	ctx := context.Background()
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(3),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithDeterministic(true),
+	)
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.Storage.GetBook(ctx, server.BookURL(1), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.Buffer{}
+	if err := dot.PrintBookGraph(book.NewGraph(root), &buf, dot.DefaultPrintBookGraphOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the fixture server listens on a random port
+	return bytes.ReplaceAll(buf.Bytes(), []byte(server.URL), []byte("http://fixture"))
+}
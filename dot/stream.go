@@ -0,0 +1,108 @@
+package dot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/bcap/book-crawler/book"
+)
+
+// StreamWriter writes a dot file incrementally, a line per book and edge as
+// they are added, so a crawl can be watched while it grows. The graph is only
+// complete, and a valid dot file, once Close is called. It is safe for
+// concurrent use
+type StreamWriter struct {
+	writer  io.Writer
+	options PrintBookGraphOptions
+
+	// books written so far by url, as edges are added by url
+	books   map[string]*book.Book
+	started bool
+	closed  bool
+	err     error
+	mutex   sync.Mutex
+}
+
+// NewStreamWriter streams to writer. The size of the graph is not known
+// upfront, so LayoutAuto uses LayoutSfdp, and ranks by depth are not set.
+// MaxEdgePriority and the node and edge templates are honored
+func NewStreamWriter(writer io.Writer, options PrintBookGraphOptions) *StreamWriter {
+	return &StreamWriter{writer: writer, options: options, books: map[string]*book.Book{}}
+}
+
+// AddBook writes the node of a book at the given depth. Books already written
+// are ignored
+func (w *StreamWriter) AddBook(b *book.Book, depth int) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err := w.start(); err != nil {
+		return err
+	}
+	if _, ok := w.books[b.URL]; ok {
+		return nil
+	}
+	w.books[b.URL] = b
+	return w.fail(writeNode(w.writer, w.options, b, depth))
+}
+
+// AddEdge writes an edge in between two books already added. Edges from or
+// to books never added are skipped, as they would be drawn without labels
+func (w *StreamWriter) AddEdge(fromURL string, toURL string, priority int, source string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err := w.start(); err != nil {
+		return err
+	}
+	from, to := w.books[fromURL], w.books[toURL]
+	if from == nil || to == nil {
+		return nil
+	}
+	edge := book.Edge{From: from, To: to, Priority: priority, Source: source}
+	return w.fail(writeEdge(w.writer, w.options, from, &edge, priority))
+}
+
+// Close ends the graph. It can be called more than once, and returns the first
+// error writing the graph, if any
+func (w *StreamWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return w.err
+	}
+	if err := w.start(); err != nil {
+		return err
+	}
+	w.closed = true
+	_, err := fmt.Fprint(w.writer, "\n}\n")
+	return w.fail(err)
+}
+
+func (w *StreamWriter) start() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.closed {
+		return errors.New("dot stream already closed")
+	}
+	if w.started {
+		return nil
+	}
+	w.started = true
+	layout := w.options.Layout
+	if layout == LayoutAuto {
+		layout = LayoutSfdp
+	}
+	writeHeader(w.writer, w.options, layout)
+	_, err := fmt.Fprint(w.writer, "\n// nodes and edges, as crawled\n")
+	return w.fail(err)
+}
+
+// fail keeps the first error, so nothing else is written after it
+func (w *StreamWriter) fail(err error) error {
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return err
+}
@@ -0,0 +1,231 @@
+package fixture
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Server serves a synthetic web of interlinked goodreads-like book pages, so
+// the crawler can be exercised without network access. Book pages live at
+// /book/show/<id> and their related books at /book/similar/<id>, while the
+// books readers also enjoyed are in a carousel of the book page. Authors live
+// at /author/show/<id> and their similar authors at /author/similar/<id>.
+// /search?q=<text> finds books whose title contains the text, and the list at
+// /list/show/<id> has every book from id on, ListPageSize per ?page=<n>
+type Server struct {
+	*httptest.Server
+
+	NumBooks int
+	NumLinks int
+	// Delay is applied to every request, to simulate slow responses
+	Delay time.Duration
+	// Missing books are answered with a 404, like deleted goodreads books
+	Missing map[int]bool
+	// Redirects maps books to the book they are permanently redirected to,
+	// like goodreads books merged into others
+	Redirects map[int]int
+	// Works makes books editions of a work when set, with book id%Works as
+	// their work id, so every Works-th book is another edition of the same work
+	Works int
+	// RobotsTxt is served at /robots.txt when set, which is a 404 otherwise
+	RobotsTxt string
+}
+
+// ListPageSize is how many books each list page has
+const ListPageSize = 10
+
+func NewServer(numBooks int, numLinks int) *Server {
+	s := &Server{NumBooks: numBooks, NumLinks: numLinks}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *Server) BookURL(id int) string {
+	return fmt.Sprintf("%s/book/show/%d", s.URL, id)
+}
+
+func (s *Server) ListURL(id int) string {
+	return fmt.Sprintf("%s/list/show/%d", s.URL, id)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if s.Delay > 0 {
+		select {
+		case <-time.After(s.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if r.URL.Path == "/robots.txt" && s.RobotsTxt != "" {
+		fmt.Fprint(w, s.RobotsTxt)
+		return
+	}
+	if r.URL.Path == "/search" {
+		fmt.Fprint(w, s.searchPage(r.URL.Query().Get("q")))
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil || id < 0 || id >= s.NumBooks {
+		http.NotFound(w, r)
+		return
+	}
+	switch parts[0] + "/" + parts[1] {
+	case "book/show":
+		if s.Missing[id] {
+			http.NotFound(w, r)
+			return
+		}
+		if to, has := s.Redirects[id]; has {
+			http.Redirect(w, r, fmt.Sprintf("/book/show/%d", to), http.StatusMovedPermanently)
+			return
+		}
+		fmt.Fprint(w, s.bookPage(id))
+	case "book/similar":
+		fmt.Fprint(w, s.similarPage(id))
+	case "author/show":
+		fmt.Fprint(w, s.authorPage(id))
+	case "author/similar":
+		fmt.Fprint(w, s.similarAuthorsPage(id))
+	case "list/show":
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		fmt.Fprint(w, s.listPage(id, page))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) numAuthors() int {
+	if s.NumBooks < 50 {
+		return s.NumBooks
+	}
+	return 50
+}
+
+func (s *Server) bookPage(id int) string {
+	work := ""
+	if s.Works > 0 {
+		work = fmt.Sprintf(`<div class="row"><a href="/work/editions/%d-book">All editions (%d editions)</a></div>`, id%s.Works, 1+id%s.Works)
+	}
+	language := "English"
+	if id%4 == 3 {
+		language = "Spanish"
+	}
+	awards := ""
+	if id%5 == 0 {
+		awards = fmt.Sprintf(`<div class="clearFloats"><div class="infoBoxRowTitle">Literary Awards</div><div class="infoBoxRowItem"><a class="award">Fixture Award (%d)</a>, <a class="award">Book %d Prize</a></div></div>`, 1950+id%70, id)
+	}
+	// like goodreads, both the cover and the title link to each book
+	var enjoyed strings.Builder
+	for i := 1; i <= s.NumLinks; i++ {
+		related := (id*11 + i) % s.NumBooks
+		fmt.Fprintf(&enjoyed, `<a href="/book/show/%[1]d"><img alt="Book %[1]d"/></a><a href="/book/show/%[1]d">Book %[1]d</a>`, related)
+	}
+	return fmt.Sprintf(`<html><body>
+<div class="siteHeader"><a href="/">Home</a></div>
+<div class="mainContentContainer">
+<h1 id="bookTitle">Book %[1]d</h1>
+<a class="authorName" href="/author/show/%[2]d"><span>Author %[2]d</span></a>
+<span itemprop="ratingValue">%[3]d.%02[4]d</span>
+<a><meta itemprop="ratingCount" content="%[5]d"/></a>
+<a><meta itemprop="reviewCount" content="%[6]d"/></a>
+<div id="description"><span>Book %[1]d is about...</span><span style="display:none">Book %[1]d is about books, and the books related to them</span></div>
+<div id="details"><div class="row"><span itemprop="numberOfPages">%[7]d pages</span></div><div class="row">Published May 5th %[10]d by Fixture Books</div>%[9]s</div>
+<div id="bookDataBox"><div class="clearFloats"><div class="infoBoxRowTitle">Edition Language</div><div class="infoBoxRowItem">%[11]s</div></div>%[14]s</div>
+<a class="bookPageGenreLink">Genre %[8]d</a>
+<div class="userShelf"><a href="/shelf/show/to-read">to-read</a> (%[12]s)</div><div class="userShelf"><a href="/shelf/show/genre-%[8]d">genre-%[8]d</a> (%[13]d)</div>
+<a class="actionLink seeMoreLink" href="/book/similar/%[1]d">See similar books</a>
+<div class="BookPage__relatedTopContent"><h3>Readers also enjoyed</h3><div class="Carousel">%[15]s</div></div>
+</div>
+</body></html>`,
+		id, id%s.numAuthors(), 1+id%5, id%100, id*10, id*3, 100+id%400, id%10, work, 1950+id%70, language, thousands(id*1001), 1+id*2, awards, enjoyed.String(),
+	)
+}
+
+// thousands formats n with comma separated thousands, like goodreads does
+func thousands(n int) string {
+	digits := strconv.Itoa(n)
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+	return digits
+}
+
+func (s *Server) similarPage(id int) string {
+	var links strings.Builder
+	for i := 1; i <= s.NumLinks; i++ {
+		related := (id*7 + i) % s.NumBooks
+		fmt.Fprintf(&links, "<div><a itemprop=\"url\" href=\"/book/show/%d\">Book %d</a></div>\n", related, related)
+	}
+	return fmt.Sprintf(`<html><body>
+<div class="responsiveMainContentContainer">
+<div class="membersAlsoLikedText">Readers also enjoyed</div>
+%s</div>
+</body></html>`, links.String())
+}
+
+func (s *Server) authorPage(id int) string {
+	var books strings.Builder
+	for bookID := id; bookID < s.NumBooks; bookID += s.numAuthors() {
+		fmt.Fprintf(&books, "<tr><td><a class=\"bookTitle\" href=\"/book/show/%d\">Book %d</a></td></tr>\n", bookID, bookID)
+	}
+	return fmt.Sprintf(`<html><body>
+<h1 class="authorName">Author %d</h1>
+<table>
+%s</table>
+</body></html>`, id, books.String())
+}
+
+func (s *Server) similarAuthorsPage(id int) string {
+	var authors strings.Builder
+	for i := 1; i <= s.NumLinks; i++ {
+		related := (id*3 + i) % s.numAuthors()
+		fmt.Fprintf(&authors, "<div><a href=\"/author/show/%d\">Author %d</a></div>\n", related, related)
+	}
+	return fmt.Sprintf(`<html><body>
+%s</body></html>`, authors.String())
+}
+
+func (s *Server) listPage(id int, page int) string {
+	var books strings.Builder
+	first := id + (page-1)*ListPageSize
+	for bookID := first; bookID < first+ListPageSize && bookID < s.NumBooks; bookID++ {
+		fmt.Fprintf(&books, "<tr><td><a class=\"bookTitle\" href=\"/book/show/%d\">Book %d</a></td></tr>\n", bookID, bookID)
+	}
+	next := ""
+	if first+ListPageSize < s.NumBooks {
+		next = fmt.Sprintf(`<a class="next_page" href="/list/show/%d?page=%d">next »</a>`, id, page+1)
+	}
+	return fmt.Sprintf(`<html><body>
+<table>
+%s</table>
+%s
+</body></html>`, books.String(), next)
+}
+
+func (s *Server) searchPage(query string) string {
+	var results strings.Builder
+	for id := 0; id < s.NumBooks && query != ""; id++ {
+		title := fmt.Sprintf("Book %d", id)
+		if strings.Contains(strings.ToLower(title), strings.ToLower(query)) {
+			fmt.Fprintf(&results, "<tr><td><a class=\"bookTitle\" href=\"/book/show/%d?from_search=true\">%s</a></td></tr>\n", id, title)
+		}
+	}
+	return fmt.Sprintf(`<html><body>
+<table>
+%s</table>
+</body></html>`, results.String())
+}
@@ -0,0 +1,172 @@
+package gexf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bcap/book-crawler/book"
+)
+
+const (
+	namespace      = "http://gexf.net/1.3"
+	xsiNamespace   = "http://www.w3.org/2001/XMLSchema-instance"
+	schemaLocation = "http://gexf.net/1.3 http://gexf.net/1.3/gexf.xsd"
+	version        = "1.3"
+)
+
+// nodeAttributes and edgeAttributes are declared once at the top of the graph
+// and referenced by id from every node and edge
+var nodeAttributes = []attribute{
+	{ID: "author", Title: "author", Type: "string"},
+	{ID: "url", Title: "url", Type: "string"},
+	{ID: "rating", Title: "rating", Type: "double"},
+	{ID: "ratings", Title: "ratings total", Type: "integer"},
+	{ID: "reviews", Title: "reviews", Type: "integer"},
+	{ID: "pages", Title: "pages", Type: "integer"},
+	{ID: "genres", Title: "genres", Type: "liststring"},
+	{ID: "depth", Title: "depth", Type: "integer"},
+}
+
+var edgeAttributes = []attribute{
+	{ID: "priority", Title: "priority", Type: "integer"},
+	{ID: "source", Title: "source", Type: "string"},
+}
+
+type document struct {
+	XMLName        xml.Name `xml:"gexf"`
+	Xmlns          string   `xml:"xmlns,attr"`
+	XmlnsXSI       string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	Version        string   `xml:"version,attr"`
+	Meta           meta     `xml:"meta"`
+	Graph          graph    `xml:"graph"`
+}
+
+type meta struct {
+	Creator string `xml:"creator"`
+}
+
+type graph struct {
+	DefaultEdgeType string       `xml:"defaultedgetype,attr"`
+	Mode            string       `xml:"mode,attr"`
+	Attributes      []attributes `xml:"attributes"`
+	Nodes           []node       `xml:"nodes>node"`
+	Edges           []edge       `xml:"edges>edge"`
+}
+
+type attributes struct {
+	Class      string      `xml:"class,attr"`
+	Attributes []attribute `xml:"attribute"`
+}
+
+type attribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type node struct {
+	ID        string     `xml:"id,attr"`
+	Label     string     `xml:"label,attr"`
+	AttValues []attValue `xml:"attvalues>attvalue"`
+}
+
+type edge struct {
+	ID        string     `xml:"id,attr"`
+	Source    string     `xml:"source,attr"`
+	Target    string     `xml:"target,attr"`
+	Weight    string     `xml:"weight,attr"`
+	AttValues []attValue `xml:"attvalues>attvalue"`
+}
+
+type attValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// PrintBookGraph writes the graph as a GEXF 1.3 document, the native format of
+// Gephi, with typed attributes for the books and their recommendations. Books
+// are identified by their url, so each of them is a single node even when the
+// graph has cycles. Edges weigh 1 for the top recommendation of a book, 1/2
+// for the second one and so on
+func PrintBookGraph(graph book.Graph, writer io.Writer) error {
+	doc := document{
+		Xmlns:          namespace,
+		XmlnsXSI:       xsiNamespace,
+		SchemaLocation: schemaLocation,
+		Version:        version,
+		Meta:           meta{Creator: "book-crawler"},
+		Graph:          newGraph(graph),
+	}
+	if _, err := io.WriteString(writer, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(writer)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode gexf: %w", err)
+	}
+	_, err := io.WriteString(writer, "\n")
+	return err
+}
+
+func newGraph(g book.Graph) graph {
+	result := graph{
+		DefaultEdgeType: "directed",
+		Mode:            "static",
+		Attributes: []attributes{
+			{Class: "node", Attributes: nodeAttributes},
+			{Class: "edge", Attributes: edgeAttributes},
+		},
+		Nodes: []node{},
+		Edges: []edge{},
+	}
+
+	book.WalkGraph(
+		g,
+		func(b *book.Book, depth int) {
+			result.Nodes = append(result.Nodes, newNode(b, depth))
+		},
+		func(from *book.Book, e book.Edge) {
+			result.Edges = append(result.Edges, edge{
+				ID:     fmt.Sprintf("e%d", len(result.Edges)),
+				Source: from.URL,
+				Target: e.To.URL,
+				Weight: fmt.Sprint(1 / float64(e.Priority+1)),
+				AttValues: []attValue{
+					{For: "priority", Value: fmt.Sprint(e.Priority)},
+					{For: "source", Value: e.Source},
+				},
+			})
+		},
+	)
+	return result
+}
+
+func newNode(b *book.Book, depth int) node {
+	n := node{
+		ID:    b.URL,
+		Label: b.Title,
+		AttValues: []attValue{
+			{For: "author", Value: b.Author},
+			{For: "url", Value: b.URL},
+		},
+	}
+	// books without a rating have no value for it, as ? is not a double
+	if b.Rating >= 0 {
+		n.AttValues = append(n.AttValues, attValue{For: "rating", Value: b.Rating.String()})
+	}
+	n.AttValues = append(n.AttValues,
+		attValue{For: "ratings", Value: fmt.Sprint(b.RatingsTotal)},
+		attValue{For: "reviews", Value: fmt.Sprint(b.Reviews)},
+		attValue{For: "pages", Value: fmt.Sprint(b.Pages)},
+	)
+	// list values are separated by pipes
+	if len(b.Genres) > 0 {
+		n.AttValues = append(n.AttValues, attValue{For: "genres", Value: strings.Join(b.Genres, "|")})
+	}
+	n.AttValues = append(n.AttValues, attValue{For: "depth", Value: fmt.Sprint(depth)})
+	return n
+}
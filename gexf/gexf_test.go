@@ -0,0 +1,199 @@
+package gexf_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"strconv"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/gexf"
+	"github.com/bcap/book-crawler/log"
+)
+
+type document struct {
+	XMLName xml.Name `xml:"http://gexf.net/1.3 gexf"`
+	Version string   `xml:"version,attr"`
+	Graph   struct {
+		DefaultEdgeType string `xml:"defaultedgetype,attr"`
+		Attributes      []struct {
+			Class      string `xml:"class,attr"`
+			Attributes []struct {
+				ID   string `xml:"id,attr"`
+				Type string `xml:"type,attr"`
+			} `xml:"attribute"`
+		} `xml:"attributes"`
+		Nodes []struct {
+			ID        string     `xml:"id,attr"`
+			Label     string     `xml:"label,attr"`
+			AttValues []attValue `xml:"attvalues>attvalue"`
+		} `xml:"nodes>node"`
+		Edges []struct {
+			Source    string     `xml:"source,attr"`
+			Target    string     `xml:"target,attr"`
+			Weight    string     `xml:"weight,attr"`
+			AttValues []attValue `xml:"attvalues>attvalue"`
+		} `xml:"edges>edge"`
+	} `xml:"graph"`
+}
+
+type attValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// valid tells whether value is of the gexf attribute type
+func valid(attrType string, value string) bool {
+	switch attrType {
+	case "integer":
+		_, err := strconv.ParseInt(value, 10, 32)
+		return err == nil
+	case "double":
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+	case "string", "liststring":
+		return true
+	}
+	return false
+}
+
+// TestGexf checks the gexf output of a crawled fixture graph, which has
+// cycles: the document must parse as gexf 1.3, declare typed attributes, have
+// a single node per book with values only for declared attributes and of
+// their type, and only have edges in between declared nodes, weighted by
+// priority
+func TestGexf(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+
+	c := crawler.NewCrawler(crawler.WithMaxDepth(4), crawler.WithMaxReadAlso(3))
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.Storage.GetBook(ctx, server.BookURL(1), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph := book.NewGraph(root)
+
+	buf := bytes.Buffer{}
+	err = gexf.PrintBookGraph(graph, &buf)
+	if err != nil {
+		t.Errorf("gexf printed: %v", err)
+	}
+
+	var doc document
+	err = xml.Unmarshal(buf.Bytes(), &doc)
+	if err != nil {
+		t.Errorf("gexf parses in the gexf 1.3 namespace: %v", err)
+	}
+	if !(doc.Version == "1.3" && doc.Graph.DefaultEdgeType == "directed") {
+		t.Errorf("gexf 1.3 directed graph (version %q, %q edges)", doc.Version, doc.Graph.DefaultEdgeType)
+	}
+
+	types := map[string]map[string]string{}
+	for _, attrs := range doc.Graph.Attributes {
+		types[attrs.Class] = map[string]string{}
+		for _, attr := range attrs.Attributes {
+			types[attrs.Class][attr.ID] = attr.Type
+		}
+	}
+	for _, id := range []string{"rating", "reviews", "pages", "genres", "depth"} {
+		if types["node"][id] == "" {
+			t.Errorf("node attribute %s declared as %s", id, types["node"][id])
+		}
+	}
+	if types["node"]["genres"] != "liststring" {
+		t.Errorf("genres are a list of strings (%s)", types["node"]["genres"])
+	}
+
+	nodes := map[string]bool{}
+	duplicated := 0
+	invalidValues := 0
+	missingValues := 0
+	withGenres := 0
+	for _, node := range doc.Graph.Nodes {
+		if nodes[node.ID] {
+			duplicated++
+		}
+		nodes[node.ID] = true
+		found := map[string]bool{}
+		for _, v := range node.AttValues {
+			attrType, declared := types["node"][v.For]
+			if !declared || !valid(attrType, v.Value) {
+				invalidValues++
+			}
+			found[v.For] = true
+		}
+		for _, id := range []string{"rating", "reviews", "pages", "depth"} {
+			if !found[id] {
+				missingValues++
+			}
+		}
+		if found["genres"] {
+			withGenres++
+		}
+		if node.Label == "" {
+			missingValues++
+		}
+	}
+	if len(nodes) != len(graph.All) {
+		t.Errorf("a node per book (%d nodes, %d books)", len(nodes), len(graph.All))
+	}
+	if duplicated != 0 {
+		t.Errorf("no duplicated node ids (%d duplicated)", duplicated)
+	}
+	if invalidValues != 0 {
+		t.Errorf("node values are declared and of their type (%d not)", invalidValues)
+	}
+	if missingValues != 0 {
+		t.Errorf("every node has a label and all of its values (%d missing)", missingValues)
+	}
+	if withGenres != len(nodes) {
+		t.Errorf("genres listed for every fixture book (%d of %d)", withGenres, len(nodes))
+	}
+
+	expectedEdges := 0
+	for _, b := range graph.All {
+		expectedEdges += len(b.AlsoRead)
+	}
+	dangling := 0
+	badWeights := 0
+	for _, edge := range doc.Graph.Edges {
+		if !nodes[edge.Source] || !nodes[edge.Target] {
+			dangling++
+		}
+		priority := -1
+		for _, v := range edge.AttValues {
+			if v.For == "priority" {
+				priority, _ = strconv.Atoi(v.Value)
+			}
+		}
+		weight, err := strconv.ParseFloat(edge.Weight, 64)
+		if err != nil || priority < 0 || weight != 1/float64(priority+1) {
+			badWeights++
+		}
+	}
+	if len(doc.Graph.Edges) != expectedEdges {
+		t.Errorf("an edge per recommendation (%d edges, %d expected)", len(doc.Graph.Edges), expectedEdges)
+	}
+	if dangling != 0 {
+		t.Errorf("edges only reference declared nodes (%d dangling)", dangling)
+	}
+	if badWeights != 0 {
+		t.Errorf("edges weighted by their priority (%d not)", badWeights)
+	}
+
+	empty := bytes.Buffer{}
+	err = gexf.PrintBookGraph(book.NewGraph(), &empty)
+	if !(err == nil && xml.Unmarshal(empty.Bytes(), &document{}) == nil) {
+		t.Errorf("empty graph is valid gexf: %v", err)
+	}
+
+}
@@ -0,0 +1,130 @@
+package graphml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/bcap/book-crawler/book"
+)
+
+const namespace = "http://graphml.graphdrawing.org/xmlns"
+
+// keys are the data attributes of nodes and edges, declared once at the top
+// of the document
+var keys = []key{
+	{ID: "title", For: "node", Name: "title", Type: "string"},
+	{ID: "author", For: "node", Name: "author", Type: "string"},
+	{ID: "url", For: "node", Name: "url", Type: "string"},
+	{ID: "rating", For: "node", Name: "rating", Type: "double"},
+	{ID: "ratings", For: "node", Name: "ratings total", Type: "int"},
+	{ID: "reviews", For: "node", Name: "reviews", Type: "int"},
+	{ID: "pages", For: "node", Name: "pages", Type: "int"},
+	{ID: "depth", For: "node", Name: "depth", Type: "int"},
+	{ID: "priority", For: "edge", Name: "priority", Type: "int"},
+	{ID: "source", For: "edge", Name: "source", Type: "string"},
+}
+
+type document struct {
+	XMLName xml.Name `xml:"graphml"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Keys    []key    `xml:"key"`
+	Graph   graph    `xml:"graph"`
+}
+
+type key struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graph struct {
+	ID          string `xml:"id,attr"`
+	EdgeDefault string `xml:"edgedefault,attr"`
+	Nodes       []node `xml:"node"`
+	Edges       []edge `xml:"edge"`
+}
+
+type node struct {
+	ID   string `xml:"id,attr"`
+	Data []data `xml:"data"`
+}
+
+type edge struct {
+	ID     string `xml:"id,attr"`
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+	Data   []data `xml:"data"`
+}
+
+type data struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// PrintBookGraph writes the graph as GraphML, which can be loaded by tools
+// like Gephi and yEd. Books are identified by their url, so each of them is a
+// single node even when the graph has cycles
+func PrintBookGraph(graph book.Graph, writer io.Writer) error {
+	doc := document{
+		Xmlns: namespace,
+		Keys:  keys,
+		Graph: newGraph(graph),
+	}
+	if _, err := io.WriteString(writer, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(writer)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode graphml: %w", err)
+	}
+	_, err := io.WriteString(writer, "\n")
+	return err
+}
+
+func newGraph(g book.Graph) graph {
+	result := graph{ID: "G", EdgeDefault: "directed", Nodes: []node{}, Edges: []edge{}}
+
+	book.WalkGraph(
+		g,
+		func(b *book.Book, depth int) {
+			result.Nodes = append(result.Nodes, newNode(b, depth))
+		},
+		func(from *book.Book, e book.Edge) {
+			result.Edges = append(result.Edges, edge{
+				ID:     fmt.Sprintf("e%d", len(result.Edges)),
+				Source: from.URL,
+				Target: e.To.URL,
+				Data: []data{
+					{Key: "priority", Value: fmt.Sprint(e.Priority)},
+					{Key: "source", Value: e.Source},
+				},
+			})
+		},
+	)
+	return result
+}
+
+func newNode(b *book.Book, depth int) node {
+	n := node{
+		ID: b.URL,
+		Data: []data{
+			{Key: "title", Value: b.Title},
+			{Key: "author", Value: b.Author},
+			{Key: "url", Value: b.URL},
+		},
+	}
+	// books without a rating have no value for it, as ? is not a double
+	if b.Rating >= 0 {
+		n.Data = append(n.Data, data{Key: "rating", Value: b.Rating.String()})
+	}
+	n.Data = append(n.Data,
+		data{Key: "ratings", Value: fmt.Sprint(b.RatingsTotal)},
+		data{Key: "reviews", Value: fmt.Sprint(b.Reviews)},
+		data{Key: "pages", Value: fmt.Sprint(b.Pages)},
+		data{Key: "depth", Value: fmt.Sprint(depth)},
+	)
+	return n
+}
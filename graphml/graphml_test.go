@@ -0,0 +1,144 @@
+package graphml_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/graphml"
+	"github.com/bcap/book-crawler/log"
+)
+
+type document struct {
+	Keys []struct {
+		ID string `xml:"id,attr"`
+	} `xml:"key"`
+	Graph struct {
+		Nodes []struct {
+			ID   string  `xml:"id,attr"`
+			Data []datum `xml:"data"`
+		} `xml:"node"`
+		Edges []struct {
+			Source string  `xml:"source,attr"`
+			Target string  `xml:"target,attr"`
+			Data   []datum `xml:"data"`
+		} `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type datum struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// TestGraphml checks the graphml output of a crawled fixture graph, which has
+// cycles: the document must parse, have a single node per book with all of
+// its data, and only have edges in between declared nodes
+func TestGraphml(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+
+	c := crawler.NewCrawler(crawler.WithMaxDepth(4), crawler.WithMaxReadAlso(3))
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.Storage.GetBook(ctx, server.BookURL(1), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph := book.NewGraph(root)
+
+	buf := bytes.Buffer{}
+	err = graphml.PrintBookGraph(graph, &buf)
+	if err != nil {
+		t.Errorf("graphml printed: %v", err)
+	}
+
+	var doc document
+	err = xml.Unmarshal(buf.Bytes(), &doc)
+	if err != nil {
+		t.Errorf("graphml parses: %v", err)
+	}
+
+	keys := map[string]bool{}
+	for _, key := range doc.Keys {
+		keys[key.ID] = true
+	}
+
+	nodes := map[string]bool{}
+	duplicated := 0
+	missingData := 0
+	for _, node := range doc.Graph.Nodes {
+		if nodes[node.ID] {
+			duplicated++
+		}
+		nodes[node.ID] = true
+		found := map[string]bool{}
+		for _, d := range node.Data {
+			found[d.Key] = keys[d.Key]
+		}
+		for _, key := range []string{"title", "author", "rating", "ratings", "reviews", "pages", "depth"} {
+			if !found[key] {
+				missingData++
+			}
+		}
+	}
+	if len(nodes) != len(graph.All) {
+		t.Errorf("a node per book (%d nodes, %d books)", len(nodes), len(graph.All))
+	}
+	if duplicated != 0 {
+		t.Errorf("no duplicated node ids (%d duplicated)", duplicated)
+	}
+	if missingData != 0 {
+		t.Errorf("every node has all of its data (%d missing)", missingData)
+	}
+
+	expectedEdges := 0
+	cycles := 0
+	for _, b := range graph.All {
+		expectedEdges += len(b.AlsoRead)
+	}
+	dangling := 0
+	noPriority := 0
+	for _, edge := range doc.Graph.Edges {
+		if !nodes[edge.Source] || !nodes[edge.Target] {
+			dangling++
+		}
+		if edge.Target == server.BookURL(1) {
+			cycles++
+		}
+		hasPriority := false
+		for _, d := range edge.Data {
+			hasPriority = hasPriority || d.Key == "priority"
+		}
+		if !hasPriority {
+			noPriority++
+		}
+	}
+	if len(doc.Graph.Edges) != expectedEdges {
+		t.Errorf("an edge per recommendation (%d edges, %d expected)", len(doc.Graph.Edges), expectedEdges)
+	}
+	if cycles <= 0 {
+		t.Errorf("graph has cycles back to the seed (%d edges)", cycles)
+	}
+	if dangling != 0 {
+		t.Errorf("edges only reference declared nodes (%d dangling)", dangling)
+	}
+	if noPriority != 0 {
+		t.Errorf("every edge has a priority (%d without)", noPriority)
+	}
+
+	empty := bytes.Buffer{}
+	err = graphml.PrintBookGraph(book.NewGraph(), &empty)
+	if !(err == nil && xml.Unmarshal(empty.Bytes(), &document{}) == nil) {
+		t.Errorf("empty graph is valid graphml: %v", err)
+	}
+
+}
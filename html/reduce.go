@@ -0,0 +1,162 @@
+package html
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// Region identifies the root element of a subtree to keep when reducing a
+// document. Empty fields match anything
+type Region struct {
+	Tag   string
+	ID    string
+	Class string
+	Rel   string
+}
+
+// DefaultRegions are the parts of a goodreads book page the extractors read
+// from: the main content and the canonical link of the head, which tells the
+// work of the edition. The rest of the page (navigation, footer, ads) is
+// dropped
+var DefaultRegions = []Region{
+	{Tag: "div", Class: "responsiveMainContentContainer"},
+	{Tag: "div", Class: "mainContentContainer"},
+	{Tag: "div", ID: "details"},
+	{Tag: "link", Rel: "canonical"},
+}
+
+// voidElements never have an end tag
+var voidElements = map[string]struct{}{
+	"area": {}, "base": {}, "br": {}, "col": {}, "embed": {}, "hr": {}, "img": {},
+	"input": {}, "link": {}, "meta": {}, "source": {}, "track": {}, "wbr": {},
+}
+
+// Reduce streams an html document and keeps only the subtrees rooted at one
+// of the regions, so a much smaller document can be handed to a full parser.
+// When no region is found the whole document is returned, as it is better to
+// parse a large page than to lose its content
+func Reduce(content []byte, regions []Region) ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString("<html><body>\n")
+	found := false
+
+	// open tags of the region being kept. Empty when outside of a region
+	var stack []string
+
+	z := xhtml.NewTokenizer(bytes.NewReader(content))
+	for {
+		tokenType := z.Next()
+		if tokenType == xhtml.ErrorToken {
+			if errors.Is(z.Err(), io.EOF) {
+				break
+			}
+			return nil, z.Err()
+		}
+
+		if len(stack) == 0 {
+			if tokenType != xhtml.StartTagToken {
+				continue
+			}
+			name, ok := matchRegion(z, regions)
+			if !ok {
+				continue
+			}
+			found = true
+			out.Write(z.Raw())
+			if _, void := voidElements[name]; !void {
+				stack = append(stack, name)
+			}
+			continue
+		}
+
+		out.Write(z.Raw())
+		switch tokenType {
+		case xhtml.StartTagToken:
+			name, _ := z.TagName()
+			if _, void := voidElements[string(name)]; !void {
+				stack = append(stack, string(name))
+			}
+		case xhtml.EndTagToken:
+			// pop up to the matching tag, which also closes elements with
+			// optional end tags (eg <p> and <li>). Unmatched end tags are ignored
+			name, _ := z.TagName()
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i] == string(name) {
+					stack = stack[:i]
+					break
+				}
+			}
+			if len(stack) == 0 {
+				out.WriteString("\n")
+			}
+		}
+	}
+
+	if !found {
+		return content, nil
+	}
+	out.WriteString("</body></html>\n")
+	return out.Bytes(), nil
+}
+
+// matchRegion checks whether the current start tag is the root of one of the
+// regions. Attributes are only read for tags that can match, as this runs for
+// every tag outside of the regions
+func matchRegion(z *xhtml.Tokenizer, regions []Region) (string, bool) {
+	nameBytes, hasAttr := z.TagName()
+	candidate := false
+	for _, region := range regions {
+		if region.Tag == "" || region.Tag == string(nameBytes) {
+			candidate = true
+			break
+		}
+	}
+	if !candidate {
+		return "", false
+	}
+	name := string(nameBytes)
+
+	var id, class, rel string
+	for hasAttr {
+		var key, value []byte
+		key, value, hasAttr = z.TagAttr()
+		switch string(key) {
+		case "id":
+			id = string(value)
+		case "class":
+			class = string(value)
+		case "rel":
+			rel = string(value)
+		}
+	}
+	for _, region := range regions {
+		if region.Tag != "" && region.Tag != name {
+			continue
+		}
+		if region.ID != "" && region.ID != id {
+			continue
+		}
+		if region.Class != "" && !hasClass(class, region.Class) {
+			continue
+		}
+		// rel is a list of link types, matched like classes
+		if region.Rel != "" && !hasClass(rel, region.Rel) {
+			continue
+		}
+		return name, true
+	}
+	return "", false
+}
+
+func hasClass(classes string, class string) bool {
+	for _, c := range strings.Fields(classes) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
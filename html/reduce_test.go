@@ -0,0 +1,102 @@
+package html_test
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/html"
+)
+
+// syntheticPage mimics the shape of a goodreads book page: the book details
+// live in the main content container, surrounded by a lot of markup the
+// extractors never look at
+func syntheticPage() []byte {
+	var noise strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&noise, `<div class="siteHeader__item"><a href="/nav/%d">Navigation item %d</a><p>some text<li>item</div>`+"\n", i, i)
+	}
+	var script strings.Builder
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&script, "var tracking%d = {\"id\": %d, \"html\": \"<div>not markup</div>\"};\n", i, i)
+	}
+	return []byte(fmt.Sprintf(`<!DOCTYPE html>
+<html><head><title>Benchmark Book</title><link rel="canonical" href="https://www.goodreads.com/work/show/42"><script>%[2]s</script></head><body>
+%[1]s
+<div class="mainContentContainer ">
+<h1 id="bookTitle">Benchmark Book</h1>
+<a class="authorName" href="/author/show/1"><span>Benchmark Author</span></a>
+<span itemprop="ratingValue">4.12</span>
+<a><meta itemprop="ratingCount" content="1234"/></a>
+<a><meta itemprop="reviewCount" content="321"/></a>
+<div id="details"><div class="row"><span itemprop="numberOfPages">352 pages</span></div>
+<div id="bookDataBox"><div class="clearFloats"><div class="infoBoxRowTitle">ASIN</div><div class="infoBoxRowItem">B000000001</div></div></div>
+</div>
+<p>an unclosed paragraph
+<a class="bookPageGenreLink" href="/genres/fiction">Fiction</a>
+<a class="bookPageGenreLink" href="/genres/classics">Classics</a>
+</div>
+%[1]s
+</body></html>`, noise.String(), script.String()))
+}
+
+func full(tb testing.TB, page []byte) []byte {
+	return page
+}
+
+func reduced(tb testing.TB, page []byte) []byte {
+	reduced, err := html.Reduce(page, html.DefaultRegions)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return reduced
+}
+
+func extract(tb testing.TB, page []byte) *book.Book {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	b := book.New("http://benchmark/book")
+	book.Build(b, doc)
+	return b
+}
+
+// TestReduce checks that parsing a reduced book page extracts the same book
+// as parsing the full page
+func TestReduce(t *testing.T) {
+	page := syntheticPage()
+	fullBook := extract(t, full(t, page))
+	reducedBook := extract(t, reduced(t, page))
+	if fullBook.Title == "" || fullBook.WorkURL == "" {
+		t.Errorf("book extracted from the full page: %+v", fullBook)
+	}
+	if !reflect.DeepEqual(fullBook, reducedBook) {
+		t.Errorf("extracted books differ:\n  full:    %+v\n  reduced: %+v", fullBook, reducedBook)
+	}
+}
+
+// BenchmarkParse compares memory allocations and time of parsing a book page
+// into a full DOM against reducing it to the main content first
+func BenchmarkParse(b *testing.B) {
+	page := syntheticPage()
+	for _, prepare := range []struct {
+		name string
+		fn   func(testing.TB, []byte) []byte
+	}{
+		{"full", full},
+		{"reduced", reduced},
+	} {
+		b.Run(prepare.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				extract(b, prepare.fn(b, page))
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package html
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	myhttp "github.com/bcap/book-crawler/http"
+)
+
+const storeExtension = ".html.gz"
+const storeIndexFile = "index.tsv"
+
+// Store persists raw html pages in a directory, gzip compressed and keyed by
+// the hash of their normalized url. An index file maps hashes back to urls
+type Store struct {
+	Dir string
+
+	indexMutex sync.Mutex
+}
+
+func NewStore(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+func URLHash(url string) (string, error) {
+	normalized, err := myhttp.NormalizeURL(url)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+func (s *Store) Path(hash string) string {
+	return filepath.Join(s.Dir, hash+storeExtension)
+}
+
+func (s *Store) Save(url string, content []byte) error {
+	hash, err := URLHash(url)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create html store directory: %w", err)
+	}
+
+	// write to a temporary file first so readers never see partial pages
+	path := s.Path(hash)
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(f)
+	if _, err := writer.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	return s.addToIndex(hash, url)
+}
+
+func (s *Store) Open(hash string) (io.ReadCloser, error) {
+	f, err := os.Open(s.Path(hash))
+	if err != nil {
+		return nil, err
+	}
+	reader, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return readCloser{Reader: reader, closers: []io.Closer{reader, f}}, nil
+}
+
+// Hashes lists the hashes of all pages present in the store
+func (s *Store) Hashes() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(s.Dir, "*"+storeExtension))
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(matches))
+	for idx, match := range matches {
+		hashes[idx] = strings.TrimSuffix(filepath.Base(match), storeExtension)
+	}
+	return hashes, nil
+}
+
+// Index returns the hash to url mapping of all pages saved in the store
+func (s *Store) Index() (map[string]string, error) {
+	s.indexMutex.Lock()
+	defer s.indexMutex.Unlock()
+
+	index := map[string]string{}
+	f, err := os.Open(filepath.Join(s.Dir, storeIndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash, url, found := strings.Cut(scanner.Text(), "\t")
+		if !found {
+			continue
+		}
+		index[hash] = url
+	}
+	return index, scanner.Err()
+}
+
+func (s *Store) addToIndex(hash string, url string) error {
+	s.indexMutex.Lock()
+	defer s.indexMutex.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(s.Dir, storeIndexFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%s\t%s\n", hash, url); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r readCloser) Close() error {
+	var firstErr error
+	for _, closer := range r.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,42 @@
+package http_test
+
+import (
+	"testing"
+
+	myhttp "github.com/bcap/book-crawler/http"
+)
+
+// TestAbsoluteURL checks that links are resolved against the page they are
+// in, whether protocol relative, relative to the host or to the page, and that
+// tracking params are stripped leaving the rest of the query as it was
+func TestAbsoluteURL(t *testing.T) {
+	const base = "https://www.goodreads.com/book/show/1"
+	for _, test := range []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"absolute", "http://example.com/book/show/123", "http://example.com/book/show/123"},
+		{"protocol relative", "//www.goodreads.com/book/show/123", "https://www.goodreads.com/book/show/123"},
+		{"protocol relative to another host", "//example.com/book/show/123", "https://example.com/book/show/123"},
+		{"scheme relative", "/book/show/123", "https://www.goodreads.com/book/show/123"},
+		{"relative", "123", "https://www.goodreads.com/book/show/123"},
+		{"relative to the parent", "../similar/1", "https://www.goodreads.com/book/similar/1"},
+		{"query kept in order", "/search?q=dune&page=2&a=1", "https://www.goodreads.com/search?q=dune&page=2&a=1"},
+		{"query escaping kept", "/search?q=dune+messiah&b=%2F", "https://www.goodreads.com/search?q=dune+messiah&b=%2F"},
+		{"tracking params", "/book/show/123?from_search=true&from_srp=true&qid=abc&rank=1&ref=nav&ac=1", "https://www.goodreads.com/book/show/123"},
+		{"utm params", "/book/show/123?utm_source=x&utm_medium=y", "https://www.goodreads.com/book/show/123"},
+		{"escaped tracking params", "/book/show/123?utm%5Fsource=x&r%61nk=1", "https://www.goodreads.com/book/show/123"},
+		{"tracking params among others", "/search?z=1&from_search=true&q=dune&utm_source=x&a=2", "https://www.goodreads.com/search?z=1&q=dune&a=2"},
+		{"fragment", "/book/show/123?ref=nav#reviews", "https://www.goodreads.com/book/show/123#reviews"},
+	} {
+		actual, err := myhttp.AbsoluteURL(base, test.url)
+		if err != nil || actual != test.expected {
+			t.Errorf("%s: %s resolved to %s, expected %s: %v", test.name, test.url, actual, test.expected, err)
+		}
+	}
+
+	if _, err := myhttp.AbsoluteURL(base, "http://[::1"); err == nil {
+		t.Errorf("invalid url fails")
+	}
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// ExponentialJitterBackoff doubles the wait on every attempt like
+// retryablehttp.DefaultBackoff, but picks it at random between min and the
+// doubled wait, so requests failing at the same time do not all retry at the
+// same time again. Waits asked with Retry-After are kept as they are. Every
+// wait is bounded by max
+func ExponentialJitterBackoff(min, max time.Duration, attempt int, resp *http.Response) time.Duration {
+	wait := retryablehttp.DefaultBackoff(min, max, attempt, resp)
+	if wait > max {
+		wait = max
+	}
+	if hasRetryAfter(resp) || wait <= min {
+		return wait
+	}
+	return min + time.Duration(rand.Int63n(int64(wait-min)+1))
+}
+
+// hasRetryAfter tells whether retryablehttp.DefaultBackoff takes the wait
+// from the Retry-After header of the response
+func hasRetryAfter(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return false
+	}
+	_, ok := resp.Header["Retry-After"]
+	return ok
+}
+
+// retryAfter reads how long the server asked to wait before retrying, either
+// in seconds or until an http date, from the Retry-After header of any
+// response. Dates in the past ask for no wait at all
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
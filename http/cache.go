@@ -0,0 +1,160 @@
+package http
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/bcap/book-crawler/log"
+)
+
+// cachedHeaders are the response headers kept along with cached bodies: the
+// validators sent back in conditional requests and what describes the body
+var cachedHeaders = []string{"ETag", "Last-Modified", "Content-Type"}
+
+// CachedResponse is what a Cache keeps of a successful response
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Cache keeps responses by the url they were requested with, so they can be
+// revalidated with conditional requests. It must be safe for concurrent use.
+// Caches holding resources, like files, can implement io.Closer as well to be
+// flushed and closed by Client.Close
+type Cache interface {
+	Get(url string) (*CachedResponse, bool)
+	Set(url string, response *CachedResponse)
+}
+
+// DefaultMemoryCacheSize is how many responses a MemoryCache keeps by default
+const DefaultMemoryCacheSize = 10000
+
+// MemoryCache is a Cache holding up to a number of responses in memory,
+// evicting the least recently used ones past that. It lives only as long as the
+// process, so it does not save any request across crawler runs
+type MemoryCache struct {
+	maxEntries int
+	mutex      sync.Mutex
+	// recent keeps the cached urls, most recently used first
+	recent    *list.List
+	responses map[string]*list.Element
+}
+
+type memoryCacheEntry struct {
+	url      string
+	response *CachedResponse
+}
+
+// NewMemoryCache creates a MemoryCache keeping up to maxEntries responses, or
+// DefaultMemoryCacheSize when maxEntries is zero or less
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMemoryCacheSize
+	}
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		recent:     list.New(),
+		responses:  map[string]*list.Element{},
+	}
+}
+
+func (c *MemoryCache) Get(url string) (*CachedResponse, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.responses[url]
+	if !ok {
+		return nil, false
+	}
+	c.recent.MoveToFront(element)
+	return element.Value.(*memoryCacheEntry).response, true
+}
+
+func (c *MemoryCache) Set(url string, response *CachedResponse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.responses[url]; ok {
+		element.Value.(*memoryCacheEntry).response = response
+		c.recent.MoveToFront(element)
+		return
+	}
+	c.responses[url] = c.recent.PushFront(&memoryCacheEntry{url: url, response: response})
+	for c.recent.Len() > c.maxEntries {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.responses, oldest.Value.(*memoryCacheEntry).url)
+	}
+}
+
+// Len is how many responses are cached
+func (c *MemoryCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.recent.Len()
+}
+
+// conditionalRequest makes a GET request conditional on the cached response
+// of url, if any, answering a 304 Not Modified with the cached response.
+// Successful responses with a validator replace the cached one
+func (c *Client) conditionalRequest(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	cached, hasCached := c.Cache.Get(url)
+	if hasCached {
+		if header == nil {
+			header = http.Header{}
+		} else {
+			header = header.Clone()
+		}
+		if etag := cached.Header.Get("ETag"); etag != "" && header.Get("If-None-Match") == "" {
+			header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" && header.Get("If-Modified-Since") == "" {
+			header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	res, err := c.request(ctx, http.MethodGet, url, header, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotModified && hasCached {
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		log.Debugf("not modified, using the cached response: %s", url)
+		// the request is kept so redirects are still noticed
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", cached.StatusCode, http.StatusText(cached.StatusCode)),
+			StatusCode:    cached.StatusCode,
+			Proto:         res.Proto,
+			ProtoMajor:    res.ProtoMajor,
+			ProtoMinor:    res.ProtoMinor,
+			Header:        cached.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(cached.Body)),
+			ContentLength: int64(len(cached.Body)),
+			Request:       res.Request,
+		}, nil
+	}
+
+	if res.StatusCode/100 != 2 || (res.Header.Get("ETag") == "" && res.Header.Get("Last-Modified") == "") {
+		return res, nil
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	stored := &CachedResponse{StatusCode: res.StatusCode, Header: http.Header{}, Body: body}
+	for _, name := range cachedHeaders {
+		for _, value := range res.Header.Values(name) {
+			stored.Header.Add(name, value)
+		}
+	}
+	c.Cache.Set(url, stored)
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return res, nil
+}
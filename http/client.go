@@ -2,19 +2,51 @@ package http
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
+	"github.com/bcap/book-crawler/clock"
 	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/metrics"
 	"github.com/hashicorp/go-retryablehttp"
 	"golang.org/x/sync/semaphore"
 )
 
+// DefaultUserAgent is sent when Client.UserAgent is not set
+const DefaultUserAgent = "book-crawler/1.0"
+
 type Client struct {
 	client                  retryablehttp.Client
+	backoff                 retryablehttp.Backoff
 	ParallelismSem          *semaphore.Weighted
 	ExtraStatusCodesToRetry []int
+	// Throttle, when set, pauses all requests while too many responses are
+	// rate limited
+	Throttle *Throttle
+	// RateLimit, when set, bounds how often requests are made to each host.
+	// Retries are not limited, as they already back off
+	RateLimit *RateLimiter
+	// Clock is used to wait in between retries. Defaults to the wall clock
+	// when nil
+	Clock clock.Clock
+	// Robots, when set, refuses urls disallowed by the robots.txt of their
+	// host with ErrDisallowedByRobots
+	Robots *Robots
+	// UserAgent is sent with every request, including retries and followed
+	// redirects, unless the request headers already have one. Defaults to
+	// DefaultUserAgent
+	UserAgent string
+	// Metrics, when set, counts retries and failed requests and observes how
+	// long each attempt takes
+	Metrics *metrics.Metrics
+	// Cache, when set, makes GET requests conditional with If-None-Match and
+	// If-Modified-Since on the cached response of their url, which is returned
+	// when the server answers 304 Not Modified. Only successful responses with
+	// an ETag or Last-Modified header are cached
+	Cache Cache
 }
 
 func NewClient(
@@ -23,10 +55,16 @@ func NewClient(
 ) *Client {
 	c := Client{
 		client:                  *retryablehttp.NewClient(),
+		backoff:                 retryablehttp.DefaultBackoff,
 		ParallelismSem:          parallelismSem,
 		ExtraStatusCodesToRetry: extraStatusCodesToRetry,
 	}
 	c.client.CheckRetry = c.checkRetry
+	// retryablehttp waits on the wall clock, so backoff is done by checkRetry
+	// instead, where the wait can go through Clock
+	c.client.Backoff = func(time.Duration, time.Duration, int, *http.Response) time.Duration {
+		return 0
+	}
 	c.client.Logger = debugLogger{}
 	return &c
 }
@@ -43,13 +81,149 @@ func (c *Client) RetryWaitMax(duration time.Duration) {
 	c.client.RetryWaitMax = duration
 }
 
+// RetryJitter randomizes the wait in between retries with
+// ExponentialJitterBackoff instead of doubling it exactly
+func (c *Client) RetryJitter(jitter bool) {
+	if jitter {
+		c.backoff = ExponentialJitterBackoff
+	} else {
+		c.backoff = retryablehttp.DefaultBackoff
+	}
+}
+
+// RequestTimeout bounds each attempt of a request, from connecting until its
+// body is read, so a hung attempt fails and is retried like any other failed
+// attempt. Zero disables it
+func (c *Client) RequestTimeout(timeout time.Duration) {
+	if c.client.HTTPClient == nil {
+		return
+	}
+	c.client.HTTPClient.Timeout = timeout
+}
+
+// ParseProxy parses a proxy url, which must have a host and one of the http,
+// https, socks5 and socks5h schemes
+func ParseProxy(rawURL string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, ErrInvalidProxy{URL: rawURL, Reason: err.Error()}
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, ErrInvalidProxy{URL: rawURL, Reason: "expected a http, https, socks5 or socks5h url"}
+	}
+	if proxyURL.Host == "" {
+		return nil, ErrInvalidProxy{URL: rawURL, Reason: "missing the proxy host"}
+	}
+	return proxyURL, nil
+}
+
+// Proxy routes every request through the proxy at proxyURL, see ParseProxy.
+// The proxy is set on the transport, so retries and followed redirects go
+// through it as well. An empty url restores the proxy from the HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY environment variables. An invalid url makes every
+// request fail instead of connecting without the proxy
+func (c *Client) Proxy(rawURL string) error {
+	if c.client.HTTPClient == nil {
+		return nil
+	}
+	transport, ok := c.client.HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		return ErrInvalidProxy{URL: rawURL, Reason: "the client transport does not support proxies"}
+	}
+	if rawURL == "" {
+		transport.Proxy = http.ProxyFromEnvironment
+		return nil
+	}
+	proxyURL, err := ParseProxy(rawURL)
+	if err != nil {
+		transport.Proxy = func(*http.Request) (*url.URL, error) {
+			return nil, err
+		}
+		return err
+	}
+	transport.Proxy = http.ProxyURL(proxyURL)
+	return nil
+}
+
+// Close closes the idle connections of the client, and its Cache when it
+// implements io.Closer, eg to flush a cache kept on disk. Requests made after
+// it open new connections as usual
+func (c *Client) Close() error {
+	if c.client.HTTPClient != nil {
+		c.client.HTTPClient.CloseIdleConnections()
+	}
+	if closer, ok := c.Cache.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// MaxRedirects controls how many redirects are followed for a single request.
+// A negative number restores the standard library default
+func (c *Client) MaxRedirects(redirects int) {
+	if c.client.HTTPClient == nil {
+		return
+	}
+	if redirects < 0 {
+		c.client.HTTPClient.CheckRedirect = nil
+		return
+	}
+	c.client.HTTPClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > redirects {
+			return ErrTooManyRedirects{URL: via[0].URL.String(), Max: redirects}
+		}
+		return nil
+	}
+}
+
 func (c *Client) Request(ctx context.Context, method string, url string, header http.Header, body io.Reader) (*http.Response, error) {
+	if c.Robots != nil {
+		if err := c.checkRobots(ctx, url); err != nil {
+			return nil, err
+		}
+	}
+	var res *http.Response
+	var err error
+	if c.Cache != nil && method == http.MethodGet && body == nil {
+		res, err = c.conditionalRequest(ctx, url, header)
+	} else {
+		res, err = c.request(ctx, method, url, header, body)
+	}
+	if err != nil || res.StatusCode >= 400 {
+		c.Metrics.IncFetchErrors()
+	}
+	return res, err
+}
+
+func (c *Client) request(ctx context.Context, method string, url string, header http.Header, body io.Reader) (*http.Response, error) {
 	req, err := retryablehttp.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
 	if header != nil {
-		req.Header = header
+		req.Header = header.Clone()
+	}
+	// the standard library copies the headers of the first request to the
+	// redirected ones, and retryablehttp reuses them on retries
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.userAgent())
+	}
+	// the attempt number drives the backoff and its start the latency metric,
+	// but neither is given to checkRetry
+	attempt := &attemptState{}
+	req.Request = req.Request.WithContext(context.WithValue(ctx, attemptKey{}, attempt))
+	if c.Throttle != nil {
+		if err := c.Throttle.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	// waiting for the rate limit does not hold a parallelism slot
+	if c.RateLimit != nil {
+		if err := c.RateLimit.Wait(ctx, url); err != nil {
+			return nil, err
+		}
 	}
 	if c.ParallelismSem != nil {
 		if err := c.ParallelismSem.Acquire(ctx, 1); err != nil {
@@ -58,22 +232,91 @@ func (c *Client) Request(ctx context.Context, method string, url string, header
 		defer c.ParallelismSem.Release(1)
 	}
 	log.Debugf("requesting: %s %s", method, url)
+	attempt.start = clock.Or(c.Clock).Now()
 	return c.client.Do(req)
 }
 
+func (c *Client) userAgent() string {
+	if c.UserAgent != "" {
+		return c.UserAgent
+	}
+	return DefaultUserAgent
+}
+
+type attemptKey struct{}
+
+type attemptState struct {
+	number int
+	start  time.Time
+}
+
 func (c *Client) checkRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	// called for every attempt, so retries are also accounted for
+	if c.Throttle != nil {
+		c.Throttle.Record(resp)
+	}
+
+	attempt, ok := ctx.Value(attemptKey{}).(*attemptState)
+	if ok {
+		c.Metrics.ObserveFetchLatency(clock.Or(c.Clock).Now().Sub(attempt.start))
+	}
+
+	// server errors are retried along with an error describing them, which
+	// is what retryablehttp returns once out of retries. They back off too
+	should, checkErr := c.shouldRetry(ctx, resp, err)
+	if !should {
+		return false, checkErr
+	}
+	if !ok {
+		return true, checkErr
+	}
+	// retryablehttp gives up without waiting once out of retries
+	if attempt.number < c.client.RetryMax {
+		c.Metrics.IncRetries()
+		wait := c.backoff(c.client.RetryWaitMin, c.client.RetryWaitMax, attempt.number, resp)
+		// the server knows best when it can take the request again
+		if asked, ok := retryAfter(resp, clock.Or(c.Clock).Now()); ok {
+			wait = asked
+			if wait > c.client.RetryWaitMax {
+				wait = c.client.RetryWaitMax
+			}
+		}
+		if err := clock.Or(c.Clock).Sleep(ctx, wait); err != nil {
+			return false, err
+		}
+		// retryablehttp sends retries itself, so they wait for the throttle
+		// here as the first attempt does in request
+		if c.Throttle != nil {
+			if err := c.Throttle.Wait(ctx); err != nil {
+				return false, err
+			}
+		}
+	}
+	attempt.number++
+	attempt.start = clock.Or(c.Clock).Now()
+	return true, checkErr
+}
+
+func (c *Client) shouldRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	// retrying does not fix the proxy
+	var invalidProxy ErrInvalidProxy
+	if errors.As(err, &invalidProxy) {
+		return false, err
+	}
+
 	// base policy retry + logging
 	should, policyErr := retryablehttp.ErrorPropagatedRetryPolicy(ctx, resp, err)
-	if policyErr != nil {
-		return should, policyErr
-	}
 	if should {
 		if err != nil {
-			log.Warnf("retrying request to %s: %s", resp.Request.URL, err)
+			// failed attempts have no response, but the error has the url
+			log.Warnf("retrying request: %s", err)
 		} else {
 			log.Warnf("retrying request to %s: got status code %d", resp.Request.URL, resp.StatusCode)
 		}
-		return true, nil
+		return true, policyErr
+	}
+	if policyErr != nil {
+		return false, policyErr
 	}
 
 	// custom retry logic
@@ -0,0 +1,112 @@
+package http_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/clock"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+)
+
+const rateLimited = 6
+
+// TestClock checks that retry backoff and throttling wait on the client
+// clock: against a server rate limiting the first requests, a client with a
+// fake clock must succeed without actually waiting, while the fake clock
+// records the backoff and the throttle pause. Also checks a crawl works with
+// a fake clock ahead of the wall clock the states are stored with
+func TestClock(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= rateLimited {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Now())
+	client := myhttp.NewClient(semaphore.NewWeighted(1), nil)
+	client.RetryMax(rateLimited)
+	client.RetryWaitMin(time.Second)
+	client.RetryWaitMax(30 * time.Second)
+	client.Clock = fake
+	client.Throttle = myhttp.NewThrottle()
+	client.Throttle.Window = 4
+	client.Throttle.Clock = fake
+
+	start := time.Now()
+	resp, err := client.Request(ctx, http.MethodGet, server.URL, nil, nil)
+	elapsed := time.Since(start)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !(err == nil && resp.StatusCode == http.StatusOK) {
+		t.Errorf("request succeeded after being rate limited: %v", err)
+	}
+	if atomic.LoadInt32(&requests) != rateLimited+1 {
+		t.Errorf("retried until not rate limited (%d requests)", atomic.LoadInt32(&requests))
+	}
+	if elapsed >= time.Second {
+		t.Errorf("did not wait on the wall clock (took %v)", elapsed)
+	}
+	// the backoff alone is 1+2+4+8+16+30 seconds
+	if fake.Slept() < time.Minute {
+		t.Errorf("backoff waited on the fake clock (slept %v)", fake.Slept())
+	}
+
+	// without retries, enough rate limited responses pause all requests, so
+	// the next one has to wait for the pause to be over
+	atomic.StoreInt32(&requests, 0)
+	client.RetryMax(0)
+	for i := 0; i < client.Throttle.Window; i++ {
+		if resp, err := client.Request(ctx, http.MethodGet, server.URL, nil, nil); err == nil {
+			resp.Body.Close()
+		}
+	}
+	slept := fake.Slept()
+	resp, err = client.Request(ctx, http.MethodGet, server.URL, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if fake.Slept()-slept < client.Throttle.MinPause {
+		t.Errorf("throttle pause waited on the fake clock (slept %v)", fake.Slept()-slept)
+	}
+
+	fixtureServer := fixture.NewServer(100, 3)
+	defer fixtureServer.Close()
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(3),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(10),
+		crawler.WithClock(clock.NewFake(time.Now().Add(time.Hour))),
+	)
+	err = c.Crawl(ctx, fixtureServer.BookURL(1))
+	crawled := 0
+	c.Storage.GetAllBooks(ctx, func(*book.Book) error {
+		crawled++
+		return nil
+	})
+	if !(err == nil && crawled > 3) {
+		t.Errorf("crawl with a fake clock succeeded (%d books): %v", crawled, err)
+	}
+	if change, err := c.Storage.GetBookState(ctx, fixtureServer.BookURL(1)); !(err == nil && change.State == storage.Linked) {
+		t.Errorf("crawl with a fake clock linked the books (%v): %v", change.State, err)
+	}
+}
@@ -0,0 +1,206 @@
+package http_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+)
+
+const lastModified = "Wed, 01 May 2024 10:00:00 GMT"
+
+// counters counts requests by path and kind
+type counters struct {
+	mutex  sync.Mutex
+	counts map[string]int
+}
+
+func (c *counters) inc(key string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.counts[key]++
+	return c.counts[key]
+}
+
+func (c *counters) get(key string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.counts[key]
+}
+
+// TestConditionalRequests checks that clients with a cache send If-None-Match
+// and If-Modified-Since for pages they fetched before, answer a 304 Not
+// Modified with the cached page, cache changed pages again and leave pages
+// without validators alone, and that a crawler with conditional requests
+// revalidates every page on a second crawl
+func TestConditionalRequests(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	counts := &counters{counts: map[string]int{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count := counts.inc(r.URL.Path)
+		if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+			counts.inc(r.URL.Path + " conditional")
+		}
+		switch r.URL.Path {
+		case "/etag":
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/last-modified":
+			w.Header().Set("Last-Modified", lastModified)
+			if r.Header.Get("If-Modified-Since") == lastModified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/changed":
+			// a new version from the second request on
+			etag := `"v1"`
+			if count > 1 {
+				etag = `"v2"`
+			}
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			fmt.Fprintf(w, "page %s", etag)
+			return
+		case "/redirect":
+			http.Redirect(w, r, "/etag", http.StatusMovedPermanently)
+			return
+		}
+		fmt.Fprintf(w, "page %s", r.URL.Path)
+	}))
+	defer server.Close()
+
+	client := myhttp.NewClient(semaphore.NewWeighted(1), nil)
+	client.Cache = myhttp.NewMemoryCache(0)
+	get := func(path string) (int, string, string) {
+		res, err := client.Request(ctx, http.MethodGet, server.URL+path, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, string(body), res.Request.URL.Path
+	}
+
+	for _, path := range []string{"/etag", "/last-modified"} {
+		_, first, _ := get(path)
+		status, second, _ := get(path)
+		if !(first == "page "+path && status == http.StatusOK && second == first) {
+			t.Errorf("%s: cached page returned when not modified (%d %q)", path, status, second)
+		}
+		if counts.get(path+" conditional") != 1 {
+			t.Errorf("%s: second request conditional (%d conditional)", path, counts.get(path+" conditional"))
+		}
+	}
+
+	_, v1, _ := get("/changed")
+	_, second, _ := get("/changed")
+	_, third, _ := get("/changed")
+	if !(v1 == `page "v1"` && second == `page "v2"` && third == second) {
+		t.Errorf("changed page returned and cached again (%q, %q, %q)", v1, second, third)
+	}
+	if counts.get("/changed conditional") != 2 {
+		t.Errorf("changed page always revalidated (%d conditional)", counts.get("/changed conditional"))
+	}
+
+	get("/none")
+	_, none, _ := get("/none")
+	if !(none == "page /none" && counts.get("/none conditional") == 0) {
+		t.Errorf("pages without validators requested as usual (%d conditional)", counts.get("/none conditional"))
+	}
+
+	get("/redirect")
+	_, redirected, finalPath := get("/redirect")
+	if !(redirected == "page /etag" && finalPath == "/etag") {
+		t.Errorf("redirected page cached, redirect still noticed (%q at %s)", redirected, finalPath)
+	}
+
+	uncached := myhttp.NewClient(semaphore.NewWeighted(1), nil)
+	before := counts.get("/etag conditional")
+	for i := 0; i < 2; i++ {
+		res, err := uncached.Request(ctx, http.MethodGet, server.URL+"/etag", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	if counts.get("/etag conditional") != before {
+		t.Errorf("no conditional requests without a cache")
+	}
+
+	// a crawler revalidates every page fetched by a previous crawl sharing its
+	// cache
+	books := fixture.NewServer(100, 3)
+	defer books.Close()
+	crawlCounts := &counters{counts: map[string]int{}}
+	withETags := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := http.Get(books.URL + r.URL.RequestURI())
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+		w.Header().Set("ETag", etag)
+		// robots.txt is missing, so never cached
+		if r.URL.Path != "/robots.txt" {
+			crawlCounts.inc("requests")
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			crawlCounts.inc("not modified")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(res.StatusCode)
+		w.Write(body)
+	}))
+	defer withETags.Close()
+
+	seed := withETags.URL + "/book/show/1"
+	options := []crawler.CrawlerOption{crawler.WithMaxDepth(2), crawler.WithMaxReadAlso(3), crawler.WithConditionalRequests(true)}
+	first := crawler.NewCrawler(options...)
+	if err := first.Crawl(ctx, seed); err != nil {
+		t.Fatal(err)
+	}
+	firstRequests := crawlCounts.get("requests")
+	c := crawler.NewCrawler(options...)
+	c.Client.Cache = first.Client.Cache
+	if err := c.Crawl(ctx, seed); err != nil {
+		t.Fatal(err)
+	}
+	secondRequests := crawlCounts.get("requests") - firstRequests
+	notModified := crawlCounts.get("not modified")
+	if !(firstRequests > 0 && secondRequests > 0 && secondRequests == notModified) {
+		t.Errorf("second crawl revalidated every page (%d then %d requests, %d not modified)", firstRequests, secondRequests, notModified)
+	}
+	book, err := c.Storage.GetBook(ctx, seed, 0)
+	if !(err == nil && book != nil && book.Title != "" && len(book.AlsoRead) > 0) {
+		t.Errorf("second crawl extracted the cached pages: %v", err)
+	}
+
+}
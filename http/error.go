@@ -0,0 +1,33 @@
+package http
+
+import (
+	"fmt"
+)
+
+type ErrDisallowedByRobots struct {
+	URL string
+}
+
+func (e ErrDisallowedByRobots) Error() string {
+	return fmt.Sprintf("%s is disallowed by robots.txt", e.URL)
+}
+
+type ErrInvalidProxy struct {
+	URL    string
+	Reason string
+}
+
+func (e ErrInvalidProxy) Error() string {
+	return fmt.Sprintf("invalid proxy %q: %s", e.URL, e.Reason)
+}
+
+type ErrTooManyRedirects struct {
+	URL string
+	Max int
+}
+
+// Error messages ending in "stopped after N redirects" are recognized by
+// retryablehttp as non retryable, which is what we want here
+func (e ErrTooManyRedirects) Error() string {
+	return fmt.Sprintf("too many redirects when requesting %s: stopped after %d redirects", e.URL, e.Max)
+}
@@ -0,0 +1,45 @@
+package http_test
+
+import (
+	"fmt"
+	"testing"
+
+	myhttp "github.com/bcap/book-crawler/http"
+)
+
+// TestMemoryCache checks that the memory cache keeps at most its size in
+// responses, evicting the least recently used one, and that replacing a
+// cached response does not grow it
+func TestMemoryCache(t *testing.T) {
+	cache := myhttp.NewMemoryCache(2)
+	url := func(i int) string { return fmt.Sprintf("https://fixture/book/show/%d", i) }
+	response := func(i int) *myhttp.CachedResponse {
+		return &myhttp.CachedResponse{StatusCode: 200, Body: []byte(url(i))}
+	}
+
+	cache.Set(url(1), response(1))
+	cache.Set(url(2), response(2))
+	cache.Set(url(2), response(2))
+	if cache.Len() != 2 {
+		t.Errorf("replaced response cached once (%d cached)", cache.Len())
+	}
+	// using 1 makes 2 the least recently used
+	if cached, ok := cache.Get(url(1)); !ok || string(cached.Body) != url(1) {
+		t.Errorf("response cached")
+	}
+	cache.Set(url(3), response(3))
+	if _, ok := cache.Get(url(2)); ok {
+		t.Errorf("least recently used response evicted")
+	}
+	for _, i := range []int{1, 3} {
+		if _, ok := cache.Get(url(i)); !ok {
+			t.Errorf("response %d kept", i)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("cache bounded (%d cached)", cache.Len())
+	}
+	if myhttp.NewMemoryCache(0) == nil {
+		t.Errorf("default sized cache created")
+	}
+}
@@ -0,0 +1,279 @@
+package http_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+)
+
+// target fails the first request to /flaky and redirects /redirect to
+// /final, recording every request it gets along with where it came from
+type target struct {
+	mutex    sync.Mutex
+	requests []*http.Request
+	seen     int
+}
+
+func (t *target) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.mutex.Lock()
+	t.requests = append(t.requests, r)
+	t.seen++
+	seen := t.seen
+	t.mutex.Unlock()
+	switch r.URL.Path {
+	case "/flaky":
+		if seen == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	case "/redirect":
+		http.Redirect(w, r, "/final", http.StatusFound)
+		return
+	}
+	io.WriteString(w, "ok")
+}
+
+func (t *target) reset() []*http.Request {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	requests := t.requests
+	t.requests = nil
+	t.seen = 0
+	return requests
+}
+
+// httpProxy forwards the requests it gets, counting them by path
+type httpProxy struct {
+	mutex  sync.Mutex
+	byPath map[string]int
+}
+
+func (p *httpProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mutex.Lock()
+	p.byPath[r.URL.Path]++
+	p.mutex.Unlock()
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	res, err := http.DefaultTransport.RoundTrip(out)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+	for key, values := range res.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(res.StatusCode)
+	io.Copy(w, res.Body)
+}
+
+// socksProxy is a socks5 server without authentication. It remembers the
+// local address of every connection it makes, so the target can tell which
+// requests came through it
+type socksProxy struct {
+	listener net.Listener
+	dialed   sync.Map
+}
+
+func newSocksProxy(t *testing.T) *socksProxy {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &socksProxy{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go p.handle(conn)
+		}
+	}()
+	return p
+}
+
+func (p *socksProxy) handle(conn net.Conn) {
+	defer conn.Close()
+	greeting := make([]byte, 2)
+	if _, err := io.ReadFull(conn, greeting); err != nil || greeting[0] != 5 {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, greeting[1])); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0})
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil || header[1] != 1 {
+		return
+	}
+	var host string
+	switch header[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 3:
+		size := make([]byte, 1)
+		io.ReadFull(conn, size)
+		name := make([]byte, size[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return
+	}
+	upstream, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	p.dialed.Store(upstream.LocalAddr().String(), struct{}{})
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+func newClient() *myhttp.Client {
+	client := myhttp.NewClient(nil, nil)
+	client.RetryMax(3)
+	client.RetryWaitMin(time.Millisecond)
+	client.RetryWaitMax(time.Millisecond)
+	return client
+}
+
+func get(ctx context.Context, client *myhttp.Client, url string) (int, error) {
+	res, err := client.Request(ctx, "GET", url, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	return res.StatusCode, nil
+}
+
+// TestProxy checks that requests go through the configured http or socks5
+// proxy, including their retries and followed redirects, and that an invalid
+// proxy fails requests right away instead of connecting without it
+func TestProxy(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	dst := &target{}
+	server := httptest.NewServer(dst)
+	defer server.Close()
+
+	// http proxy
+	proxy := &httpProxy{byPath: map[string]int{}}
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	client := newClient()
+	if err := client.Proxy(proxyServer.URL); err != nil {
+		t.Fatal(err)
+	}
+	status, err := get(ctx, client, server.URL+"/flaky")
+	if !(err == nil && status == 200) {
+		t.Errorf("http proxy: flaky request succeeded (status %d, err %v)", status, err)
+	}
+	status, err = get(ctx, client, server.URL+"/redirect")
+	if !(err == nil && status == 200) {
+		t.Errorf("http proxy: redirected request succeeded (status %d, err %v)", status, err)
+	}
+	dst.reset()
+	if proxy.byPath["/flaky"] != 2 {
+		t.Errorf("http proxy: got the request and its retry (%d)", proxy.byPath["/flaky"])
+	}
+	if !(proxy.byPath["/redirect"] == 1 && proxy.byPath["/final"] == 1) {
+		t.Errorf("http proxy: got the request and its redirect (%d, %d)", proxy.byPath["/redirect"], proxy.byPath["/final"])
+	}
+
+	// socks5 proxy
+	socks := newSocksProxy(t)
+	defer socks.listener.Close()
+
+	client = newClient()
+	if err := client.Proxy("socks5://" + socks.listener.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	status, err = get(ctx, client, server.URL+"/flaky")
+	if !(err == nil && status == 200) {
+		t.Errorf("socks5 proxy: flaky request succeeded (status %d, err %v)", status, err)
+	}
+	status, err = get(ctx, client, server.URL+"/redirect")
+	if !(err == nil && status == 200) {
+		t.Errorf("socks5 proxy: redirected request succeeded (status %d, err %v)", status, err)
+	}
+	requests := dst.reset()
+	proxied := 0
+	for _, r := range requests {
+		if _, has := socks.dialed.Load(r.RemoteAddr); has {
+			proxied++
+		}
+	}
+	if !(len(requests) == 4 && proxied == len(requests)) {
+		t.Errorf("socks5 proxy: every request, retry and redirect went through it (%d of %d)", proxied, len(requests))
+	}
+
+	// the proxy is dropped again
+	client = newClient()
+	client.Proxy("socks5://" + socks.listener.Addr().String())
+	client.Proxy("")
+	get(ctx, client, server.URL+"/final")
+	requests = dst.reset()
+	_, proxiedDirect := socks.dialed.Load(requests[0].RemoteAddr)
+	if !(len(requests) == 1 && !proxiedDirect) {
+		t.Errorf("an empty proxy connects directly")
+	}
+
+	// invalid proxies
+	for _, invalid := range []string{"ftp://proxy:21", "localhost:3128", "http://", "://"} {
+		_, err := myhttp.ParseProxy(invalid)
+		var invalidProxy myhttp.ErrInvalidProxy
+		if !errors.As(err, &invalidProxy) {
+			t.Errorf("%q is invalid: %v", invalid, err)
+		}
+	}
+	client = newClient()
+	client.RetryWaitMin(time.Hour)
+	client.RetryWaitMax(time.Hour)
+	err = client.Proxy("ftp://proxy:21")
+	if err == nil {
+		t.Errorf("setting an invalid proxy fails: %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := get(ctx, client, server.URL+"/final")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		var invalidProxy myhttp.ErrInvalidProxy
+		if !errors.As(err, &invalidProxy) {
+			t.Errorf("requests fail without retries: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("requests fail without retries: still retrying")
+	}
+	if len(dst.reset()) != 0 {
+		t.Errorf("no request reached the target without the proxy")
+	}
+
+}
@@ -0,0 +1,91 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/clock"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+)
+
+// TestRateLimit checks the per host rate limiter: requests beyond the burst
+// are spaced out at the configured rate, hosts do not share their limits,
+// waiting stops when the context is done, and a rate limited crawl does not
+// go faster than the rate
+func TestRateLimit(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	fake := clock.NewFake(time.Now())
+	limiter := myhttp.NewRateLimiter(2, 3)
+	limiter.Clock = fake
+	for i := 0; i < 10; i++ {
+		if err := limiter.Wait(ctx, "https://www.goodreads.com/book/show/1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fake.Slept() != 3500*time.Millisecond {
+		t.Errorf("10 requests at 2/s with a burst of 3 take 3.5s (%v)", fake.Slept())
+	}
+
+	slept := fake.Slept()
+	limiter.Wait(ctx, "https://example.com/1")
+	if fake.Slept() != slept {
+		t.Errorf("other hosts have their own limit (waited %v)", fake.Slept()-slept)
+	}
+
+	fake.Advance(time.Hour)
+	slept = fake.Slept()
+	for i := 0; i < 3; i++ {
+		limiter.Wait(ctx, "https://www.goodreads.com/book/show/1")
+	}
+	if fake.Slept() != slept {
+		t.Errorf("burst is available again after a pause (waited %v)", fake.Slept()-slept)
+	}
+
+	slow := myhttp.NewRateLimiter(0.1, 1)
+	slow.Wait(ctx, "https://www.goodreads.com/")
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	start := time.Now()
+	err := slow.Wait(timeoutCtx, "https://www.goodreads.com/")
+	cancel()
+	if !(errors.Is(err, context.DeadlineExceeded) && time.Since(start) < time.Second) {
+		t.Errorf("waiting stops with the context: %v after %v", err, time.Since(start))
+	}
+
+	// a crawl limited to 50 requests per second
+	const rate = 50
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+	var requests int64
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		handler.ServeHTTP(w, r)
+	})
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(3),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(10),
+		crawler.WithRateLimit(rate, 1),
+	)
+	start = time.Now()
+	err = c.Crawl(ctx, server.BookURL(1))
+	elapsed := time.Since(start)
+	made := atomic.LoadInt64(&requests)
+	minimum := time.Duration(made-1) * time.Second / rate
+	if err != nil {
+		t.Errorf("rate limited crawl succeeded: %v", err)
+	}
+	if elapsed < minimum {
+		t.Errorf("%d requests took %v, at least %v at %d/s", made, elapsed.Round(time.Millisecond), minimum, rate)
+	}
+
+}
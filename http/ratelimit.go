@@ -0,0 +1,64 @@
+package http
+
+import (
+	"context"
+	"net/url"
+	"sync"
+
+	"github.com/bcap/book-crawler/clock"
+	"golang.org/x/time/rate"
+)
+
+// RateLimiter spaces out the requests made to each host with a rate.Limiter
+// per host: up to Burst requests can be made right away, and after that Rate
+// requests per second. Unlike the parallelism semaphore, it bounds how often
+// requests are made, not how many are in flight
+type RateLimiter struct {
+	// Rate is how many requests per second are allowed for each host. Zero
+	// or less disables the limit
+	Rate float64
+	// Burst is how many requests can be made at once, at least 1
+	Burst int
+	// Clock defaults to the wall clock when nil
+	Clock clock.Clock
+
+	hosts sync.Map
+}
+
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{Rate: rate, Burst: burst}
+}
+
+// Wait blocks until a request to the host of rawURL can be made, or until ctx
+// is done, in which case ctx's error is returned
+func (l *RateLimiter) Wait(ctx context.Context, rawURL string) error {
+	if l.Rate <= 0 {
+		return nil
+	}
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	burst := l.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	limiterIntf, _ := l.hosts.LoadOrStore(host, rate.NewLimiter(rate.Limit(l.Rate), burst))
+	limiter := limiterIntf.(*rate.Limiter)
+
+	// the reservation is taken at the limiter's clock instead of using
+	// limiter.Wait, which always sleeps on the wall clock
+	clock := clock.Or(l.Clock)
+	now := clock.Now()
+	reservation := limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay <= 0 {
+		return nil
+	}
+	if err := clock.Sleep(ctx, delay); err != nil {
+		// no request is made, so the token is handed back to the limiter
+		reservation.CancelAt(clock.Now())
+		return err
+	}
+	return nil
+}
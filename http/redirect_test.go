@@ -0,0 +1,76 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+)
+
+// TestMaxRedirects checks that requests follow up to the max redirects, and
+// that redirect loops and longer chains stop at it with ErrTooManyRedirects
+// instead of hanging or being retried
+func TestMaxRedirects(t *testing.T) {
+	const maxRedirects = 3
+
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	// /loop redirects to itself, and /hop/N redirects N times before answering
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/loop" {
+			http.Redirect(w, r, "/loop", http.StatusFound)
+			return
+		}
+		hops, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+		if hops > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/hop/%d", hops-1), http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	client := myhttp.NewClient(semaphore.NewWeighted(1), nil)
+	client.RetryMax(2)
+	client.RetryWaitMin(time.Millisecond)
+	client.RetryWaitMax(time.Millisecond)
+	client.MaxRedirects(maxRedirects)
+
+	request := func(path string) error {
+		atomic.StoreInt32(&requests, 0)
+		resp, err := client.Request(ctx, http.MethodGet, server.URL+path, nil, nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := request(fmt.Sprintf("/hop/%d", maxRedirects)); err != nil {
+		t.Errorf("%d redirects followed: %v", maxRedirects, err)
+	}
+
+	for _, path := range []string{"/loop", fmt.Sprintf("/hop/%d", maxRedirects+1)} {
+		err := request(path)
+		var tooMany myhttp.ErrTooManyRedirects
+		if !errors.As(err, &tooMany) || tooMany.Max != maxRedirects || tooMany.URL != server.URL+path {
+			t.Errorf("%s stopped with ErrTooManyRedirects: %v", path, err)
+		}
+		if n := atomic.LoadInt32(&requests); n != maxRedirects+1 {
+			t.Errorf("%s stopped at the max redirects without retrying (%d requests)", path, n)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+)
+
+const timeout = 100 * time.Millisecond
+
+// TestRequestTimeout checks that a hung request attempt is aborted after the
+// request timeout and retried, that running out of retries fails the request
+// with a timeout error without cancelling the caller context, and that crawls
+// stop waiting on hung pages
+func TestRequestTimeout(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	// the first attempt hangs until the client gives up
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	client := myhttp.NewClient(semaphore.NewWeighted(1), nil)
+	client.RetryMax(1)
+	client.RetryWaitMin(time.Millisecond)
+	client.RetryWaitMax(time.Millisecond)
+	client.RequestTimeout(timeout)
+
+	start := time.Now()
+	resp, err := client.Request(ctx, http.MethodGet, server.URL, nil, nil)
+	elapsed := time.Since(start)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !(err == nil && resp.StatusCode == http.StatusOK) {
+		t.Errorf("hung attempt retried: %v", err)
+	}
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("two attempts made (%d)", atomic.LoadInt32(&requests))
+	}
+	if !(elapsed >= timeout && elapsed < 10*timeout) {
+		t.Errorf("the hung attempt waited for the timeout (took %v)", elapsed)
+	}
+
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hung.Close()
+
+	parent, cancel := context.WithCancel(ctx)
+	defer cancel()
+	start = time.Now()
+	_, err = client.Request(parent, http.MethodGet, hung.URL, nil, nil)
+	elapsed = time.Since(start)
+	var netErr net.Error
+	if !(errors.As(err, &netErr) && netErr.Timeout()) {
+		t.Errorf("out of retries fails with a timeout: %v", err)
+	}
+	if !(elapsed >= 2*timeout && elapsed < 20*timeout) {
+		t.Errorf("every attempt timed out (took %v)", elapsed)
+	}
+	if parent.Err() != nil {
+		t.Errorf("the caller context is not cancelled")
+	}
+
+	client.RequestTimeout(0)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * timeout)
+		fmt.Fprint(w, "ok")
+	}))
+	defer slow.Close()
+	resp, err = client.Request(ctx, http.MethodGet, slow.URL, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		t.Errorf("no timeout when disabled: %v", err)
+	}
+
+	// book pages take longer than the timeout, so the crawl fails instead of
+	// waiting for them
+	books := fixture.NewServer(20, 3)
+	books.Delay = 10 * timeout
+	defer books.Close()
+	c := crawler.NewCrawler(
+		crawler.WithRequestTimeout(timeout),
+		crawler.WithRequestMaxRetries(1),
+		crawler.WithRequestMinRetryWait(time.Millisecond),
+		crawler.WithRequestMaxRetryWait(time.Millisecond),
+	)
+	start = time.Now()
+	err = c.Crawl(ctx, books.BookURL(1))
+	elapsed = time.Since(start)
+	if !(errors.As(err, &netErr) && netErr.Timeout()) {
+		t.Errorf("crawls fail on hung pages: %v", err)
+	}
+	if elapsed >= books.Delay {
+		t.Errorf("crawls do not wait for hung pages (took %v)", elapsed)
+	}
+
+}
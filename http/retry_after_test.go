@@ -0,0 +1,115 @@
+package http_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/bcap/book-crawler/clock"
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+)
+
+const retryAfterMinWait, retryAfterMaxWait = time.Second, 5 * time.Minute
+
+// http dates have no sub second precision
+var start = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+// response is what the first request to a path gets, later ones succeed
+type response struct {
+	status     int
+	retryAfter string
+}
+
+// TestRetryAfter checks that retries wait for as long as the Retry-After
+// header of the failed response asks, either in seconds or until an http
+// date, bounded by the max retry wait, and that responses without a valid
+// header fall back to the usual backoff
+func TestRetryAfter(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	responses := map[string]response{
+		"/seconds":      {http.StatusTooManyRequests, "7"},
+		"/date":         {http.StatusTooManyRequests, start.Add(90 * time.Second).Format(http.TimeFormat)},
+		"/past-date":    {http.StatusTooManyRequests, start.Add(-time.Hour).Format(http.TimeFormat)},
+		"/capped":       {http.StatusTooManyRequests, "3600"},
+		"/unavailable":  {http.StatusServiceUnavailable, "12"},
+		"/server-error": {http.StatusInternalServerError, "4"},
+		"/invalid":      {http.StatusTooManyRequests, "soon"},
+		"/no-header":    {http.StatusTooManyRequests, ""},
+	}
+	var mutex sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.URL.Path]++
+		count := requests[r.URL.Path]
+		mutex.Unlock()
+		if res, has := responses[r.URL.Path]; has && count == 1 {
+			if res.retryAfter != "" {
+				w.Header().Set("Retry-After", res.retryAfter)
+			}
+			w.WriteHeader(res.status)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	request := func(path string, jitter bool) (time.Duration, int) {
+		fake := clock.NewFake(start)
+		c := myhttp.NewClient(semaphore.NewWeighted(1), nil)
+		c.RetryMax(3)
+		c.RetryWaitMin(retryAfterMinWait)
+		c.RetryWaitMax(retryAfterMaxWait)
+		c.RetryJitter(jitter)
+		c.Clock = fake
+		resp, err := c.Request(ctx, http.MethodGet, server.URL+path, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		mutex.Lock()
+		defer mutex.Unlock()
+		count := requests[path]
+		delete(requests, path)
+		return fake.Slept(), count
+	}
+
+	cases := []struct {
+		path string
+		wait time.Duration
+	}{
+		{"/seconds", 7 * time.Second},
+		{"/date", 90 * time.Second},
+		{"/past-date", 0},
+		{"/capped", retryAfterMaxWait},
+		{"/unavailable", 12 * time.Second},
+		{"/server-error", 4 * time.Second},
+		{"/invalid", retryAfterMinWait},
+		{"/no-header", retryAfterMinWait},
+	}
+	for _, jitter := range []bool{false, true} {
+		for _, tc := range cases {
+			slept, count := request(tc.path, jitter)
+			if tc.wait == retryAfterMinWait && jitter {
+				// the backoff is random, but never below the min wait
+				if !(count == 2 && slept >= retryAfterMinWait && slept <= 2*retryAfterMinWait) {
+					t.Errorf("%s with jitter: retried once after %v", tc.path, slept)
+				}
+				continue
+			}
+			if !(count == 2 && slept == tc.wait) {
+				t.Errorf("%s (jitter %v): retried once after %v, expected %v", tc.path, jitter, slept, tc.wait)
+			}
+		}
+	}
+
+}
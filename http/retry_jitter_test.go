@@ -0,0 +1,129 @@
+package http_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/bcap/book-crawler/clock"
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+)
+
+const retryJitterMinWait, retryJitterMaxWait = time.Second, 30 * time.Second
+
+// TestRetryJitter checks that retries with jitter wait a random time bounded
+// by the min retry wait and the exponential backoff, itself bounded by the
+// max retry wait, that Retry-After is still honored, and that clients
+// retrying at the same time end up waiting differently
+func TestRetryJitter(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	outOfBounds, spreadAttempts := 0, 0
+	for attempt := 0; attempt < 10; attempt++ {
+		upper := retryJitterMinWait << attempt
+		if upper > retryJitterMaxWait {
+			upper = retryJitterMaxWait
+		}
+		seen := map[time.Duration]bool{}
+		for sample := 0; sample < 200; sample++ {
+			wait := myhttp.ExponentialJitterBackoff(retryJitterMinWait, retryJitterMaxWait, attempt, nil)
+			if wait < retryJitterMinWait || wait > upper {
+				outOfBounds++
+			}
+			seen[wait] = true
+		}
+		if attempt == 0 && len(seen) == 1 || attempt > 0 && len(seen) > 100 {
+			spreadAttempts++
+		}
+	}
+	if outOfBounds != 0 {
+		t.Errorf("waits are between the min wait and the exponential backoff (%d out of bounds)", outOfBounds)
+	}
+	if spreadAttempts != 10 {
+		t.Errorf("waits are spread over the range after the first attempt (%d of 10 attempts)", spreadAttempts)
+	}
+
+	retryAfter := func(value string) *http.Response {
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": []string{value}}}
+	}
+	wait := myhttp.ExponentialJitterBackoff(retryJitterMinWait, retryJitterMaxWait, 3, retryAfter("3"))
+	if wait != 3*time.Second {
+		t.Errorf("Retry-After is honored without jitter (%v)", wait)
+	}
+	wait = myhttp.ExponentialJitterBackoff(retryJitterMinWait, retryJitterMaxWait, 0, retryAfter("120"))
+	if wait != retryJitterMaxWait {
+		t.Errorf("Retry-After is bounded by the max wait (%v)", wait)
+	}
+
+	const failures = 6
+	// every client requests its own path, failing the first times
+	requests := map[string]int{}
+	var requestsMutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsMutex.Lock()
+		requests[r.URL.Path]++
+		count := requests[r.URL.Path]
+		requestsMutex.Unlock()
+		if count <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	// without jitter every client waits 1+2+4+8+16+30 seconds
+	const exactBackoff = 61 * time.Second
+	slept := map[time.Duration]bool{}
+	bounded := true
+	for client := 0; client < 10; client++ {
+		fake := clock.NewFake(time.Now())
+		c := myhttp.NewClient(semaphore.NewWeighted(1), nil)
+		c.RetryMax(failures)
+		c.RetryWaitMin(retryJitterMinWait)
+		c.RetryWaitMax(retryJitterMaxWait)
+		c.RetryJitter(true)
+		c.Clock = fake
+		resp, err := c.Request(ctx, http.MethodGet, fmt.Sprintf("%s/%d", server.URL, client), nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if fake.Slept() < failures*retryJitterMinWait || fake.Slept() > exactBackoff {
+			bounded = false
+		}
+		slept[fake.Slept()] = true
+	}
+	if !bounded {
+		t.Errorf("retries wait between the min wait and the backoff without jitter")
+	}
+	if len(slept) <= 5 {
+		t.Errorf("clients retrying together wait differently (%d different waits of 10)", len(slept))
+	}
+
+	fake := clock.NewFake(time.Now())
+	c := myhttp.NewClient(semaphore.NewWeighted(1), nil)
+	c.RetryMax(failures)
+	c.RetryWaitMin(retryJitterMinWait)
+	c.RetryWaitMax(retryJitterMaxWait)
+	c.RetryJitter(true)
+	c.RetryJitter(false)
+	c.Clock = fake
+	resp, err := c.Request(ctx, http.MethodGet, server.URL+"/exact", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if fake.Slept() != exactBackoff {
+		t.Errorf("disabling jitter restores the exact backoff (slept %v)", fake.Slept())
+	}
+
+}
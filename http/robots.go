@@ -0,0 +1,230 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bcap/book-crawler/clock"
+	"github.com/bcap/book-crawler/log"
+)
+
+// maxRobotsSize is how much of a robots.txt file is parsed. Anything after it
+// is ignored, as recommended by RFC 9309
+const maxRobotsSize = 500 * 1024
+
+// Robots makes a client follow the robots.txt rules (Allow, Disallow and
+// Crawl-delay) of every host it requests. Rules are fetched on the first
+// request to a host and cached from then on
+type Robots struct {
+	// Agent is matched against the User-agent lines of robots.txt files. Only
+	// its product token is used, eg book-crawler for book-crawler/1.0. Hosts
+	// without a group for it are followed with the rules for *. Defaults to
+	// the user agent of the client
+	Agent string
+
+	hosts sync.Map
+}
+
+func NewRobots(agent string) *Robots {
+	return &Robots{Agent: agent}
+}
+
+type robotsHost struct {
+	once  sync.Once
+	rules robotsRules
+
+	// next is when the next request to the host can be made when it has a
+	// crawl delay
+	next  time.Time
+	mutex sync.Mutex
+}
+
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	pattern string
+	allow   bool
+	regex   *regexp.Regexp
+}
+
+// checkRobots returns ErrDisallowedByRobots when the url cannot be
+// requested, and waits for the crawl delay of the host otherwise
+func (c *Client) checkRobots(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		// let the request itself fail
+		return nil
+	}
+	key := u.Scheme + "://" + u.Host
+	hostIntf, _ := c.Robots.hosts.LoadOrStore(key, &robotsHost{})
+	host := hostIntf.(*robotsHost)
+	host.once.Do(func() {
+		host.rules = c.fetchRobots(ctx, key+"/robots.txt")
+	})
+
+	if u.Path == "/robots.txt" {
+		return nil
+	}
+	if !host.rules.allowed(u) {
+		return ErrDisallowedByRobots{URL: rawURL}
+	}
+	if host.rules.crawlDelay <= 0 {
+		return nil
+	}
+
+	clock := clock.Or(c.Clock)
+	host.mutex.Lock()
+	now := clock.Now()
+	if host.next.Before(now) {
+		host.next = now
+	}
+	wait := host.next.Sub(now)
+	host.next = host.next.Add(host.rules.crawlDelay)
+	host.mutex.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	return clock.Sleep(ctx, wait)
+}
+
+// fetchRobots fetches and parses a robots.txt file. Hosts without one, or
+// when it cannot be fetched, allow everything: a robots.txt that fails
+// temporarily should not stop a whole crawl
+func (c *Client) fetchRobots(ctx context.Context, robotsURL string) robotsRules {
+	res, err := c.request(ctx, "GET", robotsURL, nil, nil)
+	if err != nil {
+		log.Warnf("failed to fetch %s, allowing every url of the host: %v", robotsURL, err)
+		return robotsRules{}
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		if res.StatusCode/100 != 4 {
+			log.Warnf("failed to fetch %s, allowing every url of the host: got status code %d", robotsURL, res.StatusCode)
+		}
+		return robotsRules{}
+	}
+	agent := c.Robots.Agent
+	if agent == "" {
+		agent = c.userAgent()
+	}
+	rules := parseRobots(io.LimitReader(res.Body, maxRobotsSize), agent)
+	log.Debugf("loaded %d rules from %s, crawl delay %v", len(rules.rules), robotsURL, rules.crawlDelay)
+	return rules
+}
+
+// parseRobots keeps the rules of the groups matching agent, or of the *
+// groups when none does
+func parseRobots(r io.Reader, agent string) robotsRules {
+	token := strings.ToLower(strings.TrimSpace(strings.SplitN(agent, "/", 2)[0]))
+
+	var matching, wildcard robotsRules
+	var hasMatching bool
+	var agents []string
+	inRules := false
+	apply := func(fn func(*robotsRules)) {
+		for _, a := range agents {
+			if token != "" && a == token {
+				fn(&matching)
+				hasMatching = true
+			} else if a == "*" {
+				fn(&wildcard)
+			}
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// consecutive user agent lines share the same group
+			if inRules {
+				agents = nil
+				inRules = false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			// an empty disallow allows everything, which is the default
+			if value == "" {
+				continue
+			}
+			rule := robotsRule{pattern: value, allow: key == "allow", regex: robotsPattern(value)}
+			apply(func(rules *robotsRules) { rules.rules = append(rules.rules, rule) })
+		case "crawl-delay":
+			inRules = true
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds <= 0 {
+				continue
+			}
+			delay := time.Duration(seconds * float64(time.Second))
+			apply(func(rules *robotsRules) {
+				if delay > rules.crawlDelay {
+					rules.crawlDelay = delay
+				}
+			})
+		}
+	}
+
+	if hasMatching {
+		return matching
+	}
+	return wildcard
+}
+
+// robotsPattern matches paths starting with the pattern, where * matches any
+// sequence of characters and a trailing $ anchors the end of the path
+func robotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allowed applies the most specific (longest) matching rule. Allow wins over
+// disallow when both are as specific
+func (r robotsRules) allowed(u *url.URL) bool {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	allowed := true
+	longest := -1
+	for _, rule := range r.rules {
+		if !rule.regex.MatchString(path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			longest = len(rule.pattern)
+			allowed = rule.allow
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,154 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/clock"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+)
+
+const robotsTxt = `# rules for everyone
+User-agent: *
+Disallow: /private
+Allow: /private/ok
+Crawl-delay: 2
+
+User-agent: other-bot
+Disallow: /
+
+User-agent: Book-Crawler
+User-agent: someone-else
+Disallow: /book/similar/ # no recommendations
+Allow: /book/similar/1$
+Disallow: /*.pdf$
+Crawl-delay: 1.5
+`
+
+// TestRobots checks that a client following robots.txt refuses disallowed
+// urls with ErrDisallowedByRobots without requesting them, picks the group
+// for its own agent over *, applies the most specific rule, waits for the
+// crawl delay on its clock and fetches robots.txt once per host. Also checks
+// a crawl skips disallowed books unless robots.txt is ignored
+func TestRobots(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	var robotsRequests, pageRequests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			atomic.AddInt32(&robotsRequests, 1)
+			fmt.Fprint(w, robotsTxt)
+			return
+		}
+		atomic.AddInt32(&pageRequests, 1)
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Now())
+	newClient := func(agent string) *myhttp.Client {
+		client := myhttp.NewClient(nil, nil)
+		client.RetryMax(0)
+		client.Clock = fake
+		client.Robots = myhttp.NewRobots(agent)
+		return client
+	}
+	request := func(client *myhttp.Client, path string) error {
+		resp, err := client.Request(ctx, http.MethodGet, server.URL+path, nil, nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	isDisallowed := func(err error) bool {
+		var disallowed myhttp.ErrDisallowedByRobots
+		return errors.As(err, &disallowed)
+	}
+
+	client := newClient("book-crawler/1.0")
+	allowed := []string{"/book/show/1", "/book/similar/1", "/private", "/file.pdf?download=1", "/"}
+	for _, path := range allowed {
+		err := request(client, path)
+		if err != nil {
+			t.Errorf("%s is allowed: %v", path, err)
+		}
+	}
+	for _, path := range []string{"/book/similar/2", "/book/similar/10", "/file.pdf"} {
+		err := request(client, path)
+		if !isDisallowed(err) {
+			t.Errorf("%s is disallowed: %v", path, err)
+		}
+	}
+	if atomic.LoadInt32(&pageRequests) != int32(len(allowed)) {
+		t.Errorf("disallowed urls are not requested (%d requests)", atomic.LoadInt32(&pageRequests))
+	}
+	if atomic.LoadInt32(&robotsRequests) != 1 {
+		t.Errorf("robots.txt fetched once (%d times)", atomic.LoadInt32(&robotsRequests))
+	}
+	expected := time.Duration(len(allowed)-1) * 1500 * time.Millisecond
+	if fake.Slept() != expected {
+		t.Errorf("crawl delay waited on the clock (slept %v, expected %v)", fake.Slept(), expected)
+	}
+
+	other := newClient("nobody")
+	if !isDisallowed(request(other, "/private")) {
+		t.Errorf("agents without a group follow the rules for *")
+	}
+	if request(other, "/private/ok/1") != nil {
+		t.Errorf("longer allow rules win over disallow rules")
+	}
+	if atomic.LoadInt32(&robotsRequests) != 2 {
+		t.Errorf("robots.txt is cached per client (%d fetches)", atomic.LoadInt32(&robotsRequests))
+	}
+
+	// fixture servers have no robots.txt by default, which allows everything
+	missing := fixture.NewServer(10, 2)
+	defer missing.Close()
+	resp, err := client.Request(ctx, http.MethodGet, missing.BookURL(1), nil, nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		t.Errorf("hosts without robots.txt allow everything: %v", err)
+	}
+
+	const disallowedBook = 5
+	stateOf := func(respect bool) storage.State {
+		site := fixture.NewServer(60, 4)
+		defer site.Close()
+		site.RobotsTxt = fmt.Sprintf("User-agent: *\nDisallow: /book/show/%d\n", disallowedBook)
+		c := crawler.NewCrawler(
+			crawler.WithMaxDepth(4),
+			crawler.WithMaxReadAlso(4),
+			crawler.WithRespectRobots(respect),
+		)
+		if err := c.Crawl(ctx, site.BookURL(0)); err != nil {
+			t.Errorf("crawl succeeded: %v", err)
+			return storage.NotCrawled
+		}
+		state, err := c.Storage.GetBookState(ctx, site.BookURL(disallowedBook))
+		if err != nil {
+			t.Errorf("book state loaded: %v", err)
+		}
+		return state.State
+	}
+	if stateOf(true) != storage.Skipped {
+		t.Errorf("crawl skips books disallowed by robots.txt")
+	}
+	state := stateOf(false)
+	if !(state != storage.Skipped && state != storage.NotCrawled) {
+		t.Errorf("crawl ignoring robots.txt crawls them (state %v)", state)
+	}
+
+}
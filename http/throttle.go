@@ -0,0 +1,124 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bcap/book-crawler/clock"
+	"github.com/bcap/book-crawler/log"
+)
+
+const (
+	DefaultThrottleWindow    = 20
+	DefaultThrottleThreshold = 0.5
+	DefaultThrottleMinPause  = 5 * time.Second
+	DefaultThrottleMaxPause  = 5 * time.Minute
+)
+
+// Throttle pauses all requests of a client when too many of the recent
+// responses were rate limited (403 or 429), instead of letting each request
+// back off on its own. The pause doubles while the ratio of rate limited
+// responses stays above Threshold and eases back by MinPause on every
+// success (AIMD-style)
+type Throttle struct {
+	// Window is how many of the most recent responses are considered
+	Window int
+	// Threshold is the ratio of rate limited responses in the window, from 0
+	// to 1, above which requests are paused
+	Threshold float64
+	MinPause  time.Duration
+	MaxPause  time.Duration
+	// Clock defaults to the wall clock when nil
+	Clock clock.Clock
+
+	outcomes    []bool
+	next        int
+	limited     int
+	pause       time.Duration
+	pausedUntil time.Time
+	mutex       sync.Mutex
+}
+
+func NewThrottle() *Throttle {
+	return &Throttle{
+		Window:    DefaultThrottleWindow,
+		Threshold: DefaultThrottleThreshold,
+		MinPause:  DefaultThrottleMinPause,
+		MaxPause:  DefaultThrottleMaxPause,
+	}
+}
+
+// Wait blocks until the current global pause, if any, is over
+func (t *Throttle) Wait(ctx context.Context) error {
+	t.mutex.Lock()
+	clock := clock.Or(t.Clock)
+	wait := t.pausedUntil.Sub(clock.Now())
+	t.mutex.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	return clock.Sleep(ctx, wait)
+}
+
+// Record registers the outcome of a response
+func (t *Throttle) Record(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	limited := isRateLimited(resp.StatusCode)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.outcomes) != t.Window {
+		t.outcomes = make([]bool, t.Window)
+		t.next = 0
+		t.limited = 0
+	}
+	if len(t.outcomes) == 0 {
+		return
+	}
+	if t.outcomes[t.next] {
+		t.limited--
+	}
+	t.outcomes[t.next] = limited
+	t.next = (t.next + 1) % len(t.outcomes)
+	if limited {
+		t.limited++
+	}
+
+	if !limited {
+		t.pause -= t.MinPause
+		if t.pause < 0 {
+			t.pause = 0
+		}
+		return
+	}
+	if float64(t.limited)/float64(len(t.outcomes)) <= t.Threshold {
+		return
+	}
+	// responses to requests sent before the pause started should not make it
+	// any longer
+	now := clock.Or(t.Clock).Now()
+	if now.Before(t.pausedUntil) {
+		return
+	}
+	t.pause *= 2
+	if t.pause < t.MinPause {
+		t.pause = t.MinPause
+	}
+	if t.MaxPause > 0 && t.pause > t.MaxPause {
+		t.pause = t.MaxPause
+	}
+	t.pausedUntil = now.Add(t.pause)
+	log.Warnf(
+		"%d of the last %d responses were rate limited, pausing all requests for %v",
+		t.limited, len(t.outcomes), t.pause,
+	)
+}
+
+func isRateLimited(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusForbidden
+}
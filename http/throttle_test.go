@@ -0,0 +1,58 @@
+package http_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/bcap/book-crawler/clock"
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+)
+
+// TestThrottleRetries checks that retries wait for the throttle pause, not
+// only the first attempt of a request: a rate limited response starting a
+// pause longer than the backoff holds the retry until the pause is over
+func TestThrottleRetries(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Now())
+	client := myhttp.NewClient(semaphore.NewWeighted(1), nil)
+	client.RetryMax(1)
+	client.RetryWaitMin(time.Second)
+	client.RetryWaitMax(time.Second)
+	client.Clock = fake
+	client.Throttle = myhttp.NewThrottle()
+	client.Throttle.Window = 1
+	client.Throttle.Threshold = 0
+	client.Throttle.MinPause = time.Minute
+	client.Throttle.Clock = fake
+
+	resp, err := client.Request(ctx, http.MethodGet, server.URL, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !(err == nil && resp.StatusCode == http.StatusOK && atomic.LoadInt32(&requests) == 2) {
+		t.Errorf("retried once after being rate limited (%d requests): %v", atomic.LoadInt32(&requests), err)
+	}
+	if fake.Slept() < client.Throttle.MinPause {
+		t.Errorf("retry waited for the throttle pause (slept %v)", fake.Slept())
+	}
+}
@@ -0,0 +1,115 @@
+package http_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+)
+
+// TestUserAgent checks that every request of the client carries the
+// configured User-Agent, including retries and followed redirects, that it
+// defaults to myhttp.DefaultUserAgent, and that a crawl looks robots.txt
+// rules up for the agent given with crawler.WithUserAgent
+func TestUserAgent(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	var mutex sync.Mutex
+	agents := map[string][]string{}
+	failures := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		agents[r.URL.Path] = append(agents[r.URL.Path], r.UserAgent())
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/target", http.StatusFound)
+		case "/flaky":
+			if failures < 2 {
+				failures++
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, "ok")
+		default:
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	defer server.Close()
+
+	client := myhttp.NewClient(nil, nil)
+	client.RetryWaitMin(time.Millisecond)
+	client.RetryWaitMax(time.Millisecond)
+	request := func(path string, header http.Header) {
+		resp, err := client.Request(ctx, http.MethodGet, server.URL+path, header, nil)
+		if err != nil {
+			t.Errorf("request to %s succeeded: %v", path, err)
+			return
+		}
+		resp.Body.Close()
+	}
+	allAre := func(path string, agent string) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, a := range agents[path] {
+			if a != agent {
+				return false
+			}
+		}
+		return len(agents[path]) > 0
+	}
+
+	request("/default", nil)
+	if !allAre("/default", myhttp.DefaultUserAgent) {
+		t.Errorf("defaults to %s", myhttp.DefaultUserAgent)
+	}
+
+	client.UserAgent = "my-crawler/2.0 (me@example.com)"
+	request("/redirect", nil)
+	if !(allAre("/redirect", client.UserAgent) && allAre("/target", client.UserAgent)) {
+		t.Errorf("sent on followed redirects")
+	}
+	request("/flaky", nil)
+	if !(allAre("/flaky", client.UserAgent) && len(agents["/flaky"]) == 3) {
+		t.Errorf("sent on retries (%d requests)", len(agents["/flaky"]))
+	}
+
+	header := http.Header{}
+	header.Set("User-Agent", "explicit")
+	request("/explicit", header)
+	if !allAre("/explicit", "explicit") {
+		t.Errorf("request headers take precedence")
+	}
+	if !(header.Get("User-Agent") == "explicit" && len(header) == 1) {
+		t.Errorf("request headers are left untouched")
+	}
+
+	// the seed is disallowed for the crawler agent only
+	site := fixture.NewServer(20, 2)
+	defer site.Close()
+	site.RobotsTxt = "User-agent: my-crawler\nDisallow: /book/show/0\n"
+	for _, agent := range []string{"my-crawler/2.0", "book-crawler/1.0"} {
+		c := crawler.NewCrawler(crawler.WithUserAgent(agent), crawler.WithMaxDepth(1))
+		if err := c.Crawl(ctx, site.BookURL(0)); err != nil {
+			t.Errorf("crawl succeeded: %v", err)
+			continue
+		}
+		state, _ := c.Storage.GetBookState(ctx, site.BookURL(0))
+		skipped := state.State == storage.Skipped
+		if skipped != strings.HasPrefix(agent, "my-crawler") {
+			t.Errorf("robots.txt rules are looked up for %s (skipped: %v)", agent, skipped)
+		}
+	}
+
+}
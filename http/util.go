@@ -2,6 +2,7 @@ package http
 
 import (
 	urllib "net/url"
+	"strings"
 )
 
 func AbsoluteURL(baseURL string, url string) (string, error) {
@@ -15,11 +16,60 @@ func AbsoluteURL(baseURL string, url string) (string, error) {
 		return "", err
 	}
 
-	// in case it is a relative URL, make it absolute
-	if parsedURL.Host == "" {
-		parsedURL.Host = parsedBaseURL.Host
-		parsedURL.Scheme = parsedBaseURL.Scheme
+	// resolving against the base handles relative paths as well as protocol
+	// relative urls (eg //www.goodreads.com/book/show/123)
+	absoluteURL := parsedBaseURL.ResolveReference(parsedURL)
+	stripTrackingParams(absoluteURL)
+
+	return absoluteURL.String(), nil
+}
+
+// query params goodreads adds to links to track where a click came from. They
+// do not change the page being served
+var trackingParams = []string{"from_search", "from_srp", "qid", "rank", "ref", "ac"}
+
+// stripTrackingParams removes the tracking params from the query, leaving the
+// rest as they were and in the same order, as urls are used as storage keys
+func stripTrackingParams(url *urllib.URL) {
+	if url.RawQuery == "" {
+		return
+	}
+	kept := []string{}
+	for _, param := range strings.Split(url.RawQuery, "&") {
+		key, _, _ := strings.Cut(param, "=")
+		if unescaped, err := urllib.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if !isTrackingParam(key) {
+			kept = append(kept, param)
+		}
+	}
+	url.RawQuery = strings.Join(kept, "&")
+}
+
+func isTrackingParam(key string) bool {
+	if strings.HasPrefix(key, "utm_") {
+		return true
+	}
+	for _, param := range trackingParams {
+		if key == param {
+			return true
+		}
 	}
+	return false
+}
 
+// NormalizeURL strips the parts of an URL that do not change which page is
+// served (query string and fragment) and lower cases the scheme and host
+func NormalizeURL(url string) (string, error) {
+	parsedURL, err := urllib.Parse(url)
+	if err != nil {
+		return "", err
+	}
+	parsedURL.Scheme = strings.ToLower(parsedURL.Scheme)
+	parsedURL.Host = strings.ToLower(parsedURL.Host)
+	parsedURL.RawQuery = ""
+	parsedURL.Fragment = ""
+	parsedURL.RawFragment = ""
 	return parsedURL.String(), nil
 }
@@ -0,0 +1,134 @@
+package jsonl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/storage"
+)
+
+// Book is the flat representation of a book written as a single line
+type Book struct {
+	URL       string `json:"url"`
+	Title     string `json:"title"`
+	Author    string `json:"author"`
+	AuthorURL string `json:"authorURL"`
+	ASIN      string `json:"asin"`
+	ISBN      string `json:"isbn"`
+	ISBN13    string `json:"isbn13"`
+	WorkURL   string `json:"workURL"`
+	// Provenance, only set when tracked during the crawl
+	DiscoveredFrom  string `json:"discoveredFrom"`
+	DiscoveredDepth int    `json:"discoveredDepth"`
+	DiscoveredSeed  string `json:"discoveredSeed"`
+	// CrawledAt is null when unknown
+	CrawledAt    *time.Time `json:"crawledAt"`
+	Rating       *float64   `json:"rating"`
+	RatingsTotal int32      `json:"ratingsTotal"`
+	Ratings1     int32      `json:"ratings1"`
+	Ratings2     int32      `json:"ratings2"`
+	Ratings3     int32      `json:"ratings3"`
+	Ratings4     int32      `json:"ratings4"`
+	Ratings5     int32      `json:"ratings5"`
+	Reviews      int32      `json:"reviews"`
+	Pages        int32      `json:"pages"`
+	// PublishedYear is zero when unknown
+	PublishedYear int32            `json:"publishedYear"`
+	Language      string           `json:"language"`
+	Editions      int32            `json:"editions"`
+	Genres        []string         `json:"genres"`
+	Awards        []string         `json:"awards"`
+	Shelves       map[string]int32 `json:"shelves"`
+	Description   string           `json:"description"`
+	AlsoRead      []Edge           `json:"alsoRead"`
+}
+
+type Edge struct {
+	ToURL    string `json:"toURL"`
+	Priority int    `json:"priority"`
+	Source   string `json:"source"`
+}
+
+// ExportJSONL writes every book in the storage as one json object per line.
+// Books are streamed from Storage.GetAllBooks, so the full graph is never
+// held in memory
+func ExportJSONL(ctx context.Context, s storage.Storage, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return s.GetAllBooks(ctx, func(b *book.Book) error {
+		if err := encoder.Encode(NewBook(b)); err != nil {
+			return fmt.Errorf("failed to write %s as json: %w", b.URL, err)
+		}
+		return nil
+	})
+}
+
+func NewBook(b *book.Book) Book {
+	var rating *float64
+	if b.Rating >= 0 {
+		// go through the string form so 4.12 is not written as 4.119999885559082
+		value, _ := strconv.ParseFloat(b.Rating.String(), 64)
+		rating = &value
+	}
+	var crawledAt *time.Time
+	if !b.CrawledAt.IsZero() {
+		value := b.CrawledAt
+		crawledAt = &value
+	}
+	genres := b.Genres
+	if genres == nil {
+		genres = []string{}
+	}
+	awards := b.Awards
+	if awards == nil {
+		awards = []string{}
+	}
+	shelves := b.Shelves
+	if shelves == nil {
+		shelves = map[string]int32{}
+	}
+	alsoRead := make([]Edge, len(b.AlsoRead))
+	for i, edge := range b.AlsoRead {
+		alsoRead[i] = Edge{
+			ToURL:    edge.To.URL,
+			Priority: edge.Priority,
+			Source:   edge.Source,
+		}
+	}
+	return Book{
+		URL:             b.URL,
+		Title:           b.Title,
+		Author:          b.Author,
+		AuthorURL:       b.AuthorURL,
+		ASIN:            b.ASIN,
+		ISBN:            b.ISBN,
+		ISBN13:          b.ISBN13,
+		WorkURL:         b.WorkURL,
+		DiscoveredFrom:  b.DiscoveredFrom,
+		DiscoveredDepth: b.DiscoveredDepth,
+		DiscoveredSeed:  b.DiscoveredSeed,
+		CrawledAt:       crawledAt,
+		Rating:          rating,
+		RatingsTotal:    b.RatingsTotal,
+		Ratings1:        b.Ratings1,
+		Ratings2:        b.Ratings2,
+		Ratings3:        b.Ratings3,
+		Ratings4:        b.Ratings4,
+		Ratings5:        b.Ratings5,
+		Reviews:         b.Reviews,
+		Pages:           b.Pages,
+		PublishedYear:   b.PublishedYear,
+		Language:        b.Language,
+		Editions:        b.Editions,
+		Description:     b.Description,
+		Genres:          genres,
+		Awards:          awards,
+		Shelves:         shelves,
+		AlsoRead:        alsoRead,
+	}
+}
@@ -0,0 +1,116 @@
+package jsonl_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/jsonl"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+	"github.com/bcap/book-crawler/storage/memory"
+)
+
+// TestExportJSONL checks that a stored graph with a cycle is written as one
+// json object per book, in storage order, with the book fields and its edges
+// pointing to other books by url, so the cycle does not recurse
+func TestExportJSONL(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+	s := &memory.Storage{}
+	if err := s.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(ctx)
+
+	urls := make([]string, 3)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("https://www.goodreads.com/book/show/%d", i+1)
+		b := book.New(urls[i])
+		b.Title = fmt.Sprintf("Title %d", i+1)
+		b.Author = "Doe, Jane"
+		b.Rating = book.NoRating
+		if i == 0 {
+			b.Rating = book.NewRating(4.12)
+			b.Genres = []string{"Fantasy", "Horror"}
+			b.Shelves = map[string]int32{"to-read": 10}
+			b.Description = `a "quoted" <b>description</b>`
+			b.DiscoveredSeed = urls[0]
+			if _, _, err := s.SetBookState(ctx, urls[i], storage.StateChange{}, storage.Crawled); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.SetBook(ctx, urls[i], b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 1 -> 2 -> 3 -> 1, and 1 -> 3 from another source
+	links := []struct {
+		from, to int
+		priority int
+		source   string
+	}{
+		{0, 1, 0, book.SourceAlsoRead},
+		{1, 2, 0, book.SourceAlsoRead},
+		{2, 0, 0, book.SourceAlsoRead},
+		{0, 2, 1, book.SourceReadersAlsoEnjoyed},
+	}
+	for _, link := range links {
+		if err := s.LinkBookWithSource(ctx, urls[link.from], urls[link.to], link.priority, link.source); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out strings.Builder
+	if err := jsonl.ExportJSONL(ctx, s, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(urls) {
+		t.Fatalf("a line per book (%d lines)", len(lines))
+	}
+	decoder := json.NewDecoder(strings.NewReader(out.String()))
+	decoder.DisallowUnknownFields()
+
+	expectedEdges := [][]jsonl.Edge{
+		{{ToURL: urls[1], Priority: 0, Source: book.SourceAlsoRead}, {ToURL: urls[2], Priority: 1, Source: book.SourceReadersAlsoEnjoyed}},
+		{{ToURL: urls[2], Priority: 0, Source: book.SourceAlsoRead}},
+		{{ToURL: urls[0], Priority: 0, Source: book.SourceAlsoRead}},
+	}
+	for idx, line := range lines {
+		var decoded jsonl.Book
+		if err := decoder.Decode(&decoded); err != nil {
+			t.Fatalf("line %d is a json object: %v (%s)", idx, err, line)
+		}
+		if decoded.URL != urls[idx] || decoded.Title != fmt.Sprintf("Title %d", idx+1) || decoded.Author != "Doe, Jane" {
+			t.Errorf("line %d is book %d in storage order (%s)", idx, idx+1, line)
+		}
+		if fmt.Sprint(decoded.AlsoRead) != fmt.Sprint(expectedEdges[idx]) {
+			t.Errorf("line %d edges by url (%v)", idx, decoded.AlsoRead)
+		}
+		if idx == 0 {
+			if decoded.Rating == nil || *decoded.Rating != 4.12 {
+				t.Errorf("rating written as its string form (%s)", line)
+			}
+			if strings.Join(decoded.Genres, ",") != "Fantasy,Horror" || decoded.Shelves["to-read"] != 10 {
+				t.Errorf("genres and shelves (%s)", line)
+			}
+			if decoded.Description != `a "quoted" <b>description</b>` || !strings.Contains(line, "<b>") {
+				t.Errorf("description written without escaping html (%s)", line)
+			}
+			if decoded.DiscoveredSeed != urls[0] || decoded.CrawledAt == nil {
+				t.Errorf("provenance and crawl time (%s)", line)
+			}
+			continue
+		}
+		if decoded.Rating != nil || decoded.CrawledAt != nil {
+			t.Errorf("unknown rating and crawl time are null (%s)", line)
+		}
+		if decoded.Genres == nil || decoded.Awards == nil || decoded.Shelves == nil {
+			t.Errorf("empty lists and maps are not null (%s)", line)
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package log
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"sync"
+	"time"
 )
 
 const (
@@ -14,6 +19,26 @@ const (
 
 var Level = WarnLevel
 
+const (
+	TextFormat = iota
+	// JSONFormat writes every message as a json object in a line of its own,
+	// eg {"level":"info","ts":"2006-01-02T15:04:05.999Z","msg":"..."}
+	JSONFormat
+)
+
+var Format = TextFormat
+
+var levelNames = map[int]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	WarnLevel:  "warn",
+	ErrorLevel: "error",
+}
+
+// jsonMutex keeps json lines whole, as they are written straight to the
+// output of the loggers instead of through them
+var jsonMutex sync.Mutex
+
 var (
 	DebugLogger *log.Logger
 	WarnLogger  *log.Logger
@@ -61,13 +86,47 @@ func Errorf(format string, v ...any) {
 }
 
 func doLog(logger *log.Logger, loggerLevel int, message string) {
-	if loggerLevel <= Level {
-		logger.Print(message)
+	if loggerLevel > Level {
+		return
+	}
+	if Format == JSONFormat {
+		logJSON(logger, loggerLevel, message)
+		return
 	}
+	logger.Print(message)
 }
 
 func doLogf(logger *log.Logger, loggerLevel int, format string, v ...any) {
-	if loggerLevel <= Level {
-		logger.Printf(format, v...)
+	if loggerLevel > Level {
+		return
+	}
+	if Format == JSONFormat {
+		logJSON(logger, loggerLevel, fmt.Sprintf(format, v...))
+		return
+	}
+	logger.Printf(format, v...)
+}
+
+type jsonLine struct {
+	Level string `json:"level"`
+	TS    string `json:"ts"`
+	Msg   string `json:"msg"`
+}
+
+func logJSON(logger *log.Logger, loggerLevel int, message string) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	line := jsonLine{
+		Level: levelNames[loggerLevel],
+		TS:    time.Now().UTC().Format(time.RFC3339Nano),
+		Msg:   message,
+	}
+	if err := encoder.Encode(line); err != nil {
+		logger.Print(message)
+		return
 	}
+	jsonMutex.Lock()
+	defer jsonMutex.Unlock()
+	logger.Writer().Write(buf.Bytes())
 }
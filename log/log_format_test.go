@@ -0,0 +1,153 @@
+package log_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+)
+
+type line struct {
+	Level string `json:"level"`
+	TS    string `json:"ts"`
+	Msg   string `json:"msg"`
+}
+
+// syncBuffer is written to by the loggers of every level at once
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func redirect(w *syncBuffer) {
+	log.DebugLogger.SetOutput(w)
+	log.InfoLogger.SetOutput(w)
+	log.WarnLogger.SetOutput(w)
+	log.ErrorLogger.SetOutput(w)
+}
+
+// parse returns the lines that are valid json logs, and how many are not
+func parse(output string) ([]line, int) {
+	var lines []line
+	invalid := 0
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var l line
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			invalid++
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339Nano, l.TS); err != nil {
+			invalid++
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines, invalid
+}
+
+// TestLogFormat checks that the json log format writes every message as a
+// json object of its own with the level, time and message, that lines stay
+// whole when logging concurrently, and that the text format is unchanged
+func TestLogFormat(t *testing.T) {
+	var out syncBuffer
+	redirect(&out)
+	log.Level = log.InfoLevel
+	log.Format = log.JSONFormat
+
+	log.Infof("crawled book %q <%s>", "Dune & friends", "https://example.com/?a=1&b=2")
+	log.Warn("multi\nline")
+	log.Debugf("not logged at info level")
+	log.Error("failed")
+	lines, invalid := parse(out.String())
+	if !(invalid == 0 && len(lines) == 3) {
+		t.Errorf("every message is a json line (%d lines, %d invalid)", len(lines), invalid)
+	}
+	if len(lines) == 3 {
+		if !(lines[0].Level == "info" && lines[0].Msg == `crawled book "Dune & friends" <https://example.com/?a=1&b=2>`) {
+			t.Errorf("formatted message kept as is: %+v", lines[0])
+		}
+		if !(lines[1].Level == "warn" && lines[1].Msg == "multi\nline") {
+			t.Errorf("newlines kept in the message: %+v", lines[1])
+		}
+		if !(lines[2].Level == "error" && lines[2].Msg == "failed") {
+			t.Errorf("error level: %+v", lines[2])
+		}
+	}
+
+	// concurrent messages never interleave
+	out = syncBuffer{}
+	redirect(&out)
+	log.Level = log.DebugLevel
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if j%2 == 0 {
+					log.Debugf("goroutine %d message %d %s", i, j, strings.Repeat("x", 500))
+				} else {
+					log.Infof("goroutine %d message %d", i, j)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	lines, invalid = parse(out.String())
+	if !(invalid == 0 && len(lines) == 1000) {
+		t.Errorf("concurrent messages stay whole (%d lines, %d invalid)", len(lines), invalid)
+	}
+
+	// the crawl logs, progress included, are all json
+	out = syncBuffer{}
+	redirect(&out)
+	server := fixture.NewServer(50, 3)
+	c := crawler.NewCrawler(crawler.WithMaxDepth(2), crawler.WithMaxReadAlso(3))
+	if err := c.Crawl(context.Background(), server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	lines, invalid = parse(out.String())
+	crawled := 0
+	for _, l := range lines {
+		if strings.Contains(l.Msg, "crawled book") {
+			crawled++
+		}
+	}
+	if !(invalid == 0 && crawled > 0) {
+		t.Errorf("crawl logs are json lines (%d lines, %d crawled books, %d invalid)", len(lines), crawled, invalid)
+	}
+
+	// the text format is unchanged
+	out = syncBuffer{}
+	redirect(&out)
+	log.Format = log.TextFormat
+	log.Infof("plain %s", "text")
+	text := out.String()
+	if !(strings.HasPrefix(text, "INFO  ") && strings.HasSuffix(text, " plain text\n")) {
+		t.Errorf("text format unchanged: %q", text)
+	}
+
+}
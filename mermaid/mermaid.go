@@ -0,0 +1,87 @@
+package mermaid
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bcap/book-crawler/book"
+)
+
+var unsafeIDChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// labelEscaper escapes what cannot be written as is in a quoted mermaid
+// label, using mermaid entity codes
+var labelEscaper = strings.NewReplacer(
+	`"`, "#quot;",
+	"<", "#lt;",
+	">", "#gt;",
+)
+
+// PrintBookGraph writes the graph as a mermaid flowchart, to be embedded in
+// markdown documents. Nodes are labelled with the title and author of their
+// book and identified by their url, so ids are the same across runs
+func PrintBookGraph(graph book.Graph, writer io.Writer) error {
+	books := append([]*book.Book{}, graph.All...)
+	sort.Slice(books, func(i int, j int) bool {
+		return books[i].URL < books[j].URL
+	})
+	ids := nodeIDs(books)
+
+	if _, err := fmt.Fprint(writer, "graph LR\n"); err != nil {
+		return err
+	}
+	for _, b := range books {
+		label := labelEscaper.Replace(b.Title) + "<br/>" + labelEscaper.Replace(b.Author)
+		if _, err := fmt.Fprintf(writer, "    %s[\"%s\"]\n", ids[b], label); err != nil {
+			return err
+		}
+	}
+	for _, b := range books {
+		for _, edge := range b.AlsoRead {
+			// books trimmed from the graph, eg by book.TopRanked, are left out
+			to, ok := ids[edge.To]
+			if !ok {
+				continue
+			}
+			if _, err := fmt.Fprintf(writer, "    %s --> %s\n", ids[b], to); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nodeIDs derives the node ids from the book urls, eg b_book_show_1_dune for
+// /book/show/1-dune. Books whose urls sanitize to the same id, which are
+// expected to be given in url order, get a hash of their url appended
+func nodeIDs(books []*book.Book) map[*book.Book]string {
+	ids := make(map[*book.Book]string, len(books))
+	taken := map[string]bool{}
+	for _, b := range books {
+		id := sanitize(b.URL)
+		if taken[id] {
+			hash := fnv.New32a()
+			hash.Write([]byte(b.URL))
+			id = fmt.Sprintf("%s_%08x", id, hash.Sum32())
+		}
+		taken[id] = true
+		ids[b] = id
+	}
+	return ids
+}
+
+func sanitize(rawURL string) string {
+	path := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Path != "" {
+		path = u.Path
+	}
+	id := strings.Trim(unsafeIDChars.ReplaceAllString(path, "_"), "_")
+	// ids starting with a digit or named after keywords (eg end) break the
+	// mermaid parser
+	return "b_" + id
+}
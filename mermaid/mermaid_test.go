@@ -0,0 +1,116 @@
+package mermaid_test
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/mermaid"
+)
+
+var nodeRegex = regexp.MustCompile(`^    ([A-Za-z_][A-Za-z0-9_]*)\["([^"]*)"\]$`)
+var edgeRegex = regexp.MustCompile(`^    ([A-Za-z0-9_]+) --> ([A-Za-z0-9_]+)$`)
+
+func render(t *testing.T, graph book.Graph) string {
+	t.Helper()
+	var out strings.Builder
+	if err := mermaid.PrintBookGraph(graph, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+// TestMermaid checks the mermaid output: a node per book with a safe id and
+// an escaped label, an edge per recommendation in between declared nodes, and
+// the same output for the same graph
+func TestMermaid(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+	c := crawler.NewCrawler(crawler.WithMaxDepth(3), crawler.WithMaxReadAlso(3))
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.Storage.GetBook(ctx, server.BookURL(1), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph := book.NewGraph(root)
+
+	output := render(t, graph)
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if lines[0] != "graph LR" {
+		t.Errorf("starts with graph LR: %q", lines[0])
+	}
+
+	nodes := map[string]bool{}
+	edges, invalid, dangling := 0, 0, 0
+	for _, line := range lines[1:] {
+		if matches := nodeRegex.FindStringSubmatch(line); matches != nil {
+			nodes[matches[1]] = true
+			continue
+		}
+		if matches := edgeRegex.FindStringSubmatch(line); matches != nil {
+			edges++
+			if !nodes[matches[1]] || !nodes[matches[2]] {
+				dangling++
+			}
+			continue
+		}
+		invalid++
+	}
+	expectedEdges := 0
+	for _, b := range graph.All {
+		expectedEdges += len(b.AlsoRead)
+	}
+	if invalid != 0 {
+		t.Errorf("every line is a node or an edge (%d invalid)", invalid)
+	}
+	if len(nodes) != len(graph.All) {
+		t.Errorf("a node per book (%d nodes, %d books)", len(nodes), len(graph.All))
+	}
+	if edges != expectedEdges {
+		t.Errorf("an edge per recommendation (%d edges, %d expected)", edges, expectedEdges)
+	}
+	if dangling != 0 {
+		t.Errorf("edges only reference declared nodes (%d dangling)", dangling)
+	}
+
+	root, _ = c.Storage.GetBook(ctx, server.BookURL(1), 0)
+	if render(t, book.NewGraph(root)) != output {
+		t.Errorf("same graph gives the same output")
+	}
+
+	// awkward titles and urls
+	a := book.New("https://www.goodreads.com/book/show/1-dune")
+	a.Title, a.Author = `The "Best" <Book>`, "Someone"
+	b := book.New("https://www.goodreads.com/book/show/1.dune")
+	b.Title, b.Author = "end", "Other"
+	a.AlsoRead = append(a.AlsoRead, book.Edge{From: a, To: b})
+	b.AlsoRead = append(b.AlsoRead, book.Edge{From: b, To: a})
+	output = render(t, book.NewGraph(a))
+	lines = strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	ids := map[string]bool{}
+	for _, line := range lines[1:] {
+		if matches := nodeRegex.FindStringSubmatch(line); matches != nil {
+			ids[matches[1]] = true
+		}
+	}
+	if len(ids) != 2 {
+		t.Errorf("urls sanitizing to the same id get distinct ids: %v", ids)
+	}
+	if !strings.Contains(output, `The #quot;Best#quot; #lt;Book#gt;<br/>Someone`) {
+		t.Errorf("quotes and brackets escaped in labels")
+	}
+	if render(t, book.NewGraph()) != "graph LR\n" {
+		t.Errorf("empty graph is an empty flowchart")
+	}
+
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metric names, as exposed to prometheus
+const (
+	BooksCheckedName = "book_crawler_books_checked_total"
+	BooksCrawledName = "book_crawler_books_crawled_total"
+	FetchErrorsName  = "book_crawler_fetch_errors_total"
+	RetriesName      = "book_crawler_retries_total"
+	FetchLatencyName = "book_crawler_fetch_duration_seconds"
+)
+
+// Help texts of the metrics, by name
+var Help = map[string]string{
+	BooksCheckedName: "Books whose crawl state was checked, including the ones already crawled",
+	BooksCrawledName: "Books fetched and persisted",
+	FetchErrorsName:  "Requests that failed or got an error status code after all their retries",
+	RetriesName:      "Requests retried",
+	FetchLatencyName: "How long each request attempt took to get a response, without the waits in between retries",
+}
+
+// DefaultBuckets are the upper bounds of the fetch latency histogram, in
+// seconds. They are the same as the prometheus client defaults
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics counts what a crawl does, to be scraped by prometheus once
+// registered with Register.
+// Methods on a nil Metrics record nothing, so they can be called without
+// checking whether metrics are enabled
+type Metrics struct {
+	booksChecked int64
+	booksCrawled int64
+	fetchErrors  int64
+	retries      int64
+
+	latencyBuckets []float64
+	latencyCounts  []uint64
+	latencyCount   uint64
+	latencySum     float64
+	latencyMutex   sync.Mutex
+}
+
+func New() *Metrics {
+	return &Metrics{
+		latencyBuckets: DefaultBuckets,
+		latencyCounts:  make([]uint64, len(DefaultBuckets)),
+	}
+}
+
+func (m *Metrics) IncBooksChecked() {
+	if m != nil {
+		atomic.AddInt64(&m.booksChecked, 1)
+	}
+}
+
+func (m *Metrics) IncBooksCrawled() {
+	if m != nil {
+		atomic.AddInt64(&m.booksCrawled, 1)
+	}
+}
+
+func (m *Metrics) IncFetchErrors() {
+	if m != nil {
+		atomic.AddInt64(&m.fetchErrors, 1)
+	}
+}
+
+func (m *Metrics) IncRetries() {
+	if m != nil {
+		atomic.AddInt64(&m.retries, 1)
+	}
+}
+
+func (m *Metrics) ObserveFetchLatency(d time.Duration) {
+	if m == nil {
+		return
+	}
+	seconds := d.Seconds()
+	m.latencyMutex.Lock()
+	defer m.latencyMutex.Unlock()
+	for idx, bound := range m.latencyBuckets {
+		if seconds <= bound {
+			m.latencyCounts[idx]++
+		}
+	}
+	m.latencyCount++
+	m.latencySum += seconds
+}
+
+// Snapshot is the value of every metric at a point in time
+type Snapshot struct {
+	BooksChecked int64
+	BooksCrawled int64
+	FetchErrors  int64
+	Retries      int64
+	FetchLatency HistogramSnapshot
+}
+
+// HistogramSnapshot has the cumulative count of observations of each bucket,
+// in the same order as their upper bounds
+type HistogramSnapshot struct {
+	Buckets []float64
+	Counts  []uint64
+	Count   uint64
+	Sum     float64
+}
+
+func (m *Metrics) Snapshot() Snapshot {
+	if m == nil {
+		return Snapshot{}
+	}
+	m.latencyMutex.Lock()
+	defer m.latencyMutex.Unlock()
+	return Snapshot{
+		BooksChecked: atomic.LoadInt64(&m.booksChecked),
+		BooksCrawled: atomic.LoadInt64(&m.booksCrawled),
+		FetchErrors:  atomic.LoadInt64(&m.fetchErrors),
+		Retries:      atomic.LoadInt64(&m.retries),
+		FetchLatency: HistogramSnapshot{
+			Buckets: append([]float64{}, m.latencyBuckets...),
+			Counts:  append([]uint64{}, m.latencyCounts...),
+			Count:   m.latencyCount,
+			Sum:     m.latencySum,
+		},
+	}
+}
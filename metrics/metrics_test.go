@@ -0,0 +1,169 @@
+package metrics_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/clock"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	myhttp "github.com/bcap/book-crawler/http"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/metrics"
+)
+
+// TestMetrics checks that the metrics count the books checked and crawled by
+// a crawl, the failed requests and the retries, that every request attempt is
+// observed in the latency histogram and that once registered they are served
+// in the prometheus text format
+func TestMetrics(t *testing.T) {
+	log.Level = log.ErrorLevel
+	ctx := context.Background()
+
+	var nilMetrics *metrics.Metrics
+	nilMetrics.IncBooksChecked()
+	nilMetrics.ObserveFetchLatency(time.Second)
+	if nilMetrics.Snapshot().BooksChecked != 0 {
+		t.Errorf("nil metrics record nothing")
+	}
+
+	server := fixture.NewServer(200, 3)
+	defer server.Close()
+	server.Missing = map[int]bool{}
+	for id := 0; id < 200; id += 7 {
+		server.Missing[id] = true
+	}
+
+	m := metrics.New()
+	c := crawler.NewCrawler(
+		crawler.WithMaxDepth(3),
+		crawler.WithMaxReadAlso(3),
+		crawler.WithMaxParallelism(10),
+		crawler.WithMetrics(m),
+	)
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	persisted := 0
+	c.Storage.GetAllBooks(ctx, func(*book.Book) error {
+		persisted++
+		return nil
+	})
+
+	s := m.Snapshot()
+	if s.BooksCrawled != int64(persisted) {
+		t.Errorf("books crawled counted (%d, %d persisted)", s.BooksCrawled, persisted)
+	}
+	if s.BooksChecked <= s.BooksCrawled {
+		t.Errorf("books checked counted (%d)", s.BooksChecked)
+	}
+	if s.FetchErrors <= 0 {
+		t.Errorf("missing books counted as fetch errors (%d)", s.FetchErrors)
+	}
+	if s.FetchLatency.Count < uint64(persisted) {
+		t.Errorf("request attempts observed (%d)", s.FetchLatency.Count)
+	}
+	cumulative := true
+	for idx := 1; idx < len(s.FetchLatency.Counts); idx++ {
+		if s.FetchLatency.Counts[idx] < s.FetchLatency.Counts[idx-1] {
+			cumulative = false
+		}
+	}
+	if !(cumulative && s.FetchLatency.Counts[len(s.FetchLatency.Counts)-1] <= s.FetchLatency.Count) {
+		t.Errorf("latency buckets are cumulative (%v)", s.FetchLatency.Counts)
+	}
+
+	// every attempt is observed, without the waits in between retries
+	const failures = 2
+	var requests int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer flaky.Close()
+
+	fake := clock.NewFake(time.Now())
+	clientMetrics := metrics.New()
+	client := myhttp.NewClient(semaphore.NewWeighted(1), nil)
+	client.RetryMax(failures)
+	client.RetryWaitMin(time.Minute)
+	client.RetryWaitMax(time.Hour)
+	client.Clock = fake
+	client.Metrics = clientMetrics
+	resp, err := client.Request(ctx, http.MethodGet, flaky.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	cs := clientMetrics.Snapshot()
+	if cs.Retries != failures {
+		t.Errorf("retries counted (%d)", cs.Retries)
+	}
+	if cs.FetchErrors != 0 {
+		t.Errorf("retried requests that succeed are not errors (%d)", cs.FetchErrors)
+	}
+	if cs.FetchLatency.Count != failures+1 {
+		t.Errorf("every attempt observed (%d)", cs.FetchLatency.Count)
+	}
+	if cs.FetchLatency.Sum >= 1 {
+		t.Errorf("waits in between retries not observed (%.3fs in total)", cs.FetchLatency.Sum)
+	}
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	resp, err = client.Request(ctx, http.MethodGet, notFound.URL, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if clientMetrics.Snapshot().FetchErrors != 1 {
+		t.Errorf("error status codes counted (%d)", clientMetrics.Snapshot().FetchErrors)
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := m.Register(registry); err != nil {
+		t.Fatal(err)
+	}
+	metricsServer := httptest.NewServer(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	defer metricsServer.Close()
+	resp, err = http.Get(metricsServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	text := string(body)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("served as prometheus text (%s)", resp.Header.Get("Content-Type"))
+	}
+	expected := []string{
+		"# TYPE book_crawler_books_checked_total counter",
+		fmt.Sprintf("book_crawler_books_crawled_total %d\n", s.BooksCrawled),
+		fmt.Sprintf("book_crawler_fetch_errors_total %d\n", s.FetchErrors),
+		"book_crawler_retries_total 0\n",
+		"# TYPE book_crawler_fetch_duration_seconds histogram",
+		`book_crawler_fetch_duration_seconds_bucket{le="0.005"} `,
+		fmt.Sprintf("book_crawler_fetch_duration_seconds_bucket{le=\"+Inf\"} %d\n", s.FetchLatency.Count),
+		fmt.Sprintf("book_crawler_fetch_duration_seconds_count %d\n", s.FetchLatency.Count),
+	}
+	for _, line := range expected {
+		if !strings.Contains(text, line) {
+			t.Errorf("served %q", strings.TrimSpace(line))
+		}
+	}
+
+}
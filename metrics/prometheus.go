@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	booksCheckedDesc = prometheus.NewDesc(BooksCheckedName, Help[BooksCheckedName], nil, nil)
+	booksCrawledDesc = prometheus.NewDesc(BooksCrawledName, Help[BooksCrawledName], nil, nil)
+	fetchErrorsDesc  = prometheus.NewDesc(FetchErrorsName, Help[FetchErrorsName], nil, nil)
+	retriesDesc      = prometheus.NewDesc(RetriesName, Help[RetriesName], nil, nil)
+	fetchLatencyDesc = prometheus.NewDesc(FetchLatencyName, Help[FetchLatencyName], nil, nil)
+)
+
+// Register exposes the metrics on a prometheus registry
+func (m *Metrics) Register(registry *prometheus.Registry) error {
+	return registry.Register(collector{metrics: m})
+}
+
+type collector struct {
+	metrics *Metrics
+}
+
+func (c collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- booksCheckedDesc
+	ch <- booksCrawledDesc
+	ch <- fetchErrorsDesc
+	ch <- retriesDesc
+	ch <- fetchLatencyDesc
+}
+
+func (c collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.metrics.Snapshot()
+	ch <- prometheus.MustNewConstMetric(booksCheckedDesc, prometheus.CounterValue, float64(s.BooksChecked))
+	ch <- prometheus.MustNewConstMetric(booksCrawledDesc, prometheus.CounterValue, float64(s.BooksCrawled))
+	ch <- prometheus.MustNewConstMetric(fetchErrorsDesc, prometheus.CounterValue, float64(s.FetchErrors))
+	ch <- prometheus.MustNewConstMetric(retriesDesc, prometheus.CounterValue, float64(s.Retries))
+
+	buckets := make(map[float64]uint64, len(s.FetchLatency.Buckets))
+	for idx, bound := range s.FetchLatency.Buckets {
+		buckets[bound] = s.FetchLatency.Counts[idx]
+	}
+	ch <- prometheus.MustNewConstHistogram(fetchLatencyDesc, s.FetchLatency.Count, s.FetchLatency.Sum, buckets)
+}
@@ -0,0 +1,69 @@
+package metrics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/bcap/book-crawler/metrics"
+)
+
+// TestRegister checks the metrics registered on a prometheus registry are
+// gathered with the values recorded
+func TestRegister(t *testing.T) {
+	m := metrics.New()
+	m.IncBooksChecked()
+	m.IncBooksChecked()
+	m.IncBooksCrawled()
+	m.IncRetries()
+	m.ObserveFetchLatency(50 * time.Millisecond)
+	m.ObserveFetchLatency(3 * time.Second)
+
+	registry := prometheus.NewRegistry()
+	if err := m.Register(registry); err != nil {
+		t.Fatal(err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counters := map[string]float64{}
+	for _, family := range families {
+		metric := family.GetMetric()[0]
+		if counter := metric.GetCounter(); counter != nil {
+			counters[family.GetName()] = counter.GetValue()
+		}
+		if histogram := metric.GetHistogram(); histogram != nil {
+			if family.GetName() != metrics.FetchLatencyName {
+				t.Errorf("unexpected histogram %s", family.GetName())
+			}
+			if histogram.GetSampleCount() != 2 || histogram.GetSampleSum() != 3.05 {
+				t.Errorf("latency histogram has %d observations adding up to %v", histogram.GetSampleCount(), histogram.GetSampleSum())
+			}
+			for _, bucket := range histogram.GetBucket() {
+				expected := uint64(0)
+				if bucket.GetUpperBound() >= 3 {
+					expected = 2
+				} else if bucket.GetUpperBound() >= 0.05 {
+					expected = 1
+				}
+				if bucket.GetCumulativeCount() != expected {
+					t.Errorf("latency bucket %v has %d observations, expected %d", bucket.GetUpperBound(), bucket.GetCumulativeCount(), expected)
+				}
+			}
+		}
+	}
+	expected := map[string]float64{
+		metrics.BooksCheckedName: 2,
+		metrics.BooksCrawledName: 1,
+		metrics.FetchErrorsName:  0,
+		metrics.RetriesName:      1,
+	}
+	for name, value := range expected {
+		if counters[name] != value {
+			t.Errorf("%s gathered as %v, expected %v", name, counters[name], value)
+		}
+	}
+}
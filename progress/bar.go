@@ -0,0 +1,172 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bcap/book-crawler/clock"
+)
+
+// clearLine moves the cursor back to the start of the line and erases it
+const clearLine = "\r\033[K"
+
+// rateWindow is how far back the crawl rate is computed over
+const rateWindow = 10 * time.Second
+
+const barWidth = 30
+
+// Counts returns how many books a crawl crawled and checked so far
+type Counts func() (crawled int32, checked int32)
+
+// Bar renders the progress of a crawl on the last line of a terminal, redrawn
+// in place: how many books were crawled and checked and the crawl rate over
+// the last seconds. When the crawl stops at a max number of books, a bar and
+// the estimated time left are shown as well. Anything else written to the
+// terminal while the bar is shown, like logs, must go through Write so it is
+// printed above the bar
+type Bar struct {
+	// Max is how many books the crawl stops at, 0 when unlimited
+	Max int32
+	// Clock defaults to the wall clock when nil
+	Clock clock.Clock
+
+	out    io.Writer
+	counts Counts
+
+	mutex   sync.Mutex
+	line    string
+	start   time.Time
+	samples []sample
+	stopped bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type sample struct {
+	at      time.Time
+	crawled int32
+}
+
+func NewBar(out io.Writer, counts Counts) *Bar {
+	return &Bar{out: out, counts: counts}
+}
+
+// Start redraws the bar every interval until Stop is called
+func (b *Bar) Start(interval time.Duration) {
+	b.stop = make(chan struct{})
+	b.done = make(chan struct{})
+	b.Render()
+	go func() {
+		defer close(b.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				b.Render()
+			case <-b.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop draws the bar a last time and leaves it on a line of its own. Writes
+// after it go straight to the output
+func (b *Bar) Stop() {
+	if b.stop != nil {
+		close(b.stop)
+		<-b.done
+		b.stop = nil
+	}
+	b.Render()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.stopped {
+		b.stopped = true
+		io.WriteString(b.out, "\n")
+	}
+}
+
+// Render redraws the bar with the current counts
+func (b *Bar) Render() {
+	now := clock.Or(b.Clock).Now()
+	crawled, checked := b.counts()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.stopped {
+		return
+	}
+	if b.start.IsZero() {
+		b.start = now
+	}
+	b.samples = append(b.samples, sample{at: now, crawled: crawled})
+	for len(b.samples) > 1 && now.Sub(b.samples[1].at) >= rateWindow {
+		b.samples = b.samples[1:]
+	}
+	rate := 0.0
+	if oldest := b.samples[0]; now.After(oldest.at) {
+		rate = float64(crawled-oldest.crawled) / now.Sub(oldest.at).Seconds()
+	}
+
+	var line string
+	if b.Max > 0 {
+		line = fmt.Sprintf("%s %d/%d books in %d checks, %.1f books/s, %s", bar(crawled, b.Max), crawled, b.Max, checked, rate, eta(crawled, b.Max, rate))
+	} else {
+		line = fmt.Sprintf("crawled %d books in %d checks, %.1f books/s, %s elapsed", crawled, checked, rate, now.Sub(b.start).Round(time.Second))
+	}
+	b.line = line
+	io.WriteString(b.out, clearLine+line)
+}
+
+// Write prints p above the bar
+func (b *Bar) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.stopped || b.line == "" {
+		return b.out.Write(p)
+	}
+	if _, err := io.WriteString(b.out, clearLine); err != nil {
+		return 0, err
+	}
+	n, err := b.out.Write(p)
+	if err != nil {
+		return n, err
+	}
+	_, err = io.WriteString(b.out, b.line)
+	return n, err
+}
+
+func bar(crawled int32, max int32) string {
+	filled := int(int64(barWidth) * int64(crawled) / int64(max))
+	if filled > barWidth {
+		filled = barWidth
+	}
+	if filled < barWidth {
+		return "[" + strings.Repeat("=", filled) + ">" + strings.Repeat(" ", barWidth-filled-1) + "]"
+	}
+	return "[" + strings.Repeat("=", barWidth) + "]"
+}
+
+func eta(crawled int32, max int32, rate float64) string {
+	if crawled >= max {
+		return "done"
+	}
+	if rate <= 0 {
+		return "time left unknown"
+	}
+	left := time.Duration(float64(max-crawled) / rate * float64(time.Second))
+	return fmt.Sprintf("%s left", left.Round(time.Second))
+}
+
+// IsTerminal tells whether f is a terminal rather than a file or a pipe
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,132 @@
+package progress_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/clock"
+	"github.com/bcap/book-crawler/crawler"
+	"github.com/bcap/book-crawler/fixture"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/progress"
+)
+
+const clearLine = "\r\033[K"
+
+// lastLine is what the terminal shows after the output was written to it
+func lastLine(out *bytes.Buffer) string {
+	s := out.String()
+	return s[strings.LastIndex(s, clearLine)+len(clearLine):]
+}
+
+// TestProgress checks that the progress bar shows the crawl counts and the
+// rate over the last seconds, a bar and the time left when there is a max,
+// prints writes above itself and steps aside once stopped, and that crawler
+// counts match the books crawled
+func TestProgress(t *testing.T) {
+	log.Level = log.ErrorLevel
+
+	fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	var crawled, checked int32
+	counts := func() (int32, int32) {
+		return atomic.LoadInt32(&crawled), atomic.LoadInt32(&checked)
+	}
+	out := &bytes.Buffer{}
+	bar := progress.NewBar(out, counts)
+	bar.Clock = fake
+
+	bar.Render()
+	if lastLine(out) != "crawled 0 books in 0 checks, 0.0 books/s, 0s elapsed" {
+		t.Errorf("initial line: %q", lastLine(out))
+	}
+
+	crawled, checked = 50, 80
+	fake.Advance(5 * time.Second)
+	bar.Render()
+	if lastLine(out) != "crawled 50 books in 80 checks, 10.0 books/s, 5s elapsed" {
+		t.Errorf("rate since the start: %q", lastLine(out))
+	}
+
+	// the rate only looks at the last seconds, in which the crawl slowed down
+	for i := 0; i < 6; i++ {
+		crawled += 2
+		fake.Advance(5 * time.Second)
+		bar.Render()
+	}
+	if lastLine(out) != "crawled 62 books in 80 checks, 0.4 books/s, 35s elapsed" {
+		t.Errorf("rate over the last seconds: %q", lastLine(out))
+	}
+
+	fmt.Fprintf(bar, "INFO  crawled book\n")
+	written := out.String()
+	if !strings.HasSuffix(written, clearLine+"INFO  crawled book\ncrawled 62 books in 80 checks, 0.4 books/s, 35s elapsed") {
+		t.Errorf("writes printed above the bar: %q", written[len(written)-80:])
+	}
+
+	bar.Stop()
+	if !strings.HasSuffix(out.String(), "\n") {
+		t.Errorf("stopped bar left on a line of its own")
+	}
+	out.Reset()
+	fmt.Fprintf(bar, "INFO  done\n")
+	if out.String() != "INFO  done\n" {
+		t.Errorf("writes after stopping go straight through: %q", out.String())
+	}
+
+	// with a max, a bar and the time left
+	crawled = 0
+	out.Reset()
+	bounded := progress.NewBar(out, counts)
+	bounded.Clock = fake
+	bounded.Max = 100
+	bounded.Render()
+	crawled = 25
+	fake.Advance(5 * time.Second)
+	bounded.Render()
+	expected := "[=======>                      ] 25/100 books in 80 checks, 5.0 books/s, 15s left"
+	if lastLine(out) != expected {
+		t.Errorf("bar and time left: %q", lastLine(out))
+	}
+	crawled = 100
+	fake.Advance(5 * time.Second)
+	bounded.Render()
+	if !(strings.HasPrefix(lastLine(out), "[==============================] 100/100") && strings.HasSuffix(lastLine(out), ", done")) {
+		t.Errorf("full bar: %q", lastLine(out))
+	}
+
+	// started bars redraw on their own
+	out.Reset()
+	ticking := progress.NewBar(out, counts)
+	ticking.Start(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	ticking.Stop()
+	redraws := strings.Count(out.String(), clearLine)
+	if redraws <= 2 {
+		t.Errorf("started bar redrawn periodically (%d times)", redraws)
+	}
+
+	// crawler counts, without progress logs
+	ctx := context.Background()
+	server := fixture.NewServer(100, 3)
+	defer server.Close()
+	c := crawler.NewCrawler(crawler.WithMaxDepth(3), crawler.WithMaxReadAlso(3), crawler.WithProgressLogs(false))
+	if err := c.Crawl(ctx, server.BookURL(1)); err != nil {
+		t.Fatal(err)
+	}
+	books := 0
+	c.Storage.GetAllBooks(ctx, func(*book.Book) error {
+		books++
+		return nil
+	})
+	crawledBooks, checkedBooks := c.Counts()
+	if !(int(crawledBooks) == books && checkedBooks >= crawledBooks) {
+		t.Errorf("crawler counts: %d crawled, %d checked, %d books", crawledBooks, checkedBooks, books)
+	}
+
+}
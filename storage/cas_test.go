@@ -0,0 +1,90 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/bcap/book-crawler/storage"
+)
+
+// TestSetBookStateCAS checks the compare and swap of Storage.SetBookState,
+// which the whole crawl coordination relies on: when many goroutines race to
+// transition the same book from the same previous state, exactly one of them
+// must succeed
+func TestSetBookStateCAS(t *testing.T) {
+	const goroutines = 64
+	const rounds = 50
+
+	forEachBackend(t, func(t *testing.T, s storage.Storage, prefix string) {
+		ctx := context.Background()
+		transitions := []struct {
+			from storage.State
+			to   storage.State
+		}{
+			{storage.NotCrawled, storage.BeingCrawled},
+			{storage.BeingCrawled, storage.Crawled},
+			{storage.Crawled, storage.Linked},
+			{storage.Linked, storage.Linked},
+		}
+		for _, transition := range transitions {
+			wrong := 0
+			for round := 0; round < rounds; round++ {
+				url := fmt.Sprintf("%s/book/%d", prefix, round)
+				succeeded, err := race(ctx, s, url, goroutines, transition.from, transition.to)
+				if err != nil {
+					t.Fatalf("transition from %v to %v: %v", transition.from, transition.to, err)
+				}
+				if succeeded != 1 {
+					wrong++
+				}
+			}
+			if wrong > 0 {
+				t.Errorf(
+					"not exactly one of %d goroutines transitioned a book from %v to %v in %d/%d rounds",
+					goroutines, transition.from, transition.to, wrong, rounds,
+				)
+			}
+		}
+	})
+}
+
+// race makes goroutines read the state of url and then try to swap it to the
+// same new state at the same time. Returns how many of them succeeded. The
+// book is expected to be in the from state beforehand, and ends in the to
+// state
+func race(ctx context.Context, s storage.Storage, url string, goroutines int, from storage.State, to storage.State) (int, error) {
+	previous, err := s.GetBookState(ctx, url)
+	if err != nil {
+		return 0, err
+	}
+	if previous.State != from {
+		return 0, fmt.Errorf("book %s is in state %v, expected %v", url, previous.State, from)
+	}
+
+	var succeeded int
+	var firstErr error
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, set, err := s.SetBookState(ctx, url, previous, to)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if set {
+				succeeded++
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return succeeded, firstErr
+}
@@ -0,0 +1,78 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/storage"
+)
+
+// TestDeleteBook checks that deleting a book removes it, its state and its
+// edges in both directions, leaving the books it was linked to in place, and
+// that deleting it again or deleting a book never seen fails with
+// ErrBookNotFound
+func TestDeleteBook(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s storage.Storage, prefix string) {
+		ctx := context.Background()
+		books := make([]*book.Book, 3)
+		for i := range books {
+			b := book.New(fmt.Sprintf("%s/book/%d", prefix, i))
+			b.Title = fmt.Sprintf("test title %d", i)
+			b.Author = "test author"
+			b.AuthorURL = prefix + "/author"
+			b.Genres = []string{"test genre"}
+			books[i] = b
+			if _, _, err := s.SetBookState(ctx, b.URL, storage.StateChange{}, storage.Crawled); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetBook(ctx, b.URL, b); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// a -> b -> c
+		if err := s.LinkBook(ctx, books[0].URL, books[1].URL, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.LinkBook(ctx, books[1].URL, books[2].URL, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.DeleteBook(ctx, books[1].URL); err != nil {
+			t.Fatalf("deleting a book: %v", err)
+		}
+		deleted, err := s.GetBook(ctx, books[1].URL, 1)
+		if err != nil || deleted != nil {
+			t.Errorf("deleted book still stored: %+v %v", deleted, err)
+		}
+		state, err := s.GetBookState(ctx, books[1].URL)
+		if err != nil || state.State != storage.NotCrawled {
+			t.Errorf("deleted book left in state %v: %v", state.State, err)
+		}
+		for _, kept := range []*book.Book{books[0], books[2]} {
+			b, err := s.GetBook(ctx, kept.URL, 1)
+			if err != nil || b == nil {
+				t.Errorf("book %s linked to the deleted one not kept: %v", kept.URL, err)
+				continue
+			}
+			if len(b.AlsoRead) != 0 {
+				t.Errorf("book %s still linked to %d books", kept.URL, len(b.AlsoRead))
+			}
+			if b.Author != "test author" {
+				t.Errorf("author of book %s deleted along with another of their books", kept.URL)
+			}
+		}
+
+		var notFound storage.ErrBookNotFound
+		err = s.DeleteBook(ctx, books[1].URL)
+		if !errors.As(err, &notFound) || notFound.URL != books[1].URL {
+			t.Errorf("deleting a book twice: %v", err)
+		}
+		err = s.DeleteBook(ctx, prefix+"/book/never-seen")
+		if !errors.As(err, &notFound) {
+			t.Errorf("deleting a book never seen: %v", err)
+		}
+	})
+}
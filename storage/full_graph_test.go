@@ -0,0 +1,57 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/storage"
+)
+
+// TestGetFullGraphCycle checks GetFullGraph roots a component that is only a
+// cycle at its book with the smallest url, so the whole graph is walked, on
+// the backends loading the full graph at once
+func TestGetFullGraphCycle(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s storage.Storage, prefix string) {
+		full, ok := s.(interface {
+			GetFullGraph(ctx context.Context) (book.Graph, error)
+		})
+		if !ok {
+			t.Skip("no GetFullGraph")
+		}
+		ctx := context.Background()
+		urls := []string{prefix + "/book/c", prefix + "/book/a", prefix + "/book/b"}
+		for _, url := range urls {
+			b := book.New(url)
+			b.Title = url
+			if err := s.SetBook(ctx, url, b); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for idx, url := range urls {
+			if err := s.LinkBook(ctx, url, urls[(idx+1)%len(urls)], 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		graph, err := full.GetFullGraph(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var root *book.Book
+		for _, b := range graph.Roots {
+			if b.URL == urls[1] {
+				root = b
+			}
+			if b.URL == urls[0] || b.URL == urls[2] {
+				t.Errorf("one root for the cycle, got %s too", b.URL)
+			}
+		}
+		if root == nil {
+			t.Fatalf("cycle rooted at its smallest url %s", urls[1])
+		}
+		if reached := book.Collect(root); len(reached) != len(urls) {
+			t.Errorf("whole cycle reached from its root (%d books)", len(reached))
+		}
+	})
+}
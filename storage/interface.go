@@ -15,6 +15,17 @@ const (
 	BeingCrawled State = 1
 	Crawled      State = 2
 	Linked       State = 3
+	Filtered     State = 4
+	// Skipped books could not be fetched for a reason that retrying will not
+	// fix, like a deleted book
+	Skipped State = 5
+	// Merged books redirect to another book or are editions of a work already
+	// crawled under another url
+	Merged State = 6
+	// Failed books could not be fetched even after retrying, like when the
+	// site kept erroring. Unlike skipped books they are crawled again by later
+	// runs
+	Failed State = 7
 )
 
 type StateChange struct {
@@ -34,11 +45,28 @@ type Storage interface {
 
 	// State manipulation is a CAS operation (Compare And Swap)
 	GetBookState(ctx context.Context, url url) (StateChange, error)
+	// GetBookStates is GetBookState for many books in a single round trip.
+	// Books never seen are returned with the zero StateChange
+	GetBookStates(ctx context.Context, urls []url) (map[url]StateChange, error)
 	SetBookState(ctx context.Context, url url, previous StateChange, new State) (StateChange, bool, error)
 
 	GetBook(ctx context.Context, url url, maxDepth int) (*book.Book, error)
+	// GetAllBooks calls fn once for every persisted book, in url order,
+	// stopping at the first error. Related books in the AlsoRead edges may
+	// only have their URL set
+	GetAllBooks(ctx context.Context, fn func(*book.Book) error) error
 	SetBook(ctx context.Context, url url, book *book.Book) error
+	// LinkBook returns an error wrapping ErrBookNotFound when either of the
+	// books was not persisted with SetBook
 	LinkBook(ctx context.Context, url url, related url, priority int) error
+	// LinkBookWithSource is like LinkBook, but tags the edge with the kind of
+	// recommendation that originated it (eg book.SourceSimilarAuthor).
+	// LinkBook uses book.SourceAlsoRead
+	LinkBookWithSource(ctx context.Context, url url, related url, priority int, source string) error
+	// DeleteBook removes a book, its state and its edges in both directions,
+	// so a later crawl fetches it again. Returns an error wrapping
+	// ErrBookNotFound when the book is not stored
+	DeleteBook(ctx context.Context, url url) error
 }
 
 type ErrBookNotFound struct {
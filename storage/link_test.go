@@ -0,0 +1,53 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/storage"
+)
+
+// TestLinkBookNotFound checks LinkBook fails with ErrBookNotFound for the
+// missing book when either end of the edge was not persisted, including books
+// that only had their state set, and links nothing
+func TestLinkBookNotFound(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s storage.Storage, prefix string) {
+		ctx := context.Background()
+		persisted := book.New(prefix + "/book/persisted")
+		persisted.Title = "persisted"
+		if err := s.SetBook(ctx, persisted.URL, persisted); err != nil {
+			t.Fatal(err)
+		}
+		stateOnly := prefix + "/book/state-only"
+		if _, _, err := s.SetBookState(ctx, stateOnly, storage.StateChange{}, storage.Filtered); err != nil {
+			t.Fatal(err)
+		}
+		never := prefix + "/book/never-seen"
+
+		links := []struct {
+			from, to, missing string
+		}{
+			{persisted.URL, stateOnly, stateOnly},
+			{persisted.URL, never, never},
+			{stateOnly, persisted.URL, stateOnly},
+			{never, persisted.URL, never},
+		}
+		for _, link := range links {
+			err := s.LinkBook(ctx, link.from, link.to, 0)
+			var notFound storage.ErrBookNotFound
+			if !errors.As(err, &notFound) || notFound.URL != link.missing {
+				t.Errorf("linking %s to %s: expected ErrBookNotFound for %s, got %v", link.from, link.to, link.missing, err)
+			}
+		}
+
+		b, err := s.GetBook(ctx, persisted.URL, 1)
+		if err != nil || b == nil {
+			t.Fatalf("persisted book not stored: %v", err)
+		}
+		if len(b.AlsoRead) != 0 {
+			t.Errorf("failed links stored: %+v", b.AlsoRead)
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+)
+
+const (
+	opState  = "state"
+	opBook   = "book"
+	opLink   = "link"
+	opDelete = "delete"
+)
+
+// logEntry is a single storage operation, written as one json line
+type logEntry struct {
+	Op       string        `json:"op"`
+	URL      string        `json:"url"`
+	State    storage.State `json:"state,omitempty"`
+	When     time.Time     `json:"when,omitempty"`
+	Book     *book.Book    `json:"book,omitempty"`
+	Related  string        `json:"related,omitempty"`
+	Priority int           `json:"priority,omitempty"`
+	Source   string        `json:"source,omitempty"`
+}
+
+// opLog is an append-only file of the operations done on the storage
+type opLog struct {
+	file    *os.File
+	encoder *json.Encoder
+	mutex   sync.Mutex
+}
+
+func openLog(path string) (*opLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage log: %w", err)
+	}
+	return &opLog{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (l *opLog) write(entry logEntry) error {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err := l.encoder.Encode(entry); err != nil {
+		return fmt.Errorf("failed to write to storage log: %w", err)
+	}
+	return nil
+}
+
+func (l *opLog) close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+func bookEntry(b *book.Book) logEntry {
+	// edges are logged as links
+	withoutEdges := *b
+	withoutEdges.AlsoRead = nil
+	return logEntry{Op: opBook, URL: b.URL, Book: &withoutEdges}
+}
+
+// replayLog rebuilds the storage from a log written by a previous run. Books
+// that were being crawled when that run stopped are crawled again
+func (s *Storage) replayLog(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open storage log: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	decoder := json.NewDecoder(reader)
+	entries := 0
+	for {
+		var entry logEntry
+		err := decoder.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// a crash can leave a partially written last line behind
+			log.Warnf("stopped replaying storage log %s after %d entries: %v", path, entries, err)
+			break
+		}
+		entries++
+
+		switch entry.Op {
+		case opState:
+			s.state[entry.URL] = storage.StateChange{When: entry.When, State: entry.State}
+			if b := s.books[entry.URL]; b != nil {
+				b.CrawledAt = entry.When
+			}
+		case opBook:
+			if entry.Book.AlsoRead == nil {
+				entry.Book.AlsoRead = []book.Edge{}
+			}
+			entry.Book.CrawledAt = s.state[entry.URL].When
+			s.books[entry.URL] = entry.Book
+		case opLink:
+			if err := s.linkBook(entry.URL, entry.Related, entry.Priority, entry.Source); err != nil {
+				log.Warnf("failed to replay link from %s to %s: %v", entry.URL, entry.Related, err)
+			}
+		case opDelete:
+			s.deleteBook(entry.URL)
+		default:
+			return fmt.Errorf("unknown operation %q in storage log %s", entry.Op, path)
+		}
+	}
+
+	for url, state := range s.state {
+		if state.State == storage.BeingCrawled {
+			delete(s.state, url)
+		}
+	}
+	log.Infof("replayed %d storage log entries from %s", entries, path)
+	return nil
+}
+
+// compactLog rewrites the log with only what is needed to rebuild the current
+// storage. The new log is written to a temporary file first, so a crash while
+// compacting keeps the previous log
+func (s *Storage) compactLog(path string) error {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to compact storage log: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	encode := func() error {
+		urls := make([]string, 0, len(s.state))
+		for url := range s.state {
+			urls = append(urls, url)
+		}
+		sort.Strings(urls)
+		for _, url := range urls {
+			state := s.state[url]
+			if err := encoder.Encode(logEntry{Op: opState, URL: url, State: state.State, When: state.When}); err != nil {
+				return err
+			}
+		}
+
+		books := make([]*book.Book, 0, len(s.books))
+		for _, b := range s.books {
+			books = append(books, b)
+		}
+		sort.Slice(books, func(i, j int) bool { return books[i].URL < books[j].URL })
+		for _, b := range books {
+			if err := encoder.Encode(bookEntry(b)); err != nil {
+				return err
+			}
+		}
+		for _, b := range books {
+			for _, edge := range b.AlsoRead {
+				entry := logEntry{Op: opLink, URL: b.URL, Related: edge.To.URL, Priority: edge.Priority, Source: edge.Source}
+				if err := encoder.Encode(entry); err != nil {
+					return err
+				}
+			}
+		}
+		return writer.Flush()
+	}
+	if err := encode(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to compact storage log: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to compact storage log: %w", err)
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -12,6 +12,13 @@ import (
 )
 
 type Storage struct {
+	// LogPath, when set, is a file where every change is appended as it
+	// happens. The log is replayed on Initialize, so a crawl can resume after
+	// a crash or a restart, and compacted on Shutdown
+	LogPath string
+
+	log *opLog
+
 	books      map[string]*book.Book
 	booksMutex sync.RWMutex
 
@@ -20,15 +27,44 @@ type Storage struct {
 }
 
 func (s *Storage) Initialize(context.Context) error {
+	s.booksMutex.Lock()
+	defer s.booksMutex.Unlock()
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+
 	s.books = make(map[string]*book.Book)
 	s.state = make(map[string]storage.StateChange)
+	if s.LogPath == "" {
+		return nil
+	}
+	if err := s.replayLog(s.LogPath); err != nil {
+		return err
+	}
+	log, err := openLog(s.LogPath)
+	if err != nil {
+		return err
+	}
+	s.log = log
 	return nil
 }
 
 func (s *Storage) Shutdown(ctx context.Context) error {
+	s.booksMutex.Lock()
+	defer s.booksMutex.Unlock()
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+
+	var err error
+	if s.log != nil {
+		err = s.log.close()
+		if err == nil {
+			err = s.compactLog(s.LogPath)
+		}
+		s.log = nil
+	}
 	s.books = nil
 	s.state = nil
-	return nil
+	return err
 }
 
 func (s *Storage) GetBookState(ctx context.Context, url string) (storage.StateChange, error) {
@@ -38,7 +74,34 @@ func (s *Storage) GetBookState(ctx context.Context, url string) (storage.StateCh
 	return s.state[url], nil
 }
 
+func (s *Storage) GetBookStates(ctx context.Context, urls []string) (map[string]storage.StateChange, error) {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+
+	states := make(map[string]storage.StateChange, len(urls))
+	for _, url := range urls {
+		states[url] = s.state[url]
+	}
+	return states, nil
+}
+
 func (s *Storage) SetBookState(ctx context.Context, url string, previous storage.StateChange, new storage.State) (storage.StateChange, bool, error) {
+	stateChange, set, err := s.setBookState(url, previous, new)
+	if err != nil || !set {
+		return stateChange, set, err
+	}
+
+	// books are always locked before states, so this cannot happen while
+	// holding the state lock
+	s.booksMutex.Lock()
+	if b := s.books[url]; b != nil {
+		b.CrawledAt = stateChange.When
+	}
+	s.booksMutex.Unlock()
+	return stateChange, true, nil
+}
+
+func (s *Storage) setBookState(url string, previous storage.StateChange, new storage.State) (storage.StateChange, bool, error) {
 	s.stateMutex.Lock()
 	defer s.stateMutex.Unlock()
 
@@ -52,6 +115,9 @@ func (s *Storage) SetBookState(ctx context.Context, url string, previous storage
 		When:  time.Now(),
 		State: new,
 	}
+	if err := s.log.write(logEntry{Op: opState, URL: url, State: new, When: newSC.When}); err != nil {
+		return storage.StateChange{}, false, err
+	}
 	s.state[url] = newSC
 	return newSC, true, nil
 }
@@ -63,18 +129,55 @@ func (s *Storage) GetBook(ctx context.Context, url string, _ int) (*book.Book, e
 	return s.books[url], nil
 }
 
+func (s *Storage) GetAllBooks(ctx context.Context, fn func(*book.Book) error) error {
+	s.booksMutex.RLock()
+	books := make([]*book.Book, 0, len(s.books))
+	for _, b := range s.books {
+		books = append(books, b)
+	}
+	s.booksMutex.RUnlock()
+
+	sort.Slice(books, func(i, j int) bool { return books[i].URL < books[j].URL })
+	for _, b := range books {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *Storage) SetBook(ctx context.Context, url string, book *book.Book) error {
 	s.booksMutex.Lock()
 	defer s.booksMutex.Unlock()
 
+	if err := s.log.write(bookEntry(book)); err != nil {
+		return err
+	}
+	s.stateMutex.RLock()
+	book.CrawledAt = s.state[url].When
+	s.stateMutex.RUnlock()
 	s.books[url] = book
 	return nil
 }
 
 func (s *Storage) LinkBook(ctx context.Context, url string, relatedURL string, priority int) error {
+	return s.LinkBookWithSource(ctx, url, relatedURL, priority, book.SourceAlsoRead)
+}
+
+func (s *Storage) LinkBookWithSource(ctx context.Context, url string, relatedURL string, priority int, source string) error {
 	s.booksMutex.Lock()
 	defer s.booksMutex.Unlock()
 
+	if err := s.linkBook(url, relatedURL, priority, source); err != nil {
+		return err
+	}
+	return s.log.write(logEntry{Op: opLink, URL: url, Related: relatedURL, Priority: priority, Source: source})
+}
+
+func (s *Storage) linkBook(url string, relatedURL string, priority int, source string) error {
 	b := s.books[url]
 	if b == nil {
 		return fmt.Errorf("cannot link books: %w", storage.ErrBookNotFound{URL: url})
@@ -82,18 +185,62 @@ func (s *Storage) LinkBook(ctx context.Context, url string, relatedURL string, p
 
 	related := s.books[relatedURL]
 	if related == nil {
-		return nil
+		return fmt.Errorf("cannot link books: %w", storage.ErrBookNotFound{URL: relatedURL})
 	}
 
-	edge := book.Edge{From: b, To: related, Priority: priority}
-	b.AlsoRead = append(b.AlsoRead, edge)
-	lessFn := func(i, j int) bool {
-		return b.AlsoRead[i].Priority < b.AlsoRead[j].Priority
+	// keep AlsoRead ordered by priority by inserting the edge in place,
+	// instead of sorting the whole slice on every call
+	pos := sort.Search(len(b.AlsoRead), func(i int) bool {
+		return b.AlsoRead[i].Priority > priority
+	})
+	for i := pos - 1; i >= 0 && b.AlsoRead[i].Priority == priority; i-- {
+		if b.AlsoRead[i].To == related && b.AlsoRead[i].Source == source {
+			return nil
+		}
 	}
-	sort.Slice(b.AlsoRead, lessFn)
+	edge := book.Edge{From: b, To: related, Priority: priority, Source: source}
+	b.AlsoRead = append(b.AlsoRead, book.Edge{})
+	copy(b.AlsoRead[pos+1:], b.AlsoRead[pos:])
+	b.AlsoRead[pos] = edge
 
 	return nil
 }
 
+func (s *Storage) DeleteBook(ctx context.Context, url string) error {
+	s.booksMutex.Lock()
+	defer s.booksMutex.Unlock()
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+
+	if !s.deleteBook(url) {
+		return fmt.Errorf("cannot delete book: %w", storage.ErrBookNotFound{URL: url})
+	}
+	return s.log.write(logEntry{Op: opDelete, URL: url})
+}
+
+func (s *Storage) deleteBook(url string) bool {
+	b, hasBook := s.books[url]
+	_, hasState := s.state[url]
+	if !hasBook && !hasState {
+		return false
+	}
+	delete(s.books, url)
+	delete(s.state, url)
+
+	if b == nil {
+		return true
+	}
+	for _, other := range s.books {
+		alsoRead := other.AlsoRead[:0]
+		for _, edge := range other.AlsoRead {
+			if edge.To != b {
+				alsoRead = append(alsoRead, edge)
+			}
+		}
+		other.AlsoRead = alsoRead
+	}
+	return true
+}
+
 // Making sure Storage implements Storage
 var _ storage.Storage = &Storage{}
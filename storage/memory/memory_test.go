@@ -0,0 +1,142 @@
+package memory_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/storage/memory"
+)
+
+const numRelated = 1000
+
+type order struct {
+	name       string
+	priorities []int
+}
+
+// orders are the ways n related books can be linked to a single book
+func orders(n int) []order {
+	return []order{
+		{"ascending", ascending(n)},
+		{"descending", descending(n)},
+		{"random", rand.New(rand.NewSource(0)).Perm(n)},
+	}
+}
+
+func ascending(n int) []int {
+	priorities := make([]int, n)
+	for i := range priorities {
+		priorities[i] = i
+	}
+	return priorities
+}
+
+func descending(n int) []int {
+	priorities := make([]int, n)
+	for i := range priorities {
+		priorities[i] = n - 1 - i
+	}
+	return priorities
+}
+
+// setup stores a root book and a related book for each priority, returning the
+// root
+func setup(ctx context.Context, s *memory.Storage, priorities []int) *book.Book {
+	s.Initialize(ctx)
+	root := book.New("http://root")
+	s.SetBook(ctx, root.URL, root)
+	for _, priority := range priorities {
+		related := book.New(fmt.Sprintf("http://related/%d", priority))
+		s.SetBook(ctx, related.URL, related)
+	}
+	return root
+}
+
+func link(ctx context.Context, s *memory.Storage, root *book.Book, priorities []int) error {
+	for _, priority := range priorities {
+		if err := s.LinkBook(ctx, root.URL, fmt.Sprintf("http://related/%d", priority), priority); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestLinkBookOrder checks the related books of a book end up ordered by
+// priority no matter the order they were linked in
+func TestLinkBookOrder(t *testing.T) {
+	ctx := context.Background()
+	for _, order := range orders(numRelated) {
+		s := &memory.Storage{}
+		root := setup(ctx, s, order.priorities)
+		if err := link(ctx, s, root, order.priorities); err != nil {
+			t.Fatal(err)
+		}
+		if len(root.AlsoRead) != numRelated {
+			t.Errorf("%s: linked %d of %d books", order.name, len(root.AlsoRead), numRelated)
+			continue
+		}
+		for idx, edge := range root.AlsoRead {
+			if edge.Priority != idx || edge.To.URL != fmt.Sprintf("http://related/%d", idx) {
+				t.Errorf("%s: book %s with priority %d at position %d", order.name, edge.To.URL, edge.Priority, idx)
+				break
+			}
+		}
+	}
+}
+
+// BenchmarkLinkBook measures how long the memory storage takes to link
+// thousands of related books to a single book
+func BenchmarkLinkBook(b *testing.B) {
+	ctx := context.Background()
+	for _, n := range []int{1000, 10000} {
+		for _, order := range orders(n) {
+			b.Run(fmt.Sprintf("%s-%d", order.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					s := &memory.Storage{}
+					root := setup(ctx, s, order.priorities)
+					b.StartTimer()
+					if err := link(ctx, s, root, order.priorities); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestDeleteBookLog checks deleting a book is written to the storage log, so
+// it stays deleted once the log is replayed
+func TestDeleteBookLog(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "books.log")
+
+	s := &memory.Storage{LogPath: path}
+	root := setup(ctx, s, []int{0, 1})
+	if err := link(ctx, s, root, []int{0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteBook(ctx, "http://related/0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := &memory.Storage{LogPath: path}
+	if err := replayed.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer replayed.Shutdown(ctx)
+	if b, _ := replayed.GetBook(ctx, "http://related/0", 0); b != nil {
+		t.Errorf("deleted book replayed")
+	}
+	root, _ = replayed.GetBook(ctx, root.URL, 0)
+	if root == nil || len(root.AlsoRead) != 1 || root.AlsoRead[0].To.URL != "http://related/1" {
+		t.Errorf("edges to the deleted book replayed: %+v", root)
+	}
+}
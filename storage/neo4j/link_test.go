@@ -0,0 +1,39 @@
+package neo4j_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bcap/book-crawler/book"
+)
+
+// TestLinkBookRelink checks that linking the same books again with another
+// priority and source updates their edge instead of adding another one
+func TestLinkBookRelink(t *testing.T) {
+	s := newStorage(t)
+	ctx := context.Background()
+
+	from, to := benchmarkBook(-1), benchmarkBook(-2)
+	for _, b := range []*book.Book{from, to} {
+		if err := s.SetBook(ctx, b.URL, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.LinkBookWithSource(ctx, from.URL, to.URL, 3, book.SourceAlsoRead); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LinkBookWithSource(ctx, from.URL, to.URL, 1, book.SourceReadersAlsoEnjoyed); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := s.GetBook(ctx, from.URL, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.AlsoRead) != 1 {
+		t.Fatalf("books linked once (%d edges)", len(b.AlsoRead))
+	}
+	if edge := b.AlsoRead[0]; !(edge.Priority == 1 && edge.Source == book.SourceReadersAlsoEnjoyed) {
+		t.Errorf("edge updated by the last link (priority %d, source %s)", edge.Priority, edge.Source)
+	}
+}
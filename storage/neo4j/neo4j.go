@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"sort"
 	"time"
 
 	"github.com/bcap/book-crawler/book"
@@ -21,6 +22,8 @@ var initStatements = []string{
 	"CREATE CONSTRAINT IF NOT EXISTS FOR (b:Book) REQUIRE (b.url) IS UNIQUE",
 	"CREATE CONSTRAINT IF NOT EXISTS FOR (p:Person) REQUIRE (p.url) IS UNIQUE",
 	"CREATE CONSTRAINT IF NOT EXISTS FOR (g:Genre) REQUIRE (g.name) IS UNIQUE",
+	"CREATE CONSTRAINT IF NOT EXISTS FOR (w:Award) REQUIRE (w.name) IS UNIQUE",
+	"CREATE CONSTRAINT IF NOT EXISTS FOR (h:Shelf) REQUIRE (h.name) IS UNIQUE",
 	"CREATE INDEX IF NOT EXISTS FOR (b:Book) ON (b.title)",
 }
 
@@ -30,7 +33,12 @@ type Storage struct {
 	Password    string
 	BearerToken string
 
-	driver neo4j.DriverWithContext
+	// SessionPoolSize controls how many sessions are kept open and shared
+	// between operations. Defaults to DefaultSessionPoolSize
+	SessionPoolSize int
+
+	driver   neo4j.DriverWithContext
+	sessions *sessionPool
 }
 
 func New(url string) *Storage {
@@ -53,11 +61,15 @@ func (s *Storage) Initialize(ctx context.Context) error {
 		return fmt.Errorf("failed to create neo4j driver: %w", err)
 	}
 	s.driver = driver
+	s.sessions = newSessionPool(ctx, driver, s.SessionPoolSize)
 
 	return s.runInitStatements(ctx)
 }
 
 func (s *Storage) Shutdown(ctx context.Context) error {
+	if err := s.sessions.close(ctx); err != nil {
+		log.Warnf("failed to close neo4j sessions: %v", err)
+	}
 	return s.driver.Close(ctx)
 }
 
@@ -78,7 +90,33 @@ func (s *Storage) GetBookState(ctx context.Context, url string) (storage.StateCh
 		}
 		return storage.StateChange{}, nil
 	}
-	return execute(ctx, s.driver, true, work)
+	return execute(ctx, s.sessions, true, work)
+}
+
+func (s *Storage) GetBookStates(ctx context.Context, urls []string) (map[string]storage.StateChange, error) {
+	work := func(tx managedTransaction) (map[string]storage.StateChange, error) {
+		states := make(map[string]storage.StateChange, len(urls))
+		for _, url := range urls {
+			states[url] = storage.StateChange{}
+		}
+		query := "" +
+			"UNWIND $urls AS url " +
+			"MATCH (b:Book {url: url}) WHERE b.crawlState IS NOT NULL " +
+			"RETURN url, b.crawlState, b.crawlStateChanged"
+		records, err := tx.Run(ctx, query, map[string]any{"urls": urls})
+		if err != nil {
+			return nil, NewErrQuery(query, err)
+		}
+		for records.Next(ctx) {
+			values := records.Record().Values
+			states[values[0].(string)] = storage.StateChange{
+				When:  values[2].(time.Time),
+				State: storage.State(values[1].(int64)),
+			}
+		}
+		return states, records.Err()
+	}
+	return execute(ctx, s.sessions, true, work)
 }
 
 func (s *Storage) SetBookState(ctx context.Context, url string, previous storage.StateChange, new storage.State) (storage.StateChange, bool, error) {
@@ -133,7 +171,7 @@ func (s *Storage) SetBookState(ctx context.Context, url string, previous storage
 			When:  when,
 		}, nil
 	}
-	result, err := execute(ctx, s.driver, true, work)
+	result, err := execute(ctx, s.sessions, true, work)
 	if err != nil {
 		return storage.StateChange{}, false, err
 	}
@@ -148,10 +186,11 @@ func (s *Storage) GetBook(ctx context.Context, url string, maxDepth int) (*book.
 		query := fmt.Sprintf(""+
 			"MATCH (b1:Book {url: $url}) "+
 			"MATCH (b2:Book) "+
-			"MATCH (p1:Person)-[:AUTHORED]->(b1) "+
-			"MATCH (p2:Person)-[:AUTHORED]->(b2) "+
+			"MATCH (p1:Person)-[a1:AUTHORED]->(b1) WHERE a1.fromAuthorPage IS NULL "+
+			"MATCH (p2:Person)-[a2:AUTHORED]->(b2) WHERE a2.fromAuthorPage IS NULL "+
 			"MATCH (b1)-[r:ALSO_READ*0..%d]->(b2) "+
-			"RETURN b2, p2, r ",
+			"RETURN b2, p2, r, [(b2)-[:WON]->(w:Award) | w.name], "+
+			"  [(b2)-[s:SHELVED_AS]->(h:Shelf) | [h.name, s.count]] ",
 			maxDepth,
 		)
 
@@ -165,13 +204,6 @@ func (s *Storage) GetBook(ctx context.Context, url string, maxDepth int) (*book.
 
 		idMap := map[string]*book.Book{}
 
-		value := func(node *dbtype.Node, key string, defaultValue any) any {
-			if v, has := node.Props[key]; has {
-				return v
-			}
-			return defaultValue
-		}
-
 		var rootBook *book.Book
 
 		for {
@@ -181,24 +213,9 @@ func (s *Storage) GetBook(ctx context.Context, url string, maxDepth int) (*book.
 			relationships := values[2].([]interface{})
 
 			if _, has := idMap[bookNode.ElementId]; !has {
-				b := &book.Book{
-					Title:        value(&bookNode, "title", "").(string),
-					Rating:       int32(value(&bookNode, "rating", int64(0)).(int64)),
-					RatingsTotal: int32(value(&bookNode, "ratings", int64(0)).(int64)),
-					Ratings1:     int32(value(&bookNode, "ratings1", int64(0)).(int64)),
-					Ratings2:     int32(value(&bookNode, "ratings2", int64(0)).(int64)),
-					Ratings3:     int32(value(&bookNode, "ratings3", int64(0)).(int64)),
-					Ratings4:     int32(value(&bookNode, "ratings4", int64(0)).(int64)),
-					Ratings5:     int32(value(&bookNode, "ratings5", int64(0)).(int64)),
-					Reviews:      int32(value(&bookNode, "reviews", int64(0)).(int64)),
-					Pages:        int32(value(&bookNode, "pages", int64(0)).(int64)),
-					URL:          value(&bookNode, "url", "").(string),
-					Author:       value(&authorNode, "name", "").(string),
-					AuthorURL:    value(&authorNode, "url", "").(string),
-					Genres:       []string{},
-					AlsoRead:     []book.Edge{},
-				}
-				idMap[bookNode.ElementId] = b
+				idMap[bookNode.ElementId] = newBook(&bookNode, &authorNode)
+				idMap[bookNode.ElementId].Awards = awardNames(values[3])
+				idMap[bookNode.ElementId].Shelves = shelfCounts(values[4])
 			}
 
 			if len(relationships) == 0 {
@@ -216,6 +233,7 @@ func (s *Storage) GetBook(ctx context.Context, url string, maxDepth int) (*book.
 					From:     from,
 					To:       to,
 					Priority: priority,
+					Source:   edgeSource(lastRelationship.Props["source"]),
 				})
 			}
 
@@ -226,11 +244,222 @@ func (s *Storage) GetBook(ctx context.Context, url string, maxDepth int) (*book.
 
 		return rootBook, nil
 	}
-	return execute(ctx, s.driver, false, func(tx managedTransaction) (*book.Book, error) {
+	return execute(ctx, s.sessions, false, func(tx managedTransaction) (*book.Book, error) {
 		return work(tx, url, 0)
 	})
 }
 
+func (s *Storage) GetAllBooks(ctx context.Context, fn func(*book.Book) error) error {
+	work := func(tx managedTransaction) (struct{}, error) {
+		// books that only had their state set are not considered persisted
+		query := "" +
+			"MATCH (b:Book) WHERE b.title IS NOT NULL " +
+			"OPTIONAL MATCH (p:Person)-[a:AUTHORED]->(b) WHERE a.fromAuthorPage IS NULL " +
+			"RETURN b, p, " +
+			"  [(b)-[r:ALSO_READ]->(o:Book) | [o.url, r.priority, r.source]], " +
+			"  [(b)-[:WON]->(w:Award) | w.name], " +
+			"  [(b)-[s:SHELVED_AS]->(h:Shelf) | [h.name, s.count]] " +
+			"ORDER BY b.url "
+		records, err := tx.Run(ctx, query, nil)
+		if err != nil {
+			return struct{}{}, NewErrQuery(query, err)
+		}
+		for records.Next(ctx) {
+			values := records.Record().Values
+			bookNode := values[0].(dbtype.Node)
+			var authorNode dbtype.Node
+			if values[1] != nil {
+				authorNode = values[1].(dbtype.Node)
+			}
+			b := newBook(&bookNode, &authorNode)
+			b.Awards = awardNames(values[3])
+			b.Shelves = shelfCounts(values[4])
+			for _, relatedIntf := range values[2].([]any) {
+				related := relatedIntf.([]any)
+				priority := 0
+				if related[1] != nil {
+					priority = int(related[1].(int64))
+				}
+				b.AlsoRead = append(b.AlsoRead, book.Edge{
+					From:     b,
+					To:       &book.Book{URL: related[0].(string)},
+					Priority: priority,
+					Source:   edgeSource(related[2]),
+				})
+			}
+			sort.SliceStable(b.AlsoRead, func(i, j int) bool {
+				return b.AlsoRead[i].Priority < b.AlsoRead[j].Priority
+			})
+			if err := fn(b); err != nil {
+				return struct{}{}, err
+			}
+		}
+		return struct{}{}, records.Err()
+	}
+	_, err := execute(ctx, s.sessions, false, work)
+	return err
+}
+
+// GetFullGraph loads every stored book and edge with two flat queries and
+// links them in memory. Unlike GetBook with a large maxDepth, which expands
+// variable length paths and can blow up on dense graphs, this is linear in the
+// size of the graph. Books without incoming edges are the graph roots, along
+// with one book per component only made of cycles, see book.Roots
+func (s *Storage) GetFullGraph(ctx context.Context) (book.Graph, error) {
+	work := func(tx managedTransaction) (book.Graph, error) {
+		// books that only had their state set are not considered persisted
+		booksQuery := "" +
+			"MATCH (b:Book) WHERE b.title IS NOT NULL " +
+			"OPTIONAL MATCH (p:Person)-[a:AUTHORED]->(b) WHERE a.fromAuthorPage IS NULL " +
+			"RETURN b, p, [(b)-[:WON]->(w:Award) | w.name], " +
+			"  [(b)-[s:SHELVED_AS]->(h:Shelf) | [h.name, s.count]] "
+		records, err := tx.Run(ctx, booksQuery, nil)
+		if err != nil {
+			return book.Graph{}, NewErrQuery(booksQuery, err)
+		}
+		byURL := map[string]*book.Book{}
+		all := []*book.Book{}
+		for records.Next(ctx) {
+			values := records.Record().Values
+			bookNode := values[0].(dbtype.Node)
+			var authorNode dbtype.Node
+			if values[1] != nil {
+				authorNode = values[1].(dbtype.Node)
+			}
+			b := newBook(&bookNode, &authorNode)
+			if _, has := byURL[b.URL]; has {
+				continue
+			}
+			b.Awards = awardNames(values[2])
+			b.Shelves = shelfCounts(values[3])
+			byURL[b.URL] = b
+			all = append(all, b)
+		}
+		if err := records.Err(); err != nil {
+			return book.Graph{}, err
+		}
+
+		edgesQuery := "" +
+			"MATCH (b:Book)-[r:ALSO_READ]->(o:Book) " +
+			"RETURN b.url, o.url, r.priority, r.source "
+		records, err = tx.Run(ctx, edgesQuery, nil)
+		if err != nil {
+			return book.Graph{}, NewErrQuery(edgesQuery, err)
+		}
+		for records.Next(ctx) {
+			values := records.Record().Values
+			from := byURL[values[0].(string)]
+			to := byURL[values[1].(string)]
+			if from == nil || to == nil {
+				continue
+			}
+			priority := 0
+			if values[2] != nil {
+				priority = int(values[2].(int64))
+			}
+			from.AlsoRead = append(from.AlsoRead, book.Edge{
+				From:     from,
+				To:       to,
+				Priority: priority,
+				Source:   edgeSource(values[3]),
+			})
+		}
+		if err := records.Err(); err != nil {
+			return book.Graph{}, err
+		}
+
+		for _, b := range all {
+			sort.SliceStable(b.AlsoRead, func(i, j int) bool {
+				return b.AlsoRead[i].Priority < b.AlsoRead[j].Priority
+			})
+		}
+		roots := book.Roots(all)
+		sort.Slice(all, func(i, j int) bool { return all[i].Title < all[j].Title })
+		sort.Slice(roots, func(i, j int) bool { return roots[i].Title < roots[j].Title })
+		return book.Graph{
+			Roots:   roots,
+			All:     all,
+			ByDepth: book.CollectByDepth(roots...),
+		}, nil
+	}
+	return execute(ctx, s.sessions, false, work)
+}
+
+func newBook(bookNode *dbtype.Node, authorNode *dbtype.Node) *book.Book {
+	value := func(node *dbtype.Node, key string, defaultValue any) any {
+		if v, has := node.Props[key]; has {
+			return v
+		}
+		return defaultValue
+	}
+	return &book.Book{
+		Title:           value(bookNode, "title", "").(string),
+		Rating:          book.Rating(value(bookNode, "rating", int64(0)).(int64)),
+		RatingsTotal:    int32(value(bookNode, "ratings", int64(0)).(int64)),
+		Ratings1:        int32(value(bookNode, "ratings1", int64(0)).(int64)),
+		Ratings2:        int32(value(bookNode, "ratings2", int64(0)).(int64)),
+		Ratings3:        int32(value(bookNode, "ratings3", int64(0)).(int64)),
+		Ratings4:        int32(value(bookNode, "ratings4", int64(0)).(int64)),
+		Ratings5:        int32(value(bookNode, "ratings5", int64(0)).(int64)),
+		Reviews:         int32(value(bookNode, "reviews", int64(0)).(int64)),
+		Pages:           int32(value(bookNode, "pages", int64(0)).(int64)),
+		PublishedYear:   int32(value(bookNode, "publishedYear", int64(0)).(int64)),
+		Language:        value(bookNode, "language", "").(string),
+		Editions:        int32(value(bookNode, "editions", int64(-1)).(int64)),
+		Description:     value(bookNode, "description", "").(string),
+		URL:             value(bookNode, "url", "").(string),
+		ASIN:            value(bookNode, "asin", "").(string),
+		ISBN:            value(bookNode, "isbn", "").(string),
+		ISBN13:          value(bookNode, "isbn13", "").(string),
+		WorkURL:         value(bookNode, "workURL", "").(string),
+		DiscoveredFrom:  value(bookNode, "discoveredFrom", "").(string),
+		DiscoveredDepth: int(value(bookNode, "discoveredDepth", int64(0)).(int64)),
+		DiscoveredSeed:  value(bookNode, "discoveredSeed", "").(string),
+		CrawledAt:       value(bookNode, "crawlStateChanged", time.Time{}).(time.Time),
+		Author:          value(authorNode, "name", "").(string),
+		AuthorURL:       value(authorNode, "url", "").(string),
+		Genres:          []string{},
+		Awards:          []string{},
+		Shelves:         map[string]int32{},
+		AlsoRead:        []book.Edge{},
+	}
+}
+
+// awardNames reads the names of the awards won by a book, as returned by a
+// [(b)-[:WON]->(w:Award) | w.name] pattern comprehension
+func awardNames(names any) []string {
+	awards := []string{}
+	namesList, _ := names.([]any)
+	for _, name := range namesList {
+		awards = append(awards, name.(string))
+	}
+	return awards
+}
+
+// shelfCounts reads the shelves of a book and their counts, as returned by a
+// [(b)-[s:SHELVED_AS]->(h:Shelf) | [h.name, s.count]] pattern comprehension
+func shelfCounts(shelves any) map[string]int32 {
+	counts := map[string]int32{}
+	shelvesList, _ := shelves.([]any)
+	for _, shelfIntf := range shelvesList {
+		shelf := shelfIntf.([]any)
+		count := int32(0)
+		if shelf[1] != nil {
+			count = int32(shelf[1].(int64))
+		}
+		counts[shelf[0].(string)] = count
+	}
+	return counts
+}
+
+func edgeSource(source any) string {
+	// edges created before sources existed are all also read edges
+	if source == nil {
+		return book.SourceAlsoRead
+	}
+	return source.(string)
+}
+
 func (s *Storage) SetBook(ctx context.Context, url string, book *book.Book) error {
 	work := func(tx managedTransaction) (struct{}, error) {
 		query := "" +
@@ -238,53 +467,189 @@ func (s *Storage) SetBook(ctx context.Context, url string, book *book.Book) erro
 			"  SET b.title = $title, b.rating = $rating, b.ratings = $ratings, " +
 			"  b.ratings1 = $ratings1, b.ratings2 = $ratings2, b.ratings3 = $ratings3, " +
 			"  b.ratings4 = $ratings4, b.ratings5 = $ratings5, b.reviews = $reviews, " +
-			"  b.pages = $pages " +
+			"  b.pages = $pages, b.publishedYear = $publishedYear, b.language = $language, " +
+			"  b.editions = $editions, b.asin = $asin, b.workURL = $workURL, " +
+			"  b.description = $description, b.isbn = $isbn, b.isbn13 = $isbn13, " +
+			"  b.discoveredFrom = $discoveredFrom, b.discoveredDepth = $discoveredDepth, " +
+			"  b.discoveredSeed = $discoveredSeed " +
 			"MERGE (p:Person {url: $personURL}) " +
 			"  SET p.name = $author " +
-			"MERGE (p)-[:AUTHORED]->(b) "
+			"MERGE (p)-[a:AUTHORED]->(b) " +
+			"REMOVE a.fromAuthorPage "
 		attrs := map[string]any{
-			"title":     book.Title,
-			"author":    book.Author,
-			"rating":    book.Rating,
-			"ratings":   book.RatingsTotal,
-			"ratings1":  book.Ratings1,
-			"ratings2":  book.Ratings2,
-			"ratings3":  book.Ratings3,
-			"ratings4":  book.Ratings4,
-			"ratings5":  book.Ratings5,
-			"reviews":   book.Reviews,
-			"pages":     book.Pages,
-			"bookURL":   book.URL,
-			"personURL": book.AuthorURL,
+			"title":           book.Title,
+			"author":          book.Author,
+			"rating":          int32(book.Rating),
+			"ratings":         book.RatingsTotal,
+			"ratings1":        book.Ratings1,
+			"ratings2":        book.Ratings2,
+			"ratings3":        book.Ratings3,
+			"ratings4":        book.Ratings4,
+			"ratings5":        book.Ratings5,
+			"reviews":         book.Reviews,
+			"pages":           book.Pages,
+			"publishedYear":   book.PublishedYear,
+			"language":        book.Language,
+			"editions":        book.Editions,
+			"description":     book.Description,
+			"asin":            book.ASIN,
+			"isbn":            book.ISBN,
+			"isbn13":          book.ISBN13,
+			"workURL":         book.WorkURL,
+			"discoveredFrom":  book.DiscoveredFrom,
+			"discoveredDepth": book.DiscoveredDepth,
+			"discoveredSeed":  book.DiscoveredSeed,
+			"bookURL":         book.URL,
+			"personURL":       book.AuthorURL,
 		}
 		_, err := tx.Run(ctx, query, attrs)
 		if err != nil {
 			return struct{}{}, NewErrQuery(query, err)
 		}
+
+		// awards are shared between the books that won them, so only the
+		// relationships are replaced
+		awardsQuery := "" +
+			"MATCH (b:Book {url: $bookURL}) " +
+			"OPTIONAL MATCH (b)-[won:WON]->(:Award) " +
+			"DELETE won " +
+			"WITH DISTINCT b " +
+			"UNWIND $awards AS award " +
+			"MERGE (w:Award {name: award}) " +
+			"MERGE (b)-[:WON]->(w) "
+		awards := book.Awards
+		if awards == nil {
+			awards = []string{}
+		}
+		awardsParams := map[string]any{"bookURL": book.URL, "awards": awards}
+		if _, err := tx.Run(ctx, awardsQuery, awardsParams); err != nil {
+			return struct{}{}, NewErrQuery(awardsQuery, err)
+		}
+
+		// same for shelves, with how many users shelved the book in each
+		shelvesQuery := "" +
+			"MATCH (b:Book {url: $bookURL}) " +
+			"OPTIONAL MATCH (b)-[shelved:SHELVED_AS]->(:Shelf) " +
+			"DELETE shelved " +
+			"WITH DISTINCT b " +
+			"UNWIND $shelves AS shelf " +
+			"MERGE (h:Shelf {name: shelf.name}) " +
+			"MERGE (b)-[s:SHELVED_AS]->(h) " +
+			"  SET s.count = shelf.count "
+		shelves := make([]any, 0, len(book.Shelves))
+		for name, count := range book.Shelves {
+			shelves = append(shelves, map[string]any{"name": name, "count": count})
+		}
+		shelvesParams := map[string]any{"bookURL": book.URL, "shelves": shelves}
+		if _, err := tx.Run(ctx, shelvesQuery, shelvesParams); err != nil {
+			return struct{}{}, NewErrQuery(shelvesQuery, err)
+		}
 		return struct{}{}, nil
 	}
-	_, err := execute(ctx, s.driver, true, work)
+	_, err := execute(ctx, s.sessions, true, work)
 	return err
 }
 
 func (s *Storage) LinkBook(ctx context.Context, url string, relatedURL string, priority int) error {
+	return s.LinkBookWithSource(ctx, url, relatedURL, priority, book.SourceAlsoRead)
+}
+
+func (s *Storage) LinkBookWithSource(ctx context.Context, url string, relatedURL string, priority int, source string) error {
 	work := func(tx managedTransaction) (struct{}, error) {
+		// books that only had their state set are not considered persisted
+		checkQuery := "" +
+			"OPTIONAL MATCH (b:Book {url: $b_url}) WHERE b.title IS NOT NULL " +
+			"OPTIONAL MATCH (o:Book {url: $o_url}) WHERE o.title IS NOT NULL " +
+			"RETURN b IS NOT NULL, o IS NOT NULL "
+		params := map[string]any{"b_url": url, "o_url": relatedURL, "priority": priority, "source": source}
+		records, err := tx.Run(ctx, checkQuery, params)
+		if err != nil {
+			return struct{}{}, NewErrQuery(checkQuery, err)
+		}
+		if !records.Next(ctx) {
+			return struct{}{}, fmt.Errorf("cannot link books: %w", storage.ErrBookNotFound{URL: url})
+		}
+		values := records.Record().Values
+		if !values[0].(bool) {
+			return struct{}{}, fmt.Errorf("cannot link books: %w", storage.ErrBookNotFound{URL: url})
+		}
+		if !values[1].(bool) {
+			return struct{}{}, fmt.Errorf("cannot link books: %w", storage.ErrBookNotFound{URL: relatedURL})
+		}
+
+		// books are linked once, relinking them only updates the edge, eg when
+		// the related book moved up in the recommendations
 		query := "" +
 			"MATCH (b:Book {url: $b_url}), (o:Book {url: $o_url}) " +
-			"MERGE (b)-[r:ALSO_READ {priority: $priority}]->(o) "
-		params := map[string]any{"b_url": url, "o_url": relatedURL, "priority": priority}
-		_, err := tx.Run(ctx, query, params)
+			"MERGE (b)-[r:ALSO_READ]->(o) " +
+			"SET r.priority = $priority, r.source = $source "
+		if source == book.SourceAuthor {
+			// the author of b is also an author of o, even when the page of o
+			// names someone else, eg in anthologies. Such AUTHORED edges are
+			// marked so o keeps the author of its own page
+			query += "" +
+				"WITH b, o " +
+				"MATCH (p:Person)-[a:AUTHORED]->(b) WHERE a.fromAuthorPage IS NULL " +
+				"MERGE (p)-[n:AUTHORED]->(o) " +
+				"  ON CREATE SET n.fromAuthorPage = true "
+		}
+		if _, err := tx.Run(ctx, query, params); err != nil {
+			return struct{}{}, NewErrQuery(query, err)
+		}
+		return struct{}{}, nil
+	}
+	_, err := execute(ctx, s.sessions, true, work)
+	return err
+}
+
+func (s *Storage) DeleteBook(ctx context.Context, url string) error {
+	work := func(tx managedTransaction) (struct{}, error) {
+		params := map[string]any{"url": url}
+		checkQuery := "MATCH (b:Book {url: $url}) RETURN b.url"
+		records, err := tx.Run(ctx, checkQuery, params)
 		if err != nil {
-			return struct{}{}, err
+			return struct{}{}, NewErrQuery(checkQuery, err)
+		}
+		if !records.Next(ctx) {
+			return struct{}{}, fmt.Errorf("cannot delete book: %w", storage.ErrBookNotFound{URL: url})
+		}
+
+		// awards and shelves are only deleted when this was the last book
+		// that had them
+		awardsQuery := "" +
+			"MATCH (:Book {url: $url})-[:WON]->(w:Award) " +
+			"WHERE size([(w)<-[:WON]-(:Book) | 1]) = 1 " +
+			"DETACH DELETE w "
+		if _, err := tx.Run(ctx, awardsQuery, params); err != nil {
+			return struct{}{}, NewErrQuery(awardsQuery, err)
+		}
+		shelvesQuery := "" +
+			"MATCH (:Book {url: $url})-[:SHELVED_AS]->(h:Shelf) " +
+			"WHERE size([(h)<-[:SHELVED_AS]-(:Book) | 1]) = 1 " +
+			"DETACH DELETE h "
+		if _, err := tx.Run(ctx, shelvesQuery, params); err != nil {
+			return struct{}{}, NewErrQuery(shelvesQuery, err)
+		}
+
+		// authors are only deleted when this was the last book they wrote
+		query := "" +
+			"MATCH (b:Book {url: $url}) " +
+			"OPTIONAL MATCH (p:Person)-[:AUTHORED]->(b) " +
+			"DETACH DELETE b " +
+			"WITH DISTINCT p " +
+			"WHERE p IS NOT NULL AND NOT (p)-[:AUTHORED]->() " +
+			"DELETE p "
+		if _, err := tx.Run(ctx, query, params); err != nil {
+			return struct{}{}, NewErrQuery(query, err)
 		}
 		return struct{}{}, nil
 	}
-	_, err := execute(ctx, s.driver, true, work)
+	_, err := execute(ctx, s.sessions, true, work)
 	return err
 }
 
 func (s *Storage) runInitStatements(ctx context.Context) error {
-	_, err := execute(ctx, s.driver, true, func(tx managedTransaction) (struct{}, error) {
+	_, err := execute(ctx, s.sessions, true, func(tx managedTransaction) (struct{}, error) {
 		for _, stmt := range initStatements {
 			if _, err := tx.Run(ctx, stmt, nil); err != nil {
 				return struct{}{}, NewErrQuery(stmt, err)
@@ -297,13 +662,17 @@ func (s *Storage) runInitStatements(ctx context.Context) error {
 
 func execute[T any](
 	ctx context.Context,
-	driver neo4j.DriverWithContext,
+	sessions *sessionPool,
 	write bool,
 	work func(managedTransaction) (T, error),
 	configurers ...func(*neo4j.TransactionConfig),
 ) (T, error) {
-	session := driver.NewSession(ctx, neo4j.SessionConfig{})
-	defer session.Close(ctx)
+	session, err := sessions.acquire(ctx)
+	if err != nil {
+		var zeroV T
+		return zeroV, err
+	}
+	defer sessions.release(session)
 	executeFn := session.ExecuteRead
 	if write {
 		executeFn = session.ExecuteWrite
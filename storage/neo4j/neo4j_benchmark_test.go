@@ -0,0 +1,112 @@
+package neo4j_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage/neo4j"
+)
+
+// newStorage connects to the neo4j instance at $NEO4J_TEST_URL, which can be
+// started with docker-compose, skipping when it is not set
+func newStorage(tb testing.TB) *neo4j.Storage {
+	url := os.Getenv("NEO4J_TEST_URL")
+	if url == "" {
+		tb.Skip("set $NEO4J_TEST_URL to run against neo4j")
+	}
+	log.Level = log.WarnLevel
+	ctx := context.Background()
+	s := neo4j.New(url)
+	if err := s.Initialize(ctx); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { s.Shutdown(ctx) })
+	return s
+}
+
+func benchmarkBook(i int) *book.Book {
+	b := book.New(fmt.Sprintf("http://benchmark/book/%d", i))
+	b.Title = fmt.Sprintf("benchmark book %d", i)
+	b.Author = fmt.Sprintf("benchmark author %d", i%100)
+	b.AuthorURL = fmt.Sprintf("http://benchmark/author/%d", i%100)
+	b.Rating = book.Rating(300 + i%200)
+	return b
+}
+
+// BenchmarkSetBook measures SetBook throughput with as many concurrent
+// writers as there are pooled sessions
+func BenchmarkSetBook(b *testing.B) {
+	s := newStorage(b)
+	ctx := context.Background()
+
+	var next int64
+	b.SetParallelism(neo4j.DefaultSessionPoolSize)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			saved := benchmarkBook(int(atomic.AddInt64(&next, 1)))
+			if err := s.SetBook(ctx, saved.URL, saved); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkGetGraph links the books into a dense graph and compares reading
+// it back with a recursive GetBook against GetFullGraph
+func BenchmarkGetGraph(b *testing.B) {
+	const numBooks = 2000
+	const numLinks = 5
+	const depth = 4
+
+	s := newStorage(b)
+	ctx := context.Background()
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(neo4j.DefaultSessionPoolSize)
+	for i := 0; i < numBooks; i++ {
+		i := i
+		group.Go(func() error {
+			from := benchmarkBook(i)
+			if err := s.SetBook(groupCtx, from.URL, from); err != nil {
+				return err
+			}
+			for j := 1; j <= numLinks; j++ {
+				related := benchmarkBook((i*7 + j) % numBooks)
+				if err := s.SetBook(groupCtx, related.URL, related); err != nil {
+					return err
+				}
+				if err := s.LinkBook(groupCtx, from.URL, related.URL, j-1); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("GetBook", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := s.GetBook(ctx, benchmarkBook(0).URL, depth); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("GetFullGraph", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := s.GetFullGraph(ctx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package neo4j
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+const DefaultSessionPoolSize = 16
+
+// sessionPool keeps a fixed set of long lived sessions around so that
+// operations do not pay the cost of opening and closing a session every time.
+// Sessions are not safe for concurrent use, so each one is handed to a single
+// operation at a time. Every session shares the same bookmark manager, so an
+// operation sees the writes of the ones before it whichever session they ran
+// on
+type sessionPool struct {
+	sessions  chan neo4j.SessionWithContext
+	bookmarks neo4j.BookmarkManager
+
+	// closed guards releasing sessions into the closed channel
+	closed      bool
+	closedMutex sync.Mutex
+}
+
+func newSessionPool(ctx context.Context, driver neo4j.DriverWithContext, size int) *sessionPool {
+	if size <= 0 {
+		size = DefaultSessionPoolSize
+	}
+	pool := &sessionPool{
+		sessions:  make(chan neo4j.SessionWithContext, size),
+		bookmarks: neo4j.NewBookmarkManager(neo4j.BookmarkManagerConfig{}),
+	}
+	for i := 0; i < size; i++ {
+		pool.sessions <- driver.NewSession(ctx, neo4j.SessionConfig{BookmarkManager: pool.bookmarks})
+	}
+	return pool
+}
+
+func (p *sessionPool) acquire(ctx context.Context) (neo4j.SessionWithContext, error) {
+	select {
+	case session, ok := <-p.sessions:
+		if !ok {
+			return nil, errors.New("neo4j session pool is closed")
+		}
+		return session, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release hands the session back to the pool as it is. Sessions released after
+// the pool is closed are just closed
+func (p *sessionPool) release(session neo4j.SessionWithContext) {
+	p.closedMutex.Lock()
+	defer p.closedMutex.Unlock()
+	if p.closed {
+		if session != nil {
+			session.Close(context.Background())
+		}
+		return
+	}
+	p.sessions <- session
+}
+
+// close waits for all sessions to be released and closes them
+func (p *sessionPool) close(ctx context.Context) error {
+	var firstErr error
+	for i := 0; i < cap(p.sessions); i++ {
+		session, err := p.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		if session == nil {
+			continue
+		}
+		if err := session.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	p.closedMutex.Lock()
+	defer p.closedMutex.Unlock()
+	p.closed = true
+	close(p.sessions)
+	return firstErr
+}
@@ -0,0 +1,71 @@
+package neo4j
+
+import (
+	"context"
+	"testing"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// bookmarkedSession stands for a session that ran a transaction
+type bookmarkedSession struct {
+	neo4j.SessionWithContext
+	closed bool
+}
+
+func (s *bookmarkedSession) LastBookmarks() neo4j.Bookmarks {
+	return neo4j.Bookmarks{"bookmark"}
+}
+
+func (s *bookmarkedSession) Close(ctx context.Context) error {
+	s.closed = true
+	return nil
+}
+
+// TestSessionPool checks that a session holding bookmarks is put back in the
+// pool as it is when released, that nil sessions are skipped when closing, and
+// that releasing after the pool is closed does not panic. The driver never
+// connects, so no neo4j instance is needed
+func TestSessionPool(t *testing.T) {
+	ctx := context.Background()
+	driver, err := neo4j.NewDriverWithContext("neo4j://localhost:7687", neo4j.NoAuth())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close(ctx)
+	pool := newSessionPool(ctx, driver, 2)
+
+	if _, err := pool.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	used := &bookmarkedSession{}
+	pool.release(used)
+	if used.closed {
+		t.Errorf("session holding bookmarks kept open when released")
+	}
+	reused := false
+	for i := 0; i < cap(pool.sessions); i++ {
+		session, err := pool.acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reused = reused || session == used
+	}
+	if !reused {
+		t.Errorf("session holding bookmarks reused")
+	}
+
+	pool = newSessionPool(ctx, driver, 2)
+	if _, err := pool.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	pool.sessions <- nil
+	if err := pool.close(ctx); err != nil {
+		t.Errorf("pool with a nil session closed: %v", err)
+	}
+	late := &bookmarkedSession{}
+	pool.release(late)
+	if !late.closed {
+		t.Errorf("session released after the pool is closed gets closed")
+	}
+}
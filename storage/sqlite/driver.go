@@ -0,0 +1,4 @@
+package sqlite
+
+// registers the sqlite3 database/sql driver. It is built with cgo
+import _ "github.com/mattn/go-sqlite3"
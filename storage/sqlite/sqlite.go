@@ -0,0 +1,697 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bcap/book-crawler/book"
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// DriverName is the database/sql driver used by default, registered by
+// github.com/mattn/go-sqlite3
+const DriverName = "sqlite3"
+
+// maxStatesPerQuery keeps GetBookStates below the limit of bound parameters of
+// older sqlite versions (999)
+const maxStatesPerQuery = 500
+
+// pragmas cannot run inside a transaction, so they go before initStatements
+var initPragmas = []string{
+	// other processes (eg the delete command) may use the same file while a
+	// crawl is running
+	"PRAGMA busy_timeout = 5000",
+	"PRAGMA journal_mode = WAL",
+}
+
+var initStatements = []string{
+	"CREATE TABLE IF NOT EXISTS people (" +
+		"  url TEXT PRIMARY KEY, " +
+		"  name TEXT NOT NULL DEFAULT '' " +
+		")",
+	// books that only had their state set have a null title and are not
+	// considered persisted. Timestamps are unix nanoseconds
+	"CREATE TABLE IF NOT EXISTS books (" +
+		"  url TEXT PRIMARY KEY, " +
+		"  title TEXT, " +
+		"  author_url TEXT, " +
+		"  rating INTEGER NOT NULL DEFAULT 0, " +
+		"  ratings INTEGER NOT NULL DEFAULT 0, " +
+		"  ratings1 INTEGER NOT NULL DEFAULT 0, " +
+		"  ratings2 INTEGER NOT NULL DEFAULT 0, " +
+		"  ratings3 INTEGER NOT NULL DEFAULT 0, " +
+		"  ratings4 INTEGER NOT NULL DEFAULT 0, " +
+		"  ratings5 INTEGER NOT NULL DEFAULT 0, " +
+		"  reviews INTEGER NOT NULL DEFAULT 0, " +
+		"  pages INTEGER NOT NULL DEFAULT 0, " +
+		"  published_year INTEGER NOT NULL DEFAULT 0, " +
+		"  language TEXT NOT NULL DEFAULT '', " +
+		"  editions INTEGER NOT NULL DEFAULT -1, " +
+		"  asin TEXT NOT NULL DEFAULT '', " +
+		"  isbn TEXT NOT NULL DEFAULT '', " +
+		"  isbn13 TEXT NOT NULL DEFAULT '', " +
+		"  description TEXT NOT NULL DEFAULT '', " +
+		"  work_url TEXT NOT NULL DEFAULT '', " +
+		"  awards TEXT NOT NULL DEFAULT '[]', " +
+		"  shelves TEXT NOT NULL DEFAULT '{}', " +
+		"  discovered_from TEXT NOT NULL DEFAULT '', " +
+		"  discovered_depth INTEGER NOT NULL DEFAULT 0, " +
+		"  discovered_seed TEXT NOT NULL DEFAULT '', " +
+		"  crawl_state INTEGER, " +
+		"  crawl_state_changed INTEGER " +
+		")",
+	"CREATE INDEX IF NOT EXISTS books_title ON books (title)",
+	"CREATE INDEX IF NOT EXISTS books_author_url ON books (author_url)",
+	"CREATE TABLE IF NOT EXISTS also_read (" +
+		"  from_url TEXT NOT NULL, " +
+		"  to_url TEXT NOT NULL, " +
+		"  priority INTEGER NOT NULL, " +
+		"  source TEXT NOT NULL, " +
+		"  PRIMARY KEY (from_url, to_url, priority, source) " +
+		")",
+	"CREATE INDEX IF NOT EXISTS also_read_to_url ON also_read (to_url)",
+}
+
+// addedColumns are added to tables created before they existed. sqlite has
+// no ADD COLUMN IF NOT EXISTS, so duplicate column errors are ignored
+var addedColumns = []string{
+	"ALTER TABLE books ADD COLUMN description TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE books ADD COLUMN isbn TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE books ADD COLUMN isbn13 TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE books ADD COLUMN published_year INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE books ADD COLUMN language TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE books ADD COLUMN editions INTEGER NOT NULL DEFAULT -1",
+	"ALTER TABLE books ADD COLUMN awards TEXT NOT NULL DEFAULT '[]'",
+	"ALTER TABLE books ADD COLUMN shelves TEXT NOT NULL DEFAULT '{}'",
+}
+
+const bookColumns = "" +
+	"b.url, b.title, b.rating, b.ratings, b.ratings1, b.ratings2, b.ratings3, " +
+	"b.ratings4, b.ratings5, b.reviews, b.pages, b.published_year, b.language, " +
+	"b.editions, b.asin, b.isbn, b.isbn13, " +
+	"b.description, b.work_url, b.awards, b.shelves, " +
+	"b.discovered_from, b.discovered_depth, b.discovered_seed, " +
+	"b.crawl_state_changed, p.url, p.name "
+
+type Storage struct {
+	// Path is the database file, created on Initialize when missing
+	Path string
+
+	// Driver is the database/sql driver name. Defaults to DriverName
+	Driver string
+
+	db *sql.DB
+}
+
+func New(path string) *Storage {
+	return &Storage{
+		Path: path,
+	}
+}
+
+func (s *Storage) Initialize(ctx context.Context) error {
+	driver := s.Driver
+	if driver == "" {
+		driver = DriverName
+	}
+	db, err := sql.Open(driver, s.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open sqlite database %s: %w", s.Path, err)
+	}
+	// sqlite only allows a single writer at a time. Sharing one connection
+	// serializes operations here instead of failing them with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	s.db = db
+
+	for _, pragma := range initPragmas {
+		if _, err := db.ExecContext(ctx, pragma); err != nil {
+			return NewErrQuery(pragma, err)
+		}
+	}
+	return s.withTx(ctx, func(tx tx) error {
+		for _, stmt := range initStatements {
+			if _, err := tx.exec(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		for _, stmt := range addedColumns {
+			// ran directly, as a failed statement is not worth logging
+			_, err := tx.Tx.ExecContext(ctx, stmt)
+			if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+				return NewErrQuery(stmt, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Storage) Shutdown(ctx context.Context) error {
+	return s.db.Close()
+}
+
+func (s *Storage) GetBookState(ctx context.Context, url string) (storage.StateChange, error) {
+	var result storage.StateChange
+	err := s.withTx(ctx, func(tx tx) error {
+		query := "SELECT crawl_state, crawl_state_changed FROM books WHERE url = ? AND crawl_state IS NOT NULL"
+		rows, err := tx.query(ctx, query, url)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		if rows.Next() {
+			if result, err = scanState(rows); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	})
+	return result, err
+}
+
+func (s *Storage) GetBookStates(ctx context.Context, urls []string) (map[string]storage.StateChange, error) {
+	states := make(map[string]storage.StateChange, len(urls))
+	for _, url := range urls {
+		states[url] = storage.StateChange{}
+	}
+	err := s.withTx(ctx, func(tx tx) error {
+		for start := 0; start < len(urls); start += maxStatesPerQuery {
+			end := start + maxStatesPerQuery
+			if end > len(urls) {
+				end = len(urls)
+			}
+			chunk := urls[start:end]
+			query := "" +
+				"SELECT url, crawl_state, crawl_state_changed FROM books " +
+				"WHERE crawl_state IS NOT NULL AND url IN (" + placeholders(len(chunk)) + ")"
+			rows, err := tx.query(ctx, query, anySlice(chunk)...)
+			if err != nil {
+				return err
+			}
+			for rows.Next() {
+				var url string
+				var state sql.NullInt64
+				var when sql.NullInt64
+				if err := rows.Scan(&url, &state, &when); err != nil {
+					rows.Close()
+					return err
+				}
+				states[url] = storage.StateChange{When: fromNanos(when), State: storage.State(state.Int64)}
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+func (s *Storage) SetBookState(ctx context.Context, url string, previous storage.StateChange, new storage.State) (storage.StateChange, bool, error) {
+	when := time.Now().UTC()
+	var set bool
+	err := s.withTx(ctx, func(tx tx) error {
+		insert := "INSERT OR IGNORE INTO books (url) VALUES (?)"
+		if _, err := tx.exec(ctx, insert, url); err != nil {
+			return err
+		}
+
+		var query string
+		var args []any
+		if previous.State == 0 {
+			query = "" +
+				"UPDATE books SET crawl_state = ?, crawl_state_changed = ? " +
+				"WHERE url = ? " +
+				"AND ((crawl_state = 0 AND crawl_state_changed IS ?) " +
+				"OR (crawl_state IS NULL AND crawl_state_changed IS NULL))"
+			args = []any{new, when.UnixNano(), url, toNanos(previous.When)}
+		} else {
+			query = "" +
+				"UPDATE books SET crawl_state = ?, crawl_state_changed = ? " +
+				"WHERE url = ? AND crawl_state = ? AND crawl_state_changed IS ?"
+			args = []any{new, when.UnixNano(), url, previous.State, toNanos(previous.When)}
+		}
+		result, err := tx.exec(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		set = affected == 1
+		return nil
+	})
+	if err != nil || !set {
+		// CAS check failed, not changed
+		return storage.StateChange{}, false, err
+	}
+	return storage.StateChange{State: new, When: when}, true, nil
+}
+
+func (s *Storage) GetBook(ctx context.Context, url string, maxDepth int) (*book.Book, error) {
+	var root *book.Book
+	err := s.withTx(ctx, func(tx tx) error {
+		// depths are the shortest distance from the root. Books reached at
+		// maxDepth are loaded, but their own edges are not
+		reachable := "" +
+			"WITH RECURSIVE reachable(url, depth) AS (" +
+			"  SELECT url, 0 FROM books WHERE url = ? AND title IS NOT NULL " +
+			"  UNION " +
+			"  SELECT e.to_url, r.depth + 1 FROM reachable r " +
+			"  JOIN also_read e ON e.from_url = r.url " +
+			"  WHERE r.depth < ? " +
+			") "
+		booksQuery := reachable +
+			"SELECT " + bookColumns +
+			"FROM (SELECT url FROM reachable GROUP BY url) r " +
+			"JOIN books b ON b.url = r.url AND b.title IS NOT NULL " +
+			"LEFT JOIN people p ON p.url = b.author_url "
+		byURL, _, err := loadBooks(ctx, tx, booksQuery, url, maxDepth)
+		if err != nil {
+			return err
+		}
+		if root = byURL[url]; root == nil {
+			return nil
+		}
+
+		edgesQuery := reachable +
+			"SELECT e.from_url, e.to_url, e.priority, e.source " +
+			"FROM (SELECT url, MIN(depth) AS depth FROM reachable GROUP BY url) r " +
+			"JOIN also_read e ON e.from_url = r.url " +
+			"WHERE r.depth < ? " +
+			"ORDER BY e.from_url, e.priority "
+		return loadEdges(ctx, tx, byURL, edgesQuery, url, maxDepth, maxDepth)
+	})
+	return root, err
+}
+
+func (s *Storage) GetAllBooks(ctx context.Context, fn func(*book.Book) error) error {
+	var books []*book.Book
+	err := s.withTx(ctx, func(tx tx) error {
+		booksQuery := "" +
+			"SELECT " + bookColumns +
+			"FROM books b LEFT JOIN people p ON p.url = b.author_url " +
+			"WHERE b.title IS NOT NULL " +
+			"ORDER BY b.url "
+		byURL, all, err := loadBooks(ctx, tx, booksQuery)
+		if err != nil {
+			return err
+		}
+		books = all
+
+		edgesQuery := "" +
+			"SELECT from_url, to_url, priority, source FROM also_read " +
+			"ORDER BY from_url, priority "
+		rows, err := tx.query(ctx, edgesQuery)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var from, to, source string
+			var priority int
+			if err := rows.Scan(&from, &to, &priority, &source); err != nil {
+				return err
+			}
+			if b := byURL[from]; b != nil {
+				b.AlsoRead = append(b.AlsoRead, book.Edge{
+					From:     b,
+					To:       &book.Book{URL: to},
+					Priority: priority,
+					Source:   source,
+				})
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	// fn is only called after the transaction is done, so it can use the
+	// storage as well without waiting on the single connection
+	for _, b := range books {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetFullGraph loads every stored book and edge and links them in memory.
+// Books without incoming edges are the graph roots, along with one book per
+// component only made of cycles, see book.Roots
+func (s *Storage) GetFullGraph(ctx context.Context) (book.Graph, error) {
+	var graph book.Graph
+	err := s.withTx(ctx, func(tx tx) error {
+		booksQuery := "" +
+			"SELECT " + bookColumns +
+			"FROM books b LEFT JOIN people p ON p.url = b.author_url " +
+			"WHERE b.title IS NOT NULL "
+		byURL, all, err := loadBooks(ctx, tx, booksQuery)
+		if err != nil {
+			return err
+		}
+		edgesQuery := "" +
+			"SELECT from_url, to_url, priority, source FROM also_read " +
+			"ORDER BY from_url, priority "
+		if err := loadEdges(ctx, tx, byURL, edgesQuery); err != nil {
+			return err
+		}
+
+		roots := book.Roots(all)
+		sort.Slice(all, func(i, j int) bool { return all[i].Title < all[j].Title })
+		sort.Slice(roots, func(i, j int) bool { return roots[i].Title < roots[j].Title })
+		graph = book.Graph{
+			Roots:   roots,
+			All:     all,
+			ByDepth: book.CollectByDepth(roots...),
+		}
+		return nil
+	})
+	return graph, err
+}
+
+func (s *Storage) SetBook(ctx context.Context, url string, book *book.Book) error {
+	// awards are stored as a json array and shelves as a json object
+	awards := book.Awards
+	if awards == nil {
+		awards = []string{}
+	}
+	awardsJSON, err := json.Marshal(awards)
+	if err != nil {
+		return fmt.Errorf("failed to encode awards of %s: %w", book.URL, err)
+	}
+	shelves := book.Shelves
+	if shelves == nil {
+		shelves = map[string]int32{}
+	}
+	shelvesJSON, err := json.Marshal(shelves)
+	if err != nil {
+		return fmt.Errorf("failed to encode shelves of %s: %w", book.URL, err)
+	}
+	return s.withTx(ctx, func(tx tx) error {
+		person := "" +
+			"INSERT INTO people (url, name) VALUES (?, ?) " +
+			"ON CONFLICT (url) DO UPDATE SET name = excluded.name"
+		if _, err := tx.exec(ctx, person, book.AuthorURL, book.Author); err != nil {
+			return err
+		}
+		query := "" +
+			"INSERT INTO books (url, title, author_url, rating, ratings, " +
+			"  ratings1, ratings2, ratings3, ratings4, ratings5, reviews, pages, " +
+			"  published_year, language, editions, asin, isbn, isbn13, description, work_url, " +
+			"  awards, shelves, discovered_from, discovered_depth, discovered_seed) " +
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) " +
+			"ON CONFLICT (url) DO UPDATE SET " +
+			"  title = excluded.title, author_url = excluded.author_url, " +
+			"  rating = excluded.rating, ratings = excluded.ratings, " +
+			"  ratings1 = excluded.ratings1, ratings2 = excluded.ratings2, " +
+			"  ratings3 = excluded.ratings3, ratings4 = excluded.ratings4, " +
+			"  ratings5 = excluded.ratings5, reviews = excluded.reviews, " +
+			"  pages = excluded.pages, published_year = excluded.published_year, " +
+			"  language = excluded.language, editions = excluded.editions, " +
+			"  asin = excluded.asin, " +
+			"  isbn = excluded.isbn, isbn13 = excluded.isbn13, " +
+			"  description = excluded.description, work_url = excluded.work_url, " +
+			"  awards = excluded.awards, shelves = excluded.shelves, " +
+			"  discovered_from = excluded.discovered_from, " +
+			"  discovered_depth = excluded.discovered_depth, " +
+			"  discovered_seed = excluded.discovered_seed"
+		_, err := tx.exec(ctx, query,
+			book.URL, book.Title, book.AuthorURL, int32(book.Rating), book.RatingsTotal,
+			book.Ratings1, book.Ratings2, book.Ratings3, book.Ratings4, book.Ratings5,
+			book.Reviews, book.Pages, book.PublishedYear, book.Language, book.Editions, book.ASIN, book.ISBN, book.ISBN13, book.Description, book.WorkURL,
+			string(awardsJSON), string(shelvesJSON), book.DiscoveredFrom, book.DiscoveredDepth, book.DiscoveredSeed,
+		)
+		return err
+	})
+}
+
+func (s *Storage) LinkBook(ctx context.Context, url string, relatedURL string, priority int) error {
+	return s.LinkBookWithSource(ctx, url, relatedURL, priority, book.SourceAlsoRead)
+}
+
+func (s *Storage) LinkBookWithSource(ctx context.Context, url string, relatedURL string, priority int, source string) error {
+	return s.withTx(ctx, func(tx tx) error {
+		// books that only had their state set are not considered persisted
+		checkQuery := "SELECT url FROM books WHERE url IN (?, ?) AND title IS NOT NULL"
+		rows, err := tx.query(ctx, checkQuery, url, relatedURL)
+		if err != nil {
+			return err
+		}
+		found := map[string]bool{}
+		for rows.Next() {
+			var foundURL string
+			if err := rows.Scan(&foundURL); err != nil {
+				rows.Close()
+				return err
+			}
+			found[foundURL] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if !found[url] {
+			return fmt.Errorf("cannot link books: %w", storage.ErrBookNotFound{URL: url})
+		}
+		if !found[relatedURL] {
+			return fmt.Errorf("cannot link books: %w", storage.ErrBookNotFound{URL: relatedURL})
+		}
+
+		query := "INSERT OR IGNORE INTO also_read (from_url, to_url, priority, source) VALUES (?, ?, ?, ?)"
+		_, err = tx.exec(ctx, query, url, relatedURL, priority, source)
+		return err
+	})
+}
+
+func (s *Storage) DeleteBook(ctx context.Context, url string) error {
+	return s.withTx(ctx, func(tx tx) error {
+		var authorURL sql.NullString
+		checkQuery := "SELECT author_url FROM books WHERE url = ?"
+		rows, err := tx.query(ctx, checkQuery, url)
+		if err != nil {
+			return err
+		}
+		found := rows.Next()
+		if found {
+			err = rows.Scan(&authorURL)
+		}
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("cannot delete book: %w", storage.ErrBookNotFound{URL: url})
+		}
+
+		statements := []string{
+			"DELETE FROM also_read WHERE from_url = ?1 OR to_url = ?1",
+			"DELETE FROM books WHERE url = ?1",
+		}
+		for _, stmt := range statements {
+			if _, err := tx.exec(ctx, stmt, url); err != nil {
+				return err
+			}
+		}
+
+		// authors are only deleted when this was the last book they wrote
+		if authorURL.Valid {
+			query := "DELETE FROM people WHERE url = ? AND NOT EXISTS (SELECT 1 FROM books WHERE author_url = people.url)"
+			if _, err := tx.exec(ctx, query, authorURL.String); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// loadBooks runs a query selecting bookColumns and returns the books both
+// indexed by url and in the order they were returned
+func loadBooks(ctx context.Context, tx tx, query string, args ...any) (map[string]*book.Book, []*book.Book, error) {
+	rows, err := tx.query(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	byURL := map[string]*book.Book{}
+	all := []*book.Book{}
+	for rows.Next() {
+		b, err := scanBook(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		byURL[b.URL] = b
+		all = append(all, b)
+	}
+	return byURL, all, rows.Err()
+}
+
+// loadEdges runs a query selecting edges (from, to, priority, source) ordered
+// by priority, and links the books in byURL with them. Edges to books missing
+// from byURL are ignored
+func loadEdges(ctx context.Context, tx tx, byURL map[string]*book.Book, query string, args ...any) error {
+	rows, err := tx.query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fromURL, toURL, source string
+		var priority int
+		if err := rows.Scan(&fromURL, &toURL, &priority, &source); err != nil {
+			return err
+		}
+		from, to := byURL[fromURL], byURL[toURL]
+		if from == nil || to == nil {
+			continue
+		}
+		from.AlsoRead = append(from.AlsoRead, book.Edge{
+			From:     from,
+			To:       to,
+			Priority: priority,
+			Source:   source,
+		})
+	}
+	return rows.Err()
+}
+
+func scanBook(rows *sql.Rows) (*book.Book, error) {
+	b := &book.Book{
+		Genres:   []string{},
+		AlsoRead: []book.Edge{},
+	}
+	var rating int32
+	var awards, shelves string
+	var crawledAt sql.NullInt64
+	var authorURL, author sql.NullString
+	err := rows.Scan(
+		&b.URL, &b.Title, &rating, &b.RatingsTotal,
+		&b.Ratings1, &b.Ratings2, &b.Ratings3, &b.Ratings4, &b.Ratings5,
+		&b.Reviews, &b.Pages, &b.PublishedYear, &b.Language, &b.Editions, &b.ASIN, &b.ISBN, &b.ISBN13, &b.Description, &b.WorkURL,
+		&awards, &shelves, &b.DiscoveredFrom, &b.DiscoveredDepth, &b.DiscoveredSeed,
+		&crawledAt, &authorURL, &author,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(awards), &b.Awards); err != nil {
+		return nil, fmt.Errorf("failed to decode awards of %s: %w", b.URL, err)
+	}
+	if b.Awards == nil {
+		b.Awards = []string{}
+	}
+	if err := json.Unmarshal([]byte(shelves), &b.Shelves); err != nil {
+		return nil, fmt.Errorf("failed to decode shelves of %s: %w", b.URL, err)
+	}
+	if b.Shelves == nil {
+		b.Shelves = map[string]int32{}
+	}
+	b.Rating = book.Rating(rating)
+	b.CrawledAt = fromNanos(crawledAt)
+	b.AuthorURL = authorURL.String
+	b.Author = author.String
+	return b, nil
+}
+
+func scanState(rows *sql.Rows) (storage.StateChange, error) {
+	var state sql.NullInt64
+	var when sql.NullInt64
+	if err := rows.Scan(&state, &when); err != nil {
+		return storage.StateChange{}, err
+	}
+	return storage.StateChange{When: fromNanos(when), State: storage.State(state.Int64)}, nil
+}
+
+// toNanos stores the zero time as null, as its unix nanoseconds overflow
+func toNanos(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixNano()
+}
+
+func fromNanos(nanos sql.NullInt64) time.Time {
+	if !nanos.Valid {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos.Int64).UTC()
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func anySlice(values []string) []any {
+	result := make([]any, len(values))
+	for idx, value := range values {
+		result[idx] = value
+	}
+	return result
+}
+
+func (s *Storage) withTx(ctx context.Context, work func(tx) error) error {
+	sqlTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start sqlite transaction: %w", err)
+	}
+	if err := work(tx{Tx: sqlTx}); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+type tx struct {
+	*sql.Tx
+}
+
+func (t tx) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	queryId, start := t.logQuery(query, args)
+	result, err := t.Tx.ExecContext(ctx, query, args...)
+	return result, t.logResult(queryId, start, query, err)
+}
+
+func (t tx) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	queryId, start := t.logQuery(query, args)
+	rows, err := t.Tx.QueryContext(ctx, query, args...)
+	return rows, t.logResult(queryId, start, query, err)
+}
+
+func (t tx) logQuery(query string, args []any) (int32, time.Time) {
+	// generate a 6 digit query id to help logging
+	queryId := 100000 + rand.Int31n(900000)
+	log.Debugf("running sqlite query %v: %q, args: %v", queryId, query, spew.Sprintf("%+#v", args))
+	return queryId, time.Now()
+}
+
+func (t tx) logResult(queryId int32, start time.Time, query string, err error) error {
+	took := time.Since(start)
+	if err != nil {
+		log.Warnf("sqlite query %v failed in %v: %v", queryId, took, err)
+		return NewErrQuery(query, err)
+	}
+	log.Debugf("sqlite query %v executed in %v", queryId, took)
+	return nil
+}
+
+// Making sure Storage implements Storage
+var _ storage.Storage = &Storage{}
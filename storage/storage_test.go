@@ -0,0 +1,56 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/bcap/book-crawler/log"
+	"github.com/bcap/book-crawler/storage"
+	"github.com/bcap/book-crawler/storage/memory"
+	"github.com/bcap/book-crawler/storage/neo4j"
+	"github.com/bcap/book-crawler/storage/sqlite"
+)
+
+// backends create the storages every check runs against. Neo4j is added when
+// $NEO4J_TEST_URL is set
+var backends = map[string]func(t *testing.T) storage.Storage{
+	"memory": func(t *testing.T) storage.Storage { return &memory.Storage{} },
+	"sqlite": func(t *testing.T) storage.Storage {
+		return sqlite.New(filepath.Join(t.TempDir(), "books.db"))
+	},
+}
+
+func init() {
+	if url := os.Getenv("NEO4J_TEST_URL"); url != "" {
+		backends["neo4j"] = func(t *testing.T) storage.Storage { return neo4j.New(url) }
+	}
+}
+
+// forEachBackend runs fn against a new storage of every backend, along with
+// a prefix for its urls, unique so reruns against a persistent storage start
+// clean
+func forEachBackend(t *testing.T, fn func(t *testing.T, s storage.Storage, prefix string)) {
+	log.Level = log.ErrorLevel
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		newStorage := backends[name]
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newStorage(t)
+			if err := s.Initialize(ctx); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Shutdown(ctx)
+			fn(t, s, fmt.Sprintf("http://%s-test/%d", name, time.Now().UnixNano()))
+		})
+	}
+}